@@ -0,0 +1,26 @@
+// +build windows
+
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// cpuTime returns the user and system CPU time used by the process so far.
+func cpuTime() (user, sys time.Duration) {
+	h, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, 0
+	}
+	var creation, exit, kernel, usr syscall.Filetime
+	if syscall.GetProcessTimes(h, &creation, &exit, &kernel, &usr) != nil {
+		return 0, 0
+	}
+	// Filetime is in 100-nanosecond intervals.
+	return filetimeDuration(usr), filetimeDuration(kernel)
+}
+
+func filetimeDuration(ft syscall.Filetime) time.Duration {
+	return time.Duration(uint64(ft.HighDateTime)<<32|uint64(ft.LowDateTime)) * 100
+}
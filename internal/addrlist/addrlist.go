@@ -5,6 +5,7 @@ import (
 	"sort"
 	"time"
 
+	"github.com/cenkalti/rain/internal/allowlist"
 	"github.com/cenkalti/rain/internal/blocklist"
 	"github.com/cenkalti/rain/internal/externalip"
 	"github.com/cenkalti/rain/internal/peerpriority"
@@ -21,12 +22,14 @@ type AddrList struct {
 	listenPort int
 	clientIP   *net.IP
 	blocklist  *blocklist.Blocklist
+	allowlist  *allowlist.Allowlist
 
 	countBySource map[peersource.Source]int
 }
 
 // New returns a new AddrList.
-func New(maxItems int, blocklist *blocklist.Blocklist, listenPort int, clientIP *net.IP) *AddrList {
+// If allowlist is not nil, addresses that are not in the allowlist are discarded.
+func New(maxItems int, blocklist *blocklist.Blocklist, allowlist *allowlist.Allowlist, listenPort int, clientIP *net.IP) *AddrList {
 	return &AddrList{
 		peerByPriority: btree.New(2),
 
@@ -34,6 +37,7 @@ func New(maxItems int, blocklist *blocklist.Blocklist, listenPort int, clientIP
 		listenPort:    listenPort,
 		clientIP:      clientIP,
 		blocklist:     blocklist,
+		allowlist:     allowlist,
 		countBySource: make(map[peersource.Source]int),
 	}
 }
@@ -68,7 +72,8 @@ func (d *AddrList) Pop() (*net.TCPAddr, peersource.Source) {
 }
 
 // Push adds a new address to the list. Does nothing if the address is already in the list.
-func (d *AddrList) Push(addrs []*net.TCPAddr, source peersource.Source) {
+// Returns the number of addresses that are rejected by the blocklist.
+func (d *AddrList) Push(addrs []*net.TCPAddr, source peersource.Source) (blocked int) {
 	now := time.Now()
 	var added int
 	for _, ad := range addrs {
@@ -76,16 +81,18 @@ func (d *AddrList) Push(addrs []*net.TCPAddr, source peersource.Source) {
 		if ad.Port == 0 {
 			continue
 		}
-		// Discard own client
-		if ad.IP.IsLoopback() && ad.Port == d.listenPort {
-			continue
-		} else if d.clientIP.Equal(ad.IP) {
+		// Discard own client. Other clients may share the same IP address, e.g. behind a NAT.
+		if ad.Port == d.listenPort && (ad.IP.IsLoopback() || d.clientIP.Equal(ad.IP)) {
 			continue
 		}
 		if externalip.IsExternal(ad.IP) {
 			continue
 		}
 		if d.blocklist != nil && d.blocklist.Blocked(ad.IP) {
+			blocked++
+			continue
+		}
+		if d.allowlist != nil && !d.allowlist.Allowed(ad.IP) {
 			continue
 		}
 		p := &peerAddr{
@@ -119,6 +126,7 @@ func (d *AddrList) Push(addrs []*net.TCPAddr, source peersource.Source) {
 	if len(d.peerByTime) != d.peerByPriority.Len() {
 		panic("addr list data structures not in sync")
 	}
+	return blocked
 }
 
 func (d *AddrList) filterNils() {
@@ -10,7 +10,7 @@ import (
 
 func TestAddrList(t *testing.T) {
 	clientIP := net.IPv4(1, 2, 3, 4)
-	al := New(2, nil, 5000, &clientIP)
+	al := New(2, nil, nil, 5000, &clientIP)
 
 	// Push 1st addr
 	al.Push([]*net.TCPAddr{newAddr("1.1.1.1")}, peersource.Tracker)
@@ -53,6 +53,18 @@ func TestAddrList(t *testing.T) {
 	assert.Equal(t, al.peerByTime[1].index, 1)
 }
 
+func TestAddrListDiscardOwnClient(t *testing.T) {
+	clientIP := net.IPv4(1, 2, 3, 4)
+	al := New(10, nil, nil, 5000, &clientIP)
+	al.Push([]*net.TCPAddr{
+		{IP: clientIP, Port: 5000},
+		{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+		{IP: clientIP, Port: 5001},
+		{IP: net.IPv4(127, 0, 0, 1), Port: 5001},
+	}, peersource.Tracker)
+	assert.Equal(t, 2, al.Len())
+}
+
 func newAddr(ip string) *net.TCPAddr {
 	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 1}
 }
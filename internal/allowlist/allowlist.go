@@ -0,0 +1,55 @@
+// Package allowlist provides a list of IP addresses and ranges that peers are restricted to.
+package allowlist
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Allowlist holds IP ranges of the peers that are allowed to connect.
+type Allowlist struct {
+	nets []*net.IPNet
+}
+
+// New parses the rules and returns a new Allowlist.
+// Each rule is either a single IP address or a range in CIDR notation.
+func New(rules []string) (*Allowlist, error) {
+	a := &Allowlist{nets: make([]*net.IPNet, 0, len(rules))}
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if strings.ContainsRune(rule, '/') {
+			_, n, err := net.ParseCIDR(rule)
+			if err != nil {
+				return nil, err
+			}
+			a.nets = append(a.nets, n)
+			continue
+		}
+		ip := net.ParseIP(rule)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address: %q", rule)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			a.nets = append(a.nets, &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})
+		} else {
+			a.nets = append(a.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+		}
+	}
+	return a, nil
+}
+
+// Len returns the number of rules in the Allowlist.
+func (a *Allowlist) Len() int {
+	return len(a.nets)
+}
+
+// Allowed returns true if ip matches any of the rules in Allowlist.
+func (a *Allowlist) Allowed(ip net.IP) bool {
+	for _, n := range a.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package allowlist
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowlist(t *testing.T) {
+	a, err := New([]string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32", " ::1 "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 4, a.Len())
+	assert.True(t, a.Allowed(net.ParseIP("10.1.2.3")))
+	assert.True(t, a.Allowed(net.ParseIP("192.168.1.5")))
+	assert.True(t, a.Allowed(net.ParseIP("::ffff:192.168.1.5")))
+	assert.True(t, a.Allowed(net.ParseIP("2001:db8::1")))
+	assert.True(t, a.Allowed(net.ParseIP("::1")))
+	assert.False(t, a.Allowed(net.ParseIP("192.168.1.6")))
+	assert.False(t, a.Allowed(net.ParseIP("11.0.0.1")))
+	assert.False(t, a.Allowed(net.ParseIP("2001:db9::1")))
+}
+
+func TestAllowlistInvalid(t *testing.T) {
+	_, err := New([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+	_, err = New([]string{"example.com"})
+	assert.Error(t, err)
+}
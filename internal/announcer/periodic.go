@@ -32,6 +32,18 @@ const (
 	NotWorking
 )
 
+// CompletedEvent is the state of the "completed" event for a tracker.
+type CompletedEvent int
+
+const (
+	// CompletedNotDue means the torrent is not completed by downloading, so the event must not be sent.
+	CompletedNotDue CompletedEvent = iota
+	// CompletedPending means the event must be sent until the tracker accepts it.
+	CompletedPending
+	// CompletedSent means the tracker has accepted the event.
+	CompletedSent
+)
+
 // PeriodicalAnnouncer announces the Torrent to the Tracker periodically.
 type PeriodicalAnnouncer struct {
 	Tracker       tracker.Tracker
@@ -43,9 +55,14 @@ type PeriodicalAnnouncer struct {
 	seeders       int
 	leechers      int
 	warningMsg    string
+	warningAt     time.Time
+	warnings      chan TrackerWarning
 	lastError     *AnnounceError
 	log           logger.Logger
 	completedC    chan struct{}
+	completed     CompletedEvent
+	completedSent chan string
+	event         tracker.Event // event of the last announce
 	newPeers      chan []*net.TCPAddr
 	backoff       backoff.BackOff
 	getTorrent    func() tracker.Torrent
@@ -63,7 +80,10 @@ type PeriodicalAnnouncer struct {
 }
 
 // NewPeriodicalAnnouncer returns a new PeriodicalAnnouncer.
-func NewPeriodicalAnnouncer(trk tracker.Tracker, numWant int, minInterval time.Duration, getTorrent func() tracker.Torrent, completedC chan struct{}, newPeers chan []*net.TCPAddr, l logger.Logger) *PeriodicalAnnouncer {
+// completed is the initial state of the "completed" event, e.g. loaded from resume data.
+// The tracker URL is sent to completedSent when the tracker accepts the "completed" event.
+// A TrackerWarning is sent to warnings when the tracker returns a new warning message.
+func NewPeriodicalAnnouncer(trk tracker.Tracker, numWant int, minInterval time.Duration, getTorrent func() tracker.Torrent, completedC chan struct{}, completed CompletedEvent, completedSent chan string, warnings chan TrackerWarning, newPeers chan []*net.TCPAddr, l logger.Logger) *PeriodicalAnnouncer {
 	return &PeriodicalAnnouncer{
 		Tracker:        trk,
 		status:         NotContactedYet,
@@ -72,6 +92,9 @@ func NewPeriodicalAnnouncer(trk tracker.Tracker, numWant int, minInterval time.D
 		minInterval:    minInterval,
 		log:            l,
 		completedC:     completedC,
+		completed:      completed,
+		completedSent:  completedSent,
+		warnings:       warnings,
 		newPeers:       newPeers,
 		getTorrent:     getTorrent,
 		needMorePeersC: make(chan struct{}, 1),
@@ -147,6 +170,7 @@ func (a *PeriodicalAnnouncer) Run() {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// BEP 0003: No completed is sent if the file was complete when started.
+	// The event is still sent if it was pending when the torrent is stopped.
 	select {
 	case <-a.completedC:
 		a.completedC = nil
@@ -160,14 +184,18 @@ func (a *PeriodicalAnnouncer) Run() {
 			if a.status == Contacting {
 				break
 			}
+			if a.completed == CompletedPending {
+				// Previous "completed" announce has failed.
+				a.doAnnounce(ctx, tracker.EventCompleted, 0)
+				break
+			}
 			a.doAnnounce(ctx, tracker.EventNone, a.numWant)
 		case resp := <-a.responseC:
 			a.status = Working
 			a.seeders = int(resp.Seeders)
 			a.leechers = int(resp.Leechers)
-			a.warningMsg = resp.WarningMessage
-			if a.warningMsg != "" {
-				a.log.Debugln("announce warning:", a.warningMsg)
+			if resp.WarningMessage != "" {
+				a.setWarning(resp.WarningMessage)
 			}
 			a.interval = resp.Interval
 			if resp.MinInterval > 0 {
@@ -184,6 +212,17 @@ func (a *PeriodicalAnnouncer) Run() {
 				case <-a.closeC:
 				}
 			}()
+			if a.event == tracker.EventCompleted {
+				a.completed = CompletedSent
+				go func() {
+					select {
+					case a.completedSent <- a.Tracker.URL():
+					case <-a.closeC:
+					}
+				}()
+			} else if a.completed == CompletedPending {
+				a.doAnnounce(ctx, tracker.EventCompleted, 0)
+			}
 		case err := <-a.errC:
 			a.status = NotWorking
 			// Give more friendly error to the user
@@ -202,12 +241,17 @@ func (a *PeriodicalAnnouncer) Run() {
 			interval := time.Until(a.lastAnnounce.Add(a.getNextInterval()))
 			resetTimer(interval)
 		case <-a.completedC:
+			a.completedC = nil
+			if a.completed != CompletedNotDue {
+				// Event is already sent or will be sent after the ongoing announce.
+				break
+			}
+			a.completed = CompletedPending
 			if a.status == Contacting {
 				cancel()
 				ctx, cancel = context.WithCancel(context.Background())
 			}
 			a.doAnnounce(ctx, tracker.EventCompleted, 0)
-			a.completedC = nil // do not send more than one "completed" event
 		case req := <-a.statsCommandC:
 			req.Response <- a.stats()
 		case <-a.closeC:
@@ -236,37 +280,71 @@ func (a *PeriodicalAnnouncer) getNextIntervalFromError(err *AnnounceError) time.
 
 func (a *PeriodicalAnnouncer) doAnnounce(ctx context.Context, event tracker.Event, numWant int) {
 	go a.announce(ctx, event, numWant)
+	a.event = event
 	a.status = Contacting
 	a.lastAnnounce = time.Now()
 }
 
+// setWarning keeps the latest warning message of the tracker.
+// Trackers usually repeat the same warning in every response, so only changed messages are logged and sent to the torrent.
+func (a *PeriodicalAnnouncer) setWarning(msg string) {
+	a.warningAt = time.Now()
+	if msg == a.warningMsg {
+		return
+	}
+	a.warningMsg = msg
+	a.log.Warningln("announce warning:", msg)
+	if a.warnings == nil {
+		return
+	}
+	w := TrackerWarning{URL: a.Tracker.URL(), Message: msg}
+	go func() {
+		select {
+		case a.warnings <- w:
+		case <-a.closeC:
+		}
+	}()
+}
+
 func (a *PeriodicalAnnouncer) announce(ctx context.Context, event tracker.Event, numWant int) {
 	announce(ctx, a.Tracker, event, numWant, a.getTorrent(), a.responseC, a.errC)
 }
 
 // Stats about the announcer.
 type Stats struct {
-	Status       Status
-	Error        *AnnounceError
-	Warning      string
+	Status  Status
+	Error   *AnnounceError
+	Warning string
+	// Time of the last response containing the warning.
+	WarningAt    time.Time
 	Seeders      int
 	Leechers     int
 	LastAnnounce time.Time
 	NextAnnounce time.Time
+	// True if the tracker has accepted the "completed" event.
+	CompletedSent bool
 }
 
 func (a *PeriodicalAnnouncer) stats() Stats {
 	return Stats{
-		Status:       a.status,
-		Error:        a.lastError,
-		Warning:      a.warningMsg,
-		Seeders:      a.seeders,
-		Leechers:     a.leechers,
-		LastAnnounce: a.lastAnnounce,
-		NextAnnounce: a.nextAnnounce,
+		Status:        a.status,
+		Error:         a.lastError,
+		Warning:       a.warningMsg,
+		WarningAt:     a.warningAt,
+		Seeders:       a.seeders,
+		Leechers:      a.leechers,
+		LastAnnounce:  a.lastAnnounce,
+		NextAnnounce:  a.nextAnnounce,
+		CompletedSent: a.completed == CompletedSent,
 	}
 }
 
+// TrackerWarning is a warning message returned by a tracker in announce response.
+type TrackerWarning struct {
+	URL     string
+	Message string
+}
+
 // AnnounceError the error that comes from the Tracker itself.
 type AnnounceError struct {
 	Err     error
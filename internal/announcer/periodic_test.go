@@ -0,0 +1,107 @@
+package announcer
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/tracker"
+	"github.com/stretchr/testify/assert"
+)
+
+type testTracker struct {
+	events   chan tracker.Event
+	failures int
+	warning  string
+}
+
+func (t *testTracker) Announce(ctx context.Context, req tracker.AnnounceRequest) (*tracker.AnnounceResponse, error) {
+	t.events <- req.Event
+	if req.Event == tracker.EventCompleted && t.failures > 0 {
+		t.failures--
+		return nil, &tracker.Error{FailureReason: "try again", RetryIn: 10 * time.Millisecond}
+	}
+	return &tracker.AnnounceResponse{Interval: time.Minute, WarningMessage: t.warning}, nil
+}
+
+func (t *testTracker) URL() string {
+	return "http://tracker.example.com/announce"
+}
+
+func TestPendingCompletedEvent(t *testing.T) {
+	trk := &testTracker{events: make(chan tracker.Event, 10), failures: 1}
+	// Torrent was already complete when started.
+	completedC := make(chan struct{})
+	close(completedC)
+	completedSent := make(chan string, 1)
+	newPeers := make(chan []*net.TCPAddr, 10)
+	getTorrent := func() tracker.Torrent { return tracker.Torrent{} }
+	a := NewPeriodicalAnnouncer(trk, 50, time.Minute, getTorrent, completedC, CompletedPending, completedSent, nil, newPeers, logger.New("test"))
+	go a.Run()
+	defer a.Close()
+
+	// Event is sent after started event and retried after failure.
+	expected := []tracker.Event{tracker.EventStarted, tracker.EventCompleted, tracker.EventCompleted}
+	for _, e := range expected {
+		select {
+		case got := <-trk.events:
+			assert.Equal(t, e, got)
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	select {
+	case u := <-completedSent:
+		assert.Equal(t, trk.URL(), u)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	assert.True(t, a.Stats().CompletedSent)
+	select {
+	case e := <-trk.events:
+		t.Fatalf("unexpected event: %v", e)
+	default:
+	}
+}
+
+func TestCompletedEventNotDue(t *testing.T) {
+	trk := &testTracker{events: make(chan tracker.Event, 10)}
+	completedC := make(chan struct{})
+	close(completedC)
+	newPeers := make(chan []*net.TCPAddr, 10)
+	getTorrent := func() tracker.Torrent { return tracker.Torrent{} }
+	a := NewPeriodicalAnnouncer(trk, 50, time.Minute, getTorrent, completedC, CompletedNotDue, make(chan string), nil, newPeers, logger.New("test"))
+	go a.Run()
+	defer a.Close()
+
+	assert.Equal(t, tracker.EventStarted, <-trk.events)
+	assert.False(t, a.Stats().CompletedSent)
+	select {
+	case e := <-trk.events:
+		t.Fatalf("unexpected event: %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWarningMessage(t *testing.T) {
+	trk := &testTracker{events: make(chan tracker.Event, 10), warning: "low ratio"}
+	warnings := make(chan TrackerWarning, 1)
+	newPeers := make(chan []*net.TCPAddr, 10)
+	getTorrent := func() tracker.Torrent { return tracker.Torrent{} }
+	a := NewPeriodicalAnnouncer(trk, 50, time.Minute, getTorrent, make(chan struct{}), CompletedNotDue, make(chan string), warnings, newPeers, logger.New("test"))
+	go a.Run()
+	defer a.Close()
+
+	assert.Equal(t, tracker.EventStarted, <-trk.events)
+	select {
+	case w := <-warnings:
+		assert.Equal(t, TrackerWarning{URL: trk.URL(), Message: "low ratio"}, w)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	stats := a.Stats()
+	assert.Equal(t, "low ratio", stats.Warning)
+	assert.False(t, stats.WarningAt.IsZero())
+}
@@ -43,6 +43,7 @@ func (a *StopAnnouncer) Run() {
 	defer close(a.doneC)
 
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.timeout))
+	defer cancel()
 	go func() {
 		select {
 		case <-ctx.Done():
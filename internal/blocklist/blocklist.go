@@ -3,16 +3,25 @@ package blocklist
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"encoding/binary"
 	"errors"
 	"io"
 	"net"
+	"strconv"
 	"sync"
 
 	"github.com/cenkalti/rain/internal/blocklist/stree"
 )
 
-var errNotIPv4Address = errors.New("address is not ipv4")
+var (
+	errNotIPv4Address = errors.New("address is not ipv4")
+	errInvalidRange   = errors.New("invalid ip range")
+	errAllowedRange   = errors.New("range is not blocked")
+)
+
+// eMule .dat files contain an access level for each range. Ranges with a level above this value are allowed.
+const emuleMaxBlockedLevel = 127
 
 // Blocklist holds a list of IP ranges in a Segment Tree structure for faster lookups.
 type Blocklist struct {
@@ -52,15 +61,30 @@ func (b *Blocklist) Blocked(ip net.IP) bool {
 }
 
 // Reload the segment tree by reading new rules from a io.Reader.
+// Each line may be in CIDR, eMule .dat or PeerGuardian .p2p format.
+// Gzip compressed data is detected and decompressed automatically.
 func (b *Blocklist) Reload(r io.Reader) (int, error) {
-	b.m.Lock()
-	defer b.m.Unlock()
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		defer gr.Close()
+		r = gr
+	} else {
+		r = br
+	}
 
 	tree, n, err := load(r, b.Logger)
 	if err != nil {
 		return n, err
 	}
 
+	b.m.Lock()
+	defer b.m.Unlock()
+
 	b.tree = *tree
 	b.count = n
 	return n, nil
@@ -79,7 +103,10 @@ func load(r io.Reader, logger Logger) (*stree.Stree, int, error) {
 		if l[0] == '#' {
 			continue
 		}
-		r, err := parseCIDR(l)
+		r, err := parseLine(l)
+		if err == errAllowedRange {
+			continue
+		}
 		if err != nil {
 			hasError = true
 			if logger != nil {
@@ -106,6 +133,84 @@ type ipRange struct {
 	first, last uint32
 }
 
+// parseLine parses a single rule in one of the supported formats:
+//
+//	CIDR:         1.2.3.0/24
+//	eMule .dat:   001.002.003.000 - 001.002.003.255 , 000 , Description
+//	PeerGuardian: Description:1.2.3.0-1.2.3.255
+//	Plain range:  1.2.3.0 - 1.2.3.255
+func parseLine(b []byte) (r ipRange, err error) {
+	if i := bytes.IndexByte(b, ','); i != -1 {
+		// eMule rules start with the range. Descriptions of PeerGuardian rules may contain commas too.
+		if r, err = parseRange(b[:i]); err == nil {
+			err = parseEmuleLevel(b[i+1:])
+			return
+		}
+	}
+	if i := bytes.LastIndexByte(b, ':'); i != -1 {
+		return parseRange(b[i+1:])
+	}
+	if bytes.IndexByte(b, '/') != -1 {
+		return parseCIDR(b)
+	}
+	return parseRange(b)
+}
+
+// parseEmuleLevel parses the access level that follows the range in eMule rules.
+// Ranges with a level above emuleMaxBlockedLevel are allowed, so an error is returned for them.
+func parseEmuleLevel(b []byte) error {
+	if i := bytes.IndexByte(b, ','); i != -1 {
+		b = b[:i]
+	}
+	level, err := strconv.Atoi(string(bytes.TrimSpace(b)))
+	if err != nil {
+		return err
+	}
+	if level > emuleMaxBlockedLevel {
+		return errAllowedRange
+	}
+	return nil
+}
+
+func parseRange(b []byte) (r ipRange, err error) {
+	first, last := b, b
+	if i := bytes.IndexByte(b, '-'); i != -1 {
+		first, last = b[:i], b[i+1:]
+	}
+	r.first, err = parseIPv4(bytes.TrimSpace(first))
+	if err != nil {
+		return
+	}
+	r.last, err = parseIPv4(bytes.TrimSpace(last))
+	if err != nil {
+		return
+	}
+	if r.first > r.last {
+		err = errInvalidRange
+	}
+	return
+}
+
+// parseIPv4 parses a dotted IPv4 address. Unlike net.ParseIP, it accepts zero padded octets used in eMule .dat files.
+func parseIPv4(b []byte) (uint32, error) {
+	parts := bytes.Split(b, []byte{'.'})
+	if len(parts) != 4 {
+		return 0, errNotIPv4Address
+	}
+	var ip uint32
+	for _, p := range parts {
+		if len(p) == 0 || len(p) > 3 {
+			return 0, errNotIPv4Address
+		}
+		n, err := strconv.ParseUint(string(p), 10, 8)
+		if err != nil {
+			return 0, errNotIPv4Address
+		}
+		ip = ip<<8 | uint32(n)
+	}
+	return ip, nil
+}
+
 func parseCIDR(b []byte) (r ipRange, err error) {
 	_, ipnet, err := net.ParseCIDR(string(b))
 	if err != nil {
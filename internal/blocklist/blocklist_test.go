@@ -2,9 +2,11 @@ package blocklist
 
 import (
 	"bytes"
+	"compress/gzip"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -49,3 +51,41 @@ func TestEmptyList(t *testing.T) {
 	assert.False(t, b.Blocked(net.ParseIP("0.0.0.0")))
 	assert.False(t, b.Blocked(net.ParseIP("176.240.195.107")))
 }
+
+func TestFormats(t *testing.T) {
+	const rules = `# comment
+1.1.1.0/24
+002.002.002.000 - 002.002.002.255 , 000 , Some eMule range
+003.003.003.000 - 003.003.003.255 , 200 , Allowed eMule range
+Some: PeerGuardian range:4.4.4.0-4.4.4.255
+Acme, Inc:6.6.6.0-6.6.6.255
+5.5.5.5
+`
+	b := New()
+	n, err := b.Reload(strings.NewReader(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 5, n)
+	assert.True(t, b.Blocked(net.ParseIP("1.1.1.1")))
+	assert.True(t, b.Blocked(net.ParseIP("2.2.2.2")))
+	assert.False(t, b.Blocked(net.ParseIP("3.3.3.3")))
+	assert.True(t, b.Blocked(net.ParseIP("4.4.4.4")))
+	assert.True(t, b.Blocked(net.ParseIP("5.5.5.5")))
+	assert.False(t, b.Blocked(net.ParseIP("5.5.5.6")))
+	assert.True(t, b.Blocked(net.ParseIP("6.6.6.6")))
+}
+
+func TestGzip(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write([]byte("1.1.1.0/24\n"))
+	w.Close()
+	b := New()
+	n, err := b.Reload(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, n)
+	assert.True(t, b.Blocked(net.ParseIP("1.1.1.1")))
+}
@@ -11,14 +11,16 @@ import (
 )
 
 // Accept BitTorrent handshake from the connection. Handles encryption.
+// getPeerID returns the peer ID that is sent for the info hash requested by the peer.
+// Connection is rejected if getPeerID returns false.
 // Returns a new connection that is ready for sending/receiving BitTorrent protocol messages.
 func Accept(
 	conn net.Conn,
 	handshakeTimeout time.Duration,
 	getSKey func(sKeyHash [20]byte) (sKey []byte),
 	forceEncryption bool,
-	hasInfoHash func([20]byte) bool,
-	ourExtensions [8]byte, ourID [20]byte) (
+	getPeerID func(infoHash [20]byte) (ourID [20]byte, ok bool),
+	ourExtensions [8]byte) (
 	encConn net.Conn, cipher mse.CryptoMethod, peerExtensions [8]byte, peerID [20]byte, infoHash [20]byte, err error) {
 	log := logger.New("conn <- " + conn.RemoteAddr().String())
 
@@ -72,7 +74,8 @@ func Accept(
 		return
 	}
 
-	if !hasInfoHash(infoHash) {
+	ourID, ok := getPeerID(infoHash)
+	if !ok {
 		err = errInvalidInfoHash
 		return
 	}
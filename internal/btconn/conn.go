@@ -18,3 +18,16 @@ type rwConn struct {
 
 func (c *rwConn) Read(p []byte) (n int, err error)  { return c.rw.Read(p) }
 func (c *rwConn) Write(p []byte) (n int, err error) { return c.rw.Write(p) }
+
+// PeerAddr returns the remote address of the connection as TCP address.
+// Addresses of uTP connections are UDP addresses. They are converted because peers are identified by IP and port regardless of the transport.
+func PeerAddr(conn net.Conn) *net.TCPAddr {
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		return addr
+	case *net.UDPAddr:
+		return &net.TCPAddr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone}
+	default:
+		return nil
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cenkalti/rain/internal/mse"
+	"github.com/cenkalti/rain/internal/utp"
 )
 
 var (
@@ -28,7 +29,7 @@ func TestUnencrypted(t *testing.T) {
 	var gerr error
 	go func() {
 		defer close(done)
-		conn, cipher, ext, id, err2 := Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, 10*time.Second, 10*time.Second, false, false, ext1, infoHash, id1, nil)
+		conn, cipher, ext, id, err2 := Dial(&net.Dialer{}, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, 10*time.Second, 10*time.Second, false, false, ext1, infoHash, id1, nil)
 		if err2 != nil {
 			gerr = err2
 			return
@@ -50,7 +51,7 @@ func TestUnencrypted(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, cipher, ext, id, ih, err := Accept(conn, 10*time.Second, nil, false, func(ih [20]byte) bool { return ih == infoHash }, ext2, id2)
+	_, cipher, ext, id, ih, err := Accept(conn, 10*time.Second, nil, false, func(ih [20]byte) ([20]byte, bool) { return id2, ih == infoHash }, ext2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -83,7 +84,7 @@ func TestEncrypted(t *testing.T) {
 	var gerr error
 	go func() {
 		defer close(done)
-		conn, cipher, ext, id, err2 := Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, 10*time.Second, 10*time.Second, true, true, ext1, infoHash, id1, nil)
+		conn, cipher, ext, id, err2 := Dial(&net.Dialer{}, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, 10*time.Second, 10*time.Second, true, true, ext1, infoHash, id1, nil)
 		if err2 != nil {
 			gerr = err2
 			return
@@ -130,8 +131,8 @@ func TestEncrypted(t *testing.T) {
 			return nil
 		},
 		false,
-		func(ih [20]byte) bool { return ih == infoHash },
-		ext2, id2)
+		func(ih [20]byte) ([20]byte, bool) { return id2, ih == infoHash },
+		ext2)
 	if err != nil {
 		conn.Close()
 		<-done
@@ -169,3 +170,75 @@ func TestEncrypted(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestUTP(t *testing.T) {
+	l, err := utp.Listen("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s, err := utp.Listen("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	done := make(chan struct{})
+	var gerr error
+	go func() {
+		defer close(done)
+		conn, cipher, ext, id, err2 := Dial(s, l.Addr(), 10*time.Second, 10*time.Second, true, false, ext1, infoHash, id1, nil)
+		if err2 != nil {
+			gerr = err2
+			return
+		}
+		if conn == nil {
+			t.Errorf("conn: %s", conn)
+		}
+		if cipher != mse.RC4 {
+			t.Errorf("cipher: %d", cipher)
+		}
+		if ext != ext2 {
+			t.Errorf("ext: %s", ext)
+		}
+		if id != id2 {
+			t.Errorf("id: %s", id)
+		}
+	}()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cipher, ext, id, ih, err := Accept(
+		conn,
+		10*time.Second,
+		func(h [20]byte) (sKey []byte) {
+			if h == sKeyHash {
+				return infoHash[:]
+			}
+			return nil
+		},
+		false,
+		func(ih [20]byte) ([20]byte, bool) { return id2, ih == infoHash },
+		ext2)
+	if err != nil {
+		conn.Close()
+		<-done
+		t.Fatal(err)
+	}
+	<-done
+	if gerr != nil {
+		t.Fatal(gerr)
+	}
+	if cipher != mse.RC4 {
+		t.Errorf("cipher: %d", cipher)
+	}
+	if ext != ext1 {
+		t.Errorf("ext: %s", ext)
+	}
+	if ih != infoHash {
+		t.Errorf("ih: %s", ih)
+	}
+	if id != id1 {
+		t.Errorf("id: %s", id)
+	}
+}
@@ -10,10 +10,16 @@ import (
 	"github.com/cenkalti/rain/internal/mse"
 )
 
+// Dialer opens connections to peers. net.Dialer and utp.Socket implement this interface.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
 // Dial new connection to the address. Does the BitTorrent protocol handshake.
 // Handles encryption. May try to connect again if encryption does not match with given setting.
 // Returns a net.Conn that is ready for sending/receiving BitTorrent peer protocol messages.
 func Dial(
+	dialer Dialer,
 	addr net.Addr,
 	dialTimeout, handshakeTimeout time.Duration,
 	enableEncryption,
@@ -38,8 +44,7 @@ func Dial(
 
 	// First connection
 	log.Debug("Connecting to peer...")
-	dialer := net.Dialer{Timeout: dialTimeout}
-	conn, err = dialer.DialContext(ctx, addr.Network(), addr.String())
+	conn, err = dial(ctx, dialer, addr, dialTimeout)
 	if err != nil {
 		return
 	}
@@ -97,7 +102,7 @@ func Dial(
 			// Close current connection and try again without encryption
 			conn.Close()
 			log.Debug("Connecting again without encryption...")
-			conn, err = dialer.DialContext(ctx, addr.Network(), addr.String())
+			conn, err = dial(ctx, dialer, addr, dialTimeout)
 			if err != nil {
 				return
 			}
@@ -155,3 +160,9 @@ func Dial(
 	}
 	return
 }
+
+func dial(ctx context.Context, dialer Dialer, addr net.Addr, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return dialer.DialContext(ctx, addr.Network(), addr.String())
+}
@@ -5,19 +5,22 @@ import (
 
 	"github.com/cenkalti/rain/internal/piece"
 	"github.com/cenkalti/rain/internal/piececache"
+	"github.com/cenkalti/rain/internal/storage"
 )
 
 // CachedPiece is a wrapper around a piece.Piece object that is capable of reading the data from a picecache.Cache.
 type CachedPiece struct {
+	reader   storage.PieceReader
 	pi       *piece.Piece
 	cache    *piececache.Cache
 	readSize int64
 	peerID   []byte
 }
 
-// New returns a new CachedPiece object. Reads are done with blocks of `readSize`.
-func New(pi *piece.Piece, cache *piececache.Cache, readSize int64, peerID [20]byte) *CachedPiece {
+// New returns a new CachedPiece object. Reads are done with blocks of `readSize` from reader.
+func New(reader storage.PieceReader, pi *piece.Piece, cache *piececache.Cache, readSize int64, peerID [20]byte) *CachedPiece {
 	return &CachedPiece{
+		reader:   reader,
 		pi:       pi,
 		cache:    cache,
 		readSize: readSize,
@@ -41,7 +44,7 @@ func (c *CachedPiece) ReadAt(p []byte, off int64) (n int, err error) {
 
 	buf, err := c.cache.Get(string(key), func() ([]byte, error) {
 		b := make([]byte, blkEnd-blkBegin)
-		_, err = c.pi.Data.ReadAt(b, int64(blkBegin))
+		_, err = c.reader.ReadPiece(c.pi.Index, int64(blkBegin), b)
 		return b, err
 	})
 	if err != nil {
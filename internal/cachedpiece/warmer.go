@@ -0,0 +1,48 @@
+package cachedpiece
+
+import (
+	"github.com/cenkalti/rain/internal/piece"
+	"github.com/cenkalti/rain/internal/piececache"
+	"github.com/cenkalti/rain/internal/storage"
+)
+
+// Warmer loads pieces into the cache in background, so the first requests for them do not wait for disk reads.
+type Warmer struct {
+	closeC chan struct{}
+	doneC  chan struct{}
+}
+
+// NewWarmer returns a new Warmer.
+func NewWarmer() *Warmer {
+	return &Warmer{
+		closeC: make(chan struct{}),
+		doneC:  make(chan struct{}),
+	}
+}
+
+// Close stops loading pieces and waits for the ongoing read to finish.
+func (w *Warmer) Close() {
+	close(w.closeC)
+	<-w.doneC
+}
+
+// Run loads the pieces into the cache in given order with the same keys used by CachedPiece.
+// It stops at the first read error.
+func (w *Warmer) Run(reader storage.PieceReader, pieces []*piece.Piece, cache *piececache.Cache, readSize int64, peerID [20]byte) {
+	defer close(w.doneC)
+	for _, pi := range pieces {
+		c := New(reader, pi, cache, readSize, peerID)
+		var b [1]byte
+		for off := int64(0); off < int64(pi.Length); off += readSize {
+			select {
+			case <-w.closeC:
+				return
+			default:
+			}
+			_, err := c.ReadAt(b[:], off)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package cachedpiece
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/piece"
+	"github.com/cenkalti/rain/internal/piececache"
+	"github.com/stretchr/testify/assert"
+)
+
+type pieceReader struct {
+	reads int
+}
+
+func (r *pieceReader) ReadPiece(index uint32, offset int64, b []byte) (int, error) {
+	r.reads++
+	for i := range b {
+		b[i] = byte(index)
+	}
+	return len(b), nil
+}
+
+func TestWarmer(t *testing.T) {
+	cache := piececache.New(1<<20, time.Minute, 1)
+	defer cache.Close()
+	r := &pieceReader{}
+	pieces := []*piece.Piece{{Index: 1, Length: 10}, {Index: 3, Length: 4}}
+	var peerID [20]byte
+
+	w := NewWarmer()
+	w.Run(r, pieces, cache, 4, peerID)
+	w.Close()
+	assert.Equal(t, 4, r.reads)
+	assert.Equal(t, 4, cache.Len())
+	assert.Equal(t, int64(14), cache.Size())
+
+	// Reads are served from the cache after warm-up.
+	b := make([]byte, 2)
+	n, err := New(r, pieces[0], cache, 4, peerID).ReadAt(b, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []byte{1, 1}, b)
+	assert.Equal(t, 4, r.reads)
+}
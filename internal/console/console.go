@@ -409,6 +409,9 @@ func getRow(columns []string, t Torrent, index int) string {
 				if status == "Downloading Metadata" {
 					status = "Downloading"
 				}
+				if stats.Paused {
+					status = "Paused"
+				}
 				row += fmt.Sprintf("%-11s", status)
 			}
 		case "Speed":
@@ -1139,6 +1142,8 @@ func flags(p rpctypes.Peer) string {
 		sb.WriteString("I")
 	case "MANUAL":
 		sb.WriteString("M")
+	case "LSD":
+		sb.WriteString("L")
 	default:
 		sb.WriteString(" ")
 	}
@@ -1213,23 +1218,36 @@ func FormatStats(stats *rpctypes.Stats, v io.Writer) {
 	if status == "Stopped" && stats.Error != "" {
 		status = status + ": " + stats.Error
 	}
+	if stats.Paused {
+		status += " (paused)"
+	}
+	if stats.Boosted {
+		status += " (boosted)"
+	}
+	if stats.TransferMode != "" && stats.TransferMode != "Normal" {
+		status += " (" + strings.ToLower(stats.TransferMode) + ")"
+	}
 	fmt.Fprintf(v, "Status: %s\n", status)
 	fmt.Fprintf(v, "Progress: %d%%\n", getProgress(stats))
 	fmt.Fprintf(v, "Ratio: %.2f\n", getRatio(stats))
 	fmt.Fprintf(v, "Size: %s\n", getSize(stats))
 	fmt.Fprintf(v, "Peers: %d in / %d out\n", stats.Peers.Incoming, stats.Peers.Outgoing)
+	fmt.Fprintf(v, "Seeding to: %d of %d peers (%d interested, %d/%d slots used)\n", stats.Peers.Uploading, stats.Peers.Total, stats.Peers.Interested, stats.Peers.Unchoked, stats.Peers.UploadSlots)
 	fmt.Fprintf(v, "Download speed: %11s\n", getDownloadSpeed(stats))
 	fmt.Fprintf(v, "Upload speed:   %11s\n", getUploadSpeed(stats))
 	fmt.Fprintf(v, "ETA: %s\n", getETA(stats))
+	if stats.WantedRange.Length > 0 {
+		fmt.Fprintf(v, "Wanted range: file %d, %d bytes at %d (%d%% completed)\n", stats.WantedRange.File, stats.WantedRange.Length, stats.WantedRange.Offset, stats.WantedRange.Completed*100/stats.WantedRange.Length)
+	}
 }
 
 // FormatSessionStats returns the human readable representation of session stats object.
 func FormatSessionStats(s *rpctypes.SessionStats, v io.Writer) {
 	fmt.Fprintf(v, "Torrents: %d, Peers: %d, Uptime: %s\n", s.Torrents, s.Peers, time.Duration(s.Uptime)*time.Second)
-	fmt.Fprintf(v, "BlocklistRules: %d, Updated: %s ago\n", s.BlockListRules, time.Duration(s.BlockListRecency)*time.Second)
+	fmt.Fprintf(v, "BlocklistRules: %d, Updated: %s ago, Rejected Incoming: %d, Outgoing: %d\n", s.BlockListRules, time.Duration(s.BlockListRecency)*time.Second, s.BlockListRejectedIncoming, s.BlockListRejectedOutgoing)
 	fmt.Fprintf(v, "Reads: %d/s, %dKB/s, Active: %d, Pending: %d\n", s.ReadsPerSecond, s.SpeedRead/1024, s.ReadsActive, s.ReadsPending)
 	fmt.Fprintf(v, "Writes: %d/s, %dKB/s, Active: %d, Pending: %d\n", s.WritesPerSecond, s.SpeedWrite/1024, s.WritesActive, s.WritesPending)
-	fmt.Fprintf(v, "ReadCache Objects: %d, Size: %dMB, Utilization: %d%%\n", s.ReadCacheObjects, s.ReadCacheSize/(1<<20), s.ReadCacheUtilization)
+	fmt.Fprintf(v, "ReadCache Objects: %d, Size: %dMB, Utilization: %d%%, Hits: %d, Misses: %d\n", s.ReadCacheObjects, s.ReadCacheSize/(1<<20), s.ReadCacheUtilization, s.ReadCacheHits, s.ReadCacheMisses)
 	fmt.Fprintf(v, "WriteCache Objects: %d, Size: %dMB, PendingKeys: %d\n", s.WriteCacheObjects, s.WriteCacheSize/(1<<20), s.WriteCachePendingKeys)
 	fmt.Fprintf(v, "DownloadSpeed: %dKB/s, UploadSpeed: %dKB/s\n", s.SpeedDownload/1024, s.SpeedUpload/1024)
 	fmt.Fprintf(v, "BytesDownloaded: %dMB, BytesUploaded: %dMB\n", s.BytesDownloaded/1024/1024, s.BytesUploaded/1024/1024)
@@ -0,0 +1,92 @@
+// Package diallimiter provides a limiter for outgoing peer connection attempts that is shared by all torrents in a Session.
+package diallimiter
+
+import (
+	"net"
+	"sync"
+)
+
+// DialLimiter limits the number of concurrent connection attempts in total and per subnet.
+// Too many simultaneous SYN packets may overflow NAT tables of consumer routers.
+type DialLimiter struct {
+	maxTotal     int
+	maxPerSubnet int
+
+	m        sync.Mutex
+	active   int
+	bySubnet map[string]int
+	changedC chan struct{}
+}
+
+// New returns a new DialLimiter. Zero value for a limit means unlimited.
+func New(maxTotal, maxPerSubnet int) *DialLimiter {
+	return &DialLimiter{
+		maxTotal:     maxTotal,
+		maxPerSubnet: maxPerSubnet,
+		bySubnet:     make(map[string]int),
+		changedC:     make(chan struct{}),
+	}
+}
+
+// Acquire blocks until a connection attempt to ip is allowed.
+// Returns false if cancelC is closed before acquiring.
+// Release must be called after the connection attempt is finished.
+func (l *DialLimiter) Acquire(ip net.IP, cancelC chan struct{}) bool {
+	key := subnet(ip)
+	for {
+		l.m.Lock()
+		if l.available(key) {
+			l.active++
+			l.bySubnet[key]++
+			l.m.Unlock()
+			return true
+		}
+		changedC := l.changedC
+		l.m.Unlock()
+		select {
+		case <-changedC:
+		case <-cancelC:
+			return false
+		}
+	}
+}
+
+// Release the slot acquired for ip.
+func (l *DialLimiter) Release(ip net.IP) {
+	key := subnet(ip)
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.active--
+	l.bySubnet[key]--
+	if l.bySubnet[key] <= 0 {
+		delete(l.bySubnet, key)
+	}
+	// Wake up all waiters. They will check their limits again.
+	close(l.changedC)
+	l.changedC = make(chan struct{})
+}
+
+// Len returns the number of connection attempts in progress.
+func (l *DialLimiter) Len() int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.active
+}
+
+func (l *DialLimiter) available(key string) bool {
+	if l.maxTotal > 0 && l.active >= l.maxTotal {
+		return false
+	}
+	if l.maxPerSubnet > 0 && l.bySubnet[key] >= l.maxPerSubnet {
+		return false
+	}
+	return true
+}
+
+// subnet returns /24 network for IPv4 and /48 network for IPv6 addresses.
+func subnet(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
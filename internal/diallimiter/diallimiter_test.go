@@ -0,0 +1,51 @@
+package diallimiter
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDialLimiterSubnet(t *testing.T) {
+	l := New(0, 1)
+	ip1 := net.ParseIP("1.2.3.4")
+	ip2 := net.ParseIP("1.2.3.5")
+	ip3 := net.ParseIP("1.2.4.4")
+	if !l.Acquire(ip1, nil) {
+		t.FailNow()
+	}
+	if !l.Acquire(ip3, nil) {
+		t.FailNow()
+	}
+	cancelC := make(chan struct{})
+	close(cancelC)
+	if l.Acquire(ip2, cancelC) {
+		t.Fatal("must not acquire in same subnet")
+	}
+	acquiredC := make(chan bool)
+	go func() { acquiredC <- l.Acquire(ip2, nil) }()
+	select {
+	case <-acquiredC:
+		t.Fatal("must wait for release")
+	case <-time.After(10 * time.Millisecond):
+	}
+	l.Release(ip1)
+	if !<-acquiredC {
+		t.FailNow()
+	}
+	if l.Len() != 2 {
+		t.FailNow()
+	}
+}
+
+func TestDialLimiterTotal(t *testing.T) {
+	l := New(1, 0)
+	if !l.Acquire(net.ParseIP("1.2.3.4"), nil) {
+		t.FailNow()
+	}
+	cancelC := make(chan struct{})
+	close(cancelC)
+	if l.Acquire(net.ParseIP("5.6.7.8"), cancelC) {
+		t.Fatal("must not exceed total limit")
+	}
+}
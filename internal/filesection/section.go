@@ -26,33 +26,39 @@ type Piece []FileSection
 // ReadAt implements io.ReaderAt interface.
 // It reads bytes from s at given offset into p.
 // Used when uploading blocks of a piece.
+// Each section is read with a single ReadAt call directly into b.
 func (p Piece) ReadAt(b []byte, off int64) (int, error) {
-	var readers []io.Reader
-	var i int
-	var pos int64
-
-	// Skip sections up to offset
-	for ; i < len(p); i++ {
-		pos += p[i].Length
-		if pos >= off {
+	var n int
+	for _, sec := range p {
+		if len(b) == 0 {
 			break
 		}
-	}
-
-	// Add half section
-	advance := p[i].Length - (pos - off)
-	readers = append(readers, io.NewSectionReader(p[i].File, p[i].Offset+advance, p[i].Length-advance))
-
-	// Add remaining sections
-	for i++; i < len(p); i++ {
-		readers = append(readers, io.NewSectionReader(p[i].File, p[i].Offset, p[i].Length))
-		pos += p[i].Length
-		if pos >= off+int64(len(b)) {
-			break
+		if off >= sec.Length {
+			off -= sec.Length
+			continue
 		}
+		toRead := b
+		if left := sec.Length - off; int64(len(toRead)) > left {
+			toRead = toRead[:left]
+		}
+		m, err := sec.File.ReadAt(toRead, sec.Offset+off)
+		n += m
+		if m == len(toRead) {
+			err = nil
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		b = b[m:]
+		off = 0
 	}
-
-	return io.ReadFull(io.MultiReader(readers...), b)
+	if len(b) > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, nil
 }
 
 // Write implements io.Writer interface.
@@ -63,6 +69,12 @@ func (p Piece) ReadAt(b []byte, off int64) (int, error) {
 func (p Piece) Write(b []byte) (n int, err error) {
 	var m int
 	for _, sec := range p {
+		// Padding files are not written to disk.
+		if sec.Padding {
+			n += int(sec.Length)
+			b = b[sec.Length:]
+			continue
+		}
 		m, err = sec.File.WriteAt(b[:sec.Length], sec.Offset)
 		n += m
 		if err != nil {
@@ -52,6 +52,26 @@ func TestFiles(t *testing.T) {
 		t.Errorf("b = %s", string(b))
 	}
 
+	// test partial read spanning an empty section
+	b = make([]byte, 2)
+	n, err = pf.ReadAt(b, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 2 {
+		t.Errorf("n == %d", n)
+	}
+	if string(b) != "aq" {
+		t.Errorf("b = %s", string(b))
+	}
+
+	// test read beyond the end
+	b = make([]byte, 2)
+	_, err = pf.ReadAt(b, 4)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("err = %v", err)
+	}
+
 	// test write
 	n, err = pf.Write([]byte("12345"))
 	if err != nil {
@@ -0,0 +1,174 @@
+// Package handoff passes listening sockets to a new process,
+// so the new process can accept connections on the same ports without closing them in between.
+package handoff
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EnvName is the environment variable that contains the keys of the inherited files.
+// The keys are separated by commas and the file descriptors start from 3, in the same order with the keys.
+const EnvName = "RAIN_LISTEN_FDS"
+
+// First file descriptor after stdin, stdout and stderr.
+const firstFD = 3
+
+// Listeners creates listening sockets and keeps track of them, so they can be passed to a new process.
+// Sockets are keyed by network and address, e.g. "tcp/0.0.0.0:50007".
+type Listeners struct {
+	m         sync.Mutex
+	inherited map[string]*os.File
+	active    map[string]filer
+}
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// New returns a new Listeners. Sockets in inherited map are used instead of creating new ones for the same keys.
+func New(inherited map[string]*os.File) *Listeners {
+	m := make(map[string]*os.File, len(inherited))
+	for k, f := range inherited {
+		m[k] = f
+	}
+	return &Listeners{
+		inherited: m,
+		active:    make(map[string]filer),
+	}
+}
+
+func socketKey(network, address string) string {
+	return network + "/" + address
+}
+
+// takeInherited returns the inherited file for the key and removes it from the map.
+func (l *Listeners) takeInherited(key string) *os.File {
+	f, ok := l.inherited[key]
+	if !ok {
+		return nil
+	}
+	delete(l.inherited, key)
+	return f
+}
+
+// Listen returns the inherited listener for the address if there is one. Otherwise, it creates a new listener.
+func (l *Listeners) Listen(ctx context.Context, lc *net.ListenConfig, network, address string) (net.Listener, error) {
+	key := socketKey(network, address)
+	l.m.Lock()
+	defer l.m.Unlock()
+	var lis net.Listener
+	var err error
+	if f := l.takeInherited(key); f != nil {
+		lis, err = net.FileListener(f)
+		f.Close()
+	} else {
+		lis, err = lc.Listen(ctx, network, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fl, ok := lis.(filer); ok {
+		l.active[key] = fl
+	}
+	return lis, nil
+}
+
+// ListenPacket returns the inherited packet socket for the address if there is one. Otherwise, it creates a new socket.
+func (l *Listeners) ListenPacket(ctx context.Context, lc *net.ListenConfig, network, address string) (net.PacketConn, error) {
+	key := socketKey(network, address)
+	l.m.Lock()
+	defer l.m.Unlock()
+	var pc net.PacketConn
+	var err error
+	if f := l.takeInherited(key); f != nil {
+		pc, err = net.FilePacketConn(f)
+		f.Close()
+	} else {
+		pc, err = lc.ListenPacket(ctx, network, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fl, ok := pc.(filer); ok {
+		l.active[key] = fl
+	}
+	return pc, nil
+}
+
+// Files returns duplicates of the open sockets. Sockets that are closed are skipped.
+// The caller must close the returned files after passing them to the new process.
+func (l *Listeners) Files() map[string]*os.File {
+	l.m.Lock()
+	defer l.m.Unlock()
+	files := make(map[string]*os.File, len(l.active))
+	for key, fl := range l.active {
+		f, err := fl.File()
+		if err != nil {
+			// Socket is closed.
+			delete(l.active, key)
+			continue
+		}
+		files[key] = f
+	}
+	return files
+}
+
+// Close closes the inherited files that are not used.
+func (l *Listeners) Close() {
+	l.m.Lock()
+	defer l.m.Unlock()
+	for key, f := range l.inherited {
+		f.Close()
+		delete(l.inherited, key)
+	}
+}
+
+// Inherited returns the files passed by the parent process.
+// Returns nil if the process is not started by Command.
+func Inherited() map[string]*os.File {
+	value := os.Getenv(EnvName)
+	if value == "" {
+		return nil
+	}
+	os.Unsetenv(EnvName)
+	keys := strings.Split(value, ",")
+	files := make(map[string]*os.File, len(keys))
+	for i, key := range keys {
+		files[key] = os.NewFile(uintptr(firstFD+i), key)
+	}
+	return files
+}
+
+// Command returns a command that runs the current executable with the same arguments and passes the files to it.
+func Command(files map[string]*os.File) (*exec.Cmd, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files to pass")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	extraFiles := make([]*os.File, len(keys))
+	for i, key := range keys {
+		extraFiles[i] = files[key]
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), EnvName+"="+strings.Join(keys, ","))
+	cmd.ExtraFiles = extraFiles
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
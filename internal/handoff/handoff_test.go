@@ -0,0 +1,68 @@
+package handoff
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestListenersHandoff(t *testing.T) {
+	ctx := context.Background()
+	var lc net.ListenConfig
+	l := New(nil)
+	lis, err := l.Listen(ctx, &lc, "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := l.ListenPacket(ctx, &lc, "udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	files := l.Files()
+	if len(files) != 2 {
+		t.Fatalf("got %d files", len(files))
+	}
+
+	l2 := New(files)
+	defer l2.Close()
+	lis2, err := l2.Listen(ctx, &lc, "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis2.Close()
+	if lis2.Addr().String() != lis.Addr().String() {
+		t.Fatalf("listening on different address: %s", lis2.Addr())
+	}
+	pc2, err := l2.ListenPacket(ctx, &lc, "udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc2.Close()
+	if pc2.LocalAddr().String() != pc.LocalAddr().String() {
+		t.Fatalf("listening on different address: %s", pc2.LocalAddr())
+	}
+
+	// Closing the old listener does not close the socket.
+	lis.Close()
+	conn, err := net.Dial("tcp", lis2.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn2, err := lis2.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn2.Close()
+
+	// Closed sockets are not returned.
+	files = l.Files()
+	for _, f := range files {
+		f.Close()
+	}
+	if len(files) != 1 {
+		t.Fatalf("got %d files", len(files))
+	}
+}
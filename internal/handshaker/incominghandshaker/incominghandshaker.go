@@ -14,6 +14,7 @@ import (
 type IncomingHandshaker struct {
 	Conn       net.Conn
 	PeerID     [20]byte
+	InfoHash   [20]byte
 	Extensions [8]byte
 	Cipher     mse.CryptoMethod
 	Error      error
@@ -38,7 +39,7 @@ func (h *IncomingHandshaker) Close() {
 }
 
 // Run the handshaker goroutine.
-func (h *IncomingHandshaker) Run(peerID [20]byte, getSKeyFunc func([20]byte) []byte, checkInfoHashFunc func([20]byte) bool, resultC chan *IncomingHandshaker, timeout time.Duration, ourExtensions [8]byte, forceIncomingEncryption bool) {
+func (h *IncomingHandshaker) Run(getSKeyFunc func([20]byte) []byte, getPeerIDFunc func([20]byte) ([20]byte, bool), resultC chan *IncomingHandshaker, timeout time.Duration, ourExtensions [8]byte, forceIncomingEncryption bool) {
 	defer close(h.doneC)
 	defer func() {
 		select {
@@ -50,8 +51,8 @@ func (h *IncomingHandshaker) Run(peerID [20]byte, getSKeyFunc func([20]byte) []b
 
 	log := logger.New("conn <- " + h.Conn.RemoteAddr().String())
 
-	conn, cipher, peerExtensions, peerID, _, err := btconn.Accept(
-		h.Conn, timeout, getSKeyFunc, forceIncomingEncryption, checkInfoHashFunc, ourExtensions, peerID)
+	conn, cipher, peerExtensions, peerID, infoHash, err := btconn.Accept(
+		h.Conn, timeout, getSKeyFunc, forceIncomingEncryption, getPeerIDFunc, ourExtensions)
 	if err != nil {
 		if err == io.EOF {
 			log.Debug("peer has closed the connection: EOF")
@@ -71,6 +72,7 @@ func (h *IncomingHandshaker) Run(peerID [20]byte, getSKeyFunc func([20]byte) []b
 
 	h.Conn = conn
 	h.PeerID = peerID
+	h.InfoHash = infoHash
 	h.Extensions = peerExtensions
 	h.Cipher = cipher
 }
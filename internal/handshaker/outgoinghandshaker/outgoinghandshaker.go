@@ -1,16 +1,25 @@
 package outgoinghandshaker
 
 import (
+	"errors"
 	"io"
 	"net"
 	"time"
 
 	"github.com/cenkalti/rain/internal/btconn"
+	"github.com/cenkalti/rain/internal/diallimiter"
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/mse"
 	"github.com/cenkalti/rain/internal/peersource"
+	"github.com/cenkalti/rain/internal/utp"
 )
 
+var errClosed = errors.New("handshaker is closed")
+
+// ConnectionAttemptDelay is the time to wait before connecting to the next address of a peer
+// while the connection attempt to the previous address is in progress (RFC 8305).
+const ConnectionAttemptDelay = 250 * time.Millisecond
+
 // OutgoingHandshaker does the BitTorrent handshake on an outgoing connection.
 type OutgoingHandshaker struct {
 	Addr       *net.TCPAddr
@@ -21,17 +30,27 @@ type OutgoingHandshaker struct {
 	Cipher     mse.CryptoMethod
 	Error      error
 
+	// Other addresses of the same peer, e.g. IPv4 and IPv6 addresses of a hostname.
+	// Connections to all addresses are raced and the first one that completes the handshake is kept.
+	Fallbacks []*net.TCPAddr
+
+	limiter *diallimiter.DialLimiter
+
 	closeC chan struct{}
 	doneC  chan struct{}
 }
 
 // New returns a new OutgoingHandshaker for a TCP address.
-func New(addr *net.TCPAddr, source peersource.Source) *OutgoingHandshaker {
+// If limiter is not nil, handshaker waits for the limiter before dialing the address.
+// Fallback addresses are tried in order if connecting to addr does not complete in ConnectionAttemptDelay.
+func New(addr *net.TCPAddr, source peersource.Source, limiter *diallimiter.DialLimiter, fallbacks ...*net.TCPAddr) *OutgoingHandshaker {
 	return &OutgoingHandshaker{
-		Addr:   addr,
-		Source: source,
-		closeC: make(chan struct{}),
-		doneC:  make(chan struct{}),
+		Addr:      addr,
+		Source:    source,
+		Fallbacks: fallbacks,
+		limiter:   limiter,
+		closeC:    make(chan struct{}),
+		doneC:     make(chan struct{}),
 	}
 }
 
@@ -41,12 +60,66 @@ func (h *OutgoingHandshaker) Close() {
 	<-h.doneC
 }
 
+func (h *OutgoingHandshaker) closed() bool {
+	return isClosed(h.closeC)
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+type dialResult struct {
+	conn           net.Conn
+	cipher         mse.CryptoMethod
+	peerExtensions [8]byte
+	remoteID       [20]byte
+	err            error
+}
+
 // Run the handshaker.
-func (h *OutgoingHandshaker) Run(dialTimeout, handshakeTimeout time.Duration, peerID, infoHash [20]byte, resultC chan *OutgoingHandshaker, ourExtensions [8]byte, disableOutgoingEncryption, forceOutgoingEncryption bool) {
+// If utpSocket is not nil, the peer is connected over uTP first.
+// If tcpDialer is not nil, TCP is used when uTP is not available or the connection over uTP fails.
+func (h *OutgoingHandshaker) Run(dialTimeout, handshakeTimeout time.Duration, peerID, infoHash [20]byte, resultC chan *OutgoingHandshaker, ourExtensions [8]byte, disableOutgoingEncryption, forceOutgoingEncryption bool, utpSocket *utp.Socket, tcpDialer btconn.Dialer) {
 	defer close(h.doneC)
 	log := logger.New("peer -> " + h.Addr.String())
 
-	conn, cipher, peerExtensions, peerID, err := btconn.Dial(h.Addr, dialTimeout, handshakeTimeout, !disableOutgoingEncryption, forceOutgoingEncryption, ourExtensions, infoHash, peerID, h.closeC)
+	dial := func(addr *net.TCPAddr, stopC chan struct{}) (r dialResult) {
+		if h.limiter != nil {
+			if !h.limiter.Acquire(addr.IP, stopC) {
+				r.err = errClosed
+				return
+			}
+			defer h.limiter.Release(addr.IP)
+		}
+		if utpSocket != nil {
+			uaddr := &net.UDPAddr{IP: addr.IP, Port: addr.Port}
+			r.conn, r.cipher, r.peerExtensions, r.remoteID, r.err = btconn.Dial(utpSocket, uaddr, dialTimeout, handshakeTimeout, !disableOutgoingEncryption, forceOutgoingEncryption, ourExtensions, infoHash, peerID, stopC)
+			if r.err != nil && tcpDialer != nil {
+				log.Debugln("cannot connect over utp, trying tcp:", r.err)
+			}
+		}
+		if tcpDialer != nil && (utpSocket == nil || r.err != nil) && !isClosed(stopC) {
+			r.conn, r.cipher, r.peerExtensions, r.remoteID, r.err = btconn.Dial(tcpDialer, addr, dialTimeout, handshakeTimeout, !disableOutgoingEncryption, forceOutgoingEncryption, ourExtensions, infoHash, peerID, stopC)
+		}
+		if r.conn == nil && r.err == nil {
+			// Attempt is cancelled before dialing over TCP.
+			r.err = errClosed
+		}
+		return
+	}
+	r := h.race(dial)
+	if h.closed() {
+		if r.conn != nil {
+			r.conn.Close()
+		}
+		return
+	}
+	conn, cipher, peerExtensions, remoteID, err := r.conn, r.cipher, r.peerExtensions, r.remoteID, r.err
 	if err != nil {
 		if err == io.EOF {
 			log.Debug("peer has closed the connection: EOF")
@@ -66,10 +139,10 @@ func (h *OutgoingHandshaker) Run(dialTimeout, handshakeTimeout time.Duration, pe
 		}
 		return
 	}
-	log.Debugf("Connected to peer. (cipher=%s extensions=%x client=%q)", cipher, peerExtensions, peerID[:8])
+	log.Debugf("Connected to peer. (cipher=%s extensions=%x client=%q)", cipher, peerExtensions, remoteID[:8])
 
 	h.Conn = conn
-	h.PeerID = peerID
+	h.PeerID = remoteID
 	h.Extensions = peerExtensions
 	h.Cipher = cipher
 
@@ -79,3 +152,61 @@ func (h *OutgoingHandshaker) Run(dialTimeout, handshakeTimeout time.Duration, pe
 		conn.Close()
 	}
 }
+
+// race connects to the addresses of the peer as described in RFC 8305.
+// Next address is dialed when the previous attempt fails or does not complete in ConnectionAttemptDelay.
+// The first successful connection is returned and other attempts are cancelled.
+// If all attempts fail, the error of the last attempt is returned.
+func (h *OutgoingHandshaker) race(dial func(addr *net.TCPAddr, stopC chan struct{}) dialResult) dialResult {
+	addrs := append([]*net.TCPAddr{h.Addr}, h.Fallbacks...)
+	stopC := make(chan struct{})
+	resultC := make(chan dialResult, len(addrs))
+	var running, next int
+	startNext := func() {
+		addr := addrs[next]
+		next++
+		running++
+		go func() { resultC <- dial(addr, stopC) }()
+	}
+	startNext()
+	timer := time.NewTimer(ConnectionAttemptDelay)
+	defer timer.Stop()
+	var result dialResult
+	for running > 0 {
+		select {
+		case r := <-resultC:
+			running--
+			if r.err == nil {
+				result = r
+				close(stopC)
+				// Wait for cancelled attempts and close the connections that are completed meanwhile.
+				for ; running > 0; running-- {
+					if r = <-resultC; r.err == nil {
+						r.conn.Close()
+					}
+				}
+				return result
+			}
+			result = r
+			if next < len(addrs) {
+				startNext()
+				timer.Reset(ConnectionAttemptDelay)
+			}
+		case <-timer.C:
+			if next < len(addrs) {
+				startNext()
+				timer.Reset(ConnectionAttemptDelay)
+			}
+		case <-h.closeC:
+			close(stopC)
+			for ; running > 0; running-- {
+				if r := <-resultC; r.err == nil {
+					r.conn.Close()
+				}
+			}
+			return dialResult{err: errClosed}
+		}
+	}
+	close(stopC)
+	return result
+}
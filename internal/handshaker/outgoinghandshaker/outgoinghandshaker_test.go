@@ -0,0 +1,107 @@
+package outgoinghandshaker
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/peersource"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	addr6 = &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 6881}
+	addr4 = &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 6881}
+)
+
+type fakeDialer struct {
+	m       sync.Mutex
+	started map[string]time.Time
+	// Addresses that do not respond until the attempt is cancelled.
+	hang map[string]bool
+	// Addresses that are refused immediately.
+	refuse map[string]bool
+}
+
+func newFakeDialer() *fakeDialer {
+	return &fakeDialer{
+		started: make(map[string]time.Time),
+		hang:    make(map[string]bool),
+		refuse:  make(map[string]bool),
+	}
+}
+
+func (d *fakeDialer) dial(addr *net.TCPAddr, stopC chan struct{}) dialResult {
+	d.m.Lock()
+	d.started[addr.String()] = time.Now()
+	d.m.Unlock()
+	if d.hang[addr.String()] {
+		<-stopC
+		return dialResult{err: errClosed}
+	}
+	if d.refuse[addr.String()] {
+		return dialResult{err: errors.New("connection refused")}
+	}
+	c1, c2 := net.Pipe()
+	c2.Close()
+	return dialResult{conn: c1}
+}
+
+func TestRaceFallbackAfterDelay(t *testing.T) {
+	d := newFakeDialer()
+	d.hang[addr6.String()] = true
+	h := New(addr6, peersource.Manual, nil, addr4)
+	begin := time.Now()
+	r := h.race(d.dial)
+	assert.Nil(t, r.err)
+	assert.NotNil(t, r.conn)
+	r.conn.Close()
+	assert.True(t, d.started[addr4.String()].Sub(begin) >= ConnectionAttemptDelay)
+}
+
+func TestRaceFallbackAfterFailure(t *testing.T) {
+	d := newFakeDialer()
+	d.refuse[addr6.String()] = true
+	h := New(addr6, peersource.Manual, nil, addr4)
+	r := h.race(d.dial)
+	assert.Nil(t, r.err)
+	r.conn.Close()
+	// Next address is dialed without waiting when the previous attempt fails.
+	assert.True(t, d.started[addr4.String()].Sub(d.started[addr6.String()]) < ConnectionAttemptDelay)
+}
+
+func TestRaceFirstAddressWins(t *testing.T) {
+	d := newFakeDialer()
+	h := New(addr6, peersource.Manual, nil, addr4)
+	r := h.race(d.dial)
+	assert.Nil(t, r.err)
+	r.conn.Close()
+	_, ok := d.started[addr4.String()]
+	assert.False(t, ok)
+}
+
+func TestRaceAllFail(t *testing.T) {
+	d := newFakeDialer()
+	d.refuse[addr6.String()] = true
+	d.refuse[addr4.String()] = true
+	h := New(addr6, peersource.Manual, nil, addr4)
+	r := h.race(d.dial)
+	assert.NotNil(t, r.err)
+	assert.Nil(t, r.conn)
+}
+
+func TestRaceClose(t *testing.T) {
+	d := newFakeDialer()
+	d.hang[addr6.String()] = true
+	d.hang[addr4.String()] = true
+	h := New(addr6, peersource.Manual, nil, addr4)
+	go func() {
+		time.Sleep(2 * ConnectionAttemptDelay)
+		close(h.closeC)
+	}()
+	r := h.race(d.dial)
+	assert.Equal(t, errClosed, r.err)
+	assert.Len(t, d.started, 2)
+}
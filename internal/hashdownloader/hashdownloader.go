@@ -0,0 +1,230 @@
+// Package hashdownloader implements downloading of piece layers of v2 torrents from peers (BEP 52).
+package hashdownloader
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/cenkalti/rain/internal/merkle"
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+// MaxHashesPerRequest is the maximum number of hashes in a single request. Peers reject the requests for more hashes.
+const MaxHashesPerRequest = 512
+
+// Number of requests that can be waiting for response from a single peer.
+const maxRequestsPerPeer = 4
+
+var errInvalidHashes = errors.New("received hashes do not match pieces root")
+
+// Peer of a torrent that the hashes are requested from.
+type Peer interface {
+	SendMessage(msg peerprotocol.Message)
+}
+
+// HashDownloader downloads the missing piece layers of a v2 torrent.
+// Layers are requested in chunks with the proof hashes up to the pieces root, so each chunk is verified as soon as it is received.
+type HashDownloader struct {
+	layers  []*layer
+	pending map[Peer][]*chunk
+}
+
+// Layer is a piece layer that is downloaded completely.
+type Layer struct {
+	PiecesRoot []byte
+	Hashes     []byte
+}
+
+type layer struct {
+	root      [32]byte
+	numPieces int
+	width     int
+	// Hashes in the layer padded up to width.
+	hashes    []byte
+	chunks    []*chunk
+	remaining int
+}
+
+type chunk struct {
+	layer *layer
+	msg   peerprotocol.HashRequestMessage
+	done  bool
+	// Peer that the chunk is requested from, nil if the chunk is free to be requested.
+	peer        Peer
+	requestedAt time.Time
+	// Peers that rejected the request or did not respond in time.
+	failed map[Peer]struct{}
+}
+
+// New returns a new HashDownloader for the piece layers that are missing in info.
+func New(info *metainfo.Info) *HashDownloader {
+	d := &HashDownloader{
+		pending: make(map[Peer][]*chunk),
+	}
+	baseLayer := uint32(merkle.Log2(int(info.PieceLength / merkle.BlockSize)))
+	pad := info.PieceLayerPad()
+	for _, pl := range info.PieceLayers() {
+		if pl.Hashes != nil {
+			continue
+		}
+		l := &layer{
+			numPieces: int(pl.NumPieces),
+			width:     merkle.NextPowerOfTwo(int(pl.NumPieces)),
+		}
+		copy(l.root[:], pl.PiecesRoot)
+		l.hashes = make([]byte, l.width*merkle.HashSize)
+		for i := l.numPieces * merkle.HashSize; i < len(l.hashes); i += merkle.HashSize {
+			copy(l.hashes[i:], pad)
+		}
+		length := l.width
+		if length > MaxHashesPerRequest {
+			length = MaxHashesPerRequest
+		}
+		// Chunks that contain only padding are not requested.
+		for index := 0; index < l.numPieces; index += length {
+			l.chunks = append(l.chunks, &chunk{
+				layer: l,
+				msg: peerprotocol.HashRequestMessage{
+					PiecesRoot:  l.root,
+					BaseLayer:   baseLayer,
+					Index:       uint32(index),
+					Length:      uint32(length),
+					ProofLayers: uint32(merkle.Log2(l.width)),
+				},
+				failed: make(map[Peer]struct{}),
+			})
+		}
+		l.remaining = len(l.chunks)
+		d.layers = append(d.layers, l)
+	}
+	return d
+}
+
+// Done returns true if all piece layers are downloaded.
+func (d *HashDownloader) Done() bool {
+	for _, l := range d.layers {
+		if l.remaining > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Layers returns the downloaded piece layers.
+func (d *HashDownloader) Layers() []Layer {
+	ret := make([]Layer, 0, len(d.layers))
+	for _, l := range d.layers {
+		if l.remaining > 0 {
+			continue
+		}
+		ret = append(ret, Layer{
+			PiecesRoot: l.root[:],
+			Hashes:     l.hashes[:l.numPieces*merkle.HashSize],
+		})
+	}
+	return ret
+}
+
+// RequestHashes sends hash requests to the peer for the chunks that are not requested from other peers.
+func (d *HashDownloader) RequestHashes(pe Peer, now time.Time) {
+	for _, l := range d.layers {
+		for _, c := range l.chunks {
+			if len(d.pending[pe]) >= maxRequestsPerPeer {
+				return
+			}
+			if c.done || c.peer != nil {
+				continue
+			}
+			if _, ok := c.failed[pe]; ok {
+				continue
+			}
+			c.peer = pe
+			c.requestedAt = now
+			d.pending[pe] = append(d.pending[pe], c)
+			pe.SendMessage(c.msg)
+		}
+	}
+}
+
+// GotHashes must be called when a hashes message is received from the peer.
+// Hashes that are not requested from the peer are ignored. An error is returned if the hashes cannot be verified.
+func (d *HashDownloader) GotHashes(pe Peer, msg peerprotocol.HashesMessage) error {
+	c := d.removePending(pe, msg.HashRequestMessage)
+	if c == nil {
+		return nil
+	}
+	l := c.layer
+	length := int(c.msg.Length)
+	numUncles := int(c.msg.ProofLayers) - merkle.Log2(length)
+	if len(msg.Hashes) != (length+numUncles)*merkle.HashSize {
+		c.failed[pe] = struct{}{}
+		return errInvalidHashes
+	}
+	hashes := msg.Hashes[:length*merkle.HashSize]
+	uncles := msg.Hashes[length*merkle.HashSize:]
+	if !bytes.Equal(merkle.RootFromProof(hashes, int(c.msg.Index), uncles), l.root[:]) {
+		c.failed[pe] = struct{}{}
+		return errInvalidHashes
+	}
+	copy(l.hashes[int(c.msg.Index)*merkle.HashSize:], hashes)
+	c.done = true
+	l.remaining--
+	return nil
+}
+
+// Rejected must be called when a hash reject message is received from the peer.
+func (d *HashDownloader) Rejected(pe Peer, msg peerprotocol.HashRejectMessage) {
+	c := d.removePending(pe, msg.HashRequestMessage)
+	if c != nil {
+		c.failed[pe] = struct{}{}
+	}
+}
+
+// ClosePeer releases the chunks requested from the peer, so they can be requested from other peers.
+func (d *HashDownloader) ClosePeer(pe Peer) {
+	for _, c := range d.pending[pe] {
+		c.peer = nil
+	}
+	delete(d.pending, pe)
+}
+
+// CheckTimeouts releases the chunks that are not received within timeout and returns the peers that did not respond.
+// Chunks are not requested again from those peers.
+func (d *HashDownloader) CheckTimeouts(now time.Time, timeout time.Duration) []Peer {
+	var peers []Peer
+	for pe, chunks := range d.pending {
+		var timedOut bool
+		// Copy the list because removePending modifies it.
+		for _, c := range append([]*chunk(nil), chunks...) {
+			if now.Sub(c.requestedAt) >= timeout {
+				d.removePending(pe, c.msg)
+				c.failed[pe] = struct{}{}
+				timedOut = true
+			}
+		}
+		if timedOut {
+			peers = append(peers, pe)
+		}
+	}
+	return peers
+}
+
+func (d *HashDownloader) removePending(pe Peer, msg peerprotocol.HashRequestMessage) *chunk {
+	chunks := d.pending[pe]
+	for i, c := range chunks {
+		if c.msg != msg {
+			continue
+		}
+		chunks = append(chunks[:i], chunks[i+1:]...)
+		if len(chunks) == 0 {
+			delete(d.pending, pe)
+		} else {
+			d.pending[pe] = chunks
+		}
+		c.peer = nil
+		return c
+	}
+	return nil
+}
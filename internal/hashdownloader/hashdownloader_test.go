@@ -0,0 +1,113 @@
+package hashdownloader
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/merkle"
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPeer struct {
+	requests []peerprotocol.HashRequestMessage
+}
+
+func (p *testPeer) SendMessage(msg peerprotocol.Message) {
+	p.requests = append(p.requests, msg.(peerprotocol.HashRequestMessage))
+}
+
+func TestHashDownloader(t *testing.T) {
+	const pieceLength = 16 << 10
+	path := filepath.Join("..", "..", "torrent", "testdata", "sample_torrent", "data", "zero.bin")
+	b, pieceLayers, err := metainfo.NewInfoBytesV2("", []string{path}, false, pieceLength, "", logger.New("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := metainfo.NewInfo(b, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = seed.SetPieceLayers(pieceLayers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := seed.PieceLayers()[0]
+	respond := func(req peerprotocol.HashRequestMessage) peerprotocol.HashesMessage {
+		width := merkle.NextPowerOfTwo(int(layer.NumPieces))
+		pad := seed.PieceLayerPad()
+		hashes := make([]byte, int(req.Length)*merkle.HashSize)
+		n := copy(hashes, layer.Hashes[req.Index*merkle.HashSize:])
+		for i := n; i < len(hashes); i += merkle.HashSize {
+			copy(hashes[i:], pad)
+		}
+		numUncles := int(req.ProofLayers) - merkle.Log2(int(req.Length))
+		uncles := merkle.Proof(layer.Hashes, width, pad, int(req.Index), int(req.Length), numUncles)
+		return peerprotocol.HashesMessage{HashRequestMessage: req, Hashes: append(hashes, uncles...)}
+	}
+
+	info, err := metainfo.NewInfo(b, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := New(info)
+	assert.False(t, d.Done())
+	now := time.Now()
+
+	// 640 pieces are requested in two chunks.
+	p1 := &testPeer{}
+	d.RequestHashes(p1, now)
+	assert.Len(t, p1.requests, 2)
+	assert.Equal(t, uint32(0), p1.requests[0].Index)
+	assert.Equal(t, uint32(512), p1.requests[1].Index)
+	assert.Equal(t, uint32(512), p1.requests[0].Length)
+	assert.Equal(t, uint32(10), p1.requests[0].ProofLayers)
+
+	// Chunks are not requested from another peer while they are pending.
+	p2 := &testPeer{}
+	d.RequestHashes(p2, now)
+	assert.Len(t, p2.requests, 0)
+
+	// Invalid hashes are not accepted and the chunk is requested from another peer.
+	bad := respond(p1.requests[0])
+	bad.Hashes[0]++
+	assert.Equal(t, errInvalidHashes, d.GotHashes(p1, bad))
+	d.RequestHashes(p1, now)
+	assert.Len(t, p1.requests, 2)
+	d.RequestHashes(p2, now)
+	assert.Len(t, p2.requests, 1)
+	assert.Nil(t, d.GotHashes(p2, respond(p2.requests[0])))
+
+	// Chunks are released when the request times out.
+	assert.Empty(t, d.CheckTimeouts(now.Add(time.Second), 2*time.Second))
+	assert.Equal(t, []Peer{p1}, d.CheckTimeouts(now.Add(2*time.Second), 2*time.Second))
+	d.RequestHashes(p1, now)
+	assert.Len(t, p1.requests, 2)
+
+	// Rejected chunks are requested from other peers.
+	p3 := &testPeer{}
+	d.RequestHashes(p3, now)
+	assert.Len(t, p3.requests, 1)
+	d.Rejected(p3, peerprotocol.HashRejectMessage{HashRequestMessage: p3.requests[0]})
+	d.RequestHashes(p3, now)
+	assert.Len(t, p3.requests, 1)
+
+	// Chunks of closed peers are requested from other peers.
+	d.RequestHashes(p2, now)
+	assert.Len(t, p2.requests, 2)
+	d.ClosePeer(p2)
+	p4 := &testPeer{}
+	d.RequestHashes(p4, now)
+	assert.Len(t, p4.requests, 1)
+	assert.False(t, d.Done())
+	assert.Nil(t, d.GotHashes(p4, respond(p4.requests[0])))
+	assert.True(t, d.Done())
+
+	layers := d.Layers()
+	assert.Len(t, layers, 1)
+	assert.Nil(t, info.SetPieceLayer(layers[0].PiecesRoot, layers[0].Hashes))
+	assert.Equal(t, layer.Hashes, layers[0].Hashes)
+}
@@ -4,19 +4,89 @@ import "fmt"
 
 const blockSize = 16 * 1024
 
-// InfoDownloader downloads all blocks of a piece from a peer.
-type InfoDownloader struct {
-	Peer  Peer
+// Metadata holds the blocks of info dictionary that are downloaded from multiple peers in parallel.
+type Metadata struct {
 	Bytes []byte
 
-	blocks         []block
-	pending        int // in-flight requests
-	nextBlockIndex uint32
+	blocks     []block
+	downloaded int64
 }
 
 type block struct {
-	size      uint32
-	requested bool
+	size uint32
+	// Downloader that is currently requesting the block, nil if the block is free to be requested.
+	downloader *InfoDownloader
+	// Peer that sent the block.
+	source Peer
+}
+
+// NewMetadata returns a new Metadata for an info dictionary of given size.
+func NewMetadata(size uint32) *Metadata {
+	m := &Metadata{
+		Bytes: make([]byte, size),
+	}
+	m.blocks = createBlocks(size)
+	return m
+}
+
+func createBlocks(size uint32) []block {
+	numBlocks := size / blockSize
+	mod := size % blockSize
+	if mod != 0 {
+		numBlocks++
+	}
+	blocks := make([]block, numBlocks)
+	for i := range blocks {
+		blocks[i] = block{
+			size: blockSize,
+		}
+	}
+	if mod != 0 && len(blocks) > 0 {
+		blocks[len(blocks)-1].size = mod
+	}
+	return blocks
+}
+
+// Size of the info dictionary in bytes.
+func (m *Metadata) Size() int64 {
+	return int64(len(m.Bytes))
+}
+
+// Downloaded returns the number of bytes received so far.
+func (m *Metadata) Downloaded() int64 {
+	return m.downloaded
+}
+
+// Done returns true if all blocks of the metadata is downloaded.
+func (m *Metadata) Done() bool {
+	return m.downloaded == m.Size()
+}
+
+// Sources returns the peers that have sent at least one block.
+func (m *Metadata) Sources() []Peer {
+	seen := make(map[Peer]struct{})
+	var peers []Peer
+	for _, b := range m.blocks {
+		if b.source == nil {
+			continue
+		}
+		if _, ok := seen[b.source]; ok {
+			continue
+		}
+		seen[b.source] = struct{}{}
+		peers = append(peers, b.source)
+	}
+	return peers
+}
+
+// InfoDownloader downloads blocks of the info dictionary from a peer.
+// Blocks are shared with other InfoDownloaders using the same Metadata, so each block is requested from a single peer at a time.
+type InfoDownloader struct {
+	Peer     Peer
+	Metadata *Metadata
+
+	// in-flight requests
+	requested map[uint32]struct{}
 }
 
 // Peer of a torrent.
@@ -26,62 +96,71 @@ type Peer interface {
 }
 
 // New return new InfoDownloader for a single Peer.
-func New(pe Peer) *InfoDownloader {
-	d := &InfoDownloader{
-		Peer:  pe,
-		Bytes: make([]byte, pe.MetadataSize()),
+func New(pe Peer, m *Metadata) *InfoDownloader {
+	return &InfoDownloader{
+		Peer:      pe,
+		Metadata:  m,
+		requested: make(map[uint32]struct{}),
 	}
-	d.blocks = d.createBlocks()
-	return d
 }
 
 // GotBlock must be called when a metadata block is received from the peer.
 func (d *InfoDownloader) GotBlock(index uint32, data []byte) error {
-	if index >= uint32(len(d.blocks)) {
+	m := d.Metadata
+	if index >= uint32(len(m.blocks)) {
 		return fmt.Errorf("peer sent invalid metadata piece index: %q", index)
 	}
-	b := &d.blocks[index]
-	if !b.requested {
+	if _, ok := d.requested[index]; !ok {
 		return fmt.Errorf("peer sent unrequested index for metadata message: %q", index)
 	}
+	b := &m.blocks[index]
 	if uint32(len(data)) != b.size {
 		return fmt.Errorf("peer sent invalid size for metadata message: %q", len(data))
 	}
-	d.pending--
+	delete(d.requested, index)
+	if b.source != nil {
+		// Block is already received from another peer after this peer has timed out.
+		return nil
+	}
 	begin := index * blockSize
 	end := begin + b.size
-	copy(d.Bytes[begin:end], data)
+	copy(m.Bytes[begin:end], data)
+	b.downloader = nil
+	b.source = d.Peer
+	m.downloaded += int64(b.size)
 	return nil
 }
 
-func (d *InfoDownloader) createBlocks() []block {
-	numBlocks := d.Peer.MetadataSize() / blockSize
-	mod := d.Peer.MetadataSize() % blockSize
-	if mod != 0 {
-		numBlocks++
-	}
-	blocks := make([]block, numBlocks)
-	for i := range blocks {
-		blocks[i] = block{
-			size: blockSize,
+// RequestBlocks is called to request remaining blocks of metadata from the peer.
+// Blocks that are being requested from other peers are skipped.
+func (d *InfoDownloader) RequestBlocks(queueLength int) {
+	m := d.Metadata
+	for i := range m.blocks {
+		if len(d.requested) >= queueLength {
+			return
 		}
+		b := &m.blocks[i]
+		if b.source != nil || b.downloader != nil {
+			continue
+		}
+		d.Peer.RequestMetadataPiece(uint32(i))
+		b.downloader = d
+		d.requested[uint32(i)] = struct{}{}
 	}
-	if mod != 0 && len(blocks) > 0 {
-		blocks[len(blocks)-1].size = mod
-	}
-	return blocks
 }
 
-// RequestBlocks is called to request remaining blocks of metadata from the peer.
-func (d *InfoDownloader) RequestBlocks(queueLength int) {
-	for ; d.nextBlockIndex < uint32(len(d.blocks)) && d.pending < queueLength; d.nextBlockIndex++ {
-		d.Peer.RequestMetadataPiece(d.nextBlockIndex)
-		d.blocks[d.nextBlockIndex].requested = true
-		d.pending++
+// Release the blocks requested by this downloader so they can be requested from other peers.
+// Blocks received after calling Release are still accepted.
+func (d *InfoDownloader) Release() {
+	for i := range d.Metadata.blocks {
+		b := &d.Metadata.blocks[i]
+		if b.downloader == d {
+			b.downloader = nil
+		}
 	}
 }
 
-// Done returns true if all pieces of the metadata is downloaded.
-func (d *InfoDownloader) Done() bool {
-	return d.nextBlockIndex == uint32(len(d.blocks)) && d.pending == 0
+// Pending returns the number of in-flight requests.
+func (d *InfoDownloader) Pending() int {
+	return len(d.requested)
 }
@@ -17,45 +17,73 @@ func (p *TestPeer) RequestMetadataPiece(index uint32) {
 
 func TestInfoDownloader(t *testing.T) {
 	p := &TestPeer{}
-	d := New(p)
-	assert.Equal(t, 11, len(d.blocks))
-	assert.False(t, d.Done())
+	m := NewMetadata(p.MetadataSize())
+	d := New(p, m)
+	assert.Equal(t, 11, len(m.blocks))
+	assert.False(t, m.Done())
 
 	d.RequestBlocks(4)
-	assert.Equal(t, 4, d.pending)
-	assert.False(t, d.Done())
+	assert.Equal(t, 4, d.Pending())
+	assert.False(t, m.Done())
 	assert.Equal(t, []uint32{0, 1, 2, 3}, p.requested)
 
 	d.RequestBlocks(4)
-	assert.Equal(t, 4, d.pending)
+	assert.Equal(t, 4, d.Pending())
 	assert.Equal(t, []uint32{0, 1, 2, 3}, p.requested)
 
 	assert.Nil(t, d.GotBlock(0, make([]byte, blockSize)))
-	assert.Equal(t, 3, d.pending)
+	assert.Equal(t, 3, d.Pending())
 	d.RequestBlocks(4)
-	assert.Equal(t, 4, d.pending)
+	assert.Equal(t, 4, d.Pending())
 	assert.Equal(t, []uint32{0, 1, 2, 3, 4}, p.requested)
 
 	d.GotBlock(1, make([]byte, blockSize))
 	d.GotBlock(2, make([]byte, blockSize))
 	d.GotBlock(3, make([]byte, blockSize))
 	d.GotBlock(4, make([]byte, blockSize))
-	assert.Equal(t, 0, d.pending)
+	assert.Equal(t, 0, d.Pending())
 	d.RequestBlocks(4)
-	assert.Equal(t, 4, d.pending)
+	assert.Equal(t, 4, d.Pending())
 	assert.Equal(t, []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8}, p.requested)
 
-	println("---")
 	d.GotBlock(5, make([]byte, blockSize))
 	d.GotBlock(6, make([]byte, blockSize))
 	d.GotBlock(7, make([]byte, blockSize))
 	d.GotBlock(8, make([]byte, blockSize))
-	assert.Equal(t, 0, d.pending)
+	assert.Equal(t, 0, d.Pending())
 	d.RequestBlocks(4)
-	assert.Equal(t, 2, d.pending)
-	assert.False(t, d.Done())
+	assert.Equal(t, 2, d.Pending())
+	assert.False(t, m.Done())
 
 	d.GotBlock(9, make([]byte, blockSize))
 	d.GotBlock(10, make([]byte, 42))
-	assert.True(t, d.Done())
+	assert.True(t, m.Done())
+	assert.Equal(t, int64(p.MetadataSize()), m.Downloaded())
+}
+
+func TestInfoDownloaderMultiplePeers(t *testing.T) {
+	p1 := &TestPeer{}
+	p2 := &TestPeer{}
+	m := NewMetadata(p1.MetadataSize())
+	d1 := New(p1, m)
+	d2 := New(p2, m)
+
+	d1.RequestBlocks(4)
+	d2.RequestBlocks(4)
+	assert.Equal(t, []uint32{0, 1, 2, 3}, p1.requested)
+	assert.Equal(t, []uint32{4, 5, 6, 7}, p2.requested)
+
+	// p1 times out, its blocks are requested from p2.
+	d1.Release()
+	for i := uint32(4); i < 8; i++ {
+		assert.Nil(t, d2.GotBlock(i, make([]byte, blockSize)))
+	}
+	d2.RequestBlocks(4)
+	assert.Equal(t, []uint32{4, 5, 6, 7, 0, 1, 2, 3}, p2.requested)
+
+	// Late block from p1 is accepted, duplicate from p2 is ignored.
+	assert.Nil(t, d1.GotBlock(0, make([]byte, blockSize)))
+	assert.Nil(t, d2.GotBlock(0, make([]byte, blockSize)))
+	assert.Equal(t, int64(5*blockSize), m.Downloaded())
+	assert.Len(t, m.Sources(), 2)
 }
@@ -0,0 +1,99 @@
+package jsonrpc2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// Doer sends HTTP requests. *http.Client implements this interface.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DoerFunc is an adapter to allow the use of ordinary functions as Doer.
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Client calls methods of a JSON-RPC 2.0 server over HTTP.
+// It is safe for concurrent use.
+type Client struct {
+	url  string
+	doer Doer
+	seq  uint64
+}
+
+// NewHTTPClient returns a new Client that sends requests to url with doer.
+// The requests given to doer are ready to be sent, doer may change them, e.g. for adding headers.
+func NewHTTPClient(url string, doer Doer) *Client {
+	if doer == nil {
+		doer = http.DefaultClient
+	}
+	return &Client{
+		url:  url,
+		doer: doer,
+	}
+}
+
+// Call invokes the named method with params and decodes the result into reply.
+// Params are omitted from the request if nil. Errors returned from the server are of type *Error.
+func (c *Client) Call(method string, params, reply interface{}) error {
+	req := request{
+		Version: version,
+		Method:  method,
+		ID:      json.RawMessage(strconv.FormatUint(atomic.AddUint64(&c.seq, 1), 10)),
+	}
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = b
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	httpReq.Header.Set("Accept", contentType)
+	httpResp, err := c.doer.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(httpResp.Body, 32<<10))
+		return fmt.Errorf("bad HTTP status: %s", httpResp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type")); mediaType != contentType {
+		return fmt.Errorf("bad HTTP content type: %s", httpResp.Header.Get("Content-Type"))
+	}
+	var resp response
+	err = json.NewDecoder(httpResp.Body).Decode(&resp)
+	if err != nil {
+		return fmt.Errorf("bad response: %w", err)
+	}
+	if !bytes.Equal(resp.ID, req.ID) {
+		return fmt.Errorf("bad response id: %s", resp.ID)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if reply == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, reply)
+}
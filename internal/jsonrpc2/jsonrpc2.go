@@ -0,0 +1,59 @@
+// Package jsonrpc2 implements JSON-RPC 2.0 over HTTP for net/rpc servers and a client for calling them.
+package jsonrpc2
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	version     = "2.0"
+	contentType = "application/json"
+)
+
+// Error codes defined by the JSON-RPC 2.0 specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeServerError    = -32000
+)
+
+// Error is the error object in JSON-RPC 2.0 responses.
+// Methods of the server may return an Error to send a custom error code to the client.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// NewError returns an Error with given code and message.
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Error returns the JSON representation of the error.
+// net/rpc passes only the string of an error to the codec, so the server decodes the error back from this string.
+func (e *Error) Error() string {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Sprintf(`{"code":%d,"message":%q}`, e.Code, e.Message)
+	}
+	return string(b)
+}
+
+type request struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
@@ -0,0 +1,109 @@
+package jsonrpc2
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Arith struct{}
+
+type Args struct {
+	A, B int
+}
+
+func (Arith) Add(args Args, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (Arith) Div(args Args, reply *int) error {
+	if args.B == 0 {
+		return NewError(1, "division by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func (Arith) Fail(args Args, reply *int) error {
+	return errors.New("failed")
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	srv := rpc.NewServer()
+	err := srv.Register(Arith{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(HTTPHandler(srv))
+}
+
+func TestCall(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	clt := NewHTTPClient(ts.URL, nil)
+
+	var reply int
+	err := clt.Call("Arith.Add", Args{A: 1, B: 2}, &reply)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, reply)
+
+	err = clt.Call("Arith.Div", Args{A: 1}, &reply)
+	assert.Equal(t, NewError(1, "division by zero"), err)
+
+	err = clt.Call("Arith.Fail", Args{}, &reply)
+	assert.Equal(t, NewError(CodeServerError, "failed"), err)
+
+	err = clt.Call("Arith.Missing", nil, &reply)
+	var e *Error
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, CodeMethodNotFound, e.Code)
+	}
+
+	err = clt.Call("Arith.Add", []int{1}, &reply)
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, CodeInvalidParams, e.Code)
+	}
+}
+
+func TestBatchAndNotification(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	post := func(body string) (int, string) {
+		resp, err := http.Post(ts.URL, contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, strings.TrimSpace(string(b))
+	}
+
+	code, body := post(`{"jsonrpc":"2.0","method":"Arith.Add","params":{"A":1,"B":2}}`)
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Empty(t, body)
+
+	code, body = post(`[{"jsonrpc":"2.0","method":"Arith.Add","params":{"A":1,"B":2},"id":1},` +
+		`{"jsonrpc":"2.0","method":"Arith.Add","params":{"A":3,"B":4}},` +
+		`{"jsonrpc":"2.0","method":"Arith.Add","params":{"A":5,"B":6},"id":"x"}]`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `[{"jsonrpc":"2.0","id":1,"result":3},{"jsonrpc":"2.0","id":"x","result":11}]`, body)
+
+	code, body = post(`{"jsonrpc":"2.0","method":"Arith.Add"`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"code":-32700`)
+
+	code, body = post(`{"method":"Arith.Add","id":1}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"code":-32600`)
+}
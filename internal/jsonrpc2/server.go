@@ -0,0 +1,154 @@
+package jsonrpc2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/rpc"
+	"strings"
+)
+
+var null = json.RawMessage("null")
+
+type httpHandler struct {
+	rpc *rpc.Server
+}
+
+// HTTPHandler returns a handler that executes JSON-RPC 2.0 requests in the body of POST requests with srv.
+// Batch requests are supported. Requests without an ID are notifications and are not replied.
+func HTTPHandler(srv *rpc.Server) http.Handler {
+	return &httpHandler{rpc: srv}
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != contentType {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var reply interface{}
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		var batch []json.RawMessage
+		if err = json.Unmarshal(b, &batch); err != nil {
+			reply = errorResponse(null, NewError(CodeParseError, err.Error()))
+		} else if len(batch) == 0 {
+			reply = errorResponse(null, NewError(CodeInvalidRequest, "empty batch"))
+		} else {
+			replies := make([]*response, 0, len(batch))
+			for _, raw := range batch {
+				if resp := h.serve(raw); resp != nil {
+					replies = append(replies, resp)
+				}
+			}
+			if len(replies) > 0 {
+				reply = replies
+			}
+		}
+	} else if resp := h.serve(b); resp != nil {
+		reply = resp
+	}
+	if reply == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	_ = json.NewEncoder(w).Encode(reply)
+}
+
+// serve executes a single request and returns the response to send, or nil for notifications.
+func (h *httpHandler) serve(raw json.RawMessage) *response {
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return errorResponse(null, NewError(CodeParseError, err.Error()))
+		}
+		return errorResponse(null, NewError(CodeInvalidRequest, err.Error()))
+	}
+	if req.Version != version || req.Method == "" {
+		return errorResponse(req.ID, NewError(CodeInvalidRequest, "invalid request"))
+	}
+	codec := &serverCodec{req: &req}
+	_ = h.rpc.ServeRequest(codec)
+	if req.ID == nil {
+		return nil
+	}
+	if codec.resp == nil {
+		return errorResponse(req.ID, NewError(CodeInternalError, "no response"))
+	}
+	return codec.resp
+}
+
+func errorResponse(id json.RawMessage, err *Error) *response {
+	if id == nil {
+		id = null
+	}
+	return &response{Version: version, ID: id, Error: err}
+}
+
+// serverCodec reads a single request and keeps the response for it.
+type serverCodec struct {
+	req  *request
+	resp *response
+}
+
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	r.ServiceMethod = c.req.Method
+	r.Seq = 0
+	return nil
+}
+
+func (c *serverCodec) ReadRequestBody(x interface{}) error {
+	if x == nil || len(c.req.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(c.req.Params, x); err != nil {
+		return NewError(CodeInvalidParams, err.Error())
+	}
+	return nil
+}
+
+func (c *serverCodec) WriteResponse(r *rpc.Response, x interface{}) error {
+	if r.Error != "" {
+		c.resp = errorResponse(c.req.ID, parseError(r.Error))
+		return nil
+	}
+	result, err := json.Marshal(x)
+	if err != nil {
+		c.resp = errorResponse(c.req.ID, NewError(CodeInternalError, err.Error()))
+		return nil
+	}
+	c.resp = &response{Version: version, ID: c.req.ID, Result: result}
+	return nil
+}
+
+func (c *serverCodec) Close() error {
+	return nil
+}
+
+// parseError converts the error string given by net/rpc to an Error.
+func parseError(s string) *Error {
+	if strings.HasPrefix(s, "{") {
+		var e Error
+		if json.Unmarshal([]byte(s), &e) == nil && e.Message != "" {
+			return &e
+		}
+	}
+	if strings.HasPrefix(s, "rpc: can't find") || strings.HasPrefix(s, "rpc: service/method request ill-formed") {
+		return NewError(CodeMethodNotFound, s)
+	}
+	return NewError(CodeServerError, s)
+}
@@ -0,0 +1,168 @@
+// Package lsd implements Local Service Discovery for finding peers in the local network.
+// http://bittorrent.org/beps/bep_0014.html
+package lsd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/cenkalti/rain/internal/logger"
+)
+
+// Only IPv4 is supported for now.
+const multicastAddr = "239.192.152.143:6771"
+
+const searchLine = "BT-SEARCH * HTTP/1.1"
+
+// Peer is a peer found in the local network.
+type Peer struct {
+	InfoHash [20]byte
+	Addr     *net.TCPAddr
+}
+
+// LSD announces torrents to the local network and receives the announces of other clients.
+type LSD struct {
+	conn   *net.UDPConn
+	group  *net.UDPAddr
+	cookie string
+	peersC chan Peer
+	closeC chan struct{}
+	doneC  chan struct{}
+	log    logger.Logger
+}
+
+// New joins the LSD multicast group.
+// cookie is sent in announces and used for ignoring the announces of the same client.
+func New(cookie string, l logger.Logger) (*LSD, error) {
+	group, err := net.ResolveUDPAddr("udp4", multicastAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return nil, err
+	}
+	return &LSD{
+		conn:   conn,
+		group:  group,
+		cookie: cookie,
+		peersC: make(chan Peer, 100),
+		closeC: make(chan struct{}),
+		doneC:  make(chan struct{}),
+		log:    l,
+	}, nil
+}
+
+// Peers returns the channel that the peers found are sent to.
+// Peers are dropped if the channel is full.
+func (l *LSD) Peers() <-chan Peer {
+	return l.peersC
+}
+
+// Announce sends an announce for the torrent that accepts peer connections at port.
+func (l *LSD) Announce(infoHash [20]byte, port int) error {
+	_, err := l.conn.WriteToUDP(formatAnnounce(infoHash, port, l.cookie), l.group)
+	return err
+}
+
+// Run reads the announces from the network until LSD is closed. Invoke with go statement.
+func (l *LSD) Run() {
+	defer close(l.doneC)
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-l.closeC:
+			default:
+				l.log.Errorln("cannot read lsd message:", err)
+			}
+			return
+		}
+		port, cookie, infoHashes, err := parseAnnounce(buf[:n])
+		if err != nil {
+			l.log.Debugf("invalid lsd message from %s: %s", from, err)
+			continue
+		}
+		if cookie != "" && cookie == l.cookie {
+			continue
+		}
+		addr := &net.TCPAddr{IP: from.IP, Port: port}
+		for _, ih := range infoHashes {
+			select {
+			case l.peersC <- Peer{InfoHash: ih, Addr: addr}:
+			default:
+			}
+		}
+	}
+}
+
+// Close leaves the multicast group and waits for Run to return.
+func (l *LSD) Close() {
+	close(l.closeC)
+	l.conn.Close()
+	<-l.doneC
+}
+
+func formatAnnounce(infoHash [20]byte, port int, cookie string) []byte {
+	var b bytes.Buffer
+	b.WriteString(searchLine + "\r\n")
+	b.WriteString("Host: " + multicastAddr + "\r\n")
+	b.WriteString("Port: " + strconv.Itoa(port) + "\r\n")
+	b.WriteString("Infohash: " + hex.EncodeToString(infoHash[:]) + "\r\n")
+	if cookie != "" {
+		b.WriteString("cookie: " + cookie + "\r\n")
+	}
+	b.WriteString("\r\n\r\n")
+	return b.Bytes()
+}
+
+func parseAnnounce(b []byte) (port int, cookie string, infoHashes [][20]byte, err error) {
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(b)))
+	line, err := r.ReadLine()
+	if err != nil {
+		return
+	}
+	if line != searchLine {
+		err = errors.New("invalid request line")
+		return
+	}
+	header, err := r.ReadMIMEHeader()
+	if err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	port, err = strconv.Atoi(header.Get("Port"))
+	if err != nil || port <= 0 || port > 65535 {
+		err = errors.New("invalid port")
+		return
+	}
+	for _, value := range header.Values("Infohash") {
+		value = strings.TrimSpace(value)
+		var ih [20]byte
+		if len(value) != hex.EncodedLen(len(ih)) {
+			err = errors.New("invalid info hash")
+			return
+		}
+		_, err = hex.Decode(ih[:], []byte(value))
+		if err != nil {
+			return
+		}
+		infoHashes = append(infoHashes, ih)
+	}
+	if len(infoHashes) == 0 {
+		err = errors.New("no info hash")
+		return
+	}
+	cookie = header.Get("Cookie")
+	return
+}
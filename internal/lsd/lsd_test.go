@@ -0,0 +1,92 @@
+package lsd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+)
+
+func TestAnnounce(t *testing.T) {
+	var ih [20]byte
+	copy(ih[:], "01234567890123456789")
+	b := formatAnnounce(ih, 6881, "abc")
+	port, cookie, infoHashes, err := parseAnnounce(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != 6881 {
+		t.Fatalf("invalid port: %d", port)
+	}
+	if cookie != "abc" {
+		t.Fatalf("invalid cookie: %q", cookie)
+	}
+	if len(infoHashes) != 1 || infoHashes[0] != ih {
+		t.Fatalf("invalid info hashes: %v", infoHashes)
+	}
+}
+
+func TestParseAnnounce(t *testing.T) {
+	msg := "BT-SEARCH * HTTP/1.1\r\n" +
+		"Host: 239.192.152.143:6771\r\n" +
+		"Port: 51413\r\n" +
+		"Infohash: 3031323334353637383930313233343536373839\r\n" +
+		"Infohash: 3131323334353637383930313233343536373839\r\n" +
+		"\r\n\r\n"
+	port, cookie, infoHashes, err := parseAnnounce([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != 51413 || cookie != "" || len(infoHashes) != 2 {
+		t.Fatalf("invalid announce: %d %q %v", port, cookie, infoHashes)
+	}
+	invalid := []string{
+		"M-SEARCH * HTTP/1.1\r\nPort: 51413\r\nInfohash: 3031323334353637383930313233343536373839\r\n\r\n",
+		"BT-SEARCH * HTTP/1.1\r\nPort: 0\r\nInfohash: 3031323334353637383930313233343536373839\r\n\r\n",
+		"BT-SEARCH * HTTP/1.1\r\nPort: 51413\r\nInfohash: 30313233\r\n\r\n",
+		"BT-SEARCH * HTTP/1.1\r\nPort: 51413\r\nInfohash: 303132333435363738393031323334353637383930\r\n\r\n",
+		"BT-SEARCH * HTTP/1.1\r\nPort: 51413\r\n\r\n",
+	}
+	for _, msg := range invalid {
+		if _, _, _, err = parseAnnounce([]byte(msg)); err == nil {
+			t.Errorf("message must be invalid: %q", msg)
+		}
+	}
+}
+
+func TestLSD(t *testing.T) {
+	l, err := New("cookie1", logger.New("lsd"))
+	if err != nil {
+		t.Skip("multicast is not available:", err)
+	}
+	go l.Run()
+	defer l.Close()
+
+	// Multicast messages may not be delivered in test environment, so messages are sent to the socket directly.
+	conn, err := net.Dial("udp4", "127.0.0.1:6771")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var ih [20]byte
+	copy(ih[:], "01234567890123456789")
+	// Own announces are ignored.
+	_, err = conn.Write(formatAnnounce(ih, 6882, "cookie1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Write(formatAnnounce(ih, 6881, "cookie2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-l.Peers():
+		if p.InfoHash != ih || p.Addr.String() != "127.0.0.1:6881" {
+			t.Fatalf("invalid peer: %+v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("peer is not received")
+	}
+}
@@ -15,10 +15,14 @@ import (
 
 // Magnet link contains the information to download torrent metadata from network.
 type Magnet struct {
+	// InfoHash of v2 torrents is the SHA-256 info hash truncated to 20 bytes (BEP 52).
 	InfoHash [20]byte
-	Name     string
-	Trackers [][]string
-	Peers    []string
+	// InfoHashV2 is the full SHA-256 info hash of a v2 only torrent.
+	// If set, String returns a "btmh" link instead of "btih".
+	InfoHashV2 []byte
+	Name       string
+	Trackers   [][]string
+	Peers      []string
 }
 
 // New parses the string and returns new Magnet.
@@ -41,11 +45,24 @@ func New(s string) (*Magnet, error) {
 	if len(xts) == 0 {
 		return nil, errors.New("empty xt param")
 	}
-	xt := xts[0]
 
 	var magnet Magnet
-	magnet.InfoHash, err = infoHashString(xt)
-	if err != nil {
+	// Magnet links of hybrid torrents contain both v1 (btih) and v2 (btmh) info hashes.
+	// The v1 info hash is preferred because it is known by both v1 and v2 peers in the swarm.
+	var found bool
+	for _, xt := range xts {
+		ih, v2, err2 := infoHashString(xt)
+		if err2 != nil {
+			err = err2
+			continue
+		}
+		if !found || magnet.InfoHashV2 != nil && v2 == nil {
+			magnet.InfoHash = ih
+			magnet.InfoHashV2 = v2
+			found = true
+		}
+	}
+	if !found {
 		return nil, err
 	}
 
@@ -83,8 +100,14 @@ func New(s string) (*Magnet, error) {
 func (m *Magnet) String() string {
 	var b strings.Builder
 	b.Grow(2048)
-	b.WriteString("magnet:?xt=urn:btih:")
-	b.WriteString(hex.EncodeToString(m.InfoHash[:]))
+	if m.InfoHashV2 != nil {
+		mh, _ := multihash.Encode(m.InfoHashV2, multihash.SHA2_256)
+		b.WriteString("magnet:?xt=urn:btmh:")
+		b.WriteString(hex.EncodeToString(mh))
+	} else {
+		b.WriteString("magnet:?xt=urn:btih:")
+		b.WriteString(hex.EncodeToString(m.InfoHash[:]))
+	}
 	if m.Name != "" {
 		b.WriteString("&dn=")
 		b.WriteString(url.QueryEscape(m.Name))
@@ -116,7 +139,8 @@ type trackerTier struct {
 
 // infoHashString returns a new info hash value from a string.
 // s must be 40 (hex encoded) or 32 (base32 encoded) characters, otherwise it returns error.
-func infoHashString(xt string) ([20]byte, error) {
+// For v2 info hashes, the full SHA-256 hash is returned as the second value.
+func infoHashString(xt string) ([20]byte, []byte, error) {
 	var ih [20]byte
 	var b []byte
 	var err error
@@ -129,23 +153,38 @@ func infoHashString(xt string) ([20]byte, error) {
 		case 32:
 			b, err = base32.StdEncoding.DecodeString(xt)
 		default:
-			return ih, errors.New("info hash must be 32 or 40 characters")
+			return ih, nil, errors.New("info hash must be 32 or 40 characters")
 		}
 		if err != nil {
-			return ih, err
+			return ih, nil, err
 		}
 	case strings.HasPrefix(xt, "urn:btmh:"):
 		xt = xt[9:]
-		b, err = multihash.FromHexString(xt)
+		var mh multihash.Multihash
+		mh, err = multihash.FromHexString(xt)
 		if err != nil {
-			return ih, err
+			return ih, nil, err
+		}
+		var dh *multihash.DecodedMultihash
+		dh, err = multihash.Decode(mh)
+		if err != nil {
+			return ih, nil, err
+		}
+		// BEP 52: v2 info hashes are SHA-256 multihashes. They are truncated to 20 bytes in the peer protocol.
+		if dh.Code == multihash.SHA2_256 {
+			if len(dh.Digest) != 32 {
+				return ih, nil, errors.New("invalid multihash (len != 32)")
+			}
+			copy(ih[:], dh.Digest)
+			return ih, dh.Digest, nil
 		}
+		b = dh.Digest
 		if len(b) != 20 {
-			return ih, errors.New("invalid multihash (len != 20)")
+			return ih, nil, errors.New("invalid multihash (len != 20)")
 		}
 	default:
-		return ih, errors.New("invalid xt param: must start with \"urn:btih:\" or \"urn:btmh\"")
+		return ih, nil, errors.New("invalid xt param: must start with \"urn:btih:\" or \"urn:btmh\"")
 	}
 	copy(ih[:], b)
-	return ih, nil
+	return ih, nil, nil
 }
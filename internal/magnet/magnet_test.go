@@ -31,3 +31,31 @@ func TestParse(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestParseHybrid(t *testing.T) {
+	v2 := "urn:btmh:1220caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e"
+	u := "magnet:?xt=" + v2 + "&xt=urn:btih:631a31dd0a46257d5078c0dee4e66e26f73e42ac&dn=bittorrent-v2-hybrid-test"
+	m, err := New(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(m.InfoHash[:]) != "631a31dd0a46257d5078c0dee4e66e26f73e42ac" {
+		t.Fatal("invalid info hash")
+	}
+	if m.InfoHashV2 != nil {
+		t.Fatal("v1 info hash must be preferred")
+	}
+	m, err = New("magnet:?xt=" + v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(m.InfoHash[:]) != "caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa" {
+		t.Fatal("invalid truncated v2 info hash")
+	}
+	if hex.EncodeToString(m.InfoHashV2) != "caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e" {
+		t.Fatal("invalid v2 info hash")
+	}
+	if m.String() != "magnet:?xt="+v2 {
+		t.Fatal("invalid magnet string", m.String())
+	}
+}
@@ -0,0 +1,140 @@
+// Package merkle implements the SHA-256 merkle trees of BitTorrent v2 (BEP 52).
+//
+// Leaves of a tree are the hashes of 16 KiB blocks of a file.
+// Layers are padded to a power of two with the roots of subtrees of zero leaves.
+package merkle
+
+import (
+	"crypto/sha256"
+)
+
+// BlockSize is the size of the data hashed into a single leaf.
+const BlockSize = 16 * 1024
+
+// HashSize is the size of a node in the tree.
+const HashSize = sha256.Size
+
+// PadHash returns the root of a subtree with 2^height leaves of zero hashes.
+func PadHash(height int) []byte {
+	h := make([]byte, HashSize)
+	for i := 0; i < height; i++ {
+		h = hashPair(h, h)
+	}
+	return h
+}
+
+// Root returns the root of the tree that has hashes in its base layer.
+// The base layer is padded with pad up to width, which must be a power of two.
+func Root(hashes []byte, width int, pad []byte) []byte {
+	layer := make([]byte, width*HashSize)
+	n := copy(layer, hashes)
+	for i := n; i < len(layer); i += HashSize {
+		copy(layer[i:], pad)
+	}
+	for len(layer) > HashSize {
+		for i := 0; i < len(layer)/2; i += HashSize {
+			copy(layer[i:], hashPair(layer[2*i:2*i+HashSize], layer[2*i+HashSize:2*i+2*HashSize]))
+		}
+		layer = layer[:len(layer)/2]
+	}
+	return layer
+}
+
+// PieceRoot returns the root of the tree of blocks in data. Leaves are padded with zero hashes up to numLeaves.
+func PieceRoot(data []byte, numLeaves int) []byte {
+	return Root(BlockHashes(data), numLeaves, make([]byte, HashSize))
+}
+
+// BlockHashes returns the leaf hashes of data. Last block may be shorter than BlockSize.
+func BlockHashes(data []byte) []byte {
+	hashes := make([]byte, 0, (len(data)+BlockSize-1)/BlockSize*HashSize)
+	for len(data) > 0 {
+		n := BlockSize
+		if n > len(data) {
+			n = len(data)
+		}
+		sum := sha256.Sum256(data[:n])
+		hashes = append(hashes, sum[:]...)
+		data = data[n:]
+	}
+	return hashes
+}
+
+// Proof returns the uncle hashes needed for computing the root of the tree from the length hashes at index of layer.
+// The layer is padded with pad up to width. Uncles are ordered from the bottom to the top of the tree.
+func Proof(layer []byte, width int, pad []byte, index, length, numUncles int) []byte {
+	// Roots of the subtrees that have the same size with the requested hashes.
+	nodes := make([]byte, 0, width/length*HashSize)
+	padded := make([]byte, length*HashSize)
+	for i := 0; i < width; i += length {
+		begin := i * HashSize
+		end := begin + length*HashSize
+		if begin > len(layer) {
+			begin = len(layer)
+		}
+		if end > len(layer) {
+			end = len(layer)
+		}
+		n := copy(padded, layer[begin:end])
+		for j := n; j < len(padded); j += HashSize {
+			copy(padded[j:], pad)
+		}
+		nodes = append(nodes, Root(padded, length, nil)...)
+	}
+	uncles := make([]byte, 0, numUncles*HashSize)
+	pos := index / length
+	for i := 0; i < numUncles && len(nodes) > HashSize; i++ {
+		uncle := pos ^ 1
+		uncles = append(uncles, nodes[uncle*HashSize:(uncle+1)*HashSize]...)
+		for j := 0; j < len(nodes)/2; j += HashSize {
+			copy(nodes[j:], hashPair(nodes[2*j:2*j+HashSize], nodes[2*j+HashSize:2*j+2*HashSize]))
+		}
+		nodes = nodes[:len(nodes)/2]
+		pos /= 2
+	}
+	return uncles
+}
+
+// RootFromProof returns the root computed from the hashes at index of a layer and their uncle hashes.
+// Number of hashes must be a power of two and index must be a multiple of it.
+func RootFromProof(hashes []byte, index int, uncles []byte) []byte {
+	length := len(hashes) / HashSize
+	h := Root(hashes, length, nil)
+	pos := index / length
+	for i := 0; i < len(uncles); i += HashSize {
+		uncle := uncles[i : i+HashSize]
+		if pos%2 == 0 {
+			h = hashPair(h, uncle)
+		} else {
+			h = hashPair(uncle, h)
+		}
+		pos /= 2
+	}
+	return h
+}
+
+// NextPowerOfTwo returns the smallest power of two that is not less than n.
+func NextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// Log2 returns the base 2 logarithm of n, which must be a power of two.
+func Log2(n int) int {
+	var l int
+	for n > 1 {
+		n >>= 1
+		l++
+	}
+	return l
+}
+
+func hashPair(a, b []byte) []byte {
+	h := sha256.New()
+	_, _ = h.Write(a)
+	_, _ = h.Write(b)
+	return h.Sum(nil)
+}
@@ -0,0 +1,70 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPieceRoot(t *testing.T) {
+	data := bytes.Repeat([]byte{1}, 2*BlockSize+10)
+	h0 := sha256.Sum256(data[:BlockSize])
+	h1 := sha256.Sum256(data[BlockSize : 2*BlockSize])
+	h2 := sha256.Sum256(data[2*BlockSize:])
+	zero := make([]byte, HashSize)
+	expected := hashPair(hashPair(h0[:], h1[:]), hashPair(h2[:], zero))
+	assert.Equal(t, expected, PieceRoot(data, 4))
+
+	// Padding leaves of a bigger piece are zero hashes, their parents are not.
+	expected = hashPair(expected, hashPair(hashPair(zero, zero), hashPair(zero, zero)))
+	assert.Equal(t, expected, PieceRoot(data, 8))
+}
+
+func TestPadHash(t *testing.T) {
+	zero := make([]byte, HashSize)
+	assert.Equal(t, zero, PadHash(0))
+	assert.Equal(t, hashPair(hashPair(zero, zero), hashPair(zero, zero)), PadHash(2))
+	assert.Equal(t, PadHash(3), Root(nil, 8, zero))
+}
+
+func TestProof(t *testing.T) {
+	const numHashes = 11
+	const width = 16
+	pad := PadHash(1)
+	var layer []byte
+	for i := 0; i < numHashes; i++ {
+		sum := sha256.Sum256([]byte{byte(i)})
+		layer = append(layer, sum[:]...)
+	}
+	root := Root(layer, width, pad)
+	for _, length := range []int{2, 4, 8, 16} {
+		for index := 0; index < width; index += length {
+			hashes := make([]byte, length*HashSize)
+			for i := 0; i < length; i++ {
+				if (index+i)*HashSize < len(layer) {
+					copy(hashes[i*HashSize:], layer[(index+i)*HashSize:])
+				} else {
+					copy(hashes[i*HashSize:], pad)
+				}
+			}
+			numUncles := Log2(width) - Log2(length)
+			uncles := Proof(layer, width, pad, index, length, numUncles)
+			assert.Len(t, uncles, numUncles*HashSize)
+			assert.Equal(t, root, RootFromProof(hashes, index, uncles), "length: %d, index: %d", length, index)
+
+			hashes[0]++
+			assert.NotEqual(t, root, RootFromProof(hashes, index, uncles))
+		}
+	}
+}
+
+func TestNextPowerOfTwo(t *testing.T) {
+	assert.Equal(t, 1, NextPowerOfTwo(0))
+	assert.Equal(t, 1, NextPowerOfTwo(1))
+	assert.Equal(t, 4, NextPowerOfTwo(3))
+	assert.Equal(t, 4, NextPowerOfTwo(4))
+	assert.Equal(t, 8, NextPowerOfTwo(5))
+	assert.Equal(t, 3, Log2(8))
+}
@@ -0,0 +1,69 @@
+package metainfo
+
+import (
+	"crypto/sha1"
+	"runtime"
+	"sync"
+)
+
+// pieceHasher calculates the hashes of pieces concurrently while the caller keeps reading the next pieces from disk.
+type pieceHasher struct {
+	pieces    []byte
+	buffers   chan []byte
+	jobs      chan hashJob
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+type hashJob struct {
+	index int
+	data  []byte
+}
+
+// newPieceHasher returns a new pieceHasher that writes the hash of each piece into its place in pieces.
+func newPieceHasher(pieces []byte, pieceLength uint32) *pieceHasher {
+	numWorkers := runtime.NumCPU()
+	h := &pieceHasher{
+		pieces:  pieces,
+		buffers: make(chan []byte, 2*numWorkers),
+		jobs:    make(chan hashJob),
+	}
+	for i := 0; i < cap(h.buffers); i++ {
+		h.buffers <- make([]byte, pieceLength)
+	}
+	h.wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go h.worker()
+	}
+	return h
+}
+
+// Buffer returns a free buffer to read the next piece into. Blocks until a worker is done with a previous buffer.
+func (h *pieceHasher) Buffer() []byte {
+	return <-h.buffers
+}
+
+// Hash schedules the hashing of the piece at index. The buffer is returned to the pool after hashing is done.
+func (h *pieceHasher) Hash(index int, data []byte) {
+	h.jobs <- hashJob{index: index, data: data}
+}
+
+// Close waits for the pending hashes to be written.
+func (h *pieceHasher) Close() {
+	h.closeOnce.Do(func() {
+		close(h.jobs)
+		h.wg.Wait()
+	})
+}
+
+func (h *pieceHasher) worker() {
+	defer h.wg.Done()
+	hash := sha1.New()
+	var sum [sha1.Size]byte
+	for job := range h.jobs {
+		hash.Reset()
+		_, _ = hash.Write(job.data)
+		copy(h.pieces[job.index*sha1.Size:], hash.Sum(sum[:0]))
+		h.buffers <- job.data[:cap(job.data)]
+	}
+}
@@ -21,6 +21,7 @@ var (
 	errZeroPieceLength  = errors.New("torrent has zero piece length")
 	errZeroPieces       = errors.New("torrent has zero pieces")
 	errPieceLength      = errors.New("piece length must be multiple of 16K")
+	errFileSizeChanged  = errors.New("file size changed while hashing")
 )
 
 // Info contains information about torrent.
@@ -33,7 +34,13 @@ type Info struct {
 	Bytes       []byte
 	Private     bool
 	Files       []File
-	pieces      []byte
+	// V2 is true for torrents that only have BitTorrent v2 fields (BEP 52).
+	// Pieces of v2 torrents are aligned to file boundaries with padding files and verified with SHA-256 merkle trees.
+	// Hybrid torrents are used like v1 torrents.
+	V2     bool
+	pieces []byte
+	// Files of v2 torrents that have at least one piece.
+	v2Files []v2File
 }
 
 // File represents a file inside a Torrent.
@@ -71,6 +78,8 @@ type infoType struct {
 	Private     bencode.RawMessage `bencode:"private"`
 	Length      int64              `bencode:"length"` // Single File Mode
 	Files       []file             `bencode:"files"`  // Multiple File mode
+	MetaVersion int                `bencode:"meta version"`
+	FileTree    bencode.RawMessage `bencode:"file tree"`
 }
 
 func (ib *infoType) overrideUTF8Keys() {
@@ -96,13 +105,17 @@ func NewInfo(b []byte, utf8 bool, pad bool) (*Info, error) {
 	if len(ib.Pieces)%sha1.Size != 0 {
 		return nil, errInvalidPieceData
 	}
+	if utf8 {
+		ib.overrideUTF8Keys()
+	}
 	numPieces := len(ib.Pieces) / sha1.Size
 	if numPieces == 0 {
+		// BEP 52: Hybrid torrents contain v1 fields too, so they can be used like v1 torrents.
+		if ib.MetaVersion == 2 {
+			return newInfoV2(b, &ib)
+		}
 		return nil, errZeroPieces
 	}
-	if utf8 {
-		ib.overrideUTF8Keys()
-	}
 	// ".." is not allowed in file names
 	for _, file := range ib.Files {
 		for _, path := range file.Path {
@@ -219,46 +232,25 @@ func parsePrivateField(s bencode.RawMessage) bool {
 
 // NewInfoBytes creates a new Info dictionary by reading and hashing the files on the disk.
 func NewInfoBytes(root string, paths []string, private bool, pieceLength uint32, name string, log logger.Logger) ([]byte, error) {
-	var singleFileTorrent bool
-	switch len(paths) {
-	case 0:
-		return nil, errors.New("no path specified")
-	case 1:
-		if name == "" {
-			name = filepath.Base(paths[0])
-		}
-		fi, err := os.Stat(paths[0])
-		if err != nil {
-			return nil, err
-		}
-		singleFileTorrent = !fi.IsDir()
-	default:
-		if root == "" {
-			return nil, errors.New("no root specified")
-		}
-		if name == "" {
-			return nil, errors.New("no name specified")
-		}
-	}
-	totalLength, err := findTotalLength(paths)
+	name, singleFileTorrent, totalLength, err := checkPaths(root, paths, name)
 	if err != nil {
 		return nil, err
 	}
-	if totalLength == 0 {
-		return nil, errors.New("no files")
-	}
 	if pieceLength == 0 {
 		pieceLength = calculatePieceLength(totalLength)
 		log.Infof("Calculated piece length: %d K", pieceLength>>10)
 	} else if pieceLength%(16<<10) != 0 {
 		return nil, errPieceLength
 	}
-	buf := make([]byte, pieceLength)
+	numPieces := int((totalLength + int64(pieceLength) - 1) / int64(pieceLength))
+	pieces := make([]byte, numPieces*sha1.Size)
+	hasher := newPieceHasher(pieces, pieceLength)
+	defer hasher.Close()
+	buf := hasher.Buffer()
 	offset := 0
+	index := 0
 	remaining := func() []byte { return buf[offset:] }
-	hash := sha1.New()
 	var files []file
-	var pieces []byte
 	for _, path := range paths {
 		relroot := path
 		if root != "" {
@@ -291,10 +283,13 @@ func NewInfoBytes(root string, paths []string, private bool, pieceLength uint32,
 				if err != nil {
 					return err
 				}
-				// buffer finished, calculate piece hash and append to pieces
-				_, _ = hash.Write(buf)
-				pieces = hash.Sum(pieces)
-				hash.Reset()
+				// buffer finished, calculate piece hash in background and continue reading with next buffer
+				if index >= numPieces {
+					return errFileSizeChanged
+				}
+				hasher.Hash(index, buf)
+				index++
+				buf = hasher.Buffer()
 				offset = 0
 			}
 		}
@@ -305,8 +300,15 @@ func NewInfoBytes(root string, paths []string, private bool, pieceLength uint32,
 	}
 	// hash remaining buffer
 	if offset > 0 {
-		_, _ = hash.Write(buf[:offset])
-		pieces = hash.Sum(pieces)
+		if index >= numPieces {
+			return nil, errFileSizeChanged
+		}
+		hasher.Hash(index, buf[:offset])
+		index++
+	}
+	hasher.Close()
+	if index != numPieces {
+		return nil, errFileSizeChanged
 	}
 	b := struct {
 		Name        string `bencode:"name"`
@@ -329,8 +331,45 @@ func NewInfoBytes(root string, paths []string, private bool, pieceLength uint32,
 	return bencode.EncodeBytes(b)
 }
 
+// checkPaths validates the arguments of the functions that create info dictionaries and returns the name of the torrent.
+func checkPaths(root string, paths []string, name string) (string, bool, int64, error) {
+	var singleFileTorrent bool
+	switch len(paths) {
+	case 0:
+		return "", false, 0, errors.New("no path specified")
+	case 1:
+		if name == "" {
+			name = filepath.Base(paths[0])
+		}
+		fi, err := os.Stat(paths[0])
+		if err != nil {
+			return "", false, 0, err
+		}
+		singleFileTorrent = !fi.IsDir()
+	default:
+		if root == "" {
+			return "", false, 0, errors.New("no root specified")
+		}
+		if name == "" {
+			return "", false, 0, errors.New("no name specified")
+		}
+	}
+	totalLength, err := findTotalLength(paths)
+	if err != nil {
+		return "", false, 0, err
+	}
+	if totalLength == 0 {
+		return "", false, 0, errors.New("no files")
+	}
+	return name, singleFileTorrent, totalLength, nil
+}
+
 // PieceHash returns the hash of a piece at index.
+// For v2 torrents, it returns nil if the piece layer of the file is not set yet.
 func (i *Info) PieceHash(index uint32) []byte {
+	if i.V2 {
+		return i.pieceHashV2(index)
+	}
 	begin := index * sha1.Size
 	end := begin + sha1.Size
 	return i.pieces[begin:end]
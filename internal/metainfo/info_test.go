@@ -1,8 +1,15 @@
 package metainfo
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/merkle"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -47,3 +54,115 @@ func TestCleanName(t *testing.T) {
 		assert.Equal(t, c.cleaned, cleanNameN(c.name, c.max))
 	}
 }
+
+func TestV2Info(t *testing.T) {
+	const pieceLength = 32 << 10
+	root := filepath.Join("..", "..", "torrent", "testdata", "sample_torrent")
+	info, pieceLayers, err := NewInfoBytesV2("", []string{root}, false, pieceLength, "", logger.New("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBytes(info, pieceLayers, nil, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi, err := New(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := mi.Info
+	assert.True(t, i.V2)
+	assert.True(t, i.HasPieceLayers())
+	sum := sha256.Sum256(info)
+	assert.Equal(t, sum[:20], i.Hash[:])
+	assert.True(t, VerifyInfoHash(info, i.Hash))
+
+	// Every file starts at a piece boundary.
+	var data []byte
+	// Length of the data in each piece without the padding.
+	dataLengths := make([]int, i.NumPieces)
+	for _, f := range i.Files {
+		if f.Padding {
+			assert.Equal(t, filepath.Join("sample_torrent", ".pad"), filepath.Dir(f.Path))
+			data = append(data, make([]byte, f.Length)...)
+			continue
+		}
+		assert.Equal(t, 0, len(data)%pieceLength, f.Path)
+		fb, err := os.ReadFile(filepath.Join(filepath.Dir(root), f.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < len(fb); j += pieceLength {
+			n := len(fb) - j
+			if n > pieceLength {
+				n = pieceLength
+			}
+			dataLengths[(len(data)+j)/pieceLength] = n
+		}
+		data = append(data, fb...)
+	}
+	assert.Equal(t, i.Length, int64(len(data)))
+	assert.Equal(t, int(i.NumPieces), (len(data)+pieceLength-1)/pieceLength)
+	assert.Equal(t, []string{
+		filepath.Join("sample_torrent", "README"),
+		filepath.Join("sample_torrent", ".pad", "32738"),
+		filepath.Join("sample_torrent", "data", "file1.bin"),
+		filepath.Join("sample_torrent", ".pad", "22528"),
+		filepath.Join("sample_torrent", "data", "file2.bin"),
+		filepath.Join("sample_torrent", ".pad", "22528"),
+		filepath.Join("sample_torrent", "data", "zero.bin"),
+		filepath.Join("sample_torrent", "folder", "file1.txt"),
+		filepath.Join("sample_torrent", ".pad", "32763"),
+		filepath.Join("sample_torrent", "folder", "file2.txt"),
+	}, filePaths(i.Files))
+
+	// Pieces are verified with the merkle root of their data without the padding.
+	for index := uint32(0); index < i.NumPieces; index++ {
+		begin := int(index) * pieceLength
+		piece := data[begin : begin+dataLengths[index]]
+		assert.Equal(t, i.PieceHash(index), merkle.PieceRoot(piece, i.PieceLeaves(index)), "piece: %d", index)
+	}
+
+	// Piece layers must match with the pieces root.
+	layers := i.PieceLayers()
+	assert.Len(t, layers, 1)
+	assert.Equal(t, uint32(320), layers[0].NumPieces)
+	hashes := append([]byte{}, layers[0].Hashes...)
+	hashes[0]++
+	assert.Equal(t, errInvalidPieceLayer, i.SetPieceLayer(layers[0].PiecesRoot, hashes))
+	assert.Equal(t, errInvalidPieceLayer, i.SetPieceLayer(layers[0].PiecesRoot, hashes[:32]))
+
+	// Piece layers can be received later from peers.
+	i2, err := NewInfo(info, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, i2.HasPieceLayers())
+	assert.Nil(t, i2.PieceHash(10))
+	assert.Nil(t, i2.PieceLayersBytes())
+	assert.Nil(t, i2.SetPieceLayer(layers[0].PiecesRoot, layers[0].Hashes))
+	assert.True(t, i2.HasPieceLayers())
+	assert.Equal(t, i.PieceHash(10), i2.PieceHash(10))
+	assert.Equal(t, pieceLayers, i2.PieceLayersBytes())
+}
+
+func TestV2InfoInvalidFileTree(t *testing.T) {
+	cases := []string{
+		"d9:file treed0:d6:lengthi1eee12:meta versioni2e4:name1:a12:piece lengthi16384ee",
+		"d9:file treed1:ad6:lengthi1eee12:meta versioni2e4:name1:a12:piece lengthi16384ee",
+		"d9:file treed2:..d0:d6:lengthi1e11:pieces root32:01234567890123456789012345678901eee12:meta versioni2e4:name1:a12:piece lengthi16384ee",
+		"d9:file treed1:ad0:d6:lengthi1e11:pieces root32:01234567890123456789012345678901eee12:meta versioni2e4:name1:a12:piece lengthi20000ee",
+	}
+	for _, c := range cases {
+		_, err := NewInfo([]byte(c), true, true)
+		assert.NotNil(t, err, c)
+	}
+}
+
+func filePaths(files []File) []string {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	return paths
+}
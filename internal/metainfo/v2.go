@@ -0,0 +1,452 @@
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/merkle"
+	"github.com/zeebo/bencode"
+)
+
+var (
+	errPieceLengthV2     = errors.New("piece length must be a power of two and at least 16K")
+	errInvalidFileTree   = errors.New("invalid file tree")
+	errInvalidPieceLayer = errors.New("invalid piece layer")
+	errUnknownPiecesRoot = errors.New("no file with pieces root")
+)
+
+// v2File is a file in a v2 torrent that has at least one piece.
+type v2File struct {
+	length     int64
+	root       []byte
+	firstPiece uint32
+	numPieces  uint32
+	// Hashes of pieces. Files that fit in a single piece do not have a piece layer.
+	layer []byte
+}
+
+type v2FileEntry struct {
+	Length     int64  `bencode:"length"`
+	PiecesRoot []byte `bencode:"pieces root,omitempty"`
+}
+
+type v2TreeFile struct {
+	path []string
+	v2FileEntry
+}
+
+// PieceLayer contains the hashes of the pieces of a file in a v2 torrent.
+type PieceLayer struct {
+	PiecesRoot []byte
+	NumPieces  uint32
+	// Hashes is nil until the piece layer is received from a torrent file or a peer.
+	Hashes []byte
+}
+
+// newInfoV2 returns info of a torrent that only has BitTorrent v2 fields.
+// Files are placed in the piece space the same way as v1 torrents.
+// Each file starts at a piece boundary, so a padding file is added after every file that does not end at a piece boundary.
+func newInfoV2(b []byte, ib *infoType) (*Info, error) {
+	if ib.PieceLength < merkle.BlockSize || ib.PieceLength&(ib.PieceLength-1) != 0 {
+		return nil, errPieceLengthV2
+	}
+	files, err := parseFileTree(ib.FileTree, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	// No padding is needed after the last file that has data.
+	last := -1
+	for j, f := range files {
+		if f.Length < 0 {
+			return nil, errInvalidFileTree
+		}
+		if f.Length > 0 {
+			last = j
+		}
+	}
+	if last < 0 {
+		return nil, errZeroPieces
+	}
+	i := Info{
+		PieceLength: ib.PieceLength,
+		Bytes:       b,
+		Private:     parsePrivateField(ib.Private),
+		V2:          true,
+	}
+	// calculate info hash
+	sum := sha256.Sum256(b)
+	copy(i.Hash[:], sum[:])
+
+	// name field is optional
+	if ib.Name != "" {
+		i.Name = ib.Name
+	} else {
+		i.Name = hex.EncodeToString(i.Hash[:])
+	}
+
+	// construct files
+	singleFile := len(files) == 1 && len(files[0].path) == 1
+	pieceLength := int64(i.PieceLength)
+	for j, f := range files {
+		var p string
+		if singleFile {
+			p = cleanName(f.path[0])
+		} else {
+			parts := make([]string, 0, len(f.path)+1)
+			parts = append(parts, cleanName(i.Name))
+			for _, s := range f.path {
+				parts = append(parts, cleanName(s))
+			}
+			p = filepath.Join(parts...)
+		}
+		i.Files = append(i.Files, File{Path: p, Length: f.Length})
+		i.Length += f.Length
+		if f.Length == 0 {
+			continue
+		}
+		if len(f.PiecesRoot) != merkle.HashSize {
+			return nil, errInvalidFileTree
+		}
+		numPieces := uint32((f.Length + pieceLength - 1) / pieceLength)
+		i.v2Files = append(i.v2Files, v2File{
+			length:     f.Length,
+			root:       f.PiecesRoot,
+			firstPiece: i.NumPieces,
+			numPieces:  numPieces,
+		})
+		i.NumPieces += numPieces
+		if padding := int64(numPieces)*pieceLength - f.Length; padding > 0 && j < last {
+			i.Files = append(i.Files, File{
+				Path:    filepath.Join(cleanName(i.Name), ".pad", strconv.FormatInt(padding, 10)),
+				Length:  padding,
+				Padding: true,
+			})
+			i.Length += padding
+		}
+	}
+	return &i, nil
+}
+
+// parseFileTree appends the files in the "file tree" dictionary to files in the order of their paths.
+func parseFileTree(b bencode.RawMessage, path []string, files []v2TreeFile) ([]v2TreeFile, error) {
+	var m map[string]bencode.RawMessage
+	if err := bencode.DecodeBytes(b, &m); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "" {
+			// File entries are the only key in their dictionary.
+			if len(path) == 0 || len(m) != 1 {
+				return nil, errInvalidFileTree
+			}
+			var f v2TreeFile
+			if err := bencode.DecodeBytes(m[k], &f.v2FileEntry); err != nil {
+				return nil, err
+			}
+			f.path = path
+			files = append(files, f)
+			continue
+		}
+		// ".." is not allowed in file names
+		if strings.TrimSpace(k) == ".." {
+			return nil, fmt.Errorf("invalid file name: %q", filepath.Join(append(path, k)...))
+		}
+		var err error
+		files, err = parseFileTree(m[k], append(path[:len(path):len(path)], k), files)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// v2File returns the file that contains the piece at index.
+func (i *Info) v2File(index uint32) *v2File {
+	j := sort.Search(len(i.v2Files), func(j int) bool {
+		return i.v2Files[j].firstPiece+i.v2Files[j].numPieces > index
+	})
+	return &i.v2Files[j]
+}
+
+func (i *Info) pieceHashV2(index uint32) []byte {
+	f := i.v2File(index)
+	if f.numPieces == 1 {
+		return f.root
+	}
+	if f.layer == nil {
+		return nil
+	}
+	begin := (index - f.firstPiece) * merkle.HashSize
+	return f.layer[begin : begin+merkle.HashSize]
+}
+
+// PieceLeaves returns the number of leaves in the merkle tree of the piece at index.
+// Pieces of v1 torrents are not merkle trees, so it returns 0 for them.
+func (i *Info) PieceLeaves(index uint32) int {
+	if !i.V2 {
+		return 0
+	}
+	f := i.v2File(index)
+	if f.numPieces == 1 {
+		return merkle.NextPowerOfTwo(int((f.length + merkle.BlockSize - 1) / merkle.BlockSize))
+	}
+	return int(i.PieceLength / merkle.BlockSize)
+}
+
+// PieceLayerPad returns the hash that the piece layers are padded with up to a power of two.
+func (i *Info) PieceLayerPad() []byte {
+	return merkle.PadHash(merkle.Log2(int(i.PieceLength / merkle.BlockSize)))
+}
+
+// PieceLayers returns the piece layers of the files that have more than one piece.
+func (i *Info) PieceLayers() []PieceLayer {
+	var layers []PieceLayer
+	seen := make(map[string]struct{})
+	for _, f := range i.v2Files {
+		if f.numPieces == 1 {
+			continue
+		}
+		if _, ok := seen[string(f.root)]; ok {
+			continue
+		}
+		seen[string(f.root)] = struct{}{}
+		layers = append(layers, PieceLayer{PiecesRoot: f.root, NumPieces: f.numPieces, Hashes: f.layer})
+	}
+	return layers
+}
+
+// PieceLayer returns the piece layer of the file with the pieces root.
+func (i *Info) PieceLayer(root []byte) (PieceLayer, bool) {
+	for _, f := range i.v2Files {
+		if f.numPieces > 1 && bytes.Equal(f.root, root) {
+			return PieceLayer{PiecesRoot: f.root, NumPieces: f.numPieces, Hashes: f.layer}, true
+		}
+	}
+	return PieceLayer{}, false
+}
+
+// HasPieceLayers returns true if the hashes of all pieces are known.
+func (i *Info) HasPieceLayers() bool {
+	for _, f := range i.v2Files {
+		if f.numPieces > 1 && f.layer == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// SetPieceLayer sets the hashes of the pieces of the file with the pieces root after verifying them against the root.
+func (i *Info) SetPieceLayer(root, hashes []byte) error {
+	pad := i.PieceLayerPad()
+	var found bool
+	for j := range i.v2Files {
+		f := &i.v2Files[j]
+		if f.numPieces == 1 || !bytes.Equal(f.root, root) {
+			continue
+		}
+		if !found {
+			if len(hashes) != int(f.numPieces)*merkle.HashSize {
+				return errInvalidPieceLayer
+			}
+			if !bytes.Equal(merkle.Root(hashes, merkle.NextPowerOfTwo(int(f.numPieces)), pad), root) {
+				return errInvalidPieceLayer
+			}
+			found = true
+		}
+		f.layer = hashes
+	}
+	if !found {
+		return errUnknownPiecesRoot
+	}
+	return nil
+}
+
+// SetPieceLayers sets the piece layers from the bencoded "piece layers" dictionary of a torrent file.
+// Layers of files that are not in the torrent are ignored.
+func (i *Info) SetPieceLayers(b []byte) error {
+	var m map[string][]byte
+	if err := bencode.DecodeBytes(b, &m); err != nil {
+		return err
+	}
+	for root, hashes := range m {
+		err := i.SetPieceLayer([]byte(root), hashes)
+		if err == errUnknownPiecesRoot {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PieceLayersBytes returns the known piece layers as a bencoded "piece layers" dictionary.
+// It returns nil if there are none.
+func (i *Info) PieceLayersBytes() []byte {
+	m := make(map[string][]byte)
+	for _, l := range i.PieceLayers() {
+		if l.Hashes != nil {
+			m[string(l.PiecesRoot)] = l.Hashes
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	b, _ := bencode.EncodeBytes(m)
+	return b
+}
+
+// VerifyInfoHash returns true if b is the info dictionary of the torrent with the info hash.
+// Info hashes of v2 torrents are the SHA-256 hashes truncated to 20 bytes.
+func VerifyInfoHash(b []byte, hash [20]byte) bool {
+	sum1 := sha1.Sum(b)
+	if bytes.Equal(sum1[:], hash[:]) {
+		return true
+	}
+	sum256 := sha256.Sum256(b)
+	return bytes.Equal(sum256[:len(hash)], hash[:])
+}
+
+// NewInfoBytesV2 creates a new BitTorrent v2 info dictionary by reading and hashing the files on the disk.
+// Piece layers are returned as a bencoded dictionary to be put into the torrent file. It is nil if all files fit in a single piece.
+func NewInfoBytesV2(root string, paths []string, private bool, pieceLength uint32, name string, log logger.Logger) (info, pieceLayers []byte, err error) {
+	name, singleFileTorrent, totalLength, err := checkPaths(root, paths, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pieceLength == 0 {
+		pieceLength = calculatePieceLength(totalLength)
+		log.Infof("Calculated piece length: %d K", pieceLength>>10)
+	} else if pieceLength < merkle.BlockSize || pieceLength&(pieceLength-1) != 0 {
+		return nil, nil, errPieceLengthV2
+	}
+	tree := make(map[string]interface{})
+	layers := make(map[string][]byte)
+	buf := make([]byte, pieceLength)
+	pad := merkle.PadHash(merkle.Log2(int(pieceLength / merkle.BlockSize)))
+	for _, path := range paths {
+		relroot := path
+		if root != "" {
+			relroot = root
+		}
+		visit := func(vpath string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			f, err := os.Open(vpath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			relpath, err := filepath.Rel(relroot, vpath)
+			log.Infof("Adding %q", relpath)
+			if err != nil {
+				return err
+			}
+			parts := strings.Split(relpath, string(os.PathSeparator))
+			if singleFileTorrent {
+				parts = []string{name}
+			}
+			entry, layer, err := hashFileV2(f, fi.Size(), buf, pad)
+			if err != nil {
+				return err
+			}
+			node := tree
+			for _, p := range parts {
+				child, ok := node[p].(map[string]interface{})
+				if !ok {
+					child = make(map[string]interface{})
+					node[p] = child
+				}
+				node = child
+			}
+			node[""] = entry
+			if layer != nil {
+				layers[string(entry.PiecesRoot)] = layer
+			}
+			return nil
+		}
+		err = filepath.Walk(path, visit)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	b := struct {
+		FileTree    map[string]interface{} `bencode:"file tree"`
+		MetaVersion int                    `bencode:"meta version"`
+		Name        string                 `bencode:"name"`
+		Private     bool                   `bencode:"private"`
+		PieceLength uint32                 `bencode:"piece length"`
+	}{
+		FileTree:    tree,
+		MetaVersion: 2,
+		Name:        name,
+		Private:     private,
+		PieceLength: pieceLength,
+	}
+	info, err = bencode.EncodeBytes(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(layers) > 0 {
+		pieceLayers, err = bencode.EncodeBytes(layers)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return info, pieceLayers, nil
+}
+
+// hashFileV2 reads the file with length from r piece by piece into buf and returns its entry in the file tree and its piece layer.
+func hashFileV2(r io.Reader, length int64, buf []byte, pad []byte) (v2FileEntry, []byte, error) {
+	e := v2FileEntry{Length: length}
+	if length == 0 {
+		return e, nil, nil
+	}
+	zero := make([]byte, merkle.HashSize)
+	var layer, leaves []byte
+	var n int64
+	for {
+		m, err := io.ReadFull(r, buf)
+		if m > 0 {
+			n += int64(m)
+			leaves = merkle.BlockHashes(buf[:m])
+			layer = append(layer, merkle.Root(leaves, len(buf)/merkle.BlockSize, zero)...)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return e, nil, err
+		}
+	}
+	if n != length {
+		return e, nil, errFileSizeChanged
+	}
+	numPieces := len(layer) / merkle.HashSize
+	if numPieces == 1 {
+		e.PiecesRoot = merkle.Root(leaves, merkle.NextPowerOfTwo(len(leaves)/merkle.HashSize), zero)
+		return e, nil, nil
+	}
+	e.PiecesRoot = merkle.Root(layer, merkle.NextPowerOfTwo(numPieces), pad)
+	return e, layer, nil
+}
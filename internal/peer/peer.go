@@ -18,8 +18,8 @@ import (
 	"github.com/cenkalti/rain/internal/pexlist"
 	"github.com/cenkalti/rain/internal/piece"
 	"github.com/cenkalti/rain/internal/sliceset"
+	"github.com/cenkalti/rain/internal/speedlimiter"
 	"github.com/cenkalti/rain/internal/stringutil"
-	"github.com/juju/ratelimit"
 	"github.com/rcrowley/go-metrics"
 )
 
@@ -39,6 +39,7 @@ type Peer struct {
 	ExtensionsEnabled bool
 	FastEnabled       bool
 	DHTEnabled        bool
+	V2Enabled         bool
 	EncryptionCipher  mse.CryptoMethod
 
 	ClientInterested bool
@@ -51,6 +52,9 @@ type Peer struct {
 	// Snubbed means peer is sending pieces too slow.
 	Snubbed bool
 
+	// Number of times the peer did not send a requested block in time.
+	RequestTimeouts int
+
 	Downloading bool
 
 	downloadSpeed metrics.Meter
@@ -63,6 +67,9 @@ type Peer struct {
 
 	PEX *pex
 
+	// Time of the last PEX message received from the peer.
+	LastPEXMessage time.Time
+
 	snubTimeout time.Duration
 	snubTimer   *time.Timer
 
@@ -87,11 +94,12 @@ type PieceMessage struct {
 }
 
 // New wraps the net.Conn and returns a new Peer.
-func New(conn net.Conn, source peersource.Source, id [20]byte, extensions [8]byte, cipher mse.CryptoMethod, pieceReadTimeout, snubTimeout time.Duration, maxRequestsIn int, br, bw *ratelimit.Bucket) *Peer {
+func New(conn net.Conn, source peersource.Source, id [20]byte, extensions [8]byte, cipher mse.CryptoMethod, pieceReadTimeout, snubTimeout time.Duration, maxRequestsIn int, br, bw *speedlimiter.Limiter) *Peer {
 	bf, _ := bitfield.NewBytes(extensions[:], 64)
 	fastEnabled := bf.Test(61)
 	extensionsEnabled := bf.Test(43)
 	dhtEnabled := bf.Test(63)
+	v2Enabled := bf.Test(59)
 
 	t := time.NewTimer(math.MaxInt64)
 	t.Stop()
@@ -105,6 +113,7 @@ func New(conn net.Conn, source peersource.Source, id [20]byte, extensions [8]byt
 		ExtensionsEnabled: extensionsEnabled,
 		FastEnabled:       fastEnabled,
 		DHTEnabled:        dhtEnabled,
+		V2Enabled:         v2Enabled,
 		EncryptionCipher:  cipher,
 		snubTimeout:       snubTimeout,
 		snubTimer:         t,
@@ -204,6 +213,11 @@ func (p *Peer) ResetSnubTimer() {
 	p.snubTimer.Reset(p.snubTimeout)
 }
 
+// ResetSnubTimerTimeout is same as ResetSnubTimer but uses the given timeout instead of the default one.
+func (p *Peer) ResetSnubTimerTimeout(d time.Duration) {
+	p.snubTimer.Reset(d)
+}
+
 // StopSnubTimer is used to stop the timer that is for detecting if the Peer is snub.
 func (p *Peer) StopSnubTimer() {
 	p.snubTimer.Stop()
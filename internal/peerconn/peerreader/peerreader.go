@@ -14,12 +14,14 @@ import (
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/peerprotocol"
 	"github.com/cenkalti/rain/internal/piece"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/speedlimiter"
 )
 
 const (
 	// MaxBlockSize allowed in "request" messages.
 	MaxBlockSize = 16 * 1024
+	// MaxHashesLength is the maximum size of hashes allowed in "hashes" messages.
+	MaxHashesLength = 1024 * 32
 	// time to wait for a message. peer must send keep-alive messages to keep connection alive.
 	readTimeout = 2 * time.Minute
 	// length + msgid + requestmsg
@@ -34,14 +36,14 @@ type PeerReader struct {
 	r            io.Reader
 	log          logger.Logger
 	pieceTimeout time.Duration
-	bucket       *ratelimit.Bucket
+	bucket       *speedlimiter.Limiter
 	messages     chan interface{}
 	stopC        chan struct{}
 	doneC        chan struct{}
 }
 
 // New returns a new PeerReader by wrapping a net.Conn.
-func New(conn net.Conn, l logger.Logger, pieceTimeout time.Duration, b *ratelimit.Bucket) *PeerReader {
+func New(conn net.Conn, l logger.Logger, pieceTimeout time.Duration, b *speedlimiter.Limiter) *PeerReader {
 	return &PeerReader{
 		conn:         conn,
 		r:            bufio.NewReaderSize(conn, readBufferSize),
@@ -219,6 +221,42 @@ func (p *PeerReader) Run() {
 				return
 			}
 			msg = am
+		case peerprotocol.HashRequest:
+			var hm peerprotocol.HashRequestMessage
+			err = binary.Read(p.r, binary.BigEndian, &hm)
+			if err != nil {
+				return
+			}
+			msg = hm
+		case peerprotocol.HashReject:
+			var hm peerprotocol.HashRejectMessage
+			err = binary.Read(p.r, binary.BigEndian, &hm)
+			if err != nil {
+				return
+			}
+			p.log.Debugf("Received HashReject: %+v", hm)
+			msg = hm
+		case peerprotocol.Hashes:
+			var hm peerprotocol.HashesMessage
+			err = binary.Read(p.r, binary.BigEndian, &hm.HashRequestMessage)
+			if err != nil {
+				return
+			}
+			length -= 48
+			if length > MaxHashesLength {
+				err = &blockSizeError{
+					messageID:  id,
+					got:        length,
+					allowedMax: MaxHashesLength,
+				}
+				return
+			}
+			hm.Hashes = make([]byte, length)
+			_, err = io.ReadFull(p.r, hm.Hashes)
+			if err != nil {
+				return
+			}
+			msg = hm
 		case peerprotocol.Port:
 			var pm peerprotocol.PortMessage
 			err = binary.Read(p.r, binary.BigEndian, &pm)
@@ -11,7 +11,7 @@ import (
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/peerconn/peerreader"
 	"github.com/cenkalti/rain/internal/peerprotocol"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/speedlimiter"
 )
 
 const keepAlivePeriod = 2 * time.Minute
@@ -28,14 +28,14 @@ type PeerWriter struct {
 	writeC                chan peerprotocol.Message
 	messages              chan interface{}
 	servedRequests        map[peerprotocol.RequestMessage]struct{}
-	bucket                *ratelimit.Bucket
+	bucket                *speedlimiter.Limiter
 	log                   logger.Logger
 	stopC                 chan struct{}
 	doneC                 chan struct{}
 }
 
 // New returns a new PeerWriter by wrapping a net.Conn.
-func New(conn net.Conn, l logger.Logger, maxQueuedRequests int, fastEnabled bool, b *ratelimit.Bucket) *PeerWriter {
+func New(conn net.Conn, l logger.Logger, maxQueuedRequests int, fastEnabled bool, b *speedlimiter.Limiter) *PeerWriter {
 	return &PeerWriter{
 		conn:              conn,
 		queueC:            make(chan peerprotocol.Message),
@@ -38,12 +38,36 @@ func calculateBytes(a, b *net.TCPAddr) (ret [2][]byte) {
 	}
 	a4 := a.IP.To4()
 	b4 := b.IP.To4()
-	m := ipv4Mask(a4, b4)
-	ret[0] = a4.Mask(m)
-	ret[1] = b4.Mask(m)
+	if a4 != nil && b4 != nil {
+		m := ipv4Mask(a4, b4)
+		ret[0] = a4.Mask(m)
+		ret[1] = b4.Mask(m)
+		return
+	}
+	a16 := a.IP.To16()
+	b16 := b.IP.To16()
+	m := ipv6Mask(a16, b16)
+	ret[0] = a16.Mask(m)
+	ret[1] = b16.Mask(m)
 	return
 }
 
+// ipv6Mask returns the mask for IPv6 addresses. Only the network part (first 64 bits) of the addresses is masked.
+func ipv6Mask(a, b net.IP) net.IPMask {
+	m := net.CIDRMask(128, 128)
+	var tail []byte
+	switch {
+	case !sameSubnet(32, 128, a, b):
+		tail = []byte{0x55, 0x55, 0x55, 0x55}
+	case !sameSubnet(48, 128, a, b):
+		tail = []byte{0xff, 0x55, 0x55, 0x55}
+	default:
+		return m
+	}
+	copy(m[4:8], tail)
+	return m
+}
+
 func ipv4Mask(a, b net.IP) net.IPMask {
 	if !sameSubnet(16, 32, a, b) {
 		return net.IPv4Mask(0xff, 0xff, 0x55, 0x55)
@@ -22,6 +22,15 @@ func TestPeerPriority(t *testing.T) {
 	))
 }
 
+func TestPeerPriorityIPv6(t *testing.T) {
+	a := newAddr("2001:db8:1::1")
+	b := newAddr("2001:db9::1")
+	assert.Equal(t, Calculate(a, b), Calculate(b, a))
+	// Addresses differing only in the masked bits of the network part have the same priority.
+	assert.Equal(t, Calculate(a, b), Calculate(newAddr("2001:db8:3::1"), b))
+	assert.NotEqual(t, Calculate(a, b), Calculate(newAddr("2001:db8:1::2"), b))
+}
+
 func newAddr(ip string) *net.TCPAddr {
 	return &net.TCPAddr{IP: net.ParseIP(ip)}
 }
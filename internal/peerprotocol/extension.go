@@ -113,6 +113,7 @@ type ExtensionHandshakeMessage struct {
 	YourIP       string           `bencode:"yourip,omitempty"`
 	MetadataSize int              `bencode:"metadata_size,omitempty"`
 	RequestQueue int              `bencode:"reqq"`
+	UploadOnly   int              `bencode:"upload_only,omitempty"` // BEP 21
 }
 
 // NewExtensionHandshake returns a new ExtensionHandshakeMessage by filling the struct with given values.
@@ -139,8 +140,10 @@ type ExtensionMetadataMessage struct {
 
 // ExtensionPEXMessage is the message for the PEX extension.
 type ExtensionPEXMessage struct {
-	Added   string `bencode:"added"`
-	Dropped string `bencode:"dropped"`
+	Added    string `bencode:"added"`
+	Dropped  string `bencode:"dropped"`
+	Added6   string `bencode:"added6,omitempty"`
+	Dropped6 string `bencode:"dropped6,omitempty"`
 }
 
 func truncateIP(ip net.IP) net.IP {
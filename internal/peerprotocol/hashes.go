@@ -0,0 +1,64 @@
+package peerprotocol
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// HashRequestMessage is sent to request the hashes in a layer of the merkle tree of a file in a v2 torrent (BEP 52).
+// Uncle hashes are requested for verifying the hashes up to ProofLayers above the base layer.
+type HashRequestMessage struct {
+	PiecesRoot  [32]byte
+	BaseLayer   uint32
+	Index       uint32
+	Length      uint32
+	ProofLayers uint32
+}
+
+// ID returns the peer protocol message type.
+func (m HashRequestMessage) ID() MessageID { return HashRequest }
+
+// Read message data into buffer b.
+func (m HashRequestMessage) Read(b []byte) (int, error) {
+	copy(b[0:32], m.PiecesRoot[:])
+	binary.BigEndian.PutUint32(b[32:36], m.BaseLayer)
+	binary.BigEndian.PutUint32(b[36:40], m.Index)
+	binary.BigEndian.PutUint32(b[40:44], m.Length)
+	binary.BigEndian.PutUint32(b[44:48], m.ProofLayers)
+	return 48, io.EOF
+}
+
+// HashRejectMessage is sent to peer to tell that we are rejecting a hash request from you.
+type HashRejectMessage struct{ HashRequestMessage }
+
+// ID returns the peer protocol message type.
+func (m HashRejectMessage) ID() MessageID { return HashReject }
+
+// HashesMessage is sent in response to a hash request.
+// Hashes contains the requested hashes followed by the uncle hashes from the bottom to the top of the tree.
+type HashesMessage struct {
+	HashRequestMessage
+	Hashes []byte
+}
+
+// ID returns the peer protocol message type.
+func (m HashesMessage) ID() MessageID { return Hashes }
+
+// Read message bytes.
+func (m HashesMessage) Read([]byte) (int, error) {
+	panic("Read must not be called, use WriteTo")
+}
+
+// WriteTo writes the bytes into io.Writer.
+func (m HashesMessage) WriteTo(w io.Writer) (n int64, err error) {
+	var b [48]byte
+	_, _ = m.HashRequestMessage.Read(b[:])
+	nn, err := w.Write(b[:])
+	n += int64(nn)
+	if err != nil {
+		return
+	}
+	nn, err = w.Write(m.Hashes)
+	n += int64(nn)
+	return
+}
@@ -15,17 +15,22 @@ const (
 
 // PEXList contains the list of peer address for sending them to a peer at certain interval.
 // List contains 2 separate lists for added and dropped addresses.
+// IPv4 and IPv6 addresses are kept separately because they are sent in different keys of the PEX message.
 type PEXList struct {
-	added   map[tracker.CompactPeer]struct{}
-	dropped map[tracker.CompactPeer]struct{}
-	flushed bool
+	added    map[tracker.CompactPeer]struct{}
+	dropped  map[tracker.CompactPeer]struct{}
+	added6   map[tracker.CompactPeer6]struct{}
+	dropped6 map[tracker.CompactPeer6]struct{}
+	flushed  bool
 }
 
 // New returns a new empty PEXList.
 func New() *PEXList {
 	return &PEXList{
-		added:   make(map[tracker.CompactPeer]struct{}),
-		dropped: make(map[tracker.CompactPeer]struct{}),
+		added:    make(map[tracker.CompactPeer]struct{}),
+		dropped:  make(map[tracker.CompactPeer]struct{}),
+		added6:   make(map[tracker.CompactPeer6]struct{}),
+		dropped6: make(map[tracker.CompactPeer6]struct{}),
 	}
 }
 
@@ -40,6 +45,12 @@ func NewWithRecentlySeen(rs []tracker.CompactPeer) *PEXList {
 
 // Add adds the address to the added part and removes from dropped part.
 func (l *PEXList) Add(addr *net.TCPAddr) {
+	if addr.IP.To4() == nil {
+		p := tracker.NewCompactPeer6(addr)
+		l.added6[p] = struct{}{}
+		delete(l.dropped6, p)
+		return
+	}
 	p := tracker.NewCompactPeer(addr)
 	l.added[p] = struct{}{}
 	delete(l.dropped, p)
@@ -47,27 +58,44 @@ func (l *PEXList) Add(addr *net.TCPAddr) {
 
 // Drop adds the address to the dropped part and removes from added part.
 func (l *PEXList) Drop(addr *net.TCPAddr) {
+	if addr.IP.To4() == nil {
+		peer := tracker.NewCompactPeer6(addr)
+		l.dropped6[peer] = struct{}{}
+		delete(l.added6, peer)
+		return
+	}
 	peer := tracker.NewCompactPeer(addr)
 	l.dropped[peer] = struct{}{}
 	delete(l.added, peer)
 }
 
 // Flush returns added and dropped parts and empty the list.
-func (l *PEXList) Flush() (added, dropped string) {
-	added = l.flush(l.added, l.flushed)
-	dropped = l.flush(l.dropped, l.flushed)
+// Except for the first call, the number of returned IPv4 and IPv6 addresses combined is limited for each part.
+func (l *PEXList) Flush() (added, added6, dropped, dropped6 string) {
+	limit := -1
+	if l.flushed {
+		limit = maxPeers
+	}
+	added, n := flush(l.added, limit)
+	added6, _ = flush(l.added6, limit-n)
+	dropped, n = flush(l.dropped, limit)
+	dropped6, _ = flush(l.dropped6, limit-n)
 	l.flushed = true
 	return
 }
 
-func (l *PEXList) flush(m map[tracker.CompactPeer]struct{}, limit bool) string {
+// flush writes at most limit items from m and removes them from m. Negative limit means no limit.
+func flush[T interface {
+	comparable
+	MarshalBinary() ([]byte, error)
+}](m map[T]struct{}, limit int) (string, int) {
 	count := len(m)
-	if limit && count > maxPeers {
-		count = maxPeers
+	if limit >= 0 && count > limit {
+		count = limit
 	}
+	n := count
 
 	var s strings.Builder
-	s.Grow(count * 6)
 	for p := range m {
 		if count == 0 {
 			break
@@ -81,5 +109,5 @@ func (l *PEXList) flush(m map[tracker.CompactPeer]struct{}, limit bool) string {
 		s.Write(b)
 		delete(m, p)
 	}
-	return s.String()
+	return s.String(), n
 }
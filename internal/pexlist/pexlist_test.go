@@ -0,0 +1,32 @@
+package pexlist
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPEXListIPv6(t *testing.T) {
+	l := New()
+	l.Add(newAddr("1.1.1.1"))
+	l.Add(newAddr("2001:db8::1"))
+	l.Drop(newAddr("2001:db8::2"))
+	added, added6, dropped, dropped6 := l.Flush()
+	assert.Equal(t, 6, len(added))
+	assert.Equal(t, 18, len(added6))
+	assert.Equal(t, 0, len(dropped))
+	assert.Equal(t, 18, len(dropped6))
+}
+
+func TestPEXListLimit(t *testing.T) {
+	l := New()
+	l.Add(newAddr("1.1.1.1"))
+	l.Flush()
+	for i := 0; i < 40; i++ {
+		l.Add(newAddr("2.2.2." + strconv.Itoa(i)))
+		l.Add(newAddr("2001:db8::" + strconv.Itoa(i+1)))
+	}
+	added, added6, _, _ := l.Flush()
+	assert.Equal(t, maxPeers, len(added)/6+len(added6)/18)
+}
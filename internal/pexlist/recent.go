@@ -16,8 +16,11 @@ type RecentlySeen struct {
 	length int
 }
 
-// Add a new address to the list.
+// Add a new address to the list. IPv6 addresses are ignored.
 func (l *RecentlySeen) Add(addr *net.TCPAddr) {
+	if addr.IP.To4() == nil {
+		return
+	}
 	cp := tracker.NewCompactPeer(addr)
 	if l.has(cp) {
 		return
@@ -6,7 +6,9 @@ import (
 
 	"github.com/cenkalti/rain/internal/allocator"
 	"github.com/cenkalti/rain/internal/filesection"
+	"github.com/cenkalti/rain/internal/merkle"
 	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/storage"
 	"golang.org/x/exp/constraints"
 )
 
@@ -19,6 +21,7 @@ type Piece struct {
 	Length  uint32            // always equal to Info.PieceLength except last piece
 	Data    filesection.Piece // the place to write downloaded bytes
 	Hash    []byte
+	Leaves  int // number of leaves in the merkle tree of the piece for v2 torrents, zero for v1 torrents
 	Writing bool
 	Done    bool
 }
@@ -29,6 +32,16 @@ type Block struct {
 	Length uint32 // Cannot exceed BlockSize. It's shorter for last block or if the next file is a padding file.
 }
 
+// Reader implements storage.PieceReader by reading the file sections of pieces.
+type Reader []Piece
+
+var _ storage.PieceReader = Reader(nil)
+
+// ReadPiece reads len(b) bytes from the piece at index starting at offset.
+func (r Reader) ReadPiece(index uint32, offset int64, b []byte) (int, error) {
+	return r[index].Data.ReadAt(b, offset)
+}
+
 // NewPieces returns a slice of Pieces by mapping files to the pieces.
 func NewPieces(info *metainfo.Info, files []allocator.File) []Piece {
 	var (
@@ -56,8 +69,9 @@ func NewPieces(info *metainfo.Info, files []allocator.File) []Piece {
 	pieces := make([]Piece, info.NumPieces)
 	for i := uint32(0); i < info.NumPieces; i++ {
 		p := Piece{
-			Index: i,
-			Hash:  info.PieceHash(i),
+			Index:  i,
+			Hash:   info.PieceHash(i),
+			Leaves: info.PieceLeaves(i),
 		}
 
 		var sections filesection.Piece
@@ -167,10 +181,21 @@ func (p *Piece) calculateBlocks(blockSize uint32) []Block {
 }
 
 // VerifyHash returns true if hash of piece data in buffer `buf` matches the hash of Piece.
+// Pieces of v2 torrents are verified with their merkle root and h is not used.
 func (p *Piece) VerifyHash(buf []byte, h hash.Hash) bool {
 	if uint32(len(buf)) != p.Length {
 		return false
 	}
+	if p.Leaves > 0 {
+		// Padding is not part of the merkle tree. Files of v2 torrents are followed by padding, so it is at the end of the piece.
+		var n int64
+		for _, sec := range p.Data {
+			if !sec.Padding {
+				n += sec.Length
+			}
+		}
+		return bytes.Equal(merkle.PieceRoot(buf[:n], p.Leaves), p.Hash)
+	}
 	_, _ = h.Write(buf)
 	sum := h.Sum(nil)
 	return bytes.Equal(sum, p.Hash)
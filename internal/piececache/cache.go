@@ -73,6 +73,16 @@ func (c *Cache) Len() int {
 	return len(c.items)
 }
 
+// Hits returns the number of Get calls that found the item in the cache.
+func (c *Cache) Hits() int64 {
+	return c.NumCached.Count()
+}
+
+// Misses returns the number of Get calls that did not find the item in the cache.
+func (c *Cache) Misses() int64 {
+	return c.NumTotal.Count() - c.NumCached.Count()
+}
+
 // LoadsActive returns the number of active Loader calls.
 func (c *Cache) LoadsActive() int {
 	return (c.sem.Len())
@@ -256,3 +256,22 @@ func TestClear(t *testing.T) {
 
 	time.Sleep(ttl + 10*time.Millisecond)
 }
+
+func TestHitsMisses(t *testing.T) {
+	c := New(10, time.Minute, 1)
+	defer c.Close()
+
+	loader := func() ([]byte, error) { return []byte("bar"), nil }
+	for i := 0; i < 3; i++ {
+		_, err := c.Get("foo", loader)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Hits() != 2 {
+		t.Fatalf("unexpected hits: %d", c.Hits())
+	}
+	if c.Misses() != 1 {
+		t.Fatalf("unexpected misses: %d", c.Misses())
+	}
+}
@@ -23,6 +23,9 @@ type PieceDownloader struct {
 	AllowedFast bool
 	Buffer      bufferpool.Buffer
 
+	// Number of times the peer has timed out while downloading this piece.
+	Timeouts int
+
 	// blocks contains blocks that needs to be downloaded from peers.
 	// It does not contain the parts that belong to padding files.
 	blocks    map[uint32]uint32   // begin -> length
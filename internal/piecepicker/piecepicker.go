@@ -2,6 +2,7 @@ package piecepicker
 
 import (
 	"fmt"
+	"math/rand"
 	"sort"
 
 	"github.com/cenkalti/rain/internal/peer"
@@ -22,8 +23,10 @@ These are the things to consider when selecting a piece for downloading:
   * Piece is marked as allowed-fast
   * Piece is requested from another peers
   * Piece is reserved for downloading by a webseed source
-  * Is endgame mode activated (all pieces are requested)
+  * Is endgame mode activated (all pieces are requested or remaining blocks are below threshold)
   * Are there stalled peers (snubbed or choked in the middle of download)
+  * Priority of the piece and sequential download mode
+  * Piece is skipped because it belongs to files that are not going to be downloaded
 
 Do not forget to re-check these when making changes.
 
@@ -39,6 +42,10 @@ type PiecePicker struct {
 	maxDuplicateDownload int
 	available            uint32
 	endgame              bool
+	endgameBlocks        uint32
+	endgamePercent       float64
+	sequential           bool
+	randomFirstPieces    uint32
 }
 
 type myPiece struct {
@@ -47,9 +54,17 @@ type myPiece struct {
 	Requested sliceset.SliceSet[peer.Peer]
 	Snubbed   sliceset.SliceSet[peer.Peer]
 	Choked    sliceset.SliceSet[peer.Peer]
+	// Peers that gave up downloading the piece after request timeouts.
+	TimedOut sliceset.SliceSet[peer.Peer]
 
 	// Downloading from webseed source or marked to be downloaded later.
 	RequestedWebseed *webseedsource.WebseedSource
+
+	// Pieces with higher priority are picked first.
+	Priority int
+
+	// Skipped pieces are never picked.
+	Skip bool
 }
 
 // RunningDownloads returns the number of pieces that are being downloaded actively.
@@ -63,14 +78,23 @@ func (p *myPiece) StalledDownloads() int {
 	return p.Snubbed.Len() + p.Choked.Len()
 }
 
+// pickableFrom returns true if the piece can be picked for downloading from the peer.
+// Peers that gave up downloading the piece are not picked while other peers have the piece.
+func (p *myPiece) pickableFrom(pe *peer.Peer) bool {
+	if !p.Having.Has(pe) {
+		return false
+	}
+	return !p.TimedOut.Has(pe) || p.Having.Len() <= p.TimedOut.Len()
+}
+
 // AvailableForWebseed returns true if the piece can be downloaded from a webseed source.
 // If the piece is already requested from a peer, it does not become eligible for downloading from webseed until entering the endgame mode.
 func (p *myPiece) AvailableForWebseed(duplicate bool) bool {
-	if p.Done || p.Writing || p.RequestedWebseed != nil {
+	if p.Done || p.Writing || p.Skip || p.RequestedWebseed != nil {
 		return false
 	}
 	if !duplicate {
-		return p.RequestedWebseed != nil
+		return p.Requested.Len() == 0
 	}
 	return true
 }
@@ -146,6 +170,42 @@ func (p *PiecePicker) RequestedWebseedSource(i uint32) *webseedsource.WebseedSou
 	return p.pieces[i].RequestedWebseed
 }
 
+// SetPriority sets the priority of the piece at index. Pieces with higher priority are picked first. Default priority is 0.
+func (p *PiecePicker) SetPriority(i uint32, priority int) {
+	p.pieces[i].Priority = priority
+}
+
+// SetSkip sets the skip status of the piece at index. Skipped pieces are not downloaded.
+func (p *PiecePicker) SetSkip(i uint32, value bool) {
+	p.pieces[i].Skip = value
+}
+
+// SetSequential sets the sequential download mode.
+// In sequential mode, pieces with same priority are picked in the order of their indexes instead of their rarity.
+func (p *PiecePicker) SetSequential(value bool) {
+	p.sequential = value
+}
+
+// SetRandomFirstPieces sets the number of pieces that are picked randomly instead of rarest-first when starting a download.
+// Rarest pieces are often being downloaded by other peers too. Picking random pieces at start lets us complete
+// the first pieces quickly, so we have something to trade for being unchoked by other peers.
+func (p *PiecePicker) SetRandomFirstPieces(n uint32) {
+	p.randomFirstPieces = n
+}
+
+// SetEndgameThreshold sets the thresholds for activating endgame mode before all pieces are requested.
+// Endgame mode is activated when the number of remaining blocks is less than or equal to blocks,
+// or when the remaining blocks are less than or equal to percent of all blocks. Zero values disable the thresholds.
+func (p *PiecePicker) SetEndgameThreshold(blocks uint32, percent float64) {
+	p.endgameBlocks = blocks
+	p.endgamePercent = percent
+}
+
+// Endgame returns true if endgame mode is activated.
+func (p *PiecePicker) Endgame() bool {
+	return p.endgame
+}
+
 // HandleHave must be called to set the availability of the piece at the peer.
 func (p *PiecePicker) HandleHave(pe *peer.Peer, i uint32) {
 	pe.Bitfield.Set(i)
@@ -165,6 +225,13 @@ func (p *PiecePicker) HandleSnubbed(pe *peer.Peer, i uint32) {
 	p.pieces[i].Snubbed.Add(pe)
 }
 
+// HandleRequestTimeout must be called when the piece download from the peer is given up after request timeouts.
+// The piece is released for other peers and is not picked for the peer again while other peers have it.
+func (p *PiecePicker) HandleRequestTimeout(pe *peer.Peer, i uint32) {
+	p.HandleCancelDownload(pe, i)
+	p.pieces[i].TimedOut.Add(pe)
+}
+
 // HandleChoke must be called to set choke status of the remote peer.
 func (p *PiecePicker) HandleChoke(pe *peer.Peer, i uint32) {
 	p.pieces[i].Snubbed.Remove(pe)
@@ -186,6 +253,7 @@ func (p *PiecePicker) HandleCancelDownload(pe *peer.Peer, i uint32) {
 func (p *PiecePicker) HandleDisconnect(pe *peer.Peer) {
 	for i := range p.pieces {
 		p.HandleCancelDownload(pe, uint32(i))
+		p.pieces[i].TimedOut.Remove(pe)
 		p.removeHavingPeer(i, pe)
 	}
 }
@@ -243,6 +311,7 @@ func (p *PiecePicker) findPiece(pe *peer.Peer) (mp *myPiece, allowedFast bool) {
 	if pe.PeerChoking {
 		return nil, false
 	}
+	p.checkEndgameThreshold()
 	// Short path for endgame mode.
 	if p.endgame {
 		return p.pickEndgame(pe), false
@@ -263,10 +332,10 @@ func (p *PiecePicker) findPiece(pe *peer.Peer) (mp *myPiece, allowedFast bool) {
 func (p *PiecePicker) pickAllowedFast(pe *peer.Peer) *myPiece {
 	for _, pi := range pe.ReceivedAllowedFast.Items {
 		mp := &p.pieces[pi.Index]
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Skip {
 			continue
 		}
-		if mp.Requested.Len() == 0 && mp.Having.Has(pe) {
+		if mp.Requested.Len() == 0 && mp.pickableFrom(pe) {
 			return mp
 		}
 	}
@@ -274,18 +343,51 @@ func (p *PiecePicker) pickAllowedFast(pe *peer.Peer) *myPiece {
 }
 
 func (p *PiecePicker) pickRarest(pe *peer.Peer) *myPiece {
-	// Sort by rarity
+	if !p.sequential && p.randomFirstPieces > 0 && p.donePieces() < p.randomFirstPieces {
+		// Sort by priority only, pieces with same priority are picked randomly.
+		rand.Shuffle(len(p.piecesByAvailability), func(i, j int) {
+			p.piecesByAvailability[i], p.piecesByAvailability[j] = p.piecesByAvailability[j], p.piecesByAvailability[i]
+		})
+		sort.SliceStable(p.piecesByAvailability, func(i, j int) bool {
+			return p.piecesByAvailability[i].Priority > p.piecesByAvailability[j].Priority
+		})
+		return p.pickUnrequested(pe)
+	}
+	// Sort by priority, then by index or rarity
 	sort.Slice(p.piecesByAvailability, func(i, j int) bool {
-		return len(p.piecesByAvailability[i].Having.Items) < len(p.piecesByAvailability[j].Having.Items)
+		a, b := p.piecesByAvailability[i], p.piecesByAvailability[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if p.sequential {
+			return a.Index < b.Index
+		}
+		return len(a.Having.Items) < len(b.Having.Items)
 	})
+	return p.pickUnrequested(pe)
+}
+
+func (p *PiecePicker) donePieces() uint32 {
+	var n uint32
+	for i := range p.pieces {
+		if p.pieces[i].Done {
+			n++
+		}
+	}
+	return n
+}
+
+// pickUnrequested returns the first piece in piecesByAvailability that has not been requested yet.
+// Endgame mode is activated if all pieces are requested.
+func (p *PiecePicker) pickUnrequested(pe *peer.Peer) *myPiece {
 	var picked *myPiece
 	var hasUnrequested bool
 	// Select unrequested piece
 	for _, mp := range p.piecesByAvailability {
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Skip {
 			continue
 		}
-		if mp.Requested.Len() == 0 && mp.Having.Has(pe) {
+		if mp.Requested.Len() == 0 && mp.pickableFrom(pe) {
 			picked = mp
 			break
 		}
@@ -299,6 +401,31 @@ func (p *PiecePicker) pickRarest(pe *peer.Peer) *myPiece {
 	return picked
 }
 
+// checkEndgameThreshold activates endgame mode if the number of remaining blocks drops below the configured thresholds.
+func (p *PiecePicker) checkEndgameThreshold() {
+	if p.endgame || (p.endgameBlocks == 0 && p.endgamePercent <= 0) {
+		return
+	}
+	var total, remaining uint64
+	for i := range p.pieces {
+		mp := &p.pieces[i]
+		if mp.Skip {
+			continue
+		}
+		n := (uint64(mp.Length) + piece.BlockSize - 1) / piece.BlockSize
+		total += n
+		if !mp.Done {
+			remaining += n
+		}
+	}
+	if remaining == 0 {
+		return
+	}
+	if remaining <= uint64(p.endgameBlocks) || float64(remaining) <= float64(total)*p.endgamePercent/100 {
+		p.endgame = true
+	}
+}
+
 func (p *PiecePicker) pickEndgame(pe *peer.Peer) *myPiece {
 	// Sort by request count
 	sort.Slice(p.piecesByAvailability, func(i, j int) bool {
@@ -306,10 +433,10 @@ func (p *PiecePicker) pickEndgame(pe *peer.Peer) *myPiece {
 	})
 	// Select unrequested piece
 	for _, mp := range p.piecesByAvailability {
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Skip {
 			continue
 		}
-		if mp.Requested.Len() < p.maxDuplicateDownload && mp.Having.Has(pe) {
+		if mp.Requested.Len() < p.maxDuplicateDownload && mp.pickableFrom(pe) {
 			return mp
 		}
 	}
@@ -323,13 +450,13 @@ func (p *PiecePicker) pickStalled(pe *peer.Peer) *myPiece {
 	})
 	// Select unrequested piece
 	for _, mp := range p.piecesByStalled {
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Skip {
 			continue
 		}
 		if mp.RunningDownloads() > 0 {
 			continue
 		}
-		if mp.Requested.Len() < p.maxDuplicateDownload && mp.Having.Has(pe) {
+		if mp.Requested.Len() < p.maxDuplicateDownload && mp.pickableFrom(pe) {
 			return mp
 		}
 	}
@@ -69,6 +69,148 @@ func TestPiecePicker(t *testing.T) {
 	assert.True(t, pp.endgame)
 }
 
+func TestPiecePickerPriority(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	peers := make([]*peer.Peer, numPeers)
+	for i := range peers {
+		peers[i] = newPeer(i)
+	}
+	pp := New(pieces, 2, nil)
+	for i := uint32(0); i < numPieces; i++ {
+		pp.HandleHave(peers[0], i)
+		pp.HandleHave(peers[1], i)
+		pp.HandleHave(peers[2], i)
+	}
+	pp.HandleHave(newPeer(3), 2)
+
+	// Piece 2 is less rare than others but it has higher priority.
+	pp.SetPriority(2, 1)
+	assert.Equal(t, &pieces[2], pp.pickFor(peers[0]))
+
+	// Other pieces are picked in order in sequential mode.
+	pp.SetSequential(true)
+	assert.Equal(t, &pieces[0], pp.pickFor(peers[1]))
+	assert.Equal(t, &pieces[1], pp.pickFor(peers[2]))
+}
+
+func TestPiecePickerSkip(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+		pieces[i].Done = i > 1
+	}
+	pp := New(pieces, 2, nil)
+	pe := newPeer(0)
+	pp.HandleHave(pe, 0)
+	pp.HandleHave(pe, 1)
+
+	pp.SetSkip(0, true)
+	assert.Equal(t, &pieces[1], pp.pickFor(pe))
+	pe.Downloading = true
+
+	// Skipped piece is not picked in endgame mode either.
+	pe2 := newPeer(1)
+	pp.HandleHave(pe2, 0)
+	pp.HandleHave(pe2, 1)
+	assert.Equal(t, &pieces[1], pp.pickFor(pe2))
+	assert.True(t, pp.endgame)
+}
+
+func TestPiecePickerRandomFirstPieces(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pp := New(pieces, 2, nil)
+	pp.SetRandomFirstPieces(1)
+	pe := newPeer(0)
+	pe2 := newPeer(1)
+	for i := uint32(0); i < numPieces; i++ {
+		pp.HandleHave(pe, i)
+		if i != 0 {
+			pp.HandleHave(pe2, i)
+		}
+	}
+
+	// Piece 0 is the rarest but pieces are picked randomly until the first piece is done.
+	picked := make(map[uint32]struct{})
+	for i := 0; i < 100 && len(picked) < 2; i++ {
+		pi := pp.pickFor(pe)
+		picked[pi.Index] = struct{}{}
+		pp.HandleCancelDownload(pe, pi.Index)
+	}
+	assert.Len(t, picked, 2)
+
+	// Rarest piece is picked after the first piece is done.
+	pieces[1].Done = true
+	assert.Equal(t, &pieces[0], pp.pickFor(pe))
+}
+
+func TestPiecePickerEndgameThreshold(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+		pieces[i].Length = 4 * piece.BlockSize
+		pieces[i].Done = i < 4
+	}
+	pp := New(pieces, 2, nil)
+	pp.SetEndgameThreshold(8, 0)
+	pe := newPeer(0)
+	for i := uint32(0); i < numPieces; i++ {
+		pp.HandleHave(pe, i)
+	}
+
+	// 12 blocks are remaining.
+	assert.NotNil(t, pp.pickFor(pe))
+	assert.False(t, pp.Endgame())
+
+	// 8 blocks are remaining. Endgame is activated although there are unrequested pieces.
+	pieces[4].Done = true
+	pe2 := newPeer(1)
+	pp.HandleHave(pe2, 5)
+	assert.Equal(t, &pieces[5], pp.pickFor(pe2))
+	assert.True(t, pp.Endgame())
+
+	// Percentage threshold.
+	pieces[4].Done = false
+	pp = New(pieces, 2, nil)
+	pp.SetEndgameThreshold(0, 50)
+	pp.HandleHave(pe2, 5)
+	assert.NotNil(t, pp.pickFor(pe2))
+	assert.True(t, pp.Endgame())
+}
+
+func TestPiecePickerRequestTimeout(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+		pieces[i].Done = i > 1
+	}
+	pp := New(pieces, 2, nil)
+	pe := newPeer(0)
+	pp.HandleHave(pe, 0)
+	pp.HandleHave(pe, 1)
+	pp.HandleHave(pe, 2)
+	assert.Equal(t, &pieces[0], pp.pickFor(pe))
+
+	// Released piece is not picked for the same peer while another peer has it.
+	pe2 := newPeer(1)
+	pp.HandleHave(pe2, 0)
+	pp.HandleRequestTimeout(pe, 0)
+	assert.Equal(t, &pieces[1], pp.pickFor(pe))
+	assert.Equal(t, &pieces[0], pp.pickFor(pe2))
+
+	// Peer is picked again if no other peer has the piece.
+	pp.HandleCancelDownload(pe, 1)
+	pp.HandleCancelDownload(pe2, 0)
+	pp.HandleDisconnect(pe2)
+	pieces[1].Done = true
+	assert.Equal(t, &pieces[0], pp.pickFor(pe))
+}
+
 func newPiece(i int) piece.Piece {
 	return piece.Piece{Index: uint32(i)}
 }
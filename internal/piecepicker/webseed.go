@@ -84,10 +84,10 @@ func (p *PiecePicker) peerStealsFromWebseed(pe *peer.Peer) *myPiece {
 		}
 		for i := src.Downloader.End - 1; i > src.Downloader.ReadCurrent(); i-- {
 			pi := &p.pieces[i]
-			if pi.Done || pi.Writing {
+			if pi.Done || pi.Writing || pi.Skip {
 				continue
 			}
-			if !pi.Having.Has(pe) {
+			if !pi.pickableFrom(pe) {
 				continue
 			}
 			if pi.Requested.Len() > 0 {
@@ -145,7 +145,7 @@ func (p *PiecePicker) pickLastPieceOfSmallestGap(pe *peer.Peer) *myPiece {
 		// Convert index to int because it goes below zero in loop.
 		for i := int(gap.End - 1); i >= int(gap.Begin); i-- {
 			mp := &p.pieces[i]
-			if !mp.Having.Has(pe) {
+			if !mp.pickableFrom(pe) {
 				continue
 			}
 			if pe.PeerChoking && !pe.ReceivedAllowedFast.Has(mp.Piece) {
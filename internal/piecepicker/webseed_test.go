@@ -17,3 +17,16 @@ func TestPickLastPieceOfSmallestGap(t *testing.T) {
 	pp := New(pieces, 2, nil)
 	assert.Nil(t, pp.pickLastPieceOfSmallestGap(peer))
 }
+
+func TestFindGapsSkipsRequestedPieces(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pieces[0].Done = true
+	pp := New(pieces, 2, nil)
+	pe := newPeer(0)
+	pp.HandleHave(pe, 3)
+	pp.pieces[3].Requested.Add(pe)
+	assert.Equal(t, []Range{{Begin: 1, End: 3}, {Begin: 4, End: numPieces}}, pp.findGaps())
+}
@@ -2,6 +2,7 @@ package piecewriter
 
 import (
 	"crypto/sha1"
+	"time"
 
 	"github.com/cenkalti/rain/internal/bufferpool"
 	"github.com/cenkalti/rain/internal/piece"
@@ -14,9 +15,13 @@ type PieceWriter struct {
 	Piece  *piece.Piece
 	Source interface{}
 	Buffer bufferpool.Buffer
+	// Validate is called after the hash check and before writing the data, if not nil.
+	// The data is not written if it returns an error.
+	Validate func(index uint32, data []byte) error
 
-	HashOK bool
-	Error  error
+	HashOK          bool
+	ValidationError error
+	Error           error
 }
 
 // New returns new PieceWriter for a given piece.
@@ -28,18 +33,33 @@ func New(p *piece.Piece, source interface{}, buf bufferpool.Buffer) *PieceWriter
 	}
 }
 
-// Run checks the hash, then writes the data in the buffer to the disk.
-func (w *PieceWriter) Run(resultC chan *PieceWriter, closeC chan struct{}, writesPerSecond, writeBytesPerSecond metrics.Meter, sem *semaphore.Semaphore) {
+// Run checks the hash and validates the data, then writes the data in the buffer to the disk.
+// The data is not written if closeC is closed while waiting for the semaphore.
+// writeLatency is updated with the duration of the write to disk, excluding the time spent waiting for the semaphore.
+func (w *PieceWriter) Run(resultC chan *PieceWriter, closeC chan struct{}, writesPerSecond, writeBytesPerSecond metrics.Meter, writeLatency metrics.Timer, sem *semaphore.Semaphore) {
 	w.HashOK = w.Piece.VerifyHash(w.Buffer.Data, sha1.New())
-	if w.HashOK {
+	if w.HashOK && w.Validate != nil {
+		w.ValidationError = w.Validate(w.Piece.Index, w.Buffer.Data)
+	}
+	if w.HashOK && w.ValidationError == nil {
+		sem.Wait()
+		select {
+		case <-closeC:
+			sem.Signal()
+			w.Buffer.Release()
+			return
+		default:
+		}
 		writesPerSecond.Mark(1)
 		writeBytesPerSecond.Mark(int64(len(w.Buffer.Data)))
-		sem.Wait()
+		begin := time.Now()
 		_, w.Error = w.Piece.Data.Write(w.Buffer.Data)
+		writeLatency.UpdateSince(begin)
 		sem.Signal()
 	}
 	select {
 	case resultC <- w:
 	case <-closeC:
+		w.Buffer.Release()
 	}
 }
@@ -0,0 +1,103 @@
+package piecewriter
+
+import (
+	"sync"
+
+	"github.com/cenkalti/rain/internal/semaphore"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Pool runs PieceWriters in a bounded number of goroutines.
+// PieceWriters are queued until a worker is available. Workers are started on demand.
+// Methods other than Close must be called from the same goroutine.
+type Pool struct {
+	maxWorkers int
+	workers    int
+	// Number of PieceWriters added but not marked as Done yet.
+	pending int
+	size    int
+
+	queueC  chan *PieceWriter
+	resultC chan *PieceWriter
+	closeC  chan struct{}
+	wg      sync.WaitGroup
+
+	writesPerSecond     metrics.Meter
+	writeBytesPerSecond metrics.Meter
+	writeLatency        metrics.Timer
+	sem                 *semaphore.Semaphore
+}
+
+// NewPool returns a new Pool that writes at most `workers` pieces in parallel and queues `queueLength` more.
+// Results are sent to resultC. sem limits the number of writes shared with other Pools.
+func NewPool(workers, queueLength int, resultC chan *PieceWriter, writesPerSecond, writeBytesPerSecond metrics.Meter, writeLatency metrics.Timer, sem *semaphore.Semaphore) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueLength < 0 {
+		queueLength = 0
+	}
+	size := workers + queueLength
+	return &Pool{
+		maxWorkers:          workers,
+		size:                size,
+		queueC:              make(chan *PieceWriter, size),
+		resultC:             resultC,
+		closeC:              make(chan struct{}),
+		writesPerSecond:     writesPerSecond,
+		writeBytesPerSecond: writeBytesPerSecond,
+		writeLatency:        writeLatency,
+		sem:                 sem,
+	}
+}
+
+// Full returns true if no more PieceWriters can be added until a result is received.
+func (p *Pool) Full() bool {
+	return p.pending >= p.size
+}
+
+// Add queues the PieceWriter. It must not be called when the Pool is full.
+func (p *Pool) Add(w *PieceWriter) {
+	if p.Full() {
+		panic("piece writer pool is full")
+	}
+	p.pending++
+	p.queueC <- w
+	if p.workers < p.maxWorkers && p.workers < p.pending {
+		p.workers++
+		p.wg.Add(1)
+		go p.worker()
+	}
+}
+
+// Done must be called after receiving a result from the result channel.
+func (p *Pool) Done() {
+	p.pending--
+}
+
+// Close stops the workers and waits for ongoing writes to finish.
+// Results of the PieceWriters that are not received yet are discarded.
+func (p *Pool) Close() {
+	close(p.closeC)
+	p.wg.Wait()
+	for {
+		select {
+		case w := <-p.queueC:
+			w.Buffer.Release()
+		default:
+			return
+		}
+	}
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+	for {
+		select {
+		case w := <-p.queueC:
+			w.Run(p.resultC, p.closeC, p.writesPerSecond, p.writeBytesPerSecond, p.writeLatency, p.sem)
+		case <-p.closeC:
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package piecewriter
+
+import (
+	"crypto/sha1"
+	"testing"
+
+	"github.com/cenkalti/rain/internal/bufferpool"
+	"github.com/cenkalti/rain/internal/filesection"
+	"github.com/cenkalti/rain/internal/piece"
+	"github.com/cenkalti/rain/internal/semaphore"
+	"github.com/cenkalti/rain/internal/storage/memstorage"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	const numPieces = 10
+	const pieceLength = 16
+	f, _, err := memstorage.New().Open("file", numPieces*pieceLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bp := bufferpool.New(pieceLength)
+	resultC := make(chan *PieceWriter)
+	p := NewPool(2, 1, resultC, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilTimer{}, semaphore.New(1))
+	defer p.Close()
+
+	writers := make([]*PieceWriter, numPieces)
+	for i := range writers {
+		buf := bp.Get(pieceLength)
+		for j := range buf.Data {
+			buf.Data[j] = byte(i)
+		}
+		hash := sha1.Sum(buf.Data)
+		pi := &piece.Piece{
+			Index:  uint32(i),
+			Length: pieceLength,
+			Data:   filesection.Piece{{File: f, Offset: int64(i * pieceLength), Length: pieceLength}},
+			Hash:   hash[:],
+		}
+		writers[i] = New(pi, nil, buf)
+	}
+	// The last piece is corrupt.
+	writers[numPieces-1].Piece.Hash = make([]byte, sha1.Size)
+
+	var next, done int
+	for done < numPieces {
+		if next < numPieces && !p.Full() {
+			p.Add(writers[next])
+			next++
+			continue
+		}
+		w := <-resultC
+		p.Done()
+		done++
+		assert.NoError(t, w.Error)
+		assert.Equal(t, w.Piece.Index != numPieces-1, w.HashOK)
+	}
+
+	b := make([]byte, pieceLength)
+	for i := 0; i < numPieces-1; i++ {
+		_, err = f.ReadAt(b, int64(i*pieceLength))
+		assert.NoError(t, err)
+		assert.Equal(t, byte(i), b[0])
+	}
+	_, err = f.ReadAt(b, (numPieces-1)*pieceLength)
+	assert.NoError(t, err)
+	assert.Equal(t, make([]byte, pieceLength), b)
+}
@@ -0,0 +1,45 @@
+package portmapper
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+var errNoDefaultGateway = errors.New("default gateway not found")
+
+// defaultGateway returns the gateway of the default route read from the routing table.
+func defaultGateway() (net.IP, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		// Columns: Iface Destination Gateway ...
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		// Addresses in the routing table are in host byte order.
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+		if ip.IsUnspecified() {
+			continue
+		}
+		return ip, nil
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errNoDefaultGateway
+}
@@ -0,0 +1,13 @@
+// +build !linux
+
+package portmapper
+
+import (
+	"errors"
+	"net"
+)
+
+// defaultGateway is not implemented on this platform, so only UPnP can be used.
+func defaultGateway() (net.IP, error) {
+	return nil, errors.New("finding default gateway is not supported on this platform")
+}
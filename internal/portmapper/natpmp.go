@@ -0,0 +1,112 @@
+package portmapper
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// natPMPPort is the port that NAT-PMP servers listen on the gateway.
+const natPMPPort = 5351
+
+// Initial wait time for a NAT-PMP response. It is doubled on each retry as described in RFC 6886.
+const natPMPInitialTimeout = 250 * time.Millisecond
+
+var errNATPMPInvalidResponse = errors.New("invalid NAT-PMP response")
+
+// natPMP is a client for the NAT Port Mapping Protocol described in RFC 6886.
+type natPMP struct {
+	addr string
+}
+
+var _ Device = (*natPMP)(nil)
+
+func newNATPMP(gateway net.IP) *natPMP {
+	return &natPMP{addr: net.JoinHostPort(gateway.String(), strconv.Itoa(natPMPPort))}
+}
+
+func (c *natPMP) Name() string {
+	return "NAT-PMP"
+}
+
+func (c *natPMP) ExternalIP(ctx context.Context) (net.IP, error) {
+	resp, err := c.request(ctx, []byte{0, 0}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IPv4(resp[8], resp[9], resp[10], resp[11]), nil
+}
+
+func (c *natPMP) AddMapping(ctx context.Context, protocol Protocol, internalPort, externalPort int, lifetime time.Duration) (int, error) {
+	var op byte
+	switch protocol {
+	case UDP:
+		op = 1
+	case TCP:
+		op = 2
+	default:
+		return 0, fmt.Errorf("unknown protocol: %s", protocol)
+	}
+	req := make([]byte, 12)
+	req[1] = op
+	binary.BigEndian.PutUint16(req[4:6], uint16(internalPort))
+	binary.BigEndian.PutUint16(req[6:8], uint16(externalPort))
+	binary.BigEndian.PutUint32(req[8:12], uint32(lifetime/time.Second))
+	resp, err := c.request(ctx, req, 16)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(resp[10:12])), nil
+}
+
+func (c *natPMP) DeleteMapping(ctx context.Context, protocol Protocol, internalPort, externalPort int) error {
+	// A mapping is deleted by requesting it with zero lifetime and zero external port.
+	_, err := c.AddMapping(ctx, protocol, internalPort, 0, 0)
+	return err
+}
+
+// request sends the request to the gateway and waits for the response, retrying on timeout until ctx is done.
+func (c *natPMP) request(ctx context.Context, req []byte, respLen int) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp4", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp := make([]byte, 16)
+	timeout := natPMPInitialTimeout
+	for {
+		_, err = conn.Write(req)
+		if err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		_ = conn.SetReadDeadline(deadline)
+		n, err := conn.Read(resp)
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			timeout *= 2
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n < respLen || resp[0] != 0 || resp[1] != req[1]+128 {
+			return nil, errNATPMPInvalidResponse
+		}
+		if code := binary.BigEndian.Uint16(resp[2:4]); code != 0 {
+			return nil, fmt.Errorf("NAT-PMP result code: %d", code)
+		}
+		return resp[:respLen], nil
+	}
+}
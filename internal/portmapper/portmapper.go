@@ -0,0 +1,285 @@
+// Package portmapper forwards ports from the gateway to the local host with UPnP-IGD or NAT-PMP.
+package portmapper
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+)
+
+// Protocol of the mapped port.
+type Protocol string
+
+const (
+	// TCP port mapping.
+	TCP Protocol = "TCP"
+	// UDP port mapping.
+	UDP Protocol = "UDP"
+)
+
+// Device is a gateway that can forward ports to the local host.
+type Device interface {
+	// Name of the protocol used for talking to the device.
+	Name() string
+	// ExternalIP returns the public address of the gateway.
+	ExternalIP(ctx context.Context) (net.IP, error)
+	// AddMapping forwards externalPort on the gateway to internalPort on the local host for lifetime.
+	// It returns the external port assigned by the gateway which may be different than the requested one.
+	AddMapping(ctx context.Context, protocol Protocol, internalPort, externalPort int, lifetime time.Duration) (int, error)
+	// DeleteMapping removes a mapping created with AddMapping.
+	DeleteMapping(ctx context.Context, protocol Protocol, internalPort, externalPort int) error
+}
+
+// Discover finds a device on the local network. NAT-PMP is tried first on the default gateway, then UPnP.
+func Discover(ctx context.Context) (Device, error) {
+	if gw, err := defaultGateway(); err == nil {
+		d := newNATPMP(gw)
+		pctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		_, err = d.ExternalIP(pctx)
+		cancel()
+		if err == nil {
+			return d, nil
+		}
+	}
+	return discoverUPnP(ctx)
+}
+
+const (
+	discoverTimeout = 10 * time.Second
+	requestTimeout  = 10 * time.Second
+	// Time to wait before searching the device again if it is not found.
+	rediscoverInterval = 5 * time.Minute
+)
+
+// PortMapper keeps the added ports mapped on the gateway by renewing their leases until it is closed.
+// Both TCP and UDP are mapped for each port.
+type PortMapper struct {
+	lifetime time.Duration
+	discover func(ctx context.Context) (Device, error)
+	log      logger.Logger
+
+	// Ports requested to be mapped.
+	ports map[int]struct{}
+	// Internal port to external port for the mappings created on the device.
+	mapped     map[int]int
+	externalIP net.IP
+	m          sync.RWMutex
+
+	changedC chan struct{}
+	closeC   chan struct{}
+	doneC    chan struct{}
+}
+
+// New returns a new PortMapper that requests mappings with the given lifetime.
+func New(lifetime time.Duration, l logger.Logger) *PortMapper {
+	return newPortMapper(lifetime, Discover, l)
+}
+
+func newPortMapper(lifetime time.Duration, discover func(ctx context.Context) (Device, error), l logger.Logger) *PortMapper {
+	return &PortMapper{
+		lifetime: lifetime,
+		discover: discover,
+		log:      l,
+		ports:    make(map[int]struct{}),
+		mapped:   make(map[int]int),
+		changedC: make(chan struct{}, 1),
+		closeC:   make(chan struct{}),
+		doneC:    make(chan struct{}),
+	}
+}
+
+// Close stops renewing the mappings and deletes them from the device.
+func (p *PortMapper) Close() {
+	close(p.closeC)
+	<-p.doneC
+}
+
+// AddPort requests port to be mapped. It does not wait for the mapping to be created.
+func (p *PortMapper) AddPort(port int) {
+	p.m.Lock()
+	p.ports[port] = struct{}{}
+	p.m.Unlock()
+	p.notify()
+}
+
+// RemovePort requests the mapping for port to be deleted. It does not wait for the mapping to be deleted.
+func (p *PortMapper) RemovePort(port int) {
+	p.m.Lock()
+	delete(p.ports, port)
+	p.m.Unlock()
+	p.notify()
+}
+
+func (p *PortMapper) notify() {
+	select {
+	case p.changedC <- struct{}{}:
+	default:
+	}
+}
+
+// ExternalIP returns the public address of the gateway. It returns nil if there is no device found yet.
+func (p *PortMapper) ExternalIP() net.IP {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.externalIP
+}
+
+// ExternalPort returns the port on the gateway that is forwarded to port. It returns 0 if port is not mapped.
+func (p *PortMapper) ExternalPort(port int) int {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.mapped[port]
+}
+
+// Run discovers the device and keeps the requested ports mapped until Close is called.
+func (p *PortMapper) Run() {
+	defer close(p.doneC)
+
+	var device Device
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if device == nil {
+				device = p.findDevice()
+				if device == nil {
+					timer.Reset(rediscoverInterval)
+					continue
+				}
+			}
+			p.updateExternalIP(device)
+			p.sync(device, true)
+			timer.Reset(p.lifetime / 2)
+		case <-p.changedC:
+			if device != nil {
+				p.sync(device, false)
+			}
+		case <-p.closeC:
+			if device != nil {
+				p.deleteAll(device)
+			}
+			return
+		}
+	}
+}
+
+func (p *PortMapper) findDevice() Device {
+	ctx, cancel := p.context(discoverTimeout)
+	defer cancel()
+	device, err := p.discover(ctx)
+	if err != nil {
+		p.log.Debugln("cannot find port mapping device:", err)
+		return nil
+	}
+	p.log.Infoln("found port mapping device:", device.Name())
+	return device
+}
+
+func (p *PortMapper) updateExternalIP(device Device) {
+	ctx, cancel := p.context(requestTimeout)
+	defer cancel()
+	ip, err := device.ExternalIP(ctx)
+	if err != nil {
+		p.log.Warningln("cannot get external IP from port mapping device:", err)
+		return
+	}
+	p.m.Lock()
+	p.externalIP = ip
+	p.m.Unlock()
+}
+
+// sync creates the mappings for requested ports and deletes the ones that are not requested anymore.
+// Existing mappings are requested again if renew is true.
+func (p *PortMapper) sync(device Device, renew bool) {
+	var add, remove []int
+	p.m.RLock()
+	for port := range p.ports {
+		if _, ok := p.mapped[port]; renew || !ok {
+			add = append(add, port)
+		}
+	}
+	for port := range p.mapped {
+		if _, ok := p.ports[port]; !ok {
+			remove = append(remove, port)
+		}
+	}
+	p.m.RUnlock()
+
+	for _, port := range remove {
+		p.deleteMapping(device, port)
+	}
+	for _, port := range add {
+		p.addMapping(device, port)
+	}
+}
+
+func (p *PortMapper) addMapping(device Device, port int) {
+	ctx, cancel := p.context(requestTimeout)
+	defer cancel()
+	// Previously assigned port is requested when renewing the mapping.
+	p.m.RLock()
+	external, ok := p.mapped[port]
+	p.m.RUnlock()
+	if !ok {
+		external = port
+	}
+	// Same external port is requested for both protocols because a single port is announced to trackers.
+	external, err := device.AddMapping(ctx, TCP, port, external, p.lifetime)
+	if err != nil {
+		p.log.Warningf("cannot map tcp port %d: %s", port, err)
+		return
+	}
+	_, err = device.AddMapping(ctx, UDP, port, external, p.lifetime)
+	if err != nil {
+		p.log.Warningf("cannot map udp port %d: %s", port, err)
+	}
+	p.log.Debugf("mapped port %d to external port %d", port, external)
+	p.m.Lock()
+	p.mapped[port] = external
+	p.m.Unlock()
+}
+
+func (p *PortMapper) deleteMapping(device Device, port int) {
+	p.m.Lock()
+	external := p.mapped[port]
+	delete(p.mapped, port)
+	p.m.Unlock()
+	// Mappings must be deleted even if the PortMapper is closing, so closeC is not used for cancellation.
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	for _, proto := range []Protocol{TCP, UDP} {
+		err := device.DeleteMapping(ctx, proto, port, external)
+		if err != nil {
+			p.log.Debugf("cannot delete %s mapping for port %d: %s", proto, port, err)
+		}
+	}
+}
+
+func (p *PortMapper) deleteAll(device Device) {
+	p.m.RLock()
+	ports := make([]int, 0, len(p.mapped))
+	for port := range p.mapped {
+		ports = append(ports, port)
+	}
+	p.m.RUnlock()
+	for _, port := range ports {
+		p.deleteMapping(device, port)
+	}
+}
+
+// context returns a context that is cancelled after timeout or when the PortMapper is closed.
+func (p *PortMapper) context(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	go func() {
+		select {
+		case <-p.closeC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
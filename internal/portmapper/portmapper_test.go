@@ -0,0 +1,205 @@
+package portmapper
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNATPMP(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 12)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			resp := make([]byte, 16)
+			resp[1] = buf[1] + 128
+			switch {
+			case n == 2 && buf[1] == 0:
+				copy(resp[8:12], net.IPv4(1, 2, 3, 4).To4())
+				resp = resp[:12]
+			case n == 12 && (buf[1] == 1 || buf[1] == 2):
+				copy(resp[8:12], buf[4:6])
+				// Assign a different external port than requested.
+				binary.BigEndian.PutUint16(resp[10:12], binary.BigEndian.Uint16(buf[6:8])+1)
+				copy(resp[12:16], buf[8:12])
+			default:
+				binary.BigEndian.PutUint16(resp[2:4], 5)
+			}
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}()
+
+	d := &natPMP{addr: conn.LocalAddr().String()}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ip, err := d.ExternalIP(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1.2.3.4", ip.String())
+	port, err := d.AddMapping(ctx, TCP, 6881, 6881, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 6882, port)
+	err = d.DeleteMapping(ctx, UDP, 6881, 6882)
+	assert.NoError(t, err)
+}
+
+func TestUPnP(t *testing.T) {
+	var m sync.Mutex
+	var actions []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/desc.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+<device>
+<deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+<deviceList><device>
+<deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+<deviceList><device>
+<deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+<serviceList><service>
+<serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+<controlURL>/ctl</controlURL>
+</service></serviceList>
+</device></deviceList>
+</device></deviceList>
+</device>
+</root>`)
+	})
+	mux.HandleFunc("/ctl", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		action := r.Header.Get("SOAPAction")
+		m.Lock()
+		actions = append(actions, action)
+		m.Unlock()
+		switch {
+		case strings.HasSuffix(action, `#GetExternalIPAddress"`):
+			fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1"><NewExternalIPAddress>1.2.3.4</NewExternalIPAddress></u:GetExternalIPAddressResponse></s:Body></s:Envelope>`)
+		case strings.HasSuffix(action, `#AddPortMapping"`):
+			if !strings.Contains(string(b), "<NewInternalPort>6881</NewInternalPort>") {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>718</errorCode><errorDescription>ConflictInMappingEntry</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`)
+				return
+			}
+			fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body></s:Body></s:Envelope>`)
+		default:
+			fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body></s:Body></s:Envelope>`)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	d, err := newUPnP(ctx, srv.URL+"/desc.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, srv.URL+"/ctl", d.controlURL)
+	ip, err := d.ExternalIP(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1.2.3.4", ip.String())
+	port, err := d.AddMapping(ctx, TCP, 6881, 6881, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 6881, port)
+	_, err = d.AddMapping(ctx, TCP, 6882, 6882, time.Hour)
+	assert.EqualError(t, err, "UPnP error 718: ConflictInMappingEntry")
+	err = d.DeleteMapping(ctx, TCP, 6881, 6881)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"`,
+		`"urn:schemas-upnp-org:service:WANIPConnection:1#AddPortMapping"`,
+		`"urn:schemas-upnp-org:service:WANIPConnection:1#AddPortMapping"`,
+		`"urn:schemas-upnp-org:service:WANIPConnection:1#DeletePortMapping"`,
+	}, actions)
+}
+
+type testDevice struct {
+	m       sync.Mutex
+	mapping map[string]int
+}
+
+func (d *testDevice) Name() string { return "test" }
+
+func (d *testDevice) ExternalIP(ctx context.Context) (net.IP, error) {
+	return net.IPv4(1, 2, 3, 4), nil
+}
+
+func (d *testDevice) AddMapping(ctx context.Context, protocol Protocol, internalPort, externalPort int, lifetime time.Duration) (int, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.mapping[fmt.Sprintf("%s/%d", protocol, internalPort)] = externalPort + 1000
+	return externalPort + 1000, nil
+}
+
+func (d *testDevice) DeleteMapping(ctx context.Context, protocol Protocol, internalPort, externalPort int) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	delete(d.mapping, fmt.Sprintf("%s/%d", protocol, internalPort))
+	return nil
+}
+
+func (d *testDevice) len() int {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return len(d.mapping)
+}
+
+func TestPortMapper(t *testing.T) {
+	d := &testDevice{mapping: make(map[string]int)}
+	discover := func(ctx context.Context) (Device, error) { return d, nil }
+	p := newPortMapper(time.Hour, discover, logger.New("portmapper"))
+	go p.Run()
+
+	p.AddPort(6881)
+	waitFor(t, func() bool { return p.ExternalPort(6881) == 7881 })
+	assert.Equal(t, "1.2.3.4", p.ExternalIP().String())
+	assert.Equal(t, 2, d.len())
+
+	p.AddPort(6882)
+	waitFor(t, func() bool { return p.ExternalPort(6882) == 7882 })
+	assert.Equal(t, 4, d.len())
+
+	p.RemovePort(6881)
+	waitFor(t, func() bool { return d.len() == 2 })
+	assert.Equal(t, 0, p.ExternalPort(6881))
+
+	p.Close()
+	assert.Equal(t, 0, d.len())
+}
+
+func waitFor(t *testing.T, f func() bool) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if f() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout")
+}
@@ -0,0 +1,273 @@
+package portmapper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ssdpAddr = "239.255.255.250:1900"
+
+// Maximum size of the device description and SOAP responses.
+const maxUPnPResponseSize = 1 << 20
+
+var errNoUPnPDevice = errors.New("no UPnP internet gateway device found")
+
+// Services that can be used for port mapping, in order of preference.
+var upnpServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// upnp is a client for the port mapping actions of a UPnP Internet Gateway Device.
+type upnp struct {
+	controlURL  string
+	serviceType string
+	// Local address of the host in the network of the device. Mapped ports are forwarded to this address.
+	localIP net.IP
+	client  http.Client
+}
+
+var _ Device = (*upnp)(nil)
+
+// discoverUPnP searches the local network for an internet gateway device with SSDP.
+func discoverUPnP(ctx context.Context) (*upnp, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	raddr, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return nil, err
+	}
+	req := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+	_, err = conn.WriteTo([]byte(req), raddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetReadDeadline(deadline)
+	}
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			return nil, errNoUPnPDevice
+		}
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		location := resp.Header.Get("Location")
+		if location == "" {
+			continue
+		}
+		d, err := newUPnP(ctx, location)
+		if err != nil {
+			continue
+		}
+		return d, nil
+	}
+}
+
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+func (d *upnpDevice) findService(serviceType string) *upnpService {
+	for i := range d.Services {
+		if d.Services[i].ServiceType == serviceType {
+			return &d.Services[i]
+		}
+	}
+	for i := range d.Devices {
+		if s := d.Devices[i].findService(serviceType); s != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// newUPnP reads the device description at location and finds the service for port mapping.
+func newUPnP(ctx context.Context, location string) (*upnp, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	localIP, err := localIPFor(u.Host)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &upnp{localIP: localIP}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from UPnP device: %d", resp.StatusCode)
+	}
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	err = xml.NewDecoder(io.LimitReader(resp.Body, maxUPnPResponseSize)).Decode(&root)
+	if err != nil {
+		return nil, err
+	}
+	if root.URLBase != "" {
+		u, err = url.Parse(root.URLBase)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, st := range upnpServiceTypes {
+		s := root.Device.findService(st)
+		if s == nil {
+			continue
+		}
+		cu, err := u.Parse(s.ControlURL)
+		if err != nil {
+			return nil, err
+		}
+		c.controlURL = cu.String()
+		c.serviceType = st
+		return c, nil
+	}
+	return nil, errNoUPnPDevice
+}
+
+// localIPFor returns the local address that is used for connecting to the host.
+func localIPFor(hostport string) (net.IP, error) {
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		hostport = net.JoinHostPort(hostport, "80")
+	}
+	// No packets are sent for connecting a UDP socket.
+	conn, err := net.Dial("udp4", hostport)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+func (c *upnp) Name() string {
+	return "UPnP"
+}
+
+func (c *upnp) ExternalIP(ctx context.Context) (net.IP, error) {
+	var resp struct {
+		IP string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+	}
+	err := c.call(ctx, "GetExternalIPAddress", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(resp.IP)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid external IP address: %q", resp.IP)
+	}
+	return ip, nil
+}
+
+func (c *upnp) AddMapping(ctx context.Context, protocol Protocol, internalPort, externalPort int, lifetime time.Duration) (int, error) {
+	args := []upnpArg{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(externalPort)},
+		{"NewProtocol", string(protocol)},
+		{"NewInternalPort", strconv.Itoa(internalPort)},
+		{"NewInternalClient", c.localIP.String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", "rain"},
+		{"NewLeaseDuration", strconv.Itoa(int(lifetime / time.Second))},
+	}
+	err := c.call(ctx, "AddPortMapping", args, nil)
+	if err != nil {
+		return 0, err
+	}
+	return externalPort, nil
+}
+
+func (c *upnp) DeleteMapping(ctx context.Context, protocol Protocol, internalPort, externalPort int) error {
+	args := []upnpArg{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(externalPort)},
+		{"NewProtocol", string(protocol)},
+	}
+	return c.call(ctx, "DeletePortMapping", args, nil)
+}
+
+type upnpArg struct {
+	Name  string
+	Value string
+}
+
+// call invokes the SOAP action on the device and decodes the response envelope into resp if it is not nil.
+func (c *upnp) call(ctx context.Context, action string, args []upnpArg, resp interface{}) error {
+	var body strings.Builder
+	body.WriteString(`<?xml version="1.0"?>`)
+	body.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	body.WriteString(`<u:` + action + ` xmlns:u="` + c.serviceType + `">`)
+	for _, arg := range args {
+		body.WriteString("<" + arg.Name + ">")
+		_ = xml.EscapeText(&body, []byte(arg.Value))
+		body.WriteString("</" + arg.Name + ">")
+	}
+	body.WriteString(`</u:` + action + `></s:Body></s:Envelope>`)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.controlURL, strings.NewReader(body.String()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+c.serviceType+"#"+action+`"`)
+	httpResp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	r := io.LimitReader(httpResp.Body, maxUPnPResponseSize)
+	if httpResp.StatusCode != http.StatusOK {
+		var fault struct {
+			Code        int    `xml:"Body>Fault>detail>UPnPError>errorCode"`
+			Description string `xml:"Body>Fault>detail>UPnPError>errorDescription"`
+		}
+		if xml.NewDecoder(r).Decode(&fault) == nil && fault.Code != 0 {
+			return fmt.Errorf("UPnP error %d: %s", fault.Code, fault.Description)
+		}
+		return fmt.Errorf("unexpected status code from UPnP device: %d", httpResp.StatusCode)
+	}
+	if resp == nil {
+		return nil
+	}
+	return xml.NewDecoder(r).Decode(resp)
+}
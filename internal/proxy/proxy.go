@@ -0,0 +1,177 @@
+// Package proxy provides dialers that connect through SOCKS5 and HTTP CONNECT proxy servers.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// ErrUDPNotSupported is returned from ListenPacket if the proxy protocol cannot relay UDP packets.
+var ErrUDPNotSupported = errors.New("proxy does not support udp")
+
+// Dialer opens connections. net.Dialer and Proxy implement this interface.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// DialFunc is an adapter to use a function as a Dialer.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// DialContext calls f(ctx, network, address).
+func (f DialFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
+// Fallback returns a Dialer that uses direct if the connection cannot be made with primary.
+func Fallback(primary, direct Dialer) Dialer {
+	return DialFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := primary.DialContext(ctx, network, address)
+		if err == nil || ctx.Err() != nil {
+			return conn, err
+		}
+		return direct.DialContext(ctx, network, address)
+	})
+}
+
+// Proxy connects to addresses through a proxy server.
+type Proxy struct {
+	scheme string
+	addr   string
+	user   *url.Userinfo
+}
+
+var _ Dialer = (*Proxy)(nil)
+
+// New returns a new Proxy from a URL in "socks5://[user:password@]host:port" or "http://[user:password@]host:port" format.
+func New(rawURL string) (*Proxy, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	p := &Proxy{scheme: u.Scheme, addr: u.Host, user: u.User}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		p.scheme = "socks5"
+		if u.Port() == "" {
+			p.addr = net.JoinHostPort(u.Hostname(), "1080")
+		}
+	case "http":
+		if u.Port() == "" {
+			p.addr = net.JoinHostPort(u.Hostname(), "80")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("proxy host is missing")
+	}
+	return p, nil
+}
+
+// String returns the proxy URL without the password.
+func (p *Proxy) String() string {
+	u := url.URL{Scheme: p.scheme, Host: p.addr}
+	if p.user != nil {
+		u.User = url.User(p.user.Username())
+	}
+	return u.String()
+}
+
+// DialContext connects to the address through the proxy server.
+// Only TCP networks are supported. Host names in address are resolved by the proxy server.
+func (p *Proxy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("unsupported network for proxy: %s", network)
+	}
+	conn, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := conn
+	err = p.handshake(ctx, conn, func() error {
+		if p.scheme == "socks5" {
+			_, err2 := socks5Request(conn, p.user, socks5CmdConnect, address)
+			return err2
+		}
+		var err2 error
+		c, err2 = httpConnect(conn, p.user, address)
+		return err2
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot connect to %s through proxy: %w", address, err)
+	}
+	return c, nil
+}
+
+// ListenPacket returns a PacketConn that relays the packets through the proxy server.
+// Only SOCKS5 proxies support relaying UDP packets.
+func (p *Proxy) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	if p.scheme != "socks5" {
+		return nil, ErrUDPNotSupported
+	}
+	conn, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var relay string
+	err = p.handshake(ctx, conn, func() error {
+		var err2 error
+		relay, err2 = socks5Request(conn, p.user, socks5CmdUDPAssociate, "0.0.0.0:0")
+		return err2
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	pc, err := newSOCKS5PacketConn(conn, relay)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return pc, nil
+}
+
+func (p *Proxy) connect(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", p.addr)
+}
+
+// handshake runs f with the deadline of ctx set on conn. It returns when ctx is cancelled.
+func (p *Proxy) handshake(ctx context.Context, conn net.Conn, f func() error) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	errC := make(chan error, 1)
+	go func() { errC <- f() }()
+	var err error
+	select {
+	case err = <-errC:
+	case <-ctx.Done():
+		// Closing the connection unblocks f.
+		conn.Close()
+		<-errC
+		err = ctx.Err()
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return err
+}
+
+// Dialer returns a Dialer that connects through the proxy.
+// If fallback is true, direct is used for the connections that cannot be made through the proxy.
+// If p is nil, direct is returned.
+func (p *Proxy) Dialer(direct Dialer, fallback bool) Dialer {
+	if p == nil {
+		return direct
+	}
+	if fallback {
+		return Fallback(p, direct)
+	}
+	return p
+}
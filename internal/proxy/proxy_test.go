@@ -0,0 +1,281 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listen(t *testing.T, serve func(conn net.Conn)) (addr string, stop func()) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func echo(conn net.Conn) {
+	defer conn.Close()
+	_, _ = io.Copy(conn, conn)
+}
+
+func pipe(a, b net.Conn) {
+	go func() { _, _ = io.Copy(a, b); a.Close() }()
+	_, _ = io.Copy(b, a)
+	b.Close()
+}
+
+// socks5Server is a minimal SOCKS5 server that requires username "user" and password "pass".
+func socks5Server(conn net.Conn) {
+	defer conn.Close()
+	var b [2]byte
+	if _, err := io.ReadFull(conn, b[:]); err != nil {
+		return
+	}
+	methods := make([]byte, b[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	if !bytes.Contains(methods, []byte{socks5AuthPassword}) {
+		_, _ = conn.Write([]byte{socks5Version, socks5AuthNoMethod})
+		return
+	}
+	_, _ = conn.Write([]byte{socks5Version, socks5AuthPassword})
+	br := bufio.NewReader(conn)
+	ver, _ := br.ReadByte()
+	n, _ := br.ReadByte()
+	username := make([]byte, n)
+	_, _ = io.ReadFull(br, username)
+	n, _ = br.ReadByte()
+	password := make([]byte, n)
+	_, _ = io.ReadFull(br, password)
+	if ver != 1 || string(username) != "user" || string(password) != "pass" {
+		_, _ = conn.Write([]byte{1, 1})
+		return
+	}
+	_, _ = conn.Write([]byte{1, 0})
+	var header [3]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return
+	}
+	address, err := socks5ReadAddr(br)
+	if err != nil {
+		return
+	}
+	switch header[1] {
+	case socks5CmdConnect:
+		target, err := net.Dial("tcp", address)
+		if err != nil {
+			_, _ = conn.Write([]byte{socks5Version, 5, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		_, _ = conn.Write([]byte{socks5Version, 0, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+		pipe(conn, target)
+	case socks5CmdUDPAssociate:
+		relay, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			return
+		}
+		defer relay.Close()
+		bound, _ := socks5EncodeAddr(relay.LocalAddr().String())
+		_, _ = conn.Write(append([]byte{socks5Version, 0, 0}, bound...))
+		go func() {
+			var client net.Addr
+			buf := make([]byte, 1500)
+			for {
+				n, from, err := relay.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				if client == nil || from.String() == client.String() {
+					// Packet from client. Strip the header and forward.
+					client = from
+					r := bytes.NewReader(buf[3:n])
+					dest, err := socks5ReadAddr(r)
+					if err != nil {
+						continue
+					}
+					daddr, _ := net.ResolveUDPAddr("udp", dest)
+					_, _ = relay.WriteTo(buf[n-r.Len():n], daddr)
+					continue
+				}
+				// Packet from remote. Add header and send to client.
+				h, _ := socks5EncodeAddr(from.String())
+				_, _ = relay.WriteTo(append(append([]byte{0, 0, 0}, h...), buf[:n]...), client)
+			}
+		}()
+		_, _ = io.Copy(io.Discard, conn)
+	}
+}
+
+func httpProxyServer(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return
+	}
+	if req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+		_, _ = conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+		return
+	}
+	target, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		_, _ = conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+		return
+	}
+	_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	pipe(conn, target)
+}
+
+func testDial(t *testing.T, p *Proxy, address string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := p.DialContext(ctx, "tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 5)
+	_, err = io.ReadFull(conn, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "hello", string(b))
+}
+
+func TestSOCKS5(t *testing.T) {
+	echoAddr, stopEcho := listen(t, echo)
+	defer stopEcho()
+	proxyAddr, stopProxy := listen(t, socks5Server)
+	defer stopProxy()
+
+	p, err := New("socks5://user:pass@" + proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "socks5://user@"+proxyAddr, p.String())
+	testDial(t, p, echoAddr)
+
+	p, err = New("socks5://user:wrong@" + proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.DialContext(context.Background(), "tcp", echoAddr)
+	assert.Error(t, err)
+}
+
+func TestSOCKS5UDP(t *testing.T) {
+	udpEcho, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udpEcho.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := udpEcho.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = udpEcho.WriteTo(buf[:n], addr)
+		}
+	}()
+	proxyAddr, stopProxy := listen(t, socks5Server)
+	defer stopProxy()
+
+	p, err := New("socks5://user:pass@" + proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pc, err := p.ListenPacket(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	_, err = pc.WriteTo([]byte("hello"), udpEcho.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, 100)
+	n, from, err := pc.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "hello", string(b[:n]))
+	assert.Equal(t, udpEcho.LocalAddr().String(), from.String())
+}
+
+func TestHTTPConnect(t *testing.T) {
+	echoAddr, stopEcho := listen(t, echo)
+	defer stopEcho()
+	proxyAddr, stopProxy := listen(t, httpProxyServer)
+	defer stopProxy()
+
+	p, err := New("http://user:pass@" + proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDial(t, p, echoAddr)
+	_, err = p.ListenPacket(context.Background())
+	assert.Equal(t, ErrUDPNotSupported, err)
+
+	p, err = New("http://" + proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.DialContext(context.Background(), "tcp", echoAddr)
+	assert.EqualError(t, err, "cannot connect to "+echoAddr+" through proxy: proxy responded with status: 407 Proxy Authentication Required")
+}
+
+func TestFallback(t *testing.T) {
+	echoAddr, stopEcho := listen(t, echo)
+	defer stopEcho()
+
+	// Nothing listens on the proxy address.
+	p, err := New("socks5://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.DialContext(context.Background(), "tcp", echoAddr)
+	assert.Error(t, err)
+	var d net.Dialer
+	conn, err := Fallback(p, &d).DialContext(context.Background(), "tcp", echoAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("ftp://127.0.0.1:21")
+	assert.Error(t, err)
+	p, err := New("socks5h://127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "socks5://127.0.0.1:1080", p.String())
+}
@@ -0,0 +1,285 @@
+package proxy
+
+// https://www.rfc-editor.org/rfc/rfc1928
+// https://www.rfc-editor.org/rfc/rfc1929
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+const (
+	socks5Version = 5
+
+	socks5AuthNone     = 0
+	socks5AuthPassword = 2
+	socks5AuthNoMethod = 0xff
+
+	socks5CmdConnect      = 1
+	socks5CmdUDPAssociate = 3
+
+	socks5AddrIPv4   = 1
+	socks5AddrDomain = 3
+	socks5AddrIPv6   = 4
+)
+
+var socks5Errors = []string{
+	"",
+	"general failure",
+	"connection not allowed by ruleset",
+	"network unreachable",
+	"host unreachable",
+	"connection refused",
+	"TTL expired",
+	"command not supported",
+	"address type not supported",
+}
+
+// socks5Request authenticates to the server and sends the command for address.
+// It returns the address bound by the server.
+func socks5Request(conn net.Conn, user *url.Userinfo, cmd byte, address string) (string, error) {
+	methods := []byte{socks5AuthNone}
+	if user != nil {
+		methods = []byte{socks5AuthPassword}
+	}
+	_, err := conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...))
+	if err != nil {
+		return "", err
+	}
+	var resp [2]byte
+	_, err = io.ReadFull(conn, resp[:])
+	if err != nil {
+		return "", err
+	}
+	if resp[0] != socks5Version {
+		return "", fmt.Errorf("unexpected socks version: %d", resp[0])
+	}
+	switch resp[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if user == nil {
+			return "", errors.New("socks5 proxy requires authentication")
+		}
+		err = socks5Authenticate(conn, user)
+		if err != nil {
+			return "", err
+		}
+	case socks5AuthNoMethod:
+		return "", errors.New("no acceptable socks5 authentication method")
+	default:
+		return "", fmt.Errorf("unsupported socks5 authentication method: %d", resp[1])
+	}
+
+	addr, err := socks5EncodeAddr(address)
+	if err != nil {
+		return "", err
+	}
+	_, err = conn.Write(append([]byte{socks5Version, cmd, 0}, addr...))
+	if err != nil {
+		return "", err
+	}
+	var header [3]byte
+	_, err = io.ReadFull(conn, header[:])
+	if err != nil {
+		return "", err
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("unexpected socks version: %d", header[0])
+	}
+	if code := int(header[1]); code != 0 {
+		if code < len(socks5Errors) {
+			return "", errors.New("socks5 request failed: " + socks5Errors[code])
+		}
+		return "", fmt.Errorf("socks5 request failed with code: %d", code)
+	}
+	return socks5ReadAddr(conn)
+}
+
+func socks5Authenticate(conn net.Conn, user *url.Userinfo) error {
+	username := user.Username()
+	password, _ := user.Password()
+	if len(username) > 255 || len(password) > 255 {
+		return errors.New("socks5 username or password is too long")
+	}
+	b := make([]byte, 0, 3+len(username)+len(password))
+	b = append(b, 1, byte(len(username)))
+	b = append(b, username...)
+	b = append(b, byte(len(password)))
+	b = append(b, password...)
+	_, err := conn.Write(b)
+	if err != nil {
+		return err
+	}
+	var resp [2]byte
+	_, err = io.ReadFull(conn, resp[:])
+	if err != nil {
+		return err
+	}
+	if resp[1] != 0 {
+		return errors.New("socks5 authentication failed")
+	}
+	return nil
+}
+
+// socks5EncodeAddr returns the address in the format used in requests and UDP headers.
+func socks5EncodeAddr(address string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %q", portStr)
+	}
+	var b []byte
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return nil, errors.New("host name is too long")
+		}
+		b = append(b, socks5AddrDomain, byte(len(host)))
+		b = append(b, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		b = append(b, socks5AddrIPv4)
+		b = append(b, ip4...)
+	} else {
+		b = append(b, socks5AddrIPv6)
+		b = append(b, ip.To16()...)
+	}
+	return append(b, byte(port>>8), byte(port)), nil
+}
+
+func socks5ReadAddr(r io.Reader) (string, error) {
+	var atyp [1]byte
+	_, err := io.ReadFull(r, atyp[:])
+	if err != nil {
+		return "", err
+	}
+	var host string
+	switch atyp[0] {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if atyp[0] == socks5AddrIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		_, err = io.ReadFull(r, ip)
+		if err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socks5AddrDomain:
+		var n [1]byte
+		_, err = io.ReadFull(r, n[:])
+		if err != nil {
+			return "", err
+		}
+		b := make([]byte, n[0])
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			return "", err
+		}
+		host = string(b)
+	default:
+		return "", fmt.Errorf("unknown socks5 address type: %d", atyp[0])
+	}
+	var port [2]byte
+	_, err = io.ReadFull(r, port[:])
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// socks5PacketConn sends and receives UDP packets through the relay of a SOCKS5 server.
+type socks5PacketConn struct {
+	net.PacketConn
+	// UDP association is alive as long as this connection is open.
+	ctrl  net.Conn
+	relay *net.UDPAddr
+
+	closeOnce sync.Once
+}
+
+func newSOCKS5PacketConn(ctrl net.Conn, relay string) (*socks5PacketConn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", relay)
+	if err != nil {
+		return nil, err
+	}
+	if raddr.IP.IsUnspecified() {
+		// Server relays packets on the same address that it accepts connections.
+		raddr.IP = ctrl.RemoteAddr().(*net.TCPAddr).IP
+	}
+	pc, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &socks5PacketConn{
+		PacketConn: pc,
+		ctrl:       ctrl,
+		relay:      raddr,
+	}
+	go func() {
+		// Server closes the control connection when the association ends.
+		_, _ = io.Copy(io.Discard, ctrl)
+		c.Close()
+	}()
+	return c, nil
+}
+
+// WriteTo sends the packet to addr through the relay.
+func (c *socks5PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	header, err := socks5EncodeAddr(addr.String())
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 0, 3+len(header)+len(b))
+	buf = append(buf, 0, 0, 0) // reserved and fragment number
+	buf = append(buf, header...)
+	buf = append(buf, b...)
+	_, err = c.PacketConn.WriteTo(buf, c.relay)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// ReadFrom reads a packet from the relay. Returned address is the original sender of the packet.
+func (c *socks5PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	buf := make([]byte, len(b)+262)
+	for {
+		n, _, err := c.PacketConn.ReadFrom(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		// Fragmented packets are not supported.
+		if n < 4 || buf[2] != 0 {
+			continue
+		}
+		r := bytes.NewReader(buf[3:n])
+		address, err := socks5ReadAddr(r)
+		if err != nil {
+			continue
+		}
+		addr, err := net.ResolveUDPAddr("udp", address)
+		if err != nil {
+			continue
+		}
+		return copy(b, buf[n-r.Len():n]), addr, nil
+	}
+}
+
+// Close ends the UDP association.
+func (c *socks5PacketConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.ctrl.Close()
+		err = c.PacketConn.Close()
+	})
+	return err
+}
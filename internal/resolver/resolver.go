@@ -15,11 +15,13 @@ var (
 	ErrBlocked = errors.New("ip is blocked")
 	// ErrNotIPv4Address indicates that the resolved IP address is not IPv4.
 	ErrNotIPv4Address = errors.New("not ipv4 address")
+	// ErrNoAddress indicates that the host has no IP address.
+	ErrNoAddress = errors.New("no ip address")
 	// ErrInvalidPort indicates that the port number in the address is invalid.
 	ErrInvalidPort = errors.New("invalid port number")
 )
 
-// Resolve `hostport` to an IPv4 address.
+// Resolve `hostport` to an IP address. IPv4 addresses are preferred if the host has both.
 func Resolve(ctx context.Context, hostport string, timeout time.Duration, bl *blocklist.Blocklist) (net.IP, int, error) {
 	host, portStr, err := net.SplitHostPort(hostport)
 	if err != nil {
@@ -34,27 +36,23 @@ func Resolve(ctx context.Context, hostport string, timeout time.Duration, bl *bl
 	}
 	ip := net.ParseIP(host)
 	if ip == nil {
-		ip, err = ResolveIPv4(ctx, timeout, host)
+		ip, err = ResolveIP(ctx, timeout, host)
 		if err != nil {
 			return nil, 0, err
 		}
 	}
-	i4 := ip.To4()
-	if i4 == nil {
-		return nil, 0, ErrNotIPv4Address
+	if i4 := ip.To4(); i4 != nil {
+		ip = i4
 	}
 	if bl != nil && bl.Blocked(ip) {
 		return nil, 0, ErrBlocked
 	}
-	return i4, port, nil
+	return ip, port, nil
 }
 
 // ResolveIPv4 resolves `host` to and IPv4 address.
 func ResolveIPv4(ctx context.Context, timeout time.Duration, host string) (net.IP, error) {
-	var cancel func()
-	ctx, cancel = context.WithTimeout(ctx, timeout)
-	defer cancel()
-	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	addrs, err := lookup(ctx, timeout, host)
 	if err != nil {
 		return nil, err
 	}
@@ -66,3 +64,63 @@ func ResolveIPv4(ctx context.Context, timeout time.Duration, host string) (net.I
 	}
 	return nil, ErrNotIPv4Address
 }
+
+// ResolveIP resolves `host` to an IP address.
+// IPv4 address is returned if the host has one, otherwise the first IPv6 address is returned.
+func ResolveIP(ctx context.Context, timeout time.Duration, host string) (net.IP, error) {
+	addrs, err := lookup(ctx, timeout, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ia := range addrs {
+		i4 := ia.IP.To4()
+		if i4 != nil {
+			return i4, nil
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, ErrNoAddress
+	}
+	return addrs[0].IP, nil
+}
+
+// ResolveAll resolves `host` to all of its IP addresses.
+// IPv6 and IPv4 addresses are interleaved starting with IPv6, the order that is recommended in RFC 8305 for racing connections.
+func ResolveAll(ctx context.Context, timeout time.Duration, host string) ([]net.IP, error) {
+	addrs, err := lookup(ctx, timeout, host)
+	if err != nil {
+		return nil, err
+	}
+	var ip4s, ip6s []net.IP
+	for _, ia := range addrs {
+		if i4 := ia.IP.To4(); i4 != nil {
+			ip4s = append(ip4s, i4)
+		} else {
+			ip6s = append(ip6s, ia.IP)
+		}
+	}
+	if len(ip4s)+len(ip6s) == 0 {
+		return nil, ErrNoAddress
+	}
+	return interleave(ip6s, ip4s), nil
+}
+
+func interleave(a, b []net.IP) []net.IP {
+	ret := make([]net.IP, 0, len(a)+len(b))
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if i < len(a) {
+			ret = append(ret, a[i])
+		}
+		if i < len(b) {
+			ret = append(ret, b[i])
+		}
+	}
+	return ret
+}
+
+func lookup(ctx context.Context, timeout time.Duration, host string) ([]net.IPAddr, error) {
+	var cancel func()
+	ctx, cancel = context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return net.DefaultResolver.LookupIPAddr(ctx, host)
+}
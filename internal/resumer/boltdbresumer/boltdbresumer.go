@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/rcrowley/go-metrics"
 	"go.etcd.io/bbolt"
 )
 
@@ -16,55 +17,75 @@ const LatestVersion = 3
 
 // Keys for the persisten storage.
 var Keys = struct {
-	InfoHash          []byte
-	Port              []byte
-	Name              []byte
-	Trackers          []byte
-	URLList           []byte
-	FixedPeers        []byte
-	Dest              []byte
-	Info              []byte
-	Bitfield          []byte
-	AddedAt           []byte
-	BytesDownloaded   []byte
-	BytesUploaded     []byte
-	BytesWasted       []byte
-	SeededFor         []byte
-	Started           []byte
-	StopAfterDownload []byte
-	StopAfterMetadata []byte
-	CompleteCmdRun    []byte
-	Version           []byte
+	InfoHash           []byte
+	Port               []byte
+	Name               []byte
+	Trackers           []byte
+	URLList            []byte
+	FixedPeers         []byte
+	Dest               []byte
+	Info               []byte
+	PieceLayers        []byte
+	Bitfield           []byte
+	AddedAt            []byte
+	BytesDownloaded    []byte
+	BytesUploaded      []byte
+	BytesWasted        []byte
+	SeededFor          []byte
+	Started            []byte
+	StopAfterDownload  []byte
+	StopAfterMetadata  []byte
+	CompleteCmdRun     []byte
+	Paused             []byte
+	TransferMode       []byte
+	FilePriorities     []byte
+	CompletedAnnounces []byte
+	PeerAllowlist      []byte
+	SeedLimits         []byte
+	Labels             []byte
+	UploadSlots        []byte
+	Version            []byte
 }{
-	InfoHash:          []byte("info_hash"),
-	Port:              []byte("port"),
-	Name:              []byte("name"),
-	Trackers:          []byte("trackers"),
-	URLList:           []byte("url_list"),
-	FixedPeers:        []byte("fixed_peers"),
-	Dest:              []byte("dest"),
-	Info:              []byte("info"),
-	Bitfield:          []byte("bitfield"),
-	AddedAt:           []byte("added_at"),
-	BytesDownloaded:   []byte("bytes_downloaded"),
-	BytesUploaded:     []byte("bytes_uploaded"),
-	BytesWasted:       []byte("bytes_wasted"),
-	SeededFor:         []byte("seeded_for"),
-	Started:           []byte("started"),
-	StopAfterDownload: []byte("stop_after_download"),
-	StopAfterMetadata: []byte("stop_after_metadata"),
-	CompleteCmdRun:    []byte("complete_cmd_run"),
-	Version:           []byte("version"),
+	InfoHash:           []byte("info_hash"),
+	Port:               []byte("port"),
+	Name:               []byte("name"),
+	Trackers:           []byte("trackers"),
+	URLList:            []byte("url_list"),
+	FixedPeers:         []byte("fixed_peers"),
+	Dest:               []byte("dest"),
+	Info:               []byte("info"),
+	PieceLayers:        []byte("piece_layers"),
+	Bitfield:           []byte("bitfield"),
+	AddedAt:            []byte("added_at"),
+	BytesDownloaded:    []byte("bytes_downloaded"),
+	BytesUploaded:      []byte("bytes_uploaded"),
+	BytesWasted:        []byte("bytes_wasted"),
+	SeededFor:          []byte("seeded_for"),
+	Started:            []byte("started"),
+	StopAfterDownload:  []byte("stop_after_download"),
+	StopAfterMetadata:  []byte("stop_after_metadata"),
+	CompleteCmdRun:     []byte("complete_cmd_run"),
+	Paused:             []byte("paused"),
+	TransferMode:       []byte("transfer_mode"),
+	FilePriorities:     []byte("file_priorities"),
+	CompletedAnnounces: []byte("completed_announces"),
+	PeerAllowlist:      []byte("peer_allowlist"),
+	SeedLimits:         []byte("seed_limits"),
+	Labels:             []byte("labels"),
+	UploadSlots:        []byte("upload_slots"),
+	Version:            []byte("version"),
 }
 
 // Resumer contains methods for saving/loading resume information of a torrent to a BoltDB database.
 type Resumer struct {
-	db     *bbolt.DB
-	bucket []byte
+	db           *bbolt.DB
+	bucket       []byte
+	readLatency  metrics.Timer
+	writeLatency metrics.Timer
 }
 
-// New returns a new Resumer.
-func New(db *bbolt.DB, bucket []byte) (*Resumer, error) {
+// New returns a new Resumer. Durations of the transactions for reading and writing torrents are recorded in the timers.
+func New(db *bbolt.DB, bucket []byte, readLatency, writeLatency metrics.Timer) (*Resumer, error) {
 	err := db.Update(func(tx *bbolt.Tx) error {
 		_, err2 := tx.CreateBucketIfNotExists(bucket)
 		return err2
@@ -73,11 +94,18 @@ func New(db *bbolt.DB, bucket []byte) (*Resumer, error) {
 		return nil, err
 	}
 	return &Resumer{
-		db:     db,
-		bucket: bucket,
+		db:           db,
+		bucket:       bucket,
+		readLatency:  readLatency,
+		writeLatency: writeLatency,
 	}, nil
 }
 
+func (r *Resumer) update(timer metrics.Timer, fn func(tx *bbolt.Tx) error) error {
+	defer timer.UpdateSince(time.Now())
+	return r.db.Update(fn)
+}
+
 // Write the torrent spec for torrent with `torrentID`.
 func (r *Resumer) Write(torrentID string, spec *Spec) error {
 	port := strconv.Itoa(spec.Port)
@@ -93,11 +121,31 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 	if err != nil {
 		return err
 	}
+	filePriorities, err := json.Marshal(spec.FilePriorities)
+	if err != nil {
+		return err
+	}
+	completedAnnounces, err := json.Marshal(spec.CompletedAnnounces)
+	if err != nil {
+		return err
+	}
+	peerAllowlist, err := json.Marshal(spec.PeerAllowlist)
+	if err != nil {
+		return err
+	}
+	seedLimits, err := json.Marshal(spec.SeedLimits)
+	if err != nil {
+		return err
+	}
+	labels, err := json.Marshal(spec.Labels)
+	if err != nil {
+		return err
+	}
 	version := LatestVersion
 	if spec.Version != 0 {
 		version = spec.Version
 	}
-	return r.db.Update(func(tx *bbolt.Tx) error {
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
 		b, err := tx.Bucket(r.bucket).CreateBucketIfNotExists([]byte(torrentID))
 		if err != nil {
 			return err
@@ -108,7 +156,9 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 		_ = b.Put(Keys.Trackers, trackers)
 		_ = b.Put(Keys.URLList, urlList)
 		_ = b.Put(Keys.FixedPeers, fixedPeers)
+		_ = b.Put(Keys.Dest, []byte(spec.Dest))
 		_ = b.Put(Keys.Info, spec.Info)
+		_ = b.Put(Keys.PieceLayers, spec.PieceLayers)
 		_ = b.Put(Keys.Bitfield, spec.Bitfield)
 		_ = b.Put(Keys.AddedAt, []byte(spec.AddedAt.Format(time.RFC3339)))
 		_ = b.Put(Keys.BytesDownloaded, []byte(strconv.FormatInt(spec.BytesDownloaded, 10)))
@@ -119,6 +169,14 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 		_ = b.Put(Keys.StopAfterDownload, []byte(strconv.FormatBool(spec.StopAfterDownload)))
 		_ = b.Put(Keys.StopAfterMetadata, []byte(strconv.FormatBool(spec.StopAfterMetadata)))
 		_ = b.Put(Keys.CompleteCmdRun, []byte(strconv.FormatBool(spec.CompleteCmdRun)))
+		_ = b.Put(Keys.Paused, []byte(strconv.FormatBool(spec.Paused)))
+		_ = b.Put(Keys.TransferMode, []byte(strconv.Itoa(spec.TransferMode)))
+		_ = b.Put(Keys.FilePriorities, filePriorities)
+		_ = b.Put(Keys.CompletedAnnounces, completedAnnounces)
+		_ = b.Put(Keys.PeerAllowlist, peerAllowlist)
+		_ = b.Put(Keys.SeedLimits, seedLimits)
+		_ = b.Put(Keys.Labels, labels)
+		_ = b.Put(Keys.UploadSlots, []byte(strconv.Itoa(spec.UploadSlots)))
 		_ = b.Put(Keys.Version, []byte(strconv.Itoa(version)))
 		return nil
 	})
@@ -126,7 +184,7 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 
 // WriteInfo writes only the info dict of a torrent.
 func (r *Resumer) WriteInfo(torrentID string, value []byte) error {
-	return r.db.Update(func(tx *bbolt.Tx) error {
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
 		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
 		if b == nil {
 			return nil
@@ -135,9 +193,20 @@ func (r *Resumer) WriteInfo(torrentID string, value []byte) error {
 	})
 }
 
+// WritePieceLayers writes only the piece layers of a v2 torrent.
+func (r *Resumer) WritePieceLayers(torrentID string, value []byte) error {
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.PieceLayers, value)
+	})
+}
+
 // WriteBitfield writes only bitfield of a torrent.
 func (r *Resumer) WriteBitfield(torrentID string, value []byte) error {
-	return r.db.Update(func(tx *bbolt.Tx) error {
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
 		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
 		if b == nil {
 			return nil
@@ -148,7 +217,7 @@ func (r *Resumer) WriteBitfield(torrentID string, value []byte) error {
 
 // WriteStarted writes the start status of a torrent.
 func (r *Resumer) WriteStarted(torrentID string, value bool) error {
-	return r.db.Update(func(tx *bbolt.Tx) error {
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
 		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
 		if b == nil {
 			return nil
@@ -157,9 +226,113 @@ func (r *Resumer) WriteStarted(torrentID string, value bool) error {
 	})
 }
 
+// WritePaused writes the pause status of a torrent.
+func (r *Resumer) WritePaused(torrentID string, value bool) error {
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.Paused, []byte(strconv.FormatBool(value)))
+	})
+}
+
+// WriteTransferMode writes the transfer mode of a torrent.
+func (r *Resumer) WriteTransferMode(torrentID string, value int) error {
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.TransferMode, []byte(strconv.Itoa(value)))
+	})
+}
+
+// WriteUploadSlots writes the number of upload slots of a torrent. Zero value means the value in session config is used.
+func (r *Resumer) WriteUploadSlots(torrentID string, value int) error {
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.UploadSlots, []byte(strconv.Itoa(value)))
+	})
+}
+
+// WriteFilePriorities writes the download priorities of files in a torrent.
+func (r *Resumer) WriteFilePriorities(torrentID string, value []int) error {
+	filePriorities, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.FilePriorities, filePriorities)
+	})
+}
+
+// WriteCompletedAnnounces writes the state of the "completed" event for each tracker of a torrent.
+func (r *Resumer) WriteCompletedAnnounces(torrentID string, value map[string]bool) error {
+	completedAnnounces, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.CompletedAnnounces, completedAnnounces)
+	})
+}
+
+// WriteSeedLimits writes the seed limits of a torrent. Nil value means the limits in session config are used.
+func (r *Resumer) WriteSeedLimits(torrentID string, value *SeedLimits) error {
+	seedLimits, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.SeedLimits, seedLimits)
+	})
+}
+
+// WriteDest writes the directory that the files of a torrent are saved into.
+func (r *Resumer) WriteDest(torrentID string, value string) error {
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.Dest, []byte(value))
+	})
+}
+
+// WriteLabels writes the labels of a torrent.
+func (r *Resumer) WriteLabels(torrentID string, labels []string) error {
+	value, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.Labels, value)
+	})
+}
+
 // HandleStopAfterDownload clears the start status and stop_after_download fields.
 func (r *Resumer) HandleStopAfterDownload(torrentID string) error {
-	return r.db.Update(func(tx *bbolt.Tx) error {
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
 		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
 		if b == nil {
 			return nil
@@ -174,7 +347,7 @@ func (r *Resumer) HandleStopAfterDownload(torrentID string) error {
 
 // HandleStopAfterMetadata clears the start status and stop_after_metadata fields.
 func (r *Resumer) HandleStopAfterMetadata(torrentID string) error {
-	return r.db.Update(func(tx *bbolt.Tx) error {
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
 		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
 		if b == nil {
 			return nil
@@ -189,7 +362,7 @@ func (r *Resumer) HandleStopAfterMetadata(torrentID string) error {
 
 // WriteCompleteCmdRun writes the start status of a torrent.
 func (r *Resumer) WriteCompleteCmdRun(torrentID string) error {
-	return r.db.Update(func(tx *bbolt.Tx) error {
+	return r.update(r.writeLatency, func(tx *bbolt.Tx) error {
 		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
 		if b == nil {
 			return nil
@@ -205,7 +378,7 @@ func (r *Resumer) Read(torrentID string) (spec *Spec, err error) {
 			err = fmt.Errorf("cannot read torrent %q from db: %s", torrentID, r)
 		}
 	}()
-	err = r.db.Update(func(tx *bbolt.Tx) error {
+	err = r.update(r.readLatency, func(tx *bbolt.Tx) error {
 		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
 		if b == nil {
 			return fmt.Errorf("bucket not found: %q", torrentID)
@@ -275,12 +448,23 @@ func (r *Resumer) Read(torrentID string) (spec *Spec, err error) {
 			}
 		}
 
+		value = b.Get(Keys.Dest)
+		if value != nil {
+			spec.Dest = string(value)
+		}
+
 		value = b.Get(Keys.Info)
 		if value != nil {
 			spec.Info = make([]byte, len(value))
 			copy(spec.Info, value)
 		}
 
+		value = b.Get(Keys.PieceLayers)
+		if value != nil {
+			spec.PieceLayers = make([]byte, len(value))
+			copy(spec.PieceLayers, value)
+		}
+
 		value = b.Get(Keys.Bitfield)
 		if value != nil {
 			spec.Bitfield = make([]byte, len(value))
@@ -359,6 +543,70 @@ func (r *Resumer) Read(torrentID string) (spec *Spec, err error) {
 			}
 		}
 
+		value = b.Get(Keys.Paused)
+		if value != nil {
+			spec.Paused, err = strconv.ParseBool(string(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.TransferMode)
+		if value != nil {
+			spec.TransferMode, err = strconv.Atoi(string(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.UploadSlots)
+		if value != nil {
+			spec.UploadSlots, err = strconv.Atoi(string(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.FilePriorities)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.FilePriorities)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.CompletedAnnounces)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.CompletedAnnounces)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.PeerAllowlist)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.PeerAllowlist)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.SeedLimits)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.SeedLimits)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.Labels)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.Labels)
+			if err != nil {
+				return err
+			}
+		}
+
 		value = b.Get(Keys.Version)
 		if value != nil {
 			spec.Version, err = strconv.Atoi(string(value))
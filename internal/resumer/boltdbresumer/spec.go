@@ -14,7 +14,9 @@ type Spec struct {
 	Trackers          [][]string
 	URLList           []string
 	FixedPeers        []string
+	Dest              string
 	Info              []byte
+	PieceLayers       []byte // bencoded "piece layers" dictionary of v2 torrents
 	Bitfield          []byte
 	AddedAt           time.Time
 	BytesDownloaded   int64
@@ -25,54 +27,95 @@ type Spec struct {
 	StopAfterDownload bool
 	StopAfterMetadata bool
 	CompleteCmdRun    bool
-	Version           int
+	Paused            bool
+	TransferMode      int
+	FilePriorities    []int
+	// Keys are tracker URLs. Value is true if the "completed" event is sent to the tracker, false if it is pending.
+	CompletedAnnounces map[string]bool
+	// Addresses and CIDR ranges of peers allowed for the torrent. Empty means the allowlist in session config is used.
+	PeerAllowlist []string
+	// Limits for stopping the torrent after seeding. Nil means the limits in session config are used.
+	SeedLimits *SeedLimits
+	// Free-form labels for organizing torrents.
+	Labels []string
+	// Number of peers unchoked for uploading. Zero means the value in session config is used.
+	UploadSlots int
+	Version     int
+}
+
+// SeedLimits contains the limits for stopping a torrent after seeding. Zero value of a field means no limit.
+type SeedLimits struct {
+	Ratio        float64
+	Duration     time.Duration
+	IdleDuration time.Duration
+	Remove       bool
 }
 
 type jsonSpec struct {
-	Port              int
-	Name              string
-	Trackers          [][]string
-	URLList           []string
-	FixedPeers        []string
-	AddedAt           time.Time
-	BytesDownloaded   int64
-	BytesUploaded     int64
-	BytesWasted       int64
-	Started           bool
-	StopAfterDownload bool
-	StopAfterMetadata bool
-	CompleteCmdRun    bool
-	Version           int
+	Port               int
+	Name               string
+	Trackers           [][]string
+	URLList            []string
+	FixedPeers         []string
+	Dest               string
+	AddedAt            time.Time
+	BytesDownloaded    int64
+	BytesUploaded      int64
+	BytesWasted        int64
+	Started            bool
+	StopAfterDownload  bool
+	StopAfterMetadata  bool
+	CompleteCmdRun     bool
+	Paused             bool
+	TransferMode       int
+	FilePriorities     []int
+	CompletedAnnounces map[string]bool
+	PeerAllowlist      []string
+	SeedLimits         *SeedLimits
+	Labels             []string
+	UploadSlots        int
+	Version            int
 
 	// JSON unsafe types
-	InfoHash  string
-	Info      string
-	Bitfield  string
-	SeededFor int64
+	InfoHash    string
+	Info        string
+	PieceLayers string `json:",omitempty"`
+	Bitfield    string
+	SeededFor   int64
 }
 
 // MarshalJSON converts the Spec to a JSON string.
 func (s Spec) MarshalJSON() ([]byte, error) {
 	j := jsonSpec{
-		Port:              s.Port,
-		Name:              s.Name,
-		Trackers:          s.Trackers,
-		URLList:           s.URLList,
-		FixedPeers:        s.FixedPeers,
-		AddedAt:           s.AddedAt,
-		BytesDownloaded:   s.BytesDownloaded,
-		BytesUploaded:     s.BytesUploaded,
-		BytesWasted:       s.BytesWasted,
-		Started:           s.Started,
-		StopAfterDownload: s.StopAfterDownload,
-		StopAfterMetadata: s.StopAfterMetadata,
-		CompleteCmdRun:    s.CompleteCmdRun,
-		Version:           s.Version,
+		Port:               s.Port,
+		Name:               s.Name,
+		Trackers:           s.Trackers,
+		URLList:            s.URLList,
+		FixedPeers:         s.FixedPeers,
+		Dest:               s.Dest,
+		AddedAt:            s.AddedAt,
+		BytesDownloaded:    s.BytesDownloaded,
+		BytesUploaded:      s.BytesUploaded,
+		BytesWasted:        s.BytesWasted,
+		Started:            s.Started,
+		StopAfterDownload:  s.StopAfterDownload,
+		StopAfterMetadata:  s.StopAfterMetadata,
+		CompleteCmdRun:     s.CompleteCmdRun,
+		Paused:             s.Paused,
+		TransferMode:       s.TransferMode,
+		FilePriorities:     s.FilePriorities,
+		CompletedAnnounces: s.CompletedAnnounces,
+		PeerAllowlist:      s.PeerAllowlist,
+		SeedLimits:         s.SeedLimits,
+		Labels:             s.Labels,
+		UploadSlots:        s.UploadSlots,
+		Version:            s.Version,
 
-		InfoHash:  base64.StdEncoding.EncodeToString(s.InfoHash),
-		Info:      base64.StdEncoding.EncodeToString(s.Info),
-		Bitfield:  base64.StdEncoding.EncodeToString(s.Bitfield),
-		SeededFor: int64(s.SeededFor),
+		InfoHash:    base64.StdEncoding.EncodeToString(s.InfoHash),
+		Info:        base64.StdEncoding.EncodeToString(s.Info),
+		PieceLayers: base64.StdEncoding.EncodeToString(s.PieceLayers),
+		Bitfield:    base64.StdEncoding.EncodeToString(s.Bitfield),
+		SeededFor:   int64(s.SeededFor),
 	}
 	return json.Marshal(j)
 }
@@ -92,6 +135,13 @@ func (s *Spec) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
+	s.PieceLayers, err = base64.StdEncoding.DecodeString(j.PieceLayers)
+	if err != nil {
+		return err
+	}
+	if len(s.PieceLayers) == 0 {
+		s.PieceLayers = nil
+	}
 	s.Bitfield, err = base64.StdEncoding.DecodeString(j.Bitfield)
 	if err != nil {
 		return err
@@ -102,6 +152,7 @@ func (s *Spec) UnmarshalJSON(b []byte) error {
 	s.Trackers = j.Trackers
 	s.URLList = j.URLList
 	s.FixedPeers = j.FixedPeers
+	s.Dest = j.Dest
 	s.AddedAt = j.AddedAt
 	s.BytesDownloaded = j.BytesDownloaded
 	s.BytesUploaded = j.BytesUploaded
@@ -110,6 +161,14 @@ func (s *Spec) UnmarshalJSON(b []byte) error {
 	s.StopAfterDownload = j.StopAfterDownload
 	s.StopAfterMetadata = j.StopAfterMetadata
 	s.CompleteCmdRun = j.CompleteCmdRun
+	s.Paused = j.Paused
+	s.TransferMode = j.TransferMode
+	s.FilePriorities = j.FilePriorities
+	s.CompletedAnnounces = j.CompletedAnnounces
+	s.PeerAllowlist = j.PeerAllowlist
+	s.SeedLimits = j.SeedLimits
+	s.Labels = j.Labels
+	s.UploadSlots = j.UploadSlots
 	s.Version = j.Version
 	return nil
 }
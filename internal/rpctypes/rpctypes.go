@@ -7,6 +7,7 @@ type Torrent struct {
 	InfoHash string
 	Port     int
 	AddedAt  Time
+	Labels   []string
 }
 
 // Peer of a Torrent.
@@ -23,6 +24,7 @@ type Peer struct {
 	PeerChoking        bool
 	OptimisticUnchoked bool
 	Snubbed            bool
+	RequestTimeouts    int
 	EncryptedHandshake bool
 	EncryptedStream    bool
 	DownloadSpeed      int
@@ -36,6 +38,15 @@ type Webseed struct {
 	DownloadSpeed int
 }
 
+// File in a Torrent.
+type File struct {
+	Path      string
+	Length    int64
+	Padding   bool
+	Priority  int
+	Completed int64
+}
+
 // Tracker of a Torrent.
 type Tracker struct {
 	URL           string
@@ -43,11 +54,13 @@ type Tracker struct {
 	Leechers      int
 	Seeders       int
 	Warning       string
+	WarningAt     Time
 	Error         string
 	ErrorUnknown  bool
 	ErrorInternal string
 	LastAnnounce  Time
 	NextAnnounce  Time
+	CompletedSent bool
 }
 
 // SessionStats contains statistics about a Session.
@@ -57,12 +70,16 @@ type SessionStats struct {
 	Peers          int
 	PortsAvailable int
 
-	BlockListRules   int
-	BlockListRecency int
+	BlockListRules            int
+	BlockListRecency          int
+	BlockListRejectedIncoming int64
+	BlockListRejectedOutgoing int64
 
 	ReadCacheObjects     int
 	ReadCacheSize        int64
 	ReadCacheUtilization int
+	ReadCacheHits        int64
+	ReadCacheMisses      int64
 
 	ReadsPerSecond int
 	ReadsActive    int
@@ -89,30 +106,42 @@ type SessionStats struct {
 
 // Stats contains statistics about a Torrent.
 type Stats struct {
-	InfoHash string
-	Port     int
-	Status   string
-	Error    string
-	Pieces   struct {
+	Version      int
+	Time         Time
+	InfoHash     string
+	Port         int
+	Status       string
+	Paused       bool
+	Boosted      bool
+	TransferMode string
+	Error        string
+	Pieces       struct {
 		Checked   uint32
 		Have      uint32
 		Missing   uint32
 		Available uint32
 		Total     uint32
+		Failed    uint32
 	}
 	Bytes struct {
-		Total      int64
-		Allocated  int64
-		Completed  int64
-		Incomplete int64
-		Downloaded int64
-		Uploaded   int64
-		Wasted     int64
+		Total            int64
+		Wanted           int64
+		Allocated        int64
+		Completed        int64
+		Incomplete       int64
+		WantedIncomplete int64
+		Downloaded       int64
+		Uploaded         int64
+		Wasted           int64
 	}
 	Peers struct {
-		Total    int
-		Incoming int
-		Outgoing int
+		Total       int
+		Incoming    int
+		Outgoing    int
+		Interested  int
+		Unchoked    int
+		Uploading   int
+		UploadSlots int
 	}
 	Handshakes struct {
 		Total    int
@@ -124,17 +153,21 @@ type Stats struct {
 		Tracker int
 		DHT     int
 		PEX     int
+		LSD     int
 	}
 	Downloads struct {
 		Total   int
 		Running int
 		Snubbed int
 		Choked  int
+		Endgame bool
 	}
 	MetadataDownloads struct {
-		Total   int
-		Snubbed int
-		Running int
+		Total      int
+		Snubbed    int
+		Running    int
+		Downloaded int64
+		Size       int64
 	}
 	Name        string
 	Private     bool
@@ -145,7 +178,13 @@ type Stats struct {
 		Download int
 		Upload   int
 	}
-	ETA int
+	ETA         int
+	WantedRange struct {
+		File      int
+		Offset    int64
+		Length    int64
+		Completed int64
+	}
 }
 
 // GetMagnetRequest contains request arguments for Session.GetMagnet method.
@@ -170,6 +209,8 @@ type GetTorrentResponse struct {
 
 // ListTorrentsRequest contains request arguments for Session.ListTorrents method.
 type ListTorrentsRequest struct {
+	// Only the torrents having the label are listed if not empty.
+	Label string
 }
 
 // ListTorrentsResponse contains response arguments for Session.ListTorrents method.
@@ -183,6 +224,10 @@ type AddTorrentOptions struct {
 	Stopped           bool
 	StopAfterDownload bool
 	StopAfterMetadata bool
+	PeerAllowlist     []string
+	Dest              string
+	Labels            []string
+	UploadSlots       int
 }
 
 // AddTorrentRequest contains request arguments for Session.AddTorrent method.
@@ -207,6 +252,17 @@ type AddURIResponse struct {
 	Torrent Torrent
 }
 
+// AddInfoHashRequest contains request arguments for Session.AddInfoHash method.
+type AddInfoHashRequest struct {
+	InfoHash string
+	AddTorrentOptions
+}
+
+// AddInfoHashResponse contains response arguments for Session.AddInfoHash method.
+type AddInfoHashResponse struct {
+	Torrent Torrent
+}
+
 // RemoveTorrentRequest contains request arguments for Session.RemoveTorrent method.
 type RemoveTorrentRequest struct {
 	ID string
@@ -224,6 +280,14 @@ type CleanDatabaseRequest struct {
 type CleanDatabaseResponse struct {
 }
 
+// ReloadBlocklistRequest contains request arguments for Session.ReloadBlocklist method.
+type ReloadBlocklistRequest struct {
+}
+
+// ReloadBlocklistResponse contains response arguments for Session.ReloadBlocklist method.
+type ReloadBlocklistResponse struct {
+}
+
 // GetSessionStatsRequest contains request arguments for Session.GetSessionStats method.
 type GetSessionStatsRequest struct {
 }
@@ -273,6 +337,60 @@ type GetTorrentWebseedsResponse struct {
 	Webseeds []Webseed
 }
 
+// SetTransferModeRequest contains request arguments for Session.SetTransferMode method.
+type SetTransferModeRequest struct {
+	ID string
+	// One of "normal", "upload-only" or "download-only".
+	Mode string
+}
+
+// SetTransferModeResponse contains response arguments for Session.SetTransferMode method.
+type SetTransferModeResponse struct {
+}
+
+// GetTorrentFilesRequest contains request arguments for Session.GetTorrentFiles method.
+type GetTorrentFilesRequest struct {
+	ID string
+}
+
+// GetTorrentFilesResponse contains response arguments for Session.GetTorrentFiles method.
+type GetTorrentFilesResponse struct {
+	Files []File
+}
+
+// SetFilePrioritiesRequest contains request arguments for Session.SetFilePriorities method.
+type SetFilePrioritiesRequest struct {
+	ID         string
+	Priorities []int
+}
+
+// SetFilePrioritiesResponse contains response arguments for Session.SetFilePriorities method.
+type SetFilePrioritiesResponse struct {
+}
+
+// SetPiecePriorityRequest contains request arguments for Session.SetPiecePriority method.
+type SetPiecePriorityRequest struct {
+	ID       string
+	Index    uint32
+	Priority int
+}
+
+// SetPiecePriorityResponse contains response arguments for Session.SetPiecePriority method.
+type SetPiecePriorityResponse struct {
+}
+
+// SetByteRangeWantedRequest contains request arguments for Session.SetByteRangeWanted method.
+type SetByteRangeWantedRequest struct {
+	ID     string
+	File   int
+	Offset int64
+	Length int64
+}
+
+// SetByteRangeWantedResponse contains response arguments for Session.SetByteRangeWanted method.
+type SetByteRangeWantedResponse struct {
+}
+
 // StartTorrentRequest contains request arguments for Session.StartTorrent method.
 type StartTorrentRequest struct {
 	ID string
@@ -300,6 +418,24 @@ type AnnounceTorrentRequest struct {
 type AnnounceTorrentResponse struct {
 }
 
+// PauseTorrentRequest contains request arguments for Session.PauseTorrent method.
+type PauseTorrentRequest struct {
+	ID string
+}
+
+// PauseTorrentResponse contains response arguments for Session.PauseTorrent method.
+type PauseTorrentResponse struct {
+}
+
+// ResumeTorrentRequest contains request arguments for Session.ResumeTorrent method.
+type ResumeTorrentRequest struct {
+	ID string
+}
+
+// ResumeTorrentResponse contains response arguments for Session.ResumeTorrent method.
+type ResumeTorrentResponse struct {
+}
+
 // VerifyTorrentRequest contains request arguments for Session.VerifyTorrent method.
 type VerifyTorrentRequest struct {
 	ID string
@@ -309,6 +445,45 @@ type VerifyTorrentRequest struct {
 type VerifyTorrentResponse struct {
 }
 
+// VerifyTorrentDataRequest contains request arguments for Session.VerifyTorrentData method.
+type VerifyTorrentDataRequest struct {
+	ID string
+}
+
+// VerifyTorrentDataResponse contains response arguments for Session.VerifyTorrentData method.
+type VerifyTorrentDataResponse struct {
+}
+
+// MoveTorrentDataRequest contains request arguments for Session.MoveTorrentData method.
+type MoveTorrentDataRequest struct {
+	ID  string
+	Dir string
+}
+
+// MoveTorrentDataResponse contains response arguments for Session.MoveTorrentData method.
+type MoveTorrentDataResponse struct {
+}
+
+// SetTorrentLabelsRequest contains request arguments for Session.SetTorrentLabels method.
+type SetTorrentLabelsRequest struct {
+	ID     string
+	Labels []string
+}
+
+// SetTorrentLabelsResponse contains response arguments for Session.SetTorrentLabels method.
+type SetTorrentLabelsResponse struct {
+}
+
+// SetTorrentUploadSlotsRequest contains request arguments for Session.SetTorrentUploadSlots method.
+type SetTorrentUploadSlotsRequest struct {
+	ID          string
+	UploadSlots int
+}
+
+// SetTorrentUploadSlotsResponse contains response arguments for Session.SetTorrentUploadSlots method.
+type SetTorrentUploadSlotsResponse struct {
+}
+
 // MoveTorrentRequest contains request arguments for Session.MoveTorrent method.
 type MoveTorrentRequest struct {
 	ID     string
@@ -339,6 +514,16 @@ type AddTrackerRequest struct {
 type AddTrackerResponse struct {
 }
 
+// ScanOrphanedDataRequest contains request arguments for Session.ScanOrphanedData method.
+type ScanOrphanedDataRequest struct {
+	Remove bool
+}
+
+// ScanOrphanedDataResponse contains response arguments for Session.ScanOrphanedData method.
+type ScanOrphanedDataResponse struct {
+	Paths []string
+}
+
 // StartAllTorrentsRequest contains request arguments for Session.StartAllTorrents method.
 type StartAllTorrentsRequest struct {
 }
@@ -354,3 +539,16 @@ type StopAllTorrentsRequest struct {
 // StopAllTorrentsResponse contains response arguments for Session.StopAllTorrents method.
 type StopAllTorrentsResponse struct {
 }
+
+// SetSpeedLimitRequest contains request arguments for Session.SetSpeedLimit method.
+// Limits are in bytes per second. Zero means unlimited.
+// If ID is empty, global limits of the Session are set.
+type SetSpeedLimitRequest struct {
+	ID       string
+	Download int64
+	Upload   int64
+}
+
+// SetSpeedLimitResponse contains response arguments for Session.SetSpeedLimit method.
+type SetSpeedLimitResponse struct {
+}
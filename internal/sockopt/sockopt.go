@@ -0,0 +1,30 @@
+// Package sockopt sets the options of peer sockets for integrating with the traffic shaping rules of the system.
+package sockopt
+
+import "syscall"
+
+// Options of a peer socket. Zero values leave the defaults of the operating system.
+type Options struct {
+	// DSCP value (0-63) that is set in the IP header of the packets.
+	DSCP int
+	// Size of the socket receive buffer (SO_RCVBUF).
+	ReadBufferSize int
+	// Size of the socket send buffer (SO_SNDBUF).
+	WriteBufferSize int
+	// Max number of unsent bytes in the send queue of TCP sockets (TCP_NOTSENT_LOWAT).
+	NotSentLowat int
+}
+
+// Control sets the options on the socket before it is connected or bound.
+// It can be used as the Control function of net.Dialer and net.ListenConfig.
+// Sockets accepted from a listener inherit the options of the listener.
+func (o Options) Control(network, address string, c syscall.RawConn) error {
+	var err error
+	cerr := c.Control(func(fd uintptr) {
+		err = o.set(fd, network)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package sockopt
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func (o Options) set(fd uintptr, network string) error {
+	s := int(fd)
+	if o.DSCP != 0 {
+		// DSCP is the upper 6 bits of the TOS field.
+		if strings.HasSuffix(network, "6") {
+			if err := unix.SetsockoptInt(s, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, o.DSCP<<2); err != nil {
+				return os.NewSyscallError("setsockopt", err)
+			}
+			// Dual-stack sockets are IPv6 sockets, IPv4 packets of them take the TOS from IP_TOS.
+			// Setting it may fail on IPv6-only sockets.
+			err := unix.SetsockoptInt(s, unix.IPPROTO_IP, unix.IP_TOS, o.DSCP<<2)
+			if err != nil && err != unix.EINVAL && err != unix.ENOPROTOOPT {
+				return os.NewSyscallError("setsockopt", err)
+			}
+		} else if err := unix.SetsockoptInt(s, unix.IPPROTO_IP, unix.IP_TOS, o.DSCP<<2); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if o.ReadBufferSize != 0 {
+		if err := unix.SetsockoptInt(s, unix.SOL_SOCKET, unix.SO_RCVBUF, o.ReadBufferSize); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if o.WriteBufferSize != 0 {
+		if err := unix.SetsockoptInt(s, unix.SOL_SOCKET, unix.SO_SNDBUF, o.WriteBufferSize); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if o.NotSentLowat != 0 && strings.HasPrefix(network, "tcp") {
+		if err := unix.SetsockoptInt(s, unix.IPPROTO_TCP, unix.TCP_NOTSENT_LOWAT, o.NotSentLowat); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package sockopt
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestControl(t *testing.T) {
+	o := Options{DSCP: 8, ReadBufferSize: 64 << 10, NotSentLowat: 16 << 10}
+	lc := net.ListenConfig{Control: o.Control}
+	// Listening on "tcp" with unspecified address creates a dual-stack IPv6 socket if IPv6 is supported.
+	for _, network := range []string{"tcp4", "tcp"} {
+		l, err := lc.Listen(context.Background(), network, ":0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		rc, err := l.(*net.TCPListener).SyscallConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tos, tclass, lowat int
+		var serr error
+		err = rc.Control(func(fd uintptr) {
+			tos, serr = unix.GetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS)
+			if serr != nil {
+				return
+			}
+			lowat, serr = unix.GetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_NOTSENT_LOWAT)
+			if serr != nil {
+				return
+			}
+			if l.Addr().(*net.TCPAddr).IP.To4() == nil {
+				tclass, serr = unix.GetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_TCLASS)
+			} else {
+				tclass = 8 << 2
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if serr != nil {
+			t.Fatal(serr)
+		}
+		if tos != 8<<2 {
+			t.Errorf("invalid tos on %s: %d", network, tos)
+		}
+		if tclass != 8<<2 {
+			t.Errorf("invalid traffic class on %s: %d", network, tclass)
+		}
+		if lowat != 16<<10 {
+			t.Errorf("invalid lowat on %s: %d", network, lowat)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+// +build !linux
+
+package sockopt
+
+func (o Options) set(fd uintptr, network string) error {
+	return nil
+}
@@ -0,0 +1,66 @@
+// Package speedlimiter provides token bucket rate limiters that can be changed at runtime and chained together.
+package speedlimiter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/ratelimit"
+)
+
+// Limiter limits the rate of bytes transferred.
+// Each Limiter may have a parent Limiter. Bytes taken from a Limiter are also taken from its parent,
+// so a torrent limiter can be chained to the session limiter.
+type Limiter struct {
+	parent *Limiter
+
+	m      sync.Mutex
+	rate   int64
+	bucket *ratelimit.Bucket
+}
+
+// New returns a new Limiter with the rate given in bytes per second. Zero rate means unlimited.
+func New(rate int64, parent *Limiter) *Limiter {
+	l := &Limiter{parent: parent}
+	l.SetRate(rate)
+	return l
+}
+
+// SetRate changes the rate of the Limiter. Zero rate means unlimited.
+func (l *Limiter) SetRate(rate int64) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if rate < 0 {
+		rate = 0
+	}
+	l.rate = rate
+	if rate == 0 {
+		l.bucket = nil
+		return
+	}
+	l.bucket = ratelimit.NewBucketWithRate(float64(rate), rate)
+}
+
+// Rate returns the current rate of the Limiter in bytes per second. Zero rate means unlimited.
+func (l *Limiter) Rate() int64 {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.rate
+}
+
+// Take n bytes from the Limiter and its parents.
+// Returns the duration that the caller must wait before transferring the bytes.
+func (l *Limiter) Take(n int64) time.Duration {
+	l.m.Lock()
+	var d time.Duration
+	if l.bucket != nil {
+		d = l.bucket.Take(n)
+	}
+	l.m.Unlock()
+	if l.parent != nil {
+		if pd := l.parent.Take(n); pd > d {
+			d = pd
+		}
+	}
+	return d
+}
@@ -0,0 +1,29 @@
+package speedlimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := New(0, nil)
+	if d := l.Take(1 << 20); d != 0 {
+		t.Fatal(d)
+	}
+}
+
+func TestLimiterParent(t *testing.T) {
+	parent := New(1000, nil)
+	l := New(0, parent)
+	l.Take(1000)
+	if d := l.Take(1000); d < 900*time.Millisecond {
+		t.Fatal("must wait for parent", d)
+	}
+	parent.SetRate(0)
+	if d := l.Take(1000); d != 0 {
+		t.Fatal(d)
+	}
+	if parent.Rate() != 0 {
+		t.FailNow()
+	}
+}
@@ -84,3 +84,16 @@ func (s *FileStorage) Open(name string, size int64) (f storage.File, exists bool
 func (s *FileStorage) RootDir() string {
 	return s.dest
 }
+
+// Provider creates a FileStorage in the directory of each torrent.
+type Provider struct {
+	// Permissions of the created files and directories.
+	Perm fs.FileMode
+}
+
+var _ storage.Provider = Provider{}
+
+// NewStorage returns a new FileStorage at dir.
+func (p Provider) NewStorage(id, dir string) (storage.Storage, error) {
+	return New(dir, p.Perm)
+}
@@ -0,0 +1,96 @@
+package filestorage
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Move moves the files with names from src directory to dst directory.
+// Files are renamed if possible. Otherwise, they are copied and synced to disk before the originals are removed,
+// so files can be moved across filesystems. Files that do not exist in src are skipped.
+// Directories that are left empty in src are removed.
+// Existing files in dst are not overwritten; no file is moved if any of them exists.
+// The names of the files that are moved are returned even if an error occurs,
+// so the caller can move them back.
+func Move(src, dst string, names []string, perm fs.FileMode) (moved []string, err error) {
+	for _, name := range names {
+		to := filepath.Join(dst, filepath.Clean(name))
+		_, err = os.Lstat(to)
+		if err == nil {
+			return nil, &fs.PathError{Op: "move", Path: to, Err: fs.ErrExist}
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	for _, name := range names {
+		from := filepath.Join(src, filepath.Clean(name))
+		to := filepath.Join(dst, filepath.Clean(name))
+		_, err = os.Stat(from)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+		err = os.MkdirAll(filepath.Dir(to), os.ModeDir|perm)
+		if err != nil {
+			return moved, err
+		}
+		err = os.Rename(from, to)
+		if err != nil {
+			// Rename does not work across filesystems.
+			err = copyFile(from, to, perm)
+			if err != nil {
+				return moved, err
+			}
+			err = os.Remove(from)
+			if err != nil {
+				_ = os.Remove(to)
+				return moved, err
+			}
+		}
+		moved = append(moved, name)
+		removeEmptyDirs(src, filepath.Dir(from))
+	}
+	return moved, nil
+}
+
+func copyFile(from, to string, perm fs.FileMode) (err error) {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm&^0111)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = out.Close()
+			_ = os.Remove(to)
+		}
+	}()
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+	err = out.Sync()
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// removeEmptyDirs removes dir and its parents until root if they are empty.
+func removeEmptyDirs(root, dir string) {
+	for dir != root && len(dir) > len(root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
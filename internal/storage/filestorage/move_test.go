@@ -0,0 +1,132 @@
+package filestorage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMove(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	names := []string{
+		filepath.Join("torrent", "a.txt"),
+		filepath.Join("torrent", "dir", "b.txt"),
+		filepath.Join("torrent", "missing.txt"),
+	}
+	for _, name := range names[:2] {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(src, name)), 0750)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(src, name), []byte(name), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	moved, err := Move(src, dst, names, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 2 {
+		t.Fatalf("moved files: %v", moved)
+	}
+	for _, name := range names[:2] {
+		b, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != name {
+			t.Fatalf("invalid content in %s: %q", name, b)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(src, "torrent")); !os.IsNotExist(err) {
+		t.Fatalf("empty directories must be removed, got: %v", err)
+	}
+	if _, err = os.Stat(src); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMoveExisting(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		err := os.WriteFile(filepath.Join(src, name), []byte("new"), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.WriteFile(filepath.Join(dst, "b.txt"), []byte("old"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, err := Move(src, dst, []string{"a.txt", "b.txt"}, 0750)
+	if !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(moved) != 0 {
+		t.Fatalf("moved files: %v", moved)
+	}
+	if _, err = os.Stat(filepath.Join(src, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dst, "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("file must not be moved, got: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dst, "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old" {
+		t.Fatalf("existing file is overwritten: %q", b)
+	}
+}
+
+func TestCopyFileExisting(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from")
+	to := filepath.Join(dir, "to")
+	err := os.WriteFile(from, []byte("data"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(to, []byte("old"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = copyFile(from, to, 0750)
+	if !os.IsExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := os.ReadFile(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old" {
+		t.Fatalf("existing file is overwritten: %q", b)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from")
+	to := filepath.Join(dir, "to")
+	err := os.WriteFile(from, []byte("data"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = copyFile(from, to, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "data" {
+		t.Fatalf("invalid content: %q", b)
+	}
+}
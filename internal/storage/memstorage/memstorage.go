@@ -0,0 +1,102 @@
+// Package memstorage implements Storage interface that keeps the files in memory.
+// Data is not persisted so it is suitable for ephemeral torrents, e.g. streaming.
+package memstorage
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+
+	"github.com/cenkalti/rain/internal/storage"
+)
+
+var errWriteBeyondEnd = errors.New("write beyond end of file")
+
+// MemStorage implements Storage interface for keeping files in memory.
+// Files are kept after they are closed, so they can be opened again until the MemStorage is garbage collected.
+type MemStorage struct {
+	m     sync.Mutex
+	files map[string]*file
+}
+
+// New returns a new empty MemStorage.
+func New() *MemStorage {
+	return &MemStorage{files: make(map[string]*file)}
+}
+
+var _ storage.Storage = (*MemStorage)(nil)
+
+// Open a file.
+func (s *MemStorage) Open(name string, size int64) (f storage.File, exists bool, err error) {
+	name = filepath.Clean(name)
+	s.m.Lock()
+	defer s.m.Unlock()
+	mf, ok := s.files[name]
+	if !ok {
+		mf = &file{data: make([]byte, size)}
+		s.files[name] = mf
+		return mf, false, nil
+	}
+	mf.truncate(size)
+	return mf, true, nil
+}
+
+// RootDir returns an empty string because files are not saved on disk.
+func (s *MemStorage) RootDir() string {
+	return ""
+}
+
+type file struct {
+	m    sync.RWMutex
+	data []byte
+}
+
+var _ storage.File = (*file)(nil)
+
+func (f *file) truncate(size int64) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if int64(len(f.data)) == size {
+		return
+	}
+	data := make([]byte, size)
+	copy(data, f.data)
+	f.data = data
+}
+
+func (f *file) ReadAt(p []byte, off int64) (n int, err error) {
+	f.m.RLock()
+	defer f.m.RUnlock()
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n = copy(p, f.data[off:])
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+func (f *file) WriteAt(p []byte, off int64) (n int, err error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if off+int64(len(p)) > int64(len(f.data)) {
+		return 0, errWriteBeyondEnd
+	}
+	return copy(f.data[off:], p), nil
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+// Provider creates a new MemStorage for each torrent.
+type Provider struct{}
+
+var _ storage.Provider = Provider{}
+
+// NewStorage returns a new MemStorage. The directory is not used.
+func (Provider) NewStorage(id, dir string) (storage.Storage, error) {
+	return New(), nil
+}
@@ -0,0 +1,38 @@
+package memstorage
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemStorage(t *testing.T) {
+	s := New()
+	f, exists, err := s.Open("dir/file", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, exists)
+	n, err := f.WriteAt([]byte("abc"), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	_, err = f.WriteAt([]byte("abc"), 8)
+	assert.Error(t, err)
+	assert.NoError(t, f.Close())
+
+	// Data is kept after the file is closed.
+	f, exists, err = s.Open("dir/../dir/file", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, exists)
+	b := make([]byte, 4)
+	n, err = f.ReadAt(b, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, []byte("\x00abc"), b)
+	n, err = f.ReadAt(b, 8)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []byte("bc"), b[:n])
+}
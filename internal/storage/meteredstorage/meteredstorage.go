@@ -0,0 +1,72 @@
+// Package meteredstorage provides a Storage that records the durations of the operations of another Storage.
+package meteredstorage
+
+import (
+	"time"
+
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Metrics contains the timers that the durations of the operations are recorded in.
+type Metrics struct {
+	Open  metrics.Timer
+	Read  metrics.Timer
+	Write metrics.Timer
+}
+
+// New returns a Storage that records the durations of the operations of s in m.
+// Returned Storage implements storage.PieceReader if s implements it.
+func New(s storage.Storage, m *Metrics) storage.Storage {
+	ms := &Storage{Storage: s, metrics: m}
+	if pr, ok := s.(storage.PieceReader); ok {
+		return &pieceReaderStorage{Storage: ms, pieceReader: pr}
+	}
+	return ms
+}
+
+// Storage records the durations of the operations of the embedded Storage.
+type Storage struct {
+	storage.Storage
+	metrics *Metrics
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+// Open a file.
+func (s *Storage) Open(name string, size int64) (f storage.File, exists bool, err error) {
+	defer s.metrics.Open.UpdateSince(time.Now())
+	f, exists, err = s.Storage.Open(name, size)
+	if err != nil {
+		return
+	}
+	f = &file{File: f, metrics: s.metrics}
+	return
+}
+
+type pieceReaderStorage struct {
+	*Storage
+	pieceReader storage.PieceReader
+}
+
+var _ storage.PieceReader = (*pieceReaderStorage)(nil)
+
+func (s *pieceReaderStorage) ReadPiece(index uint32, offset int64, b []byte) (n int, err error) {
+	defer s.metrics.Read.UpdateSince(time.Now())
+	return s.pieceReader.ReadPiece(index, offset, b)
+}
+
+type file struct {
+	storage.File
+	metrics *Metrics
+}
+
+func (f *file) ReadAt(p []byte, off int64) (n int, err error) {
+	defer f.metrics.Read.UpdateSince(time.Now())
+	return f.File.ReadAt(p, off)
+}
+
+func (f *file) WriteAt(p []byte, off int64) (n int, err error) {
+	defer f.metrics.Write.UpdateSince(time.Now())
+	return f.File.WriteAt(p, off)
+}
@@ -0,0 +1,37 @@
+package meteredstorage
+
+import (
+	"testing"
+
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/cenkalti/rain/internal/storage/memstorage"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeteredStorage(t *testing.T) {
+	m := &Metrics{
+		Open:  metrics.NewTimer(),
+		Read:  metrics.NewTimer(),
+		Write: metrics.NewTimer(),
+	}
+	s := New(memstorage.New(), m)
+	_, ok := s.(storage.PieceReader)
+	assert.False(t, ok)
+
+	f, _, err := s.Open("file", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt([]byte("abc"), 0)
+	assert.NoError(t, err)
+	_, err = f.ReadAt(make([]byte, 3), 0)
+	assert.NoError(t, err)
+	_, err = f.ReadAt(make([]byte, 3), 3)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	assert.Equal(t, int64(1), m.Open.Count())
+	assert.Equal(t, int64(2), m.Read.Count())
+	assert.Equal(t, int64(1), m.Write.Count())
+}
@@ -0,0 +1,22 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package mmapstorage
+
+import (
+	"errors"
+	"os"
+)
+
+var errNotSupported = errors.New("memory mapped files are not supported on this platform")
+
+func mmap(f *os.File, size int64) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+func msync(b []byte) error {
+	return errNotSupported
+}
+
+func munmap(b []byte) error {
+	return errNotSupported
+}
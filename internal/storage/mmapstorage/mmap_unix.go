@@ -0,0 +1,31 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package mmapstorage
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func mmap(f *os.File, size int64) ([]byte, error) {
+	if size == 0 {
+		// Empty files cannot be mapped.
+		return nil, nil
+	}
+	return unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+}
+
+func msync(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	return unix.Msync(b, unix.MS_SYNC)
+}
+
+func munmap(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	return unix.Munmap(b)
+}
@@ -0,0 +1,169 @@
+// Package mmapstorage implements Storage interface that uses memory mapped files on disk as storage.
+// Reads and writes are copied from and to the mapped memory, without making a system call for each operation.
+package mmapstorage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cenkalti/rain/internal/storage"
+)
+
+var (
+	errWriteBeyondEnd = errors.New("write beyond end of file")
+	errFileTooLarge   = errors.New("file is too large to map into memory")
+)
+
+// MmapStorage implements Storage interface for saving files on disk by mapping them into memory.
+type MmapStorage struct {
+	dest string
+	perm fs.FileMode
+}
+
+// New returns a new MmapStorage at the destination.
+func New(dest string, perm fs.FileMode) (*MmapStorage, error) {
+	var err error
+	dest, err = filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	return &MmapStorage{dest: dest, perm: perm}, nil
+}
+
+var _ storage.Storage = (*MmapStorage)(nil)
+
+// Open a file.
+func (s *MmapStorage) Open(name string, size int64) (f storage.File, exists bool, err error) {
+	if size != int64(int(size)) {
+		err = errFileTooLarge
+		return
+	}
+
+	name = filepath.Clean(name)
+
+	// All files are saved under dest.
+	name = filepath.Join(s.dest, name)
+
+	// Create containing dir if not exists.
+	err = os.MkdirAll(filepath.Dir(name), os.ModeDir|s.perm)
+	if err != nil {
+		return
+	}
+
+	// Open OS file.
+	var mode = s.perm &^ 0111
+	of, err := os.OpenFile(name, os.O_RDWR, mode)
+	if os.IsNotExist(err) {
+		of, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE, mode)
+	} else if err == nil {
+		exists = true
+	}
+	if err != nil {
+		return
+	}
+
+	// Make sure OS file is closed in case of any error.
+	defer func() {
+		if err != nil {
+			_ = of.Close()
+		}
+	}()
+
+	fi, err := of.Stat()
+	if err != nil {
+		return
+	}
+	if fi.Size() != size {
+		err = of.Truncate(size)
+		if err != nil {
+			return
+		}
+	}
+	data, err := mmap(of, size)
+	if err != nil {
+		return
+	}
+	f = &file{f: of, data: data}
+	return
+}
+
+func (s *MmapStorage) RootDir() string {
+	return s.dest
+}
+
+type file struct {
+	f *os.File
+
+	// Reads and writes may continue while the torrent is being stopped.
+	// Accessing the memory after it is unmapped crashes the process, so data is guarded until the file is closed.
+	mData  sync.RWMutex
+	data   []byte
+	closed bool
+}
+
+var _ storage.File = (*file)(nil)
+
+func (f *file) ReadAt(p []byte, off int64) (n int, err error) {
+	f.mData.RLock()
+	defer f.mData.RUnlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n = copy(p, f.data[off:])
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+func (f *file) WriteAt(p []byte, off int64) (n int, err error) {
+	f.mData.RLock()
+	defer f.mData.RUnlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if off+int64(len(p)) > int64(len(f.data)) {
+		return 0, errWriteBeyondEnd
+	}
+	return copy(f.data[off:], p), nil
+}
+
+// Close flushes the mapped memory to disk and closes the file.
+// Reads and writes after Close return os.ErrClosed.
+func (f *file) Close() error {
+	f.mData.Lock()
+	defer f.mData.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	err := msync(f.data)
+	if err2 := munmap(f.data); err == nil {
+		err = err2
+	}
+	f.data = nil
+	if err2 := f.f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// Provider creates a MmapStorage in the directory of each torrent.
+type Provider struct {
+	// Permissions of the created files and directories.
+	Perm fs.FileMode
+}
+
+var _ storage.Provider = Provider{}
+
+// NewStorage returns a new MmapStorage at dir.
+func (p Provider) NewStorage(id, dir string) (storage.Storage, error) {
+	return New(dir, p.Perm)
+}
@@ -0,0 +1,101 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package mmapstorage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMmapStorage(t *testing.T) {
+	dir, err := os.MkdirTemp("", "rain-mmapstorage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := New(dir, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, exists, err := s.Open("dir/file", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, exists)
+	n, err := f.WriteAt([]byte("abc"), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	_, err = f.WriteAt([]byte("abc"), 8)
+	assert.Error(t, err)
+	assert.NoError(t, f.Close())
+
+	b, err := os.ReadFile(filepath.Join(dir, "dir", "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("\x00\x00\x00\x00\x00\x00\x00abc"), b)
+
+	f, exists, err = s.Open("dir/file", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, exists)
+	b = make([]byte, 4)
+	n, err = f.ReadAt(b, 8)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []byte("bc"), b[:n])
+	assert.NoError(t, f.Close())
+
+	// Empty files are not mapped.
+	f, _, err = s.Open("empty", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.ReadAt(b, 0)
+	assert.Equal(t, io.EOF, err)
+	assert.NoError(t, f.Close())
+}
+
+func TestCloseWhileReading(t *testing.T) {
+	dir, err := os.MkdirTemp("", "rain-mmapstorage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := New(dir, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		f, _, err := s.Open("file", 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b := make([]byte, 16<<10)
+				for {
+					if _, err := f.ReadAt(b, 0); err != nil {
+						assert.ErrorIs(t, err, os.ErrClosed)
+						return
+					}
+					if _, err := f.WriteAt(b, 1<<19); err != nil {
+						assert.ErrorIs(t, err, os.ErrClosed)
+						return
+					}
+				}
+			}()
+		}
+		assert.NoError(t, f.Close())
+		wg.Wait()
+		assert.ErrorIs(t, f.Close(), os.ErrClosed)
+	}
+}
@@ -9,6 +9,21 @@ type Storage interface {
 	RootDir() string
 }
 
+// Provider creates a Storage for each torrent in a Session.
+type Provider interface {
+	// NewStorage returns the Storage for the torrent with id.
+	// dir is the directory that the files of the torrent are saved into when they are stored on disk.
+	NewStorage(id, dir string) (Storage, error)
+}
+
+// PieceReader reads the data of pieces. It is used when uploading blocks to peers.
+// A Storage may implement PieceReader if it can serve piece data more efficiently than reading each file in the piece,
+// e.g. by copying from memory mapped files or by keeping the data in pieces natively.
+type PieceReader interface {
+	// ReadPiece reads len(b) bytes from the piece at index starting at offset.
+	ReadPiece(index uint32, offset int64, b []byte) (n int, err error)
+}
+
 // File interface for reading/writing torrent data.
 type File interface {
 	io.ReaderAt
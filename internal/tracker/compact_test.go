@@ -22,3 +22,21 @@ func TestCompactPeer(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestCompactPeer6(t *testing.T) {
+	cp := CompactPeer6{
+		IP:   [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1},
+		Port: 5,
+	}
+	b, err := cp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := DecodePeersCompact6(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0].String() != "[2001:db8::1]:5" {
+		t.Fatalf("unexpected addresses: %v", addrs)
+	}
+}
@@ -68,6 +68,14 @@ func (t *HTTPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 	sb.WriteString(percentEscape(req.Torrent.PeerID))
 	sb.WriteString("&port=")
 	sb.WriteString(strconv.Itoa(req.Torrent.Port))
+	if req.Torrent.IP != nil {
+		sb.WriteString("&ip=")
+		sb.WriteString(req.Torrent.IP.String())
+	}
+	if req.Torrent.IPv6 != nil {
+		sb.WriteString("&ipv6=")
+		sb.WriteString(url.QueryEscape(req.Torrent.IPv6.String()))
+	}
 	sb.WriteString("&uploaded=")
 	sb.WriteString(strconv.FormatInt(req.Torrent.BytesUploaded, 10))
 	sb.WriteString("&downloaded=")
@@ -166,6 +174,14 @@ func (t *HTTPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 	if err != nil {
 		return nil, err
 	}
+	// BEP 7: IPv6 peers are sent in a separate key.
+	if len(response.Peers6) > 0 {
+		peers6, err := tracker.DecodePeersCompact6(response.Peers6)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, peers6...)
+	}
 	t.log.Debugf("got %d peers", len(peers))
 
 	// Filter external IP
@@ -2,7 +2,9 @@ package httptracker_test
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 	"time"
@@ -99,3 +101,37 @@ func TestHTTPTracker(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestAnnounceIPv6(t *testing.T) {
+	queryC := make(chan url.Values, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queryC <- r.URL.Query()
+		_, _ = w.Write([]byte("d8:intervali60e5:peers0:e"))
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trk := httptracker.New(ts.URL, u, timeout, new(http.Transport), "Mozilla/5.0", 2*1024*1024)
+	req := tracker.AnnounceRequest{
+		Torrent: tracker.Torrent{
+			InfoHash: [20]byte{6},
+			PeerID:   [20]byte{1},
+			Port:     1111,
+			IPv6:     &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 2222},
+		},
+	}
+	_, err = trk.Announce(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := <-queryC
+	if ipv6 := q.Get("ipv6"); ipv6 != "[2001:db8::1]:2222" {
+		t.Fatalf("invalid ipv6 param: %q", ipv6)
+	}
+	if port := q.Get("port"); port != "1111" {
+		t.Fatalf("invalid port param: %q", port)
+	}
+}
@@ -1,5 +1,7 @@
 package tracker
 
+import "net"
+
 // Torrent contains fields that are sent in an announce request.
 type Torrent struct {
 	BytesUploaded   int64
@@ -8,4 +10,9 @@ type Torrent struct {
 	InfoHash        [20]byte
 	PeerID          [20]byte
 	Port            int
+	// Address of the client sent to the tracker. Tracker uses the address of the request if nil.
+	IP net.IP
+	// IPv6 address of the client sent to HTTP trackers in addition to the address of the request (BEP 7),
+	// so peers can connect over IPv6 when the tracker is announced over IPv4.
+	IPv6 *net.TCPAddr
 }
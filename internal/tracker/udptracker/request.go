@@ -3,6 +3,7 @@ package udptracker
 import (
 	"context"
 	"encoding/binary"
+	"net"
 
 	"github.com/cenkalti/rain/internal/tracker"
 )
@@ -10,6 +11,9 @@ import (
 type transportRequest struct {
 	*requestBase
 	transferAnnounceRequest
+
+	// Resolved address of the tracker. Set by the transport before sending the request.
+	addr *net.UDPAddr
 }
 
 var _ udpRequest = (*transportRequest)(nil)
@@ -25,6 +29,9 @@ func newTransportRequest(ctx context.Context, req tracker.AnnounceRequest, dest
 		NumWant:    int32(req.NumWant),
 		Port:       uint16(req.Torrent.Port),
 	}
+	if ip4 := req.Torrent.IP.To4(); ip4 != nil {
+		request.IP = binary.BigEndian.Uint32(ip4)
+	}
 	binary.BigEndian.PutUint32(request.PeerID[16:20], request.Key)
 	request.Action = actionAnnounce
 
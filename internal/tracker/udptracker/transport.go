@@ -30,6 +30,9 @@ type Transport struct {
 	log        logger.Logger
 	dnsTimeout time.Duration
 
+	// Opens the socket that requests are sent from.
+	listen func() (net.PacketConn, error)
+
 	// Transport.Do will send messages to this channel.
 	requestC chan *transportRequest
 
@@ -44,11 +47,19 @@ type Transport struct {
 }
 
 // NewTransport returns a new UDP tracker transport.
-func NewTransport(bl *blocklist.Blocklist, dnsTimeout time.Duration) *Transport {
+// If listen is not nil, it is called for opening the socket instead of listening on a random UDP port.
+func NewTransport(bl *blocklist.Blocklist, dnsTimeout time.Duration, listen func() (net.PacketConn, error)) *Transport {
+	if listen == nil {
+		listen = func() (net.PacketConn, error) {
+			// Listening on unspecified address makes the socket dual-stack so both IPv4 and IPv6 trackers can be reached.
+			return net.ListenUDP("udp", &net.UDPAddr{})
+		}
+	}
 	return &Transport{
 		blocklist:  bl,
 		log:        logger.New("udp tracker transport"),
 		dnsTimeout: dnsTimeout,
+		listen:     listen,
 		requestC:   make(chan *transportRequest),
 		readC:      make(chan []byte),
 		closeC:     make(chan struct{}),
@@ -88,8 +99,7 @@ func (t *Transport) Do(req *transportRequest) ([]byte, error) {
 func (t *Transport) Run() {
 	t.log.Debugln("Starting transport run loop")
 	var listening bool
-	var laddr net.UDPAddr
-	udpConn, listenErr := net.ListenUDP("udp4", &laddr)
+	udpConn, listenErr := t.listen()
 	if listenErr != nil {
 		t.log.Error(listenErr)
 	} else {
@@ -137,6 +147,7 @@ func (t *Transport) Run() {
 			} else {
 				if !conn.connectedAt.IsZero() {
 					req.ConnectionID = conn.id
+					req.addr = conn.addr
 					trx, err := beginTransaction(req)
 					if err != nil {
 						trx.request.SetResponse(nil, err)
@@ -185,6 +196,7 @@ func (t *Transport) Run() {
 			// Start announce transaction for all waiting requests.
 			for _, req := range conn.requests {
 				req.ConnectionID = conn.id
+				req.addr = conn.addr
 				trx, err := beginTransaction(req)
 				if err != nil {
 					trx.request.SetResponse(nil, err)
@@ -254,12 +266,12 @@ func (t *Transport) Run() {
 }
 
 // readLoop reads datagrams from connection and sends to the run loop.
-func (t *Transport) readLoop(conn net.Conn) {
+func (t *Transport) readLoop(conn net.PacketConn) {
 	// Read buffer must be big enough to hold a UDP packet of maximum expected size.
 	const maxNumWant = 1000
-	bigBuf := make([]byte, 20+6*maxNumWant)
+	bigBuf := make([]byte, 20+18*maxNumWant)
 	for {
-		n, err := conn.Read(bigBuf)
+		n, _, err := conn.ReadFrom(bigBuf)
 		if err != nil {
 			select {
 			case <-t.closeC:
@@ -289,7 +301,7 @@ type connectionResult struct {
 	connectedAt time.Time
 }
 
-func resolveDestinationAndConnect(trx *transaction, dest string, udpConn *net.UDPConn, dnsTimeout time.Duration, blocklist *blocklist.Blocklist, resultC chan *connectionResult, stopC chan struct{}) {
+func resolveDestinationAndConnect(trx *transaction, dest string, udpConn net.PacketConn, dnsTimeout time.Duration, blocklist *blocklist.Blocklist, resultC chan *connectionResult, stopC chan struct{}) {
 	res := &connectionResult{
 		trx:  trx,
 		dest: dest,
@@ -318,7 +330,7 @@ func resolveDestinationAndConnect(trx *transaction, dest string, udpConn *net.UD
 	}
 }
 
-func sendAndReceiveConnect(trx *transaction, conn *net.UDPConn, addr net.Addr) (connectionID int64, err error) {
+func sendAndReceiveConnect(trx *transaction, conn net.PacketConn, addr net.Addr) (connectionID int64, err error) {
 	// Send request until the transaction is canceled.
 	go retryTransaction(trx, conn, addr)
 
@@ -350,7 +362,7 @@ func sendAndReceiveConnect(trx *transaction, conn *net.UDPConn, addr net.Addr) (
 // Send the request until the transaction is canceled.
 // Transaction canceled by either via outer context or when response is received from the tracker.
 // It backs off with the algorithm described in BEP15 and retries.
-func retryTransaction(trx *transaction, conn *net.UDPConn, addr net.Addr) {
+func retryTransaction(trx *transaction, conn net.PacketConn, addr net.Addr) {
 	var b bytes.Buffer
 	_, _ = trx.request.WriteTo(&b)
 	data := b.Bytes()
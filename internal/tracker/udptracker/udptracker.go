@@ -52,7 +52,9 @@ func (t *UDPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 		return nil, err
 	}
 
-	response, peers, err := t.parseAnnounceResponse(reply)
+	// BEP 15: Announce responses from trackers reached over IPv6 contain IPv6 peer addresses.
+	ipv6 := announce.addr != nil && announce.addr.IP.To4() == nil
+	response, peers, err := t.parseAnnounceResponse(reply, ipv6)
 	if err != nil {
 		return nil, tracker.ErrDecode
 	}
@@ -66,7 +68,7 @@ func (t *UDPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 	}, nil
 }
 
-func (t *UDPTracker) parseAnnounceResponse(data []byte) (*udpAnnounceResponse, []*net.TCPAddr, error) {
+func (t *UDPTracker) parseAnnounceResponse(data []byte, ipv6 bool) (*udpAnnounceResponse, []*net.TCPAddr, error) {
 	var response udpAnnounceResponse
 	err := binary.Read(bytes.NewReader(data), binary.BigEndian, &response)
 	if err != nil {
@@ -76,7 +78,11 @@ func (t *UDPTracker) parseAnnounceResponse(data []byte) (*udpAnnounceResponse, [
 	if response.Action != actionAnnounce {
 		return nil, nil, errors.New("invalid action")
 	}
-	peers, err := tracker.DecodePeersCompact(data[binary.Size(response):])
+	decode := tracker.DecodePeersCompact
+	if ipv6 {
+		decode = tracker.DecodePeersCompact6
+	}
+	peers, err := decode(data[binary.Size(response):])
 	if err != nil {
 		return nil, nil, err
 	}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/cenkalti/rain/internal/blocklist"
+	"github.com/cenkalti/rain/internal/proxy"
 	"github.com/cenkalti/rain/internal/resolver"
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/tracker/httptracker"
@@ -23,16 +24,33 @@ type TrackerManager struct {
 	udpTransport  *udptracker.Transport
 }
 
+// Maximum duration for setting up the UDP relay on the proxy server.
+const proxyUDPTimeout = 30 * time.Second
+
 // New returns a new TrackerManager.
-func New(bl *blocklist.Blocklist, dnsTimeout time.Duration, tlsSkipVerify bool) *TrackerManager {
+// If pr is not nil, trackers are contacted through the proxy.
+// If proxyFallback is true, trackers that cannot be reached through the proxy are contacted directly.
+func New(bl *blocklist.Blocklist, dnsTimeout time.Duration, tlsSkipVerify bool, pr *proxy.Proxy, proxyFallback bool) *TrackerManager {
+	var listenUDP func() (net.PacketConn, error)
+	if pr != nil {
+		listenUDP = func() (net.PacketConn, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), proxyUDPTimeout)
+			defer cancel()
+			pc, err := pr.ListenPacket(ctx)
+			if err != nil && proxyFallback {
+				return net.ListenUDP("udp", &net.UDPAddr{})
+			}
+			return pc, err
+		}
+	}
 	m := &TrackerManager{
 		httpTransport: &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: tlsSkipVerify}, // nolint: gosec
 		},
-		udpTransport: udptracker.NewTransport(bl, dnsTimeout),
+		udpTransport: udptracker.NewTransport(bl, dnsTimeout, listenUDP),
 	}
 	go m.udpTransport.Run()
-	m.httpTransport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+	direct := proxy.DialFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
 		ip, port, err := resolver.Resolve(ctx, addr, dnsTimeout, bl)
 		if err != nil {
 			return nil, err
@@ -40,7 +58,9 @@ func New(bl *blocklist.Blocklist, dnsTimeout time.Duration, tlsSkipVerify bool)
 		var d net.Dialer
 		taddr := &net.TCPAddr{IP: ip, Port: port}
 		return d.DialContext(ctx, network, taddr.String())
-	}
+	})
+	// Host names are resolved by the proxy server. Blocklist is not checked for trackers contacted through the proxy.
+	m.httpTransport.DialContext = pr.Dialer(direct, proxyFallback).DialContext
 	return m
 }
 
@@ -48,6 +48,12 @@ func New(numUnchoked, numOptimisticUnchoked int) *Unchoker {
 	}
 }
 
+// SetNumUnchoked changes the number of peers unchoked by their speed.
+// The change is applied in the next call to TickUnchoke.
+func (u *Unchoker) SetNumUnchoked(n int) {
+	u.numUnchoked = n
+}
+
 // HandleDisconnect must be called to remove the peer from internal indexes.
 func (u *Unchoker) HandleDisconnect(pe Peer) {
 	delete(u.peersUnchoked, pe)
@@ -97,11 +103,25 @@ func (u *Unchoker) TickUnchoke(allPeers []Peer, torrentCompleted bool) {
 		}
 	}
 	for _, pe := range peers {
+		if !optimistic && pe.Optimistic() {
+			// Optimistic unchokes are kept until the next optimistic round.
+			continue
+		}
 		u.chokePeer(pe)
 	}
 	u.round = (u.round + 1) % 3
 }
 
+// ChokeAll chokes all peers that are unchoked by the Unchoker.
+func (u *Unchoker) ChokeAll() {
+	for pe := range u.peersUnchoked {
+		u.chokePeer(pe)
+	}
+	for pe := range u.peersUnchokedOptimistic {
+		u.chokePeer(pe)
+	}
+}
+
 func (u *Unchoker) chokePeer(pe Peer) {
 	if pe.Choking() {
 		return
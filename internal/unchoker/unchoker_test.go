@@ -143,6 +143,44 @@ func TestTickUnchoke(t *testing.T) {
 	}, testPeers)
 }
 
+func TestTickUnchokeKeepsOptimistic(t *testing.T) {
+	testPeers := []*TestPeer{
+		{interested: true, choking: true, downloadSpeed: 4},
+		{choking: true, downloadSpeed: 2},
+		{interested: true, choking: true},
+	}
+	getPeers := func() []Peer {
+		peers := make([]Peer, len(testPeers))
+		for i := range peers {
+			peers[i] = testPeers[i]
+		}
+		return peers
+	}
+	u := New(1, 1)
+
+	// Slowest peer is the only candidate for optimistic unchoke.
+	u.round = 0
+	u.TickUnchoke(getPeers(), false)
+	assert.True(t, testPeers[2].optimistic)
+
+	// Optimistically unchoked peer is slower than the others but must stay unchoked until the next optimistic round.
+	testPeers[1].interested = true
+	u.round = 1
+	u.TickUnchoke(getPeers(), false)
+	assert.False(t, testPeers[0].choking)
+	assert.True(t, testPeers[1].choking)
+	assert.False(t, testPeers[2].choking)
+	assert.True(t, testPeers[2].optimistic)
+
+	// Number of slots can be changed.
+	u.SetNumUnchoked(2)
+	u.round = 1
+	u.TickUnchoke(getPeers(), false)
+	assert.False(t, testPeers[0].choking)
+	assert.False(t, testPeers[1].choking)
+	assert.False(t, testPeers[2].choking)
+}
+
 type TestPeer struct {
 	interested    bool
 	choking       bool
@@ -8,6 +8,8 @@ type downloadJob struct {
 	Filename   string
 	RangeBegin int64
 	Length     int64
+	// Padding files are not requested from the server. Their contents are zeros.
+	Padding bool
 }
 
 func createJobs(pieces []piece.Piece, begin, end uint32) []downloadJob {
@@ -24,6 +26,7 @@ func createJobs(pieces []piece.Piece, begin, end uint32) []downloadJob {
 					Filename:   sec.Name,
 					RangeBegin: sec.Offset,
 					Length:     sec.Length,
+					Padding:    sec.Padding,
 				}
 				continue
 			}
@@ -38,6 +41,7 @@ func createJobs(pieces []piece.Piece, begin, end uint32) []downloadJob {
 				Filename:   sec.Name,
 				RangeBegin: sec.Offset,
 				Length:     sec.Length,
+				Padding:    sec.Padding,
 			}
 		}
 	}
@@ -113,3 +113,50 @@ func TestCreateJobs(t *testing.T) {
 	}, createJobs(pieces, 2, 3))
 	assert.Equal(t, ([]downloadJob)(nil), createJobs(pieces, 2, 2))
 }
+
+func TestCreateJobsPadding(t *testing.T) {
+	pieces := []piece.Piece{
+		{
+			Data: []filesection.FileSection{
+				{
+					Name:   "file1",
+					Offset: 0,
+					Length: 10,
+				},
+				{
+					Name:    ".pad/6",
+					Offset:  0,
+					Length:  6,
+					Padding: true,
+				},
+			},
+		},
+		{
+			Data: []filesection.FileSection{
+				{
+					Name:   "file2",
+					Offset: 0,
+					Length: 16,
+				},
+			},
+		},
+	}
+	assert.Equal(t, []downloadJob{
+		{
+			Filename:   "file1",
+			RangeBegin: 0,
+			Length:     10,
+		},
+		{
+			Filename:   ".pad/6",
+			RangeBegin: 0,
+			Length:     6,
+			Padding:    true,
+		},
+		{
+			Filename:   "file2",
+			RangeBegin: 0,
+			Length:     16,
+		},
+	}, createJobs(pieces, 0, 2))
+}
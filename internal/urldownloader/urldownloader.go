@@ -11,14 +11,14 @@ import (
 
 	"github.com/cenkalti/rain/internal/bufferpool"
 	"github.com/cenkalti/rain/internal/piece"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/speedlimiter"
 )
 
 // URLDownloader downloads files from a HTTP source.
 type URLDownloader struct {
 	URL                 string
 	Begin, End, current uint32 // piece index
-	bucket              *ratelimit.Bucket
+	bucket              *speedlimiter.Limiter
 	closeC, doneC       chan struct{}
 }
 
@@ -32,7 +32,7 @@ type PieceResult struct {
 }
 
 // New returns a new URLDownloader for the given source and piece range.
-func New(source string, begin, end uint32, b *ratelimit.Bucket) *URLDownloader {
+func New(source string, begin, end uint32, b *speedlimiter.Limiter) *URLDownloader {
 	return &URLDownloader{
 		URL:     source,
 		Begin:   begin,
@@ -90,7 +90,38 @@ func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile
 	var n int // position in piece
 	buf := pool.Get(int(pieces[d.current].Length))
 
+	// nextPiece sends the completed piece in buf and allocates a new buffer for the next piece.
+	// It returns true if the last piece has been sent.
+	nextPiece := func() bool {
+		index := d.current
+		done := d.current >= d.readEnd()-1
+		d.sendResult(resultC, &PieceResult{Downloader: d, Buffer: buf, Index: index, Done: done})
+		if done {
+			return true
+		}
+		d.incrCurrent()
+		// Allocate new buffer for next piece
+		n = 0
+		buf = pool.Get(int(pieces[d.current].Length))
+		return false
+	}
+
 	processJob := func(job downloadJob) bool {
+		if job.Padding {
+			var m int64 // position in padding
+			for m < job.Length {
+				b := buf.Data[n : int64(n)+calcReadSize(buf, n, job, m)]
+				for i := range b {
+					b[i] = 0
+				}
+				n += len(b)
+				m += int64(len(b))
+				if n == len(buf.Data) && nextPiece() {
+					return true
+				}
+			}
+			return true
+		}
 		u := d.getURL(job.Filename, multifile)
 		req, err := http.NewRequest(http.MethodGet, u, nil)
 		if err != nil {
@@ -130,17 +161,8 @@ func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile
 			}
 			n += o
 			m += int64(o)
-			if n == len(buf.Data) { // piece completed
-				index := d.current
-				done := d.current >= d.readEnd()-1
-				d.sendResult(resultC, &PieceResult{Downloader: d, Buffer: buf, Index: index, Done: done})
-				if done {
-					return true
-				}
-				d.incrCurrent()
-				// Allocate new buffer for next piece
-				n = 0
-				buf = pool.Get(int(pieces[d.current].Length))
+			if n == len(buf.Data) && nextPiece() { // piece completed
+				return true
 			}
 		}
 		return true
@@ -0,0 +1,643 @@
+package utp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// Maximum number of payload bytes in a packet. Keeps the datagrams below the MTU of most paths.
+	maxPayload = 1400 - headerSize
+	// Size of the receive buffer advertised to the peer.
+	recvBufferSize = 1 << 20
+	// Maximum number of packets that are sent but not acknowledged yet.
+	maxOutgoingPackets = 1 << 12
+	// Out of order packets further than this are dropped.
+	maxOutOfOrder = 1 << 12
+
+	// LEDBAT parameters
+	targetDelay     = 100 * time.Millisecond
+	maxCwndIncrease = 3000
+	minWindow       = maxPayload
+	initialWindow   = 3000
+	maxWindow       = 1 << 22
+
+	initialRTO          = time.Second
+	minRTO              = 500 * time.Millisecond
+	maxRTO              = time.Minute
+	maxTransmissions    = 6
+	maxSynTransmissions = 3
+	dupAckThreshold     = 3
+	keepAliveInterval   = 29 * time.Second
+	tickInterval        = 100 * time.Millisecond
+)
+
+const (
+	stateSynSent = iota
+	stateSynRecv
+	stateConnected
+)
+
+var (
+	errConnClosed = errors.New("utp connection closed")
+	errReset      = errors.New("utp connection reset by peer")
+	errTimeout    = errors.New("utp connection timed out")
+)
+
+type packet struct {
+	typ           uint8
+	seqNr         uint16
+	payload       []byte
+	sentAt        time.Time
+	transmissions int
+}
+
+type inPacket struct {
+	payload []byte
+	fin     bool
+}
+
+// Conn is a uTP connection. It implements net.Conn.
+type Conn struct {
+	socket *Socket
+	raddr  net.Addr
+	recvID uint16
+	sendID uint16
+
+	m      sync.Mutex
+	cond   *sync.Cond
+	state  int
+	err    error
+	closed bool
+	doneC  chan struct{}
+
+	// Sending side
+	seqNr     uint16
+	lastAck   uint16
+	dupAcks   int
+	outgoing  []*packet
+	curWindow int
+	maxWindow float64
+	peerWnd   int
+	finSent   bool
+	lastSend  time.Time
+
+	// Receiving side
+	ackNr      uint16
+	readBuf    bytes.Buffer
+	outOfOrder map[uint16]inPacket
+	gotFin     bool
+	replyMicro uint32
+
+	rtt    time.Duration
+	rttVar time.Duration
+	rto    time.Duration
+	delay  delayHistory
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readTimer     *time.Timer
+	writeTimer    *time.Timer
+}
+
+var _ net.Conn = (*Conn)(nil)
+
+func newConn(s *Socket, raddr net.Addr, recvID, sendID uint16, state int) *Conn {
+	c := &Conn{
+		socket:     s,
+		raddr:      raddr,
+		recvID:     recvID,
+		sendID:     sendID,
+		state:      state,
+		doneC:      make(chan struct{}),
+		seqNr:      1,
+		maxWindow:  initialWindow,
+		peerWnd:    recvBufferSize,
+		outOfOrder: make(map[uint16]inPacket),
+		rto:        initialRTO,
+	}
+	c.cond = sync.NewCond(&c.m)
+	go c.run()
+	return c
+}
+
+// connect sends a SYN packet and waits until the peer acknowledges it.
+func (c *Conn) connect(ctx context.Context) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.m.Lock()
+			c.cond.Broadcast()
+			c.m.Unlock()
+		case <-done:
+		}
+	}()
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.sendPacket(stSyn, nil)
+	for c.state == stateSynSent && c.err == nil && ctx.Err() == nil {
+		c.cond.Wait()
+	}
+	if c.err != nil {
+		return c.err
+	}
+	if err := ctx.Err(); err != nil {
+		c.destroyLocked(err)
+		return err
+	}
+	return nil
+}
+
+// Read data from the connection.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for {
+		if c.closed {
+			return 0, c.opError("read", errConnClosed)
+		}
+		if c.readBuf.Len() > 0 {
+			break
+		}
+		if c.gotFin {
+			return 0, io.EOF
+		}
+		if c.err != nil {
+			return 0, c.opError("read", c.err)
+		}
+		if deadlineExceeded(c.readDeadline) {
+			return 0, c.opError("read", os.ErrDeadlineExceeded)
+		}
+		c.cond.Wait()
+	}
+	before := c.readBuf.Len()
+	n, _ := c.readBuf.Read(b)
+	// Let the peer know that the receive window is open again.
+	if before > recvBufferSize/2 && c.readBuf.Len() <= recvBufferSize/2 && c.err == nil {
+		c.sendState()
+	}
+	return n, nil
+}
+
+// Write data to the connection. Blocks until all data is sent, subject to the congestion window.
+func (c *Conn) Write(b []byte) (n int, err error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for n < len(b) {
+		for !c.canSend() {
+			if c.closed {
+				return n, c.opError("write", errConnClosed)
+			}
+			if c.err != nil {
+				return n, c.opError("write", c.err)
+			}
+			if deadlineExceeded(c.writeDeadline) {
+				return n, c.opError("write", os.ErrDeadlineExceeded)
+			}
+			c.cond.Wait()
+		}
+		size := len(b) - n
+		if size > maxPayload {
+			size = maxPayload
+		}
+		payload := make([]byte, size)
+		copy(payload, b[n:n+size])
+		c.sendPacket(stData, payload)
+		n += size
+	}
+	return n, nil
+}
+
+func (c *Conn) canSend() bool {
+	if c.closed || c.err != nil || c.state != stateConnected || deadlineExceeded(c.writeDeadline) {
+		return false
+	}
+	if c.curWindow == 0 {
+		return true
+	}
+	if len(c.outgoing) >= maxOutgoingPackets {
+		return false
+	}
+	window := int(c.maxWindow)
+	if c.peerWnd < window {
+		window = c.peerWnd
+	}
+	return c.curWindow+maxPayload <= window
+}
+
+// Close the connection. Sends a FIN packet to the peer and returns without waiting for the acknowledgement.
+func (c *Conn) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.closed {
+		return errConnClosed
+	}
+	c.closed = true
+	c.cond.Broadcast()
+	if c.err != nil {
+		return nil
+	}
+	if c.state != stateConnected {
+		c.destroyLocked(errConnClosed)
+		return nil
+	}
+	c.sendPacket(stFin, nil)
+	c.finSent = true
+	return nil
+}
+
+// LocalAddr returns the local address of the socket.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.socket.Addr()
+}
+
+// RemoteAddr returns the UDP address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// SetDeadline sets both the read and write deadlines.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.readDeadline = t
+	c.readTimer = c.resetTimer(c.readTimer, t)
+	c.writeDeadline = t
+	c.writeTimer = c.resetTimer(c.writeTimer, t)
+	return nil
+}
+
+// SetReadDeadline sets the deadline for Read calls.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.readDeadline = t
+	c.readTimer = c.resetTimer(c.readTimer, t)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Write calls.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.writeDeadline = t
+	c.writeTimer = c.resetTimer(c.writeTimer, t)
+	return nil
+}
+
+// resetTimer replaces the timer that wakes up the goroutines waiting on the connection when the deadline is reached.
+func (c *Conn) resetTimer(timer *time.Timer, t time.Time) *time.Timer {
+	if timer != nil {
+		timer.Stop()
+	}
+	c.cond.Broadcast()
+	if t.IsZero() {
+		return nil
+	}
+	return time.AfterFunc(time.Until(t), func() {
+		c.m.Lock()
+		c.cond.Broadcast()
+		c.m.Unlock()
+	})
+}
+
+func (c *Conn) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: "utp", Source: c.LocalAddr(), Addr: c.raddr, Err: err}
+}
+
+func deadlineExceeded(t time.Time) bool {
+	return !t.IsZero() && !time.Now().Before(t)
+}
+
+// reset sends a reset packet to the peer and destroys the connection.
+func (c *Conn) reset() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.writePacket(stReset, c.seqNr, nil)
+	c.destroyLocked(errConnClosed)
+}
+
+func (c *Conn) destroy(err error) {
+	c.m.Lock()
+	c.destroyLocked(err)
+	c.m.Unlock()
+}
+
+func (c *Conn) destroyLocked(err error) {
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.outgoing = nil
+	c.curWindow = 0
+	if c.readTimer != nil {
+		c.readTimer.Stop()
+	}
+	if c.writeTimer != nil {
+		c.writeTimer.Stop()
+	}
+	close(c.doneC)
+	c.cond.Broadcast()
+	c.socket.removeConn(c)
+}
+
+// run retransmits the lost packets and sends keep-alive packets until the connection is destroyed.
+func (c *Conn) run() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.tick()
+		case <-c.doneC:
+			return
+		}
+	}
+}
+
+func (c *Conn) tick() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.err != nil {
+		return
+	}
+	now := time.Now()
+	if len(c.outgoing) == 0 {
+		if c.state == stateConnected && now.Sub(c.lastSend) >= keepAliveInterval {
+			c.sendState()
+		}
+		return
+	}
+	p := c.outgoing[0]
+	if now.Sub(p.sentAt) < c.rto {
+		return
+	}
+	limit := maxTransmissions
+	if p.typ == stSyn {
+		limit = maxSynTransmissions
+	}
+	if p.transmissions >= limit {
+		c.destroyLocked(errTimeout)
+		return
+	}
+	c.rto *= 2
+	if c.rto > maxRTO {
+		c.rto = maxRTO
+	}
+	c.maxWindow = minWindow
+	c.dupAcks = 0
+	c.transmit(p)
+}
+
+func (c *Conn) handlePacket(h *header, payload []byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.replyMicro = timestampMicro() - h.Timestamp
+	c.peerWnd = int(h.WndSize)
+	switch h.Type {
+	case stReset:
+		c.destroyLocked(errReset)
+		return
+	case stSyn:
+		if c.state == stateSynRecv {
+			c.ackNr = h.SeqNr
+			c.seqNr = uint16(rand.Intn(1 << 16))
+			c.lastAck = c.seqNr - 1
+			c.state = stateConnected
+		}
+		// Duplicate SYN packets are acknowledged again in case our reply is lost.
+		c.sendState()
+		return
+	}
+	if c.state == stateSynSent {
+		if h.Type != stState {
+			return
+		}
+		c.ackNr = h.SeqNr - 1
+		c.state = stateConnected
+		c.cond.Broadcast()
+	}
+	c.handleAck(h)
+	switch h.Type {
+	case stData:
+		c.handleData(h.SeqNr, payload, false)
+	case stFin:
+		c.handleData(h.SeqNr, nil, true)
+	}
+	if c.closed && c.finSent && len(c.outgoing) == 0 {
+		c.destroyLocked(errConnClosed)
+	}
+}
+
+func (c *Conn) handleAck(h *header) {
+	now := time.Now()
+	var acked, removed int
+	for len(c.outgoing) > 0 && !seqLess(h.AckNr, c.outgoing[0].seqNr) {
+		p := c.outgoing[0]
+		c.outgoing[0] = nil
+		c.outgoing = c.outgoing[1:]
+		removed++
+		acked += len(p.payload)
+		if p.transmissions == 1 {
+			c.updateRTT(now.Sub(p.sentAt))
+		}
+	}
+	if removed > 0 {
+		c.curWindow -= acked
+		c.lastAck = h.AckNr
+		c.dupAcks = 0
+		c.rto = c.rtt + 4*c.rttVar
+		if c.rto < minRTO {
+			c.rto = minRTO
+		}
+		c.updateWindow(acked, h.TimestampDiff, now)
+		c.cond.Broadcast()
+		return
+	}
+	if h.Type == stState && h.AckNr == c.lastAck && len(c.outgoing) > 0 {
+		c.dupAcks++
+		if c.dupAcks == dupAckThreshold {
+			// Fast retransmit
+			c.maxWindow /= 2
+			if c.maxWindow < minWindow {
+				c.maxWindow = minWindow
+			}
+			c.transmit(c.outgoing[0])
+		}
+	}
+}
+
+// updateRTT updates the round trip time estimations as described in RFC 6298.
+func (c *Conn) updateRTT(sample time.Duration) {
+	if c.rtt == 0 {
+		c.rtt = sample
+		c.rttVar = sample / 2
+		return
+	}
+	delta := c.rtt - sample
+	if delta < 0 {
+		delta = -delta
+	}
+	c.rttVar += (delta - c.rttVar) / 4
+	c.rtt += (sample - c.rtt) / 8
+}
+
+// updateWindow adjusts the congestion window with LEDBAT.
+// The window grows while the queuing delay is below the target and shrinks when it is above.
+func (c *Conn) updateWindow(acked int, delaySample uint32, now time.Time) {
+	if acked == 0 {
+		return
+	}
+	var ourDelay time.Duration
+	if delaySample != 0 {
+		ourDelay = c.delay.Add(delaySample, now)
+	}
+	offTarget := float64(targetDelay-ourDelay) / float64(targetDelay)
+	windowFactor := float64(acked) / c.maxWindow
+	if windowFactor > 1 {
+		windowFactor = 1
+	}
+	c.maxWindow += maxCwndIncrease * offTarget * windowFactor
+	if c.maxWindow < minWindow {
+		c.maxWindow = minWindow
+	} else if c.maxWindow > maxWindow {
+		c.maxWindow = maxWindow
+	}
+}
+
+func (c *Conn) handleData(seqNr uint16, payload []byte, fin bool) {
+	if c.gotFin || !seqLess(c.ackNr, seqNr) {
+		// Duplicate packet. Our acknowledgement may be lost.
+		c.sendState()
+		return
+	}
+	if seqNr-c.ackNr > maxOutOfOrder {
+		return
+	}
+	if seqNr != c.ackNr+1 {
+		if _, ok := c.outOfOrder[seqNr]; !ok {
+			c.outOfOrder[seqNr] = inPacket{payload: append([]byte(nil), payload...), fin: fin}
+		}
+		c.sendState()
+		return
+	}
+	c.deliver(payload, fin)
+	for !c.gotFin {
+		p, ok := c.outOfOrder[c.ackNr+1]
+		if !ok {
+			break
+		}
+		delete(c.outOfOrder, c.ackNr+1)
+		c.deliver(p.payload, p.fin)
+	}
+	c.sendState()
+	c.cond.Broadcast()
+}
+
+func (c *Conn) deliver(payload []byte, fin bool) {
+	c.ackNr++
+	if fin {
+		c.gotFin = true
+		c.outOfOrder = nil
+		return
+	}
+	if !c.closed {
+		c.readBuf.Write(payload)
+	}
+}
+
+// sendPacket sends a packet that consumes a sequence number and must be acknowledged by the peer.
+func (c *Conn) sendPacket(typ uint8, payload []byte) {
+	p := &packet{typ: typ, seqNr: c.seqNr, payload: payload}
+	c.seqNr++
+	c.outgoing = append(c.outgoing, p)
+	c.curWindow += len(payload)
+	c.transmit(p)
+}
+
+func (c *Conn) transmit(p *packet) {
+	p.transmissions++
+	p.sentAt = time.Now()
+	c.writePacket(p.typ, p.seqNr, p.payload)
+}
+
+// sendState sends an acknowledgement.
+func (c *Conn) sendState() {
+	c.writePacket(stState, c.seqNr, nil)
+}
+
+func (c *Conn) writePacket(typ uint8, seqNr uint16, payload []byte) {
+	h := header{
+		Type:          typ,
+		ConnID:        c.sendID,
+		Timestamp:     timestampMicro(),
+		TimestampDiff: c.replyMicro,
+		WndSize:       uint32(c.recvWindow()),
+		SeqNr:         seqNr,
+		AckNr:         c.ackNr,
+	}
+	if typ == stSyn {
+		h.ConnID = c.recvID
+	}
+	b := make([]byte, headerSize+len(payload))
+	h.Marshal(b)
+	copy(b[headerSize:], payload)
+	c.lastSend = time.Now()
+	// Errors are ignored because lost packets are sent again.
+	_, _ = c.socket.pc.WriteTo(b, c.raddr)
+}
+
+func (c *Conn) recvWindow() int {
+	n := recvBufferSize - c.readBuf.Len()
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+func timestampMicro() uint32 {
+	return uint32(time.Now().UnixNano() / int64(time.Microsecond))
+}
+
+// delayHistory keeps the minimum one-way delay seen in the last two minutes as the base delay.
+// Clocks of the hosts are not synchronized so only the difference from the base delay is meaningful.
+type delayHistory struct {
+	mins      [2]uint32
+	rotatedAt time.Time
+}
+
+// Add a delay sample and return the queuing delay.
+func (d *delayHistory) Add(sample uint32, now time.Time) time.Duration {
+	switch {
+	case d.rotatedAt.IsZero():
+		d.mins[0], d.mins[1] = sample, sample
+		d.rotatedAt = now
+	case now.Sub(d.rotatedAt) > time.Minute:
+		d.mins[1] = d.mins[0]
+		d.mins[0] = sample
+		d.rotatedAt = now
+	case sample < d.mins[0]:
+		d.mins[0] = sample
+	}
+	base := d.mins[0]
+	if d.mins[1] < base {
+		base = d.mins[1]
+	}
+	return time.Duration(sample-base) * time.Microsecond
+}
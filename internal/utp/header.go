@@ -0,0 +1,79 @@
+package utp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Packet types defined in BEP 29.
+const (
+	stData  = 0
+	stFin   = 1
+	stState = 2
+	stReset = 3
+	stSyn   = 4
+)
+
+const (
+	version    = 1
+	headerSize = 20
+)
+
+var errInvalidPacket = errors.New("invalid utp packet")
+
+type header struct {
+	Type          uint8
+	ConnID        uint16
+	Timestamp     uint32
+	TimestampDiff uint32
+	WndSize       uint32
+	SeqNr         uint16
+	AckNr         uint16
+}
+
+func (h *header) Marshal(b []byte) {
+	b[0] = h.Type<<4 | version
+	b[1] = 0 // no extensions
+	binary.BigEndian.PutUint16(b[2:4], h.ConnID)
+	binary.BigEndian.PutUint32(b[4:8], h.Timestamp)
+	binary.BigEndian.PutUint32(b[8:12], h.TimestampDiff)
+	binary.BigEndian.PutUint32(b[12:16], h.WndSize)
+	binary.BigEndian.PutUint16(b[16:18], h.SeqNr)
+	binary.BigEndian.PutUint16(b[18:20], h.AckNr)
+}
+
+// Unmarshal parses the header in b and returns the payload of the packet.
+// Extensions are skipped because none of them are supported.
+func (h *header) Unmarshal(b []byte) ([]byte, error) {
+	if len(b) < headerSize {
+		return nil, errInvalidPacket
+	}
+	if b[0]&0x0f != version {
+		return nil, errInvalidPacket
+	}
+	h.Type = b[0] >> 4
+	if h.Type > stSyn {
+		return nil, errInvalidPacket
+	}
+	h.ConnID = binary.BigEndian.Uint16(b[2:4])
+	h.Timestamp = binary.BigEndian.Uint32(b[4:8])
+	h.TimestampDiff = binary.BigEndian.Uint32(b[8:12])
+	h.WndSize = binary.BigEndian.Uint32(b[12:16])
+	h.SeqNr = binary.BigEndian.Uint16(b[16:18])
+	h.AckNr = binary.BigEndian.Uint16(b[18:20])
+	ext := b[1]
+	b = b[headerSize:]
+	for ext != 0 {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, errInvalidPacket
+		}
+		ext = b[0]
+		b = b[2+int(b[1]):]
+	}
+	return b, nil
+}
+
+// seqLess compares sequence numbers taking wrapping into account.
+func seqLess(a, b uint16) bool {
+	return int16(a-b) < 0
+}
@@ -0,0 +1,226 @@
+// Package utp implements the uTorrent transport protocol (BEP 29).
+//
+// uTP is a reliable, ordered stream protocol on top of UDP.
+// It uses LEDBAT congestion control which keeps the queuing delay on the path low
+// by backing off as soon as the delay grows, so that it does not slow down other traffic of the user.
+//
+// See http://www.bittorrent.org/beps/bep_0029.html for details.
+package utp
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+)
+
+// Number of incoming connections waiting to be accepted.
+// Connections are reset if the backlog is full.
+const acceptBacklog = 32
+
+var errSocketClosed = errors.New("utp socket closed")
+
+type connKey struct {
+	addr   string
+	recvID uint16
+}
+
+// Socket multiplexes uTP connections on a single UDP socket.
+// It implements net.Listener for accepting incoming connections and
+// can be used for dialing outgoing connections at the same time.
+type Socket struct {
+	pc        net.PacketConn
+	m         sync.Mutex
+	conns     map[connKey]*Conn
+	acceptC   chan *Conn
+	closeC    chan struct{}
+	doneC     chan struct{}
+	closeOnce sync.Once
+}
+
+var _ net.Listener = (*Socket)(nil)
+
+// Listen creates a new uTP socket on the local UDP address.
+func Listen(network, address string) (*Socket, error) {
+	pc, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewSocket(pc), nil
+}
+
+// NewSocket returns a new uTP socket that sends and receives packets on pc.
+func NewSocket(pc net.PacketConn) *Socket {
+	s := &Socket{
+		pc:      pc,
+		conns:   make(map[connKey]*Conn),
+		acceptC: make(chan *Conn, acceptBacklog),
+		closeC:  make(chan struct{}),
+		doneC:   make(chan struct{}),
+	}
+	go s.readLoop()
+	return s
+}
+
+// Addr returns the local address of the socket.
+func (s *Socket) Addr() net.Addr {
+	return s.pc.LocalAddr()
+}
+
+// Accept waits for the next incoming connection.
+func (s *Socket) Accept() (net.Conn, error) {
+	select {
+	case c := <-s.acceptC:
+		return c, nil
+	case <-s.closeC:
+		return nil, errSocketClosed
+	}
+}
+
+// DialContext opens a new uTP connection to the address.
+// Network must be one of "udp", "udp4" or "udp6".
+func (s *Socket) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	s.m.Lock()
+	select {
+	case <-s.closeC:
+		s.m.Unlock()
+		return nil, errSocketClosed
+	default:
+	}
+	key := connKey{addr: raddr.String()}
+	for {
+		key.recvID = uint16(rand.Intn(1 << 16))
+		if _, ok := s.conns[key]; !ok {
+			break
+		}
+	}
+	c := newConn(s, raddr, key.recvID, key.recvID+1, stateSynSent)
+	s.conns[key] = c
+	s.m.Unlock()
+
+	if err = c.connect(ctx); err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "utp", Addr: raddr, Err: err}
+	}
+	return c, nil
+}
+
+// Close the socket and all connections on it.
+func (s *Socket) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closeC)
+		err = s.pc.Close()
+		<-s.doneC
+		s.m.Lock()
+		conns := make([]*Conn, 0, len(s.conns))
+		for _, c := range s.conns {
+			conns = append(conns, c)
+		}
+		s.m.Unlock()
+		for _, c := range conns {
+			c.destroy(errSocketClosed)
+		}
+	})
+	return err
+}
+
+func (s *Socket) readLoop() {
+	defer close(s.doneC)
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := s.pc.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-s.closeC:
+				return
+			default:
+			}
+			// Errors caused by ICMP messages are reported on the socket on some platforms.
+			continue
+		}
+		s.handlePacket(buf[:n], addr)
+	}
+}
+
+func (s *Socket) handlePacket(b []byte, addr net.Addr) {
+	var h header
+	payload, err := h.Unmarshal(b)
+	if err != nil {
+		return
+	}
+	key := connKey{addr: addr.String(), recvID: h.ConnID}
+	var accepted bool
+	s.m.Lock()
+	var c *Conn
+	switch h.Type {
+	case stSyn:
+		key.recvID = h.ConnID + 1
+		c = s.conns[key]
+		if c == nil {
+			c = newConn(s, addr, key.recvID, h.ConnID, stateSynRecv)
+			s.conns[key] = c
+			accepted = true
+		}
+	case stReset:
+		c = s.findResetConn(addr.String(), h.ConnID)
+	default:
+		c = s.conns[key]
+	}
+	s.m.Unlock()
+	if c == nil {
+		if h.Type != stReset {
+			s.sendReset(&h, addr)
+		}
+		return
+	}
+	c.handlePacket(&h, payload)
+	if accepted {
+		select {
+		case s.acceptC <- c:
+		default:
+			c.reset()
+		}
+	}
+}
+
+// findResetConn returns the connection that the reset packet belongs to.
+// The connection ID in a reset packet may be either our receive ID or our send ID.
+func (s *Socket) findResetConn(addr string, id uint16) *Conn {
+	if c, ok := s.conns[connKey{addr, id}]; ok {
+		return c
+	}
+	if c, ok := s.conns[connKey{addr, id + 1}]; ok && c.sendID == id {
+		return c
+	}
+	if c, ok := s.conns[connKey{addr, id - 1}]; ok && c.sendID == id {
+		return c
+	}
+	return nil
+}
+
+func (s *Socket) sendReset(h *header, addr net.Addr) {
+	var b [headerSize]byte
+	r := header{
+		Type:      stReset,
+		ConnID:    h.ConnID,
+		Timestamp: timestampMicro(),
+		SeqNr:     uint16(rand.Intn(1 << 16)),
+		AckNr:     h.SeqNr,
+	}
+	r.Marshal(b[:])
+	_, _ = s.pc.WriteTo(b[:], addr)
+}
+
+func (s *Socket) removeConn(c *Conn) {
+	key := connKey{addr: c.raddr.String(), recvID: c.recvID}
+	s.m.Lock()
+	if s.conns[key] == c {
+		delete(s.conns, key)
+	}
+	s.m.Unlock()
+}
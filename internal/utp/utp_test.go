@@ -0,0 +1,115 @@
+package utp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestSockets(t *testing.T) (s1, s2 *Socket) {
+	s1, err := Listen("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err = Listen("udp4", "127.0.0.1:0")
+	if err != nil {
+		s1.Close()
+		t.Fatal(err)
+	}
+	return s1, s2
+}
+
+func TestTransfer(t *testing.T) {
+	s1, s2 := newTestSockets(t)
+	defer s1.Close()
+	defer s2.Close()
+
+	data := make([]byte, 4<<20)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	errC := make(chan error, 1)
+	go func() {
+		conn, err := s1.Accept()
+		if err != nil {
+			errC <- err
+			return
+		}
+		_, err = conn.Write(data)
+		if err != nil {
+			errC <- err
+			return
+		}
+		errC <- conn.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := s2.DialContext(ctx, "udp4", s1.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.SetReadDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	received, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-errC; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Fatalf("received data does not match, len: %d", len(received))
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	s1, s2 := newTestSockets(t)
+	defer s1.Close()
+	defer s2.Close()
+
+	conn, err := s2.DialContext(context.Background(), "udp4", s1.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Read(make([]byte, 1))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatal("error is not a timeout")
+	}
+}
+
+func TestDialCancel(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	s, err := Listen("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Nobody answers on pc so the dial cannot complete.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = s.DialContext(ctx, "udp4", pc.LocalAddr().String())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -15,6 +15,10 @@ type WebseedSource struct {
 	LastError     error
 	DisabledAt    time.Time
 	DownloadSpeed metrics.Meter
+	// Number of consecutive failed downloads. Reset after a piece is downloaded successfully.
+	Failures int
+	// Time to retry the disabled source. Zero if the source is not going to be retried.
+	RetryAt time.Time
 }
 
 // NewList returns a new WebseedSource list.
@@ -34,6 +38,19 @@ func (s *WebseedSource) Downloading() bool {
 	return s.Downloader != nil
 }
 
+// RetryDelay returns the duration to wait before retrying the source after a failure.
+// The delay starts from initial and doubles with each consecutive failure, up to max.
+func (s *WebseedSource) RetryDelay(initial, max time.Duration) time.Duration {
+	d := initial
+	for i := 1; i < s.Failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
 // Remaining returns the number of pieces that is going to be downloaded by this source.
 // If there is a piece currently downloading, it is not counted.
 func (s *WebseedSource) Remaining() uint32 {
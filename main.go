@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 
@@ -11,6 +15,7 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"strconv"
@@ -21,9 +26,11 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/cenkalti/boltbrowser/boltbrowser"
 	"github.com/cenkalti/rain/internal/console"
+	"github.com/cenkalti/rain/internal/handoff"
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/magnet"
 	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/rpctypes"
 	"github.com/cenkalti/rain/rainrpc"
 	"github.com/cenkalti/rain/torrent"
 	"github.com/hokaccha/go-prettyjson"
@@ -156,6 +163,10 @@ func main() {
 					Usage: "request timeout",
 					Value: 10 * time.Second,
 				},
+				cli.StringFlag{
+					Name:  "token",
+					Usage: "token to identify the client to RPC server",
+				},
 			},
 			Before: handleBeforeClient,
 			Subcommands: []cli.Command{
@@ -170,6 +181,12 @@ func main() {
 					Usage:    "list torrents",
 					Category: "Getters",
 					Action:   handleList,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "label",
+							Usage: "only list torrents having `LABEL`",
+						},
+					},
 				},
 				{
 					Name:     "add",
@@ -179,7 +196,7 @@ func main() {
 					Flags: []cli.Flag{
 						cli.StringFlag{
 							Name:     "torrent,t",
-							Usage:    "file or URI",
+							Usage:    "file, URI or info hash",
 							Required: true,
 						},
 						cli.BoolFlag{
@@ -198,6 +215,22 @@ func main() {
 							Name:  "id",
 							Usage: "if id is not given, a unique id is automatically generated",
 						},
+						cli.StringSliceFlag{
+							Name:  "allow-peer",
+							Usage: "only connect to peers in `IP/CIDR`, can be given multiple times",
+						},
+						cli.StringFlag{
+							Name:  "dest",
+							Usage: "save files into `DIR` instead of the data directory in server config",
+						},
+						cli.StringSliceFlag{
+							Name:  "label",
+							Usage: "add `LABEL` to torrent, can be given multiple times",
+						},
+						cli.IntFlag{
+							Name:  "upload-slots",
+							Usage: "unchoke `N` peers for uploading instead of the number in server config",
+						},
 					},
 				},
 				{
@@ -218,6 +251,12 @@ func main() {
 					Category: "Actions",
 					Action:   handleCleanDatabase,
 				},
+				{
+					Name:     "reload-blocklist",
+					Usage:    "reload blocklist from its source",
+					Category: "Actions",
+					Action:   handleReloadBlocklist,
+				},
 				{
 					Name:     "stats",
 					Usage:    "get stats of torrent",
@@ -270,6 +309,18 @@ func main() {
 						},
 					},
 				},
+				{
+					Name:     "files",
+					Usage:    "get files of torrent",
+					Category: "Getters",
+					Action:   handleFiles,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+					},
+				},
 				{
 					Name:     "peers",
 					Usage:    "get peers of torrent",
@@ -340,6 +391,67 @@ func main() {
 						},
 					},
 				},
+				{
+					Name:     "set-labels",
+					Usage:    "replace labels of torrent",
+					Category: "Actions",
+					Action:   handleSetLabels,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.StringSliceFlag{
+							Name:  "label",
+							Usage: "`LABEL` of torrent, can be given multiple times, no label clears all labels",
+						},
+					},
+				},
+				{
+					Name:     "set-upload-slots",
+					Usage:    "set number of peers unchoked for uploading",
+					Category: "Actions",
+					Action:   handleSetUploadSlots,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.IntFlag{
+							Name:     "slots,n",
+							Usage:    "number of unchoked peers, 0 uses the number in server config",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:     "move-data",
+					Usage:    "move files of torrent to another directory",
+					Category: "Actions",
+					Action:   handleMoveData,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:     "dir",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:     "verify-data",
+					Usage:    "verify files and download missing pieces",
+					Category: "Actions",
+					Action:   handleVerifyData,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+					},
+				},
 				{
 					Name:     "start",
 					Usage:    "start torrent",
@@ -364,6 +476,30 @@ func main() {
 						},
 					},
 				},
+				{
+					Name:     "pause",
+					Usage:    "pause torrent without disconnecting peers",
+					Category: "Actions",
+					Action:   handlePause,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:     "resume",
+					Usage:    "resume paused torrent",
+					Category: "Actions",
+					Action:   handleResume,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+					},
+				},
 				{
 					Name:     "start-all",
 					Usage:    "start all torrents",
@@ -376,6 +512,145 @@ func main() {
 					Category: "Actions",
 					Action:   handleStopAll,
 				},
+				{
+					Name:     "orphaned-data",
+					Usage:    "list files in data directory that do not belong to any torrent",
+					Category: "Actions",
+					Action:   handleOrphanedData,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "remove",
+							Usage: "remove the listed files, only allowed if data directory includes torrent IDs",
+						},
+					},
+				},
+				{
+					Name:     "export",
+					Usage:    "export resume data of all torrents to an archive",
+					Category: "Actions",
+					Action:   handleExport,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "file,f",
+							Usage: "write archive to `FILE` instead of stdout",
+						},
+					},
+				},
+				{
+					Name:     "import",
+					Usage:    "import torrents from an archive created with export command",
+					Category: "Actions",
+					Action:   handleImport,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "file,f",
+							Usage:    "read archive from `FILE`",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:     "speed-limit",
+					Usage:    "set speed limits of a torrent or the session",
+					Category: "Actions",
+					Action:   handleSpeedLimit,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "id",
+							Usage: "torrent id. global limits are set if not given.",
+						},
+						cli.Int64Flag{
+							Name:  "download,d",
+							Usage: "download speed limit in KB/s. 0 means unlimited.",
+						},
+						cli.Int64Flag{
+							Name:  "upload,u",
+							Usage: "upload speed limit in KB/s. 0 means unlimited.",
+						},
+					},
+				},
+				{
+					Name:     "transfer-mode",
+					Usage:    "restrict downloading or uploading of torrent",
+					Category: "Actions",
+					Action:   handleTransferMode,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:  "mode,m",
+							Usage: "one of normal, upload-only or download-only",
+							Value: "normal",
+						},
+					},
+				},
+				{
+					Name:     "file-priorities",
+					Usage:    "set download priorities of files in torrent",
+					Category: "Actions",
+					Action:   handleFilePriorities,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:     "priorities,p",
+							Usage:    "comma separated list of priorities in the order of files. -1 skips the file, 0 is normal and 1 is high priority.",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:     "piece-priority",
+					Usage:    "set download priority of a piece in torrent",
+					Category: "Actions",
+					Action:   handlePiecePriority,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.UintFlag{
+							Name:     "index,i",
+							Usage:    "piece index",
+							Required: true,
+						},
+						cli.IntFlag{
+							Name:     "priority,p",
+							Usage:    "-1 skips the piece, 0 is normal and 1 or higher is high priority. Overrides the priorities of files.",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:     "byte-range",
+					Usage:    "download only the pieces containing a byte range of a file in torrent",
+					Category: "Actions",
+					Action:   handleByteRange,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.IntFlag{
+							Name:     "file,f",
+							Usage:    "file index",
+							Required: true,
+						},
+						cli.Int64Flag{
+							Name:  "offset,o",
+							Usage: "offset of the range in file",
+						},
+						cli.Int64Flag{
+							Name:     "length,l",
+							Usage:    "length of the range. 0 removes the range.",
+							Required: true,
+						},
+					},
+				},
 				{
 					Name:     "move",
 					Usage:    "move torrent to another server",
@@ -452,6 +727,36 @@ func main() {
 			Usage:  "rewrite database to save up space",
 			Action: handleCompactDatabase,
 		},
+		{
+			Name:   "bench",
+			Usage:  "download generated data from in-process seeders over loopback and report throughput",
+			Action: handleBench,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "peers,n",
+					Value: 4,
+					Usage: "number of seeders",
+				},
+				cli.IntFlag{
+					Name:  "size,s",
+					Value: 256,
+					Usage: "size of generated data in MB",
+				},
+				cli.IntFlag{
+					Name:  "piece-length,l",
+					Usage: "piece length in KB. calculated automatically by default.",
+				},
+				cli.IntFlag{
+					Name:  "port",
+					Value: 40000,
+					Usage: "first port to listen for peer connections. one port is used for each session.",
+				},
+				cli.DurationFlag{
+					Name:  "timeout,t",
+					Value: 10 * time.Minute,
+				},
+			},
+		},
 		{
 			Name:  "torrent",
 			Usage: "manage torrent files",
@@ -521,6 +826,10 @@ func main() {
 							Name:  "webseed,w",
 							Usage: "add webseed `URL`",
 						},
+						cli.BoolFlag{
+							Name:  "v2",
+							Usage: "create BitTorrent v2 torrent. piece length must be a power of two.",
+						},
 					},
 				},
 			},
@@ -574,6 +883,142 @@ func handleCompactDatabase(c *cli.Context) error {
 	return os.Rename(f.Name(), dbPath)
 }
 
+func handleBench(c *cli.Context) error {
+	numPeers := c.Int("peers")
+	size := int64(c.Int("size")) << 20
+	pieceLength := uint32(c.Int("piece-length") << 10)
+	port := c.Int("port")
+	timeout := c.Duration("timeout")
+	if numPeers < 1 {
+		return errors.New("at least one seeder is required")
+	}
+
+	dir, err := ioutil.TempDir("", "rain-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Generate random data to be seeded.
+	seedDir := filepath.Join(dir, "seed")
+	err = os.Mkdir(seedDir, 0750)
+	if err != nil {
+		return err
+	}
+	dataPath := filepath.Join(seedDir, "data")
+	f, err := os.Create(dataPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(f, rand.Reader, size)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	info, err := metainfo.NewInfoBytes(seedDir, []string{dataPath}, false, pieceLength, "", log)
+	if err != nil {
+		return err
+	}
+	mi, err := metainfo.NewBytes(info, nil, nil, nil, "")
+	if err != nil {
+		return err
+	}
+
+	newSession := func(i int, dataDir string) (*torrent.Session, error) {
+		cfg := torrent.DefaultConfig
+		cfg.Database = filepath.Join(dir, fmt.Sprintf("session-%d.db", i))
+		cfg.DataDir = dataDir
+		cfg.DataDirIncludesTorrentID = false
+		cfg.Host = "127.0.0.1"
+		cfg.PortBegin = uint16(port + i)
+		cfg.PortEnd = uint16(port + i + 1)
+		cfg.DHTEnabled = false
+		cfg.PEXEnabled = false
+		cfg.LSDEnabled = false
+		cfg.RPCEnabled = false
+		cfg.ResumeOnStartup = false
+		return torrent.NewSession(cfg)
+	}
+
+	// Start seeders.
+	addrs := make([]string, 0, numPeers)
+	for i := 1; i <= numPeers; i++ {
+		ses, err := newSession(i, seedDir)
+		if err != nil {
+			return err
+		}
+		defer ses.Close()
+		t, err := ses.AddTorrent(bytes.NewReader(mi), nil)
+		if err != nil {
+			return err
+		}
+		for t.Stats().Status != torrent.Seeding {
+			select {
+			case err = <-t.NotifyStop():
+				return fmt.Errorf("seeder stopped: %w", err)
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		addrs = append(addrs, "127.0.0.1:"+strconv.Itoa(t.Port()))
+	}
+	log.Infof("started %d seeders", numPeers)
+
+	// Start downloader.
+	ses, err := newSession(0, filepath.Join(dir, "download"))
+	if err != nil {
+		return err
+	}
+	defer ses.Close()
+	t, err := ses.AddTorrent(bytes.NewReader(mi), &torrent.AddTorrentOptions{Stopped: true})
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		err = t.AddPeer(addr)
+		if err != nil {
+			return err
+		}
+	}
+	var m1, m2 runtime.MemStats
+	runtime.ReadMemStats(&m1)
+	user1, sys1 := cpuTime()
+	begin := time.Now()
+	err = t.Start()
+	if err != nil {
+		return err
+	}
+	select {
+	case <-t.NotifyComplete():
+	case err = <-t.NotifyStop():
+		return fmt.Errorf("downloader stopped: %w", err)
+	case <-time.After(timeout):
+		return errors.New("download did not finish in time")
+	}
+	elapsed := time.Since(begin)
+	user2, sys2 := cpuTime()
+	runtime.ReadMemStats(&m2)
+	user, sys := user2-user1, sys2-sys1
+
+	stats := t.Stats()
+	fmt.Printf("Seeders:     %d\n", numPeers)
+	fmt.Printf("Size:        %d MB\n", size>>20)
+	fmt.Printf("Piece size:  %d KB\n", stats.PieceLength>>10)
+	fmt.Printf("Duration:    %s\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("Throughput:  %.2f MB/s\n", float64(stats.Bytes.Downloaded)/elapsed.Seconds()/(1<<20))
+	fmt.Printf("Wasted:      %d bytes\n", stats.Bytes.Wasted)
+	// Seeders run in the same process, so their CPU usage is included.
+	fmt.Printf("CPU time:    %s (user %s, sys %s)\n", (user + sys).Round(time.Millisecond), user.Round(time.Millisecond), sys.Round(time.Millisecond))
+	fmt.Printf("CPU usage:   %.0f%%\n", 100*(user+sys).Seconds()/elapsed.Seconds())
+	fmt.Printf("Allocated:   %d MB\n", (m2.TotalAlloc-m1.TotalAlloc)>>20)
+	fmt.Printf("Mallocs:     %d\n", m2.Mallocs-m1.Mallocs)
+	fmt.Printf("GC cycles:   %d\n", m2.NumGC-m1.NumGC)
+	return nil
+}
+
 func handleBeforeCommand(c *cli.Context) error {
 	cpuprofile := c.GlobalString("cpuprofile")
 	if cpuprofile != "" {
@@ -662,18 +1107,50 @@ func handleServer(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	cfg.InheritedListeners = handoff.Inherited()
 	ses, err := torrent.NewSession(cfg)
 	if err != nil {
 		return err
 	}
 	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-	s := <-ch
-	log.Noticef("received %s, stopping server", s)
-
+	signal.Notify(ch, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM}, upgradeSignals...)...)
+	for s := range ch {
+		if s == syscall.SIGINT || s == syscall.SIGTERM {
+			log.Noticef("received %s, stopping server", s)
+			break
+		}
+		log.Noticef("received %s, starting new server process", s)
+		err = startNewServer(ses)
+		if err != nil {
+			log.Errorln("cannot start new server process:", err.Error())
+			continue
+		}
+		log.Notice("new server process is started, stopping server")
+		break
+	}
 	return ses.Close()
 }
 
+// startNewServer runs the same executable and passes the listening sockets to it.
+// New process waits until the session database is released by this process.
+func startNewServer(ses *torrent.Session) error {
+	files := ses.ListenerFiles()
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	cmd, err := handoff.Command(files)
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
 func handleDownload(c *cli.Context) error {
 	arg := c.String("torrent")
 	seed := c.Bool("seed")
@@ -847,6 +1324,7 @@ func handleMagnetToTorrent(c *cli.Context) error {
 func handleBeforeClient(c *cli.Context) error {
 	clt = rainrpc.NewClient(c.String("url"))
 	clt.SetTimeout(c.Duration("timeout"))
+	clt.SetToken(c.String("token"))
 	return nil
 }
 
@@ -861,7 +1339,13 @@ func handleVersion(c *cli.Context) error {
 }
 
 func handleList(c *cli.Context) error {
-	resp, err := clt.ListTorrents()
+	var resp []rpctypes.Torrent
+	var err error
+	if label := c.String("label"); label != "" {
+		resp, err = clt.ListTorrentsByLabel(label)
+	} else {
+		resp, err = clt.ListTorrents()
+	}
 	if err != nil {
 		return err
 	}
@@ -878,6 +1362,11 @@ func isURI(arg string) bool {
 	return strings.HasPrefix(arg, "magnet:") || strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://")
 }
 
+func isInfoHash(arg string) bool {
+	b, err := hex.DecodeString(arg)
+	return err == nil && len(b) == 20
+}
+
 func handleAdd(c *cli.Context) error {
 	var b []byte
 	var marshalErr error
@@ -887,6 +1376,10 @@ func handleAdd(c *cli.Context) error {
 		StopAfterDownload: c.Bool("stop-after-download"),
 		StopAfterMetadata: c.Bool("stop-after-metadata"),
 		ID:                c.String("id"),
+		PeerAllowlist:     c.StringSlice("allow-peer"),
+		Dest:              c.String("dest"),
+		Labels:            c.StringSlice("label"),
+		UploadSlots:       c.Int("upload-slots"),
 	}
 	if isURI(arg) {
 		resp, err := clt.AddURI(arg, addOpt)
@@ -894,6 +1387,12 @@ func handleAdd(c *cli.Context) error {
 			return err
 		}
 		b, marshalErr = prettyjson.Marshal(resp)
+	} else if isInfoHash(arg) {
+		resp, err := clt.AddInfoHash(arg, addOpt)
+		if err != nil {
+			return err
+		}
+		b, marshalErr = prettyjson.Marshal(resp)
 	} else {
 		f, err := os.Open(arg)
 		if err != nil {
@@ -922,6 +1421,10 @@ func handleCleanDatabase(c *cli.Context) error {
 	return clt.CleanDatabase()
 }
 
+func handleReloadBlocklist(c *cli.Context) error {
+	return clt.ReloadBlocklist()
+}
+
 func handleStats(c *cli.Context) error {
 	s, err := clt.GetTorrentStats(c.String("id"))
 	if err != nil {
@@ -986,6 +1489,20 @@ func handleWebseeds(c *cli.Context) error {
 	return nil
 }
 
+func handleFiles(c *cli.Context) error {
+	resp, err := clt.GetTorrentFiles(c.String("id"))
+	if err != nil {
+		return err
+	}
+	b, err := prettyjson.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, _ = os.Stdout.Write(b)
+	_, _ = os.Stdout.WriteString("\n")
+	return nil
+}
+
 func handlePeers(c *cli.Context) error {
 	resp, err := clt.GetTorrentPeers(c.String("id"))
 	if err != nil {
@@ -1016,6 +1533,22 @@ func handleVerify(c *cli.Context) error {
 	return clt.VerifyTorrent(c.String("id"))
 }
 
+func handleVerifyData(c *cli.Context) error {
+	return clt.VerifyTorrentData(c.String("id"))
+}
+
+func handleSetLabels(c *cli.Context) error {
+	return clt.SetTorrentLabels(c.String("id"), c.StringSlice("label"))
+}
+
+func handleSetUploadSlots(c *cli.Context) error {
+	return clt.SetTorrentUploadSlots(c.String("id"), c.Int("slots"))
+}
+
+func handleMoveData(c *cli.Context) error {
+	return clt.MoveTorrentData(c.String("id"), c.String("dir"))
+}
+
 func handleStart(c *cli.Context) error {
 	return clt.StartTorrent(c.String("id"))
 }
@@ -1024,6 +1557,14 @@ func handleStop(c *cli.Context) error {
 	return clt.StopTorrent(c.String("id"))
 }
 
+func handlePause(c *cli.Context) error {
+	return clt.PauseTorrent(c.String("id"))
+}
+
+func handleResume(c *cli.Context) error {
+	return clt.ResumeTorrent(c.String("id"))
+}
+
 func handleStartAll(c *cli.Context) error {
 	return clt.StartAllTorrents()
 }
@@ -1032,6 +1573,71 @@ func handleStopAll(c *cli.Context) error {
 	return clt.StopAllTorrents()
 }
 
+func handleOrphanedData(c *cli.Context) error {
+	resp, err := clt.ScanOrphanedData(c.Bool("remove"))
+	if err != nil {
+		return err
+	}
+	for _, path := range resp {
+		fmt.Println(path)
+	}
+	return nil
+}
+
+func handleExport(c *cli.Context) error {
+	name := c.String("file")
+	if name == "" {
+		return clt.Export(os.Stdout)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = clt.Export(f)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func handleImport(c *cli.Context) error {
+	f, err := os.Open(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return clt.Import(f)
+}
+
+func handleSpeedLimit(c *cli.Context) error {
+	return clt.SetSpeedLimit(c.String("id"), c.Int64("download")*1024, c.Int64("upload")*1024)
+}
+
+func handleTransferMode(c *cli.Context) error {
+	return clt.SetTransferMode(c.String("id"), c.String("mode"))
+}
+
+func handleFilePriorities(c *cli.Context) error {
+	var priorities []int
+	for _, s := range strings.Split(c.String("priorities"), ",") {
+		p, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		priorities = append(priorities, p)
+	}
+	return clt.SetFilePriorities(c.String("id"), priorities)
+}
+
+func handlePiecePriority(c *cli.Context) error {
+	return clt.SetPiecePriority(c.String("id"), uint32(c.Uint("index")), c.Int("priority"))
+}
+
+func handleByteRange(c *cli.Context) error {
+	return clt.SetByteRangeWanted(c.String("id"), c.Int("file"), c.Int64("offset"), c.Int64("length"))
+}
+
 func handleMove(c *cli.Context) error {
 	return clt.MoveTorrent(c.String("id"), c.String("target"))
 }
@@ -1098,6 +1704,7 @@ func handleTorrentCreate(c *cli.Context) error {
 	comment := c.String("comment")
 	trackers := c.StringSlice("tracker")
 	webseeds := c.StringSlice("webseed")
+	v2 := c.Bool("v2")
 
 	var err error
 	out, err = homedir.Expand(out)
@@ -1116,11 +1723,17 @@ func handleTorrentCreate(c *cli.Context) error {
 		tiers[i] = []string{tr}
 	}
 
-	info, err := metainfo.NewInfoBytes(root, paths, private, uint32(pieceLength<<10), name, log)
-	if err != nil {
-		return err
-	}
-	mi, err := metainfo.NewBytes(info, tiers, webseeds, comment)
+	mi, err := torrent.CreateTorrent(torrent.CreateTorrentOptions{
+		Paths:       paths,
+		Root:        root,
+		Name:        name,
+		PieceLength: uint32(pieceLength << 10),
+		Private:     private,
+		Trackers:    tiers,
+		Webseeds:    webseeds,
+		Comment:     comment,
+		V2:          v2,
+	})
 	if err != nil {
 		return err
 	}
@@ -3,13 +3,15 @@ package rainrpc
 
 import (
 	"encoding/base64"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/cenkalti/rain/internal/jsonrpc2"
 	"github.com/cenkalti/rain/internal/rpctypes"
-	"github.com/powerman/rpc-codec/jsonrpc2"
 )
 
 // Client is a JSON-RPC 2.0 client for calling methods of a remote Session.
@@ -17,6 +19,7 @@ type Client struct {
 	client     *jsonrpc2.Client
 	httpClient *http.Client
 	addr       string
+	token      string
 }
 
 // NewClient returns a new Client for remote address.
@@ -24,11 +27,25 @@ func NewClient(addr string) *Client {
 	hc := &http.Client{
 		Timeout: 10 * time.Second,
 	}
-	return &Client{
-		client:     jsonrpc2.NewCustomHTTPClient(addr, hc),
+	c := &Client{
 		httpClient: hc,
 		addr:       addr,
 	}
+	c.client = jsonrpc2.NewHTTPClient(addr, jsonrpc2.DoerFunc(c.do))
+	return c
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.httpClient.Do(req)
+}
+
+// SetToken sets the token that is sent with requests to identify the client.
+// The server uses it in the audit log if the token is configured in Config.RPCTokens.
+func (c *Client) SetToken(token string) {
+	c.token = token
 }
 
 func (c *Client) SetTimeout(d time.Duration) {
@@ -42,7 +59,8 @@ func (c *Client) Addr() string {
 
 // Close the client.
 func (c *Client) Close() error {
-	return c.client.Close()
+	c.httpClient.CloseIdleConnections()
+	return nil
 }
 
 // ServerVersion returns the Rain version on remote server.
@@ -57,12 +75,23 @@ func (c *Client) ListTorrents() ([]rpctypes.Torrent, error) {
 	return reply.Torrents, c.client.Call("Session.ListTorrents", nil, &reply)
 }
 
+// ListTorrentsByLabel returns the list of torrents having the label in remote Session.
+func (c *Client) ListTorrentsByLabel(label string) ([]rpctypes.Torrent, error) {
+	args := rpctypes.ListTorrentsRequest{Label: label}
+	var reply rpctypes.ListTorrentsResponse
+	return reply.Torrents, c.client.Call("Session.ListTorrents", args, &reply)
+}
+
 // AddTorrentOptions contains optional parameters for adding a new Torrent.
 type AddTorrentOptions struct {
 	ID                string
 	Stopped           bool
 	StopAfterDownload bool
 	StopAfterMetadata bool
+	PeerAllowlist     []string
+	Dest              string
+	Labels            []string
+	UploadSlots       int
 }
 
 // AddTorrent adds a new torrent by reading .torrent file.
@@ -77,6 +106,10 @@ func (c *Client) AddTorrent(f io.Reader, options *AddTorrentOptions) (*rpctypes.
 		args.AddTorrentOptions.Stopped = options.Stopped
 		args.AddTorrentOptions.StopAfterDownload = options.StopAfterDownload
 		args.AddTorrentOptions.StopAfterMetadata = options.StopAfterMetadata
+		args.AddTorrentOptions.PeerAllowlist = options.PeerAllowlist
+		args.AddTorrentOptions.Dest = options.Dest
+		args.AddTorrentOptions.Labels = options.Labels
+		args.AddTorrentOptions.UploadSlots = options.UploadSlots
 	}
 	var reply rpctypes.AddTorrentResponse
 	return &reply.Torrent, c.client.Call("Session.AddTorrent", args, &reply)
@@ -90,11 +123,32 @@ func (c *Client) AddURI(uri string, options *AddTorrentOptions) (*rpctypes.Torre
 		args.AddTorrentOptions.Stopped = options.Stopped
 		args.AddTorrentOptions.StopAfterDownload = options.StopAfterDownload
 		args.AddTorrentOptions.StopAfterMetadata = options.StopAfterMetadata
+		args.AddTorrentOptions.PeerAllowlist = options.PeerAllowlist
+		args.AddTorrentOptions.Dest = options.Dest
+		args.AddTorrentOptions.Labels = options.Labels
+		args.AddTorrentOptions.UploadSlots = options.UploadSlots
 	}
 	var reply rpctypes.AddURIResponse
 	return &reply.Torrent, c.client.Call("Session.AddURI", args, &reply)
 }
 
+// AddInfoHash adds a new torrent by its info hash. Info hash must be given in hex encoding.
+func (c *Client) AddInfoHash(infoHash string, options *AddTorrentOptions) (*rpctypes.Torrent, error) {
+	args := rpctypes.AddInfoHashRequest{InfoHash: infoHash}
+	if options != nil {
+		args.AddTorrentOptions.ID = options.ID
+		args.AddTorrentOptions.Stopped = options.Stopped
+		args.AddTorrentOptions.StopAfterDownload = options.StopAfterDownload
+		args.AddTorrentOptions.StopAfterMetadata = options.StopAfterMetadata
+		args.AddTorrentOptions.PeerAllowlist = options.PeerAllowlist
+		args.AddTorrentOptions.Dest = options.Dest
+		args.AddTorrentOptions.Labels = options.Labels
+		args.AddTorrentOptions.UploadSlots = options.UploadSlots
+	}
+	var reply rpctypes.AddInfoHashResponse
+	return &reply.Torrent, c.client.Call("Session.AddInfoHash", args, &reply)
+}
+
 // RemoveTorrent removes a torrent from remote Session and deletes its data.
 func (c *Client) RemoveTorrent(id string) error {
 	args := rpctypes.RemoveTorrentRequest{ID: id}
@@ -109,6 +163,13 @@ func (c *Client) CleanDatabase() error {
 	return c.client.Call("Session.CleanDatabase", args, &reply)
 }
 
+// ReloadBlocklist loads the blocklist of remote Session from its source immediately.
+func (c *Client) ReloadBlocklist() error {
+	var args rpctypes.ReloadBlocklistRequest
+	var reply rpctypes.ReloadBlocklistResponse
+	return c.client.Call("Session.ReloadBlocklist", args, &reply)
+}
+
 // GetTorrentStats returns statistics about a torrent.
 func (c *Client) GetTorrentStats(id string) (*rpctypes.Stats, error) {
 	args := rpctypes.GetTorrentStatsRequest{ID: id}
@@ -163,6 +224,45 @@ func (c *Client) GetTorrentWebseeds(id string) ([]rpctypes.Webseed, error) {
 	return reply.Webseeds, c.client.Call("Session.GetTorrentWebseeds", args, &reply)
 }
 
+// SetTransferMode restricts the direction of data transfer of a torrent.
+// Mode must be one of "normal", "upload-only" or "download-only".
+func (c *Client) SetTransferMode(id string, mode string) error {
+	args := rpctypes.SetTransferModeRequest{ID: id, Mode: mode}
+	var reply rpctypes.SetTransferModeResponse
+	return c.client.Call("Session.SetTransferMode", args, &reply)
+}
+
+// GetTorrentFiles returns the files of a torrent.
+func (c *Client) GetTorrentFiles(id string) ([]rpctypes.File, error) {
+	args := rpctypes.GetTorrentFilesRequest{ID: id}
+	var reply rpctypes.GetTorrentFilesResponse
+	return reply.Files, c.client.Call("Session.GetTorrentFiles", args, &reply)
+}
+
+// SetFilePriorities sets the download priorities of the files in a torrent.
+// Priority values are -1 for skipping the file, 0 for normal and 1 for high priority.
+func (c *Client) SetFilePriorities(id string, priorities []int) error {
+	args := rpctypes.SetFilePrioritiesRequest{ID: id, Priorities: priorities}
+	var reply rpctypes.SetFilePrioritiesResponse
+	return c.client.Call("Session.SetFilePriorities", args, &reply)
+}
+
+// SetPiecePriority sets the download priority of a piece in a torrent.
+// Priority values are -1 for skipping the piece, 0 for normal and 1 or higher for high priority.
+func (c *Client) SetPiecePriority(id string, index uint32, priority int) error {
+	args := rpctypes.SetPiecePriorityRequest{ID: id, Index: index, Priority: priority}
+	var reply rpctypes.SetPiecePriorityResponse
+	return c.client.Call("Session.SetPiecePriority", args, &reply)
+}
+
+// SetByteRangeWanted downloads only the pieces containing length bytes at offset in the file at index.
+// Zero length removes the range.
+func (c *Client) SetByteRangeWanted(id string, index int, offset, length int64) error {
+	args := rpctypes.SetByteRangeWantedRequest{ID: id, File: index, Offset: offset, Length: length}
+	var reply rpctypes.SetByteRangeWantedResponse
+	return c.client.Call("Session.SetByteRangeWanted", args, &reply)
+}
+
 // StartTorrent starts the torrent.
 func (c *Client) StartTorrent(id string) error {
 	args := rpctypes.StartTorrentRequest{ID: id}
@@ -184,6 +284,20 @@ func (c *Client) AnnounceTorrent(id string) error {
 	return c.client.Call("Session.AnnounceTorrent", args, &reply)
 }
 
+// PauseTorrent pauses data transfer of the torrent without closing peer connections.
+func (c *Client) PauseTorrent(id string) error {
+	args := rpctypes.PauseTorrentRequest{ID: id}
+	var reply rpctypes.PauseTorrentResponse
+	return c.client.Call("Session.PauseTorrent", args, &reply)
+}
+
+// ResumeTorrent resumes data transfer of a paused torrent.
+func (c *Client) ResumeTorrent(id string) error {
+	args := rpctypes.ResumeTorrentRequest{ID: id}
+	var reply rpctypes.ResumeTorrentResponse
+	return c.client.Call("Session.ResumeTorrent", args, &reply)
+}
+
 // VerifyTorrent stops the torrent and verifies all of the pieces on disk.
 // After verification is done, the torrent stays in stopped state.
 func (c *Client) VerifyTorrent(id string) error {
@@ -192,6 +306,35 @@ func (c *Client) VerifyTorrent(id string) error {
 	return c.client.Call("Session.VerifyTorrent", args, &reply)
 }
 
+// VerifyTorrentData verifies all of the pieces on disk and starts the torrent to download missing pieces.
+func (c *Client) VerifyTorrentData(id string) error {
+	args := rpctypes.VerifyTorrentDataRequest{ID: id}
+	var reply rpctypes.VerifyTorrentDataResponse
+	return c.client.Call("Session.VerifyTorrentData", args, &reply)
+}
+
+// MoveTorrentData moves the files of the torrent into dir on the server.
+// Returns after the files are moved, so the timeout may need to be increased with SetTimeout for large torrents.
+func (c *Client) MoveTorrentData(id, dir string) error {
+	args := rpctypes.MoveTorrentDataRequest{ID: id, Dir: dir}
+	var reply rpctypes.MoveTorrentDataResponse
+	return c.client.Call("Session.MoveTorrentData", args, &reply)
+}
+
+// SetTorrentLabels replaces the labels of the torrent.
+func (c *Client) SetTorrentLabels(id string, labels []string) error {
+	args := rpctypes.SetTorrentLabelsRequest{ID: id, Labels: labels}
+	var reply rpctypes.SetTorrentLabelsResponse
+	return c.client.Call("Session.SetTorrentLabels", args, &reply)
+}
+
+// SetTorrentUploadSlots sets the number of peers unchoked for uploading. Zero value means the value in server config is used.
+func (c *Client) SetTorrentUploadSlots(id string, n int) error {
+	args := rpctypes.SetTorrentUploadSlotsRequest{ID: id, UploadSlots: n}
+	var reply rpctypes.SetTorrentUploadSlotsResponse
+	return c.client.Call("Session.SetTorrentUploadSlots", args, &reply)
+}
+
 // MoveTorrent moves the torrent to another Session.
 func (c *Client) MoveTorrent(id, target string) error {
 	args := rpctypes.MoveTorrentRequest{ID: id, Target: target}
@@ -199,6 +342,14 @@ func (c *Client) MoveTorrent(id, target string) error {
 	return c.client.Call("Session.MoveTorrent", args, &reply)
 }
 
+// ScanOrphanedData returns the paths in the data directory of the Session that do not belong to any torrent.
+// Paths are removed if remove is true.
+func (c *Client) ScanOrphanedData(remove bool) ([]string, error) {
+	args := rpctypes.ScanOrphanedDataRequest{Remove: remove}
+	var reply rpctypes.ScanOrphanedDataResponse
+	return reply.Paths, c.client.Call("Session.ScanOrphanedData", args, &reply)
+}
+
 // StartAllTorrents starts all torrents in the Session.
 func (c *Client) StartAllTorrents() error {
 	args := rpctypes.StartAllTorrentsRequest{}
@@ -213,6 +364,14 @@ func (c *Client) StopAllTorrents() error {
 	return c.client.Call("Session.StopAllTorrents", args, &reply)
 }
 
+// SetSpeedLimit sets the download and upload speed limits in bytes per second. Zero means unlimited.
+// If id is empty, global limits of the session are set.
+func (c *Client) SetSpeedLimit(id string, download, upload int64) error {
+	args := rpctypes.SetSpeedLimitRequest{ID: id, Download: download, Upload: upload}
+	var reply rpctypes.SetSpeedLimitResponse
+	return c.client.Call("Session.SetSpeedLimit", args, &reply)
+}
+
 // AddPeer adds a new peer the a torrent.
 func (c *Client) AddPeer(id string, addr string) error {
 	args := rpctypes.AddPeerRequest{ID: id, Addr: addr}
@@ -226,3 +385,45 @@ func (c *Client) AddTracker(id string, uri string) error {
 	var reply rpctypes.AddTrackerResponse
 	return c.client.Call("Session.AddTracker", args, &reply)
 }
+
+// Export writes the resume data of all torrents in remote Session to w.
+// The archive can be imported into another Session with Import.
+func (c *Client) Export(w io.Writer) error {
+	req, err := http.NewRequest(http.MethodGet, c.addr+"/export", nil) // nolint: noctx
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return httpError(resp)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Import adds the torrents in an archive written by Export to remote Session.
+func (c *Client) Import(r io.Reader) error {
+	req, err := http.NewRequest(http.MethodPost, c.addr+"/import", r) // nolint: noctx
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return httpError(resp)
+	}
+	return nil
+}
+
+func httpError(resp *http.Response) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("http error: %d %s", resp.StatusCode, strings.TrimSpace(string(b)))
+}
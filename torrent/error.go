@@ -1,10 +1,127 @@
 package torrent
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/cenkalti/rain/internal/announcer"
 )
 
+// ErrTorrentClosed is returned from the methods of Torrent after the torrent is removed from the Session
+// or the Session is closed.
+var ErrTorrentClosed = errors.New("torrent is closed")
+
+// ErrTorrentTooLarge is returned from Session.AddTorrent and Session.AddURI methods
+// when the size of the torrent file or the number of pieces exceeds the limits in Config.
+var ErrTorrentTooLarge = errors.New("torrent too large")
+
+// ErrLimitExceeded is returned from Session.AddTorrent and Session.AddURI methods
+// when the torrent exceeds one of the limits in Config or AddTorrentOptions.Limits.
+// For magnet links, the limits are checked after the metadata is downloaded and the torrent is stopped with this error.
+// errors.Is reports true for ErrTorrentTooLarge.
+type ErrLimitExceeded struct {
+	// Name of the exceeded limit. One of "pieces", "files" or "size".
+	Limit string
+	// Value in the torrent.
+	Value int64
+	// Maximum allowed value.
+	Max int64
+}
+
+// Error implements error interface.
+func (e *ErrLimitExceeded) Error() string {
+	return fmt.Sprintf("%s: %s %d exceeds limit %d", ErrTorrentTooLarge, e.Limit, e.Value, e.Max)
+}
+
+// Unwrap returns ErrTorrentTooLarge.
+func (e *ErrLimitExceeded) Unwrap() error {
+	return ErrTorrentTooLarge
+}
+
+// ErrUnsupportedScheme is returned from Session.AddURI method when the scheme of the URI is not one of http, https or magnet.
+type ErrUnsupportedScheme struct {
+	Scheme string
+}
+
+// Error implements error interface.
+func (e *ErrUnsupportedScheme) Error() string {
+	return "unsupported uri scheme: " + e.Scheme
+}
+
+// ErrDuplicateTorrent is returned from Session.AddTorrent and Session.AddURI methods
+// when a torrent with the same info hash already exists in the Session,
+// or AddTorrentOptions.ID is given and a torrent with the same ID already exists in the Session.
+type ErrDuplicateTorrent struct {
+	// ID of the torrent in the Session.
+	ExistingID string
+}
+
+// Error implements error interface.
+func (e *ErrDuplicateTorrent) Error() string {
+	return "duplicate torrent: " + e.ExistingID
+}
+
+// ErrInvalidMetainfo is returned from Session.AddTorrent and Session.AddURI methods when the torrent file cannot be parsed.
+type ErrInvalidMetainfo struct {
+	// Human readable description of the problem.
+	Reason string
+	err    error
+}
+
+func newInvalidMetainfoError(err error) *ErrInvalidMetainfo {
+	return &ErrInvalidMetainfo{
+		Reason: err.Error(),
+		err:    err,
+	}
+}
+
+// Error implements error interface.
+func (e *ErrInvalidMetainfo) Error() string {
+	return "invalid metainfo: " + e.Reason
+}
+
+// Unwrap returns the underlying error.
+func (e *ErrInvalidMetainfo) Unwrap() error {
+	return e.err
+}
+
+// ErrPieceValidation is the error that the torrent is stopped with when Config.PieceValidator rejects a piece.
+// The torrent is kept stopped after the Session is restarted until it is started again.
+type ErrPieceValidation struct {
+	// Index of the rejected piece.
+	Index uint32
+	err   error
+}
+
+// Error implements error interface.
+func (e *ErrPieceValidation) Error() string {
+	return fmt.Sprintf("piece #%d failed validation: %s", e.Index, e.err)
+}
+
+// Unwrap returns the error returned from the PieceValidator.
+func (e *ErrPieceValidation) Unwrap() error {
+	return e.err
+}
+
+// ErrResumeWrite is returned from Torrent.Start and Torrent.Stop methods
+// when the state of the torrent cannot be saved to the resume database. The state of the torrent is not changed.
+type ErrResumeWrite struct {
+	TorrentID string
+	err       error
+}
+
+// Error implements error interface.
+func (e *ErrResumeWrite) Error() string {
+	return "cannot write resume info of torrent " + e.TorrentID + ": " + e.err.Error()
+}
+
+// Unwrap returns the error from the resume database.
+func (e *ErrResumeWrite) Unwrap() error {
+	return e.err
+}
+
 // InputError is returned from Session.AddTorrent and Session.AddURI methods when there is problem with the input.
+// Use errors.Is and errors.As functions for checking the cause of the error.
 type InputError struct {
 	err error
 }
@@ -3,7 +3,9 @@ package torrent
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"net"
 	"net/http"
@@ -13,18 +15,27 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cenkalti/rain/internal/acceptor"
+	"github.com/cenkalti/rain/internal/allowlist"
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/blocklist"
+	"github.com/cenkalti/rain/internal/diallimiter"
+	"github.com/cenkalti/rain/internal/handoff"
+	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
 	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/lsd"
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/piececache"
+	"github.com/cenkalti/rain/internal/portmapper"
+	"github.com/cenkalti/rain/internal/proxy"
 	"github.com/cenkalti/rain/internal/resolver"
 	"github.com/cenkalti/rain/internal/resourcemanager"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
 	"github.com/cenkalti/rain/internal/semaphore"
+	"github.com/cenkalti/rain/internal/speedlimiter"
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/trackermanager"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/utp"
 	"github.com/mitchellh/go-homedir"
 	"github.com/nictuku/dht"
 	"go.etcd.io/bbolt"
@@ -46,17 +57,25 @@ type Session struct {
 	log            logger.Logger
 	extensions     [8]byte
 	dht            *dht.DHT
+	lsd            *lsd.LSD
 	rpc            *rpcServer
 	trackerManager *trackermanager.TrackerManager
 	ram            *resourcemanager.ResourceManager[*peer.Peer]
 	pieceCache     *piececache.Cache
 	webseedClient  http.Client
+	addURLClient   *http.Client
+	httpTransport  http.RoundTripper
 	createdAt      time.Time
 	semWrite       *semaphore.Semaphore
+	dialLimiter    *diallimiter.DialLimiter
+	portMapper     *portmapper.PortMapper
+	proxy          *proxy.Proxy
+	listeners      *handoff.Listeners
 	metrics        *sessionMetrics
-	bucketDownload *ratelimit.Bucket
-	bucketUpload   *ratelimit.Bucket
+	bucketDownload *speedlimiter.Limiter
+	bucketUpload   *speedlimiter.Limiter
 	closeC         chan struct{}
+	watchDoneC     chan struct{}
 
 	mPeerRequests   sync.Mutex
 	dhtPeerRequests map[*torrent]struct{}
@@ -69,24 +88,72 @@ type Session struct {
 	mPorts         sync.RWMutex
 	availablePorts map[int]struct{}
 
+	// Accepts peer connections for all torrents if Config.Port is set.
+	acceptor                  *acceptor.Acceptor
+	utpAcceptor               *acceptor.Acceptor
+	utpSocket                 *utp.Socket
+	incomingConnC             chan net.Conn
+	incomingHandshakers       map[*incominghandshaker.IncomingHandshaker]struct{}
+	incomingHandshakerResultC chan *incominghandshaker.IncomingHandshaker
+	acceptorDoneC             chan struct{}
+
 	mBlocklist         sync.RWMutex
 	blocklist          *blocklist.Blocklist
 	blocklistTimestamp time.Time
+
+	// Peers allowed for torrents that do not have their own allowlist. Nil means all peers are allowed.
+	allowlist *allowlist.Allowlist
 }
 
 // NewSession creates a new Session for downloading and seeding torrents.
 // Returned session must be closed after use.
 func NewSession(cfg Config) (*Session, error) {
-	if cfg.PortBegin >= cfg.PortEnd {
+	if cfg.Port == 0 && cfg.PortBegin >= cfg.PortEnd {
 		return nil, errors.New("invalid port range")
 	}
+	switch cfg.PeerTransport {
+	case "", PeerTransportTCP, PeerTransportUTP, PeerTransportBoth:
+	default:
+		return nil, errors.New("invalid peer transport")
+	}
+	if cfg.PeerDSCP < 0 || cfg.PeerDSCP > 63 {
+		return nil, errors.New("invalid peer dscp value")
+	}
+	if cfg.PeerReadBufferSize < 0 || cfg.PeerWriteBufferSize < 0 || cfg.PeerNotSentLowat < 0 {
+		return nil, errors.New("invalid peer socket option")
+	}
+	var pr *proxy.Proxy
+	if cfg.ProxyURL != "" {
+		var err error
+		pr, err = proxy.New(cfg.ProxyURL)
+		if err != nil {
+			return nil, errors.New("invalid proxy url: " + err.Error())
+		}
+		if cfg.DisableProxyFallback {
+			// DHT and LSD traffic cannot be sent through the proxy.
+			cfg.DHTEnabled = false
+			cfg.LSDEnabled = false
+		}
+	}
+	var al *allowlist.Allowlist
+	if len(cfg.PeerAllowlist) > 0 {
+		var err error
+		al, err = allowlist.New(cfg.PeerAllowlist)
+		if err != nil {
+			return nil, errors.New("invalid peer allowlist: " + err.Error())
+		}
+	}
+	httpTransport := newHTTPTransport(pr, !cfg.DisableProxyFallback)
+	addURLClient, err := newAddURLClient(&cfg, httpTransport)
+	if err != nil {
+		return nil, errors.New("invalid torrent add cookies: " + err.Error())
+	}
 	if cfg.MaxOpenFiles > 0 {
 		err := setNoFile(cfg.MaxOpenFiles)
 		if err != nil {
 			return nil, errors.New("cannot change max open files limit: " + err.Error())
 		}
 	}
-	var err error
 	cfg.Database, err = homedir.Expand(cfg.Database)
 	if err != nil {
 		return nil, err
@@ -99,8 +166,30 @@ func NewSession(cfg Config) (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(cfg.WatchDirs) > 0 && cfg.WatchInterval <= 0 {
+		return nil, errors.New("invalid watch interval")
+	}
+	cfg.WatchDirs = append([]WatchDir(nil), cfg.WatchDirs...)
+	for i := range cfg.WatchDirs {
+		wd := &cfg.WatchDirs[i]
+		if wd.Path == "" {
+			return nil, errors.New("watch dir path is empty")
+		}
+		wd.Path, err = homedir.Expand(wd.Path)
+		if err != nil {
+			return nil, err
+		}
+		err = os.MkdirAll(wd.Path, os.ModeDir|cfg.FilePermissions)
+		if err != nil {
+			return nil, err
+		}
+	}
 	l := logger.New("session")
-	db, err := bbolt.Open(cfg.Database, cfg.FilePermissions&^0111, &bbolt.Options{Timeout: time.Second})
+	dbTimeout := time.Second
+	if len(cfg.InheritedListeners) > 0 {
+		dbTimeout = cfg.HandoffTimeout
+	}
+	db, err := bbolt.Open(cfg.Database, cfg.FilePermissions&^0111, &bbolt.Options{Timeout: dbTimeout})
 	if err == bbolt.ErrTimeout {
 		return nil, errors.New("resume database is locked by another process")
 	} else if err != nil {
@@ -129,10 +218,6 @@ func NewSession(cfg Config) (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
-	res, err := boltdbresumer.New(db, torrentsBucket)
-	if err != nil {
-		return nil, err
-	}
 	var dhtNode *dht.DHT
 	if cfg.DHTEnabled {
 		dhtConfig := dht.NewConfig()
@@ -150,9 +235,22 @@ func NewSession(cfg Config) (*Session, error) {
 			return nil, err
 		}
 	}
+	var lsdNode *lsd.LSD
+	if cfg.LSDEnabled {
+		var cookie [8]byte
+		_, _ = rand.Read(cookie[:])
+		var lerr error
+		lsdNode, lerr = lsd.New(hex.EncodeToString(cookie[:]), logger.New("lsd"))
+		if lerr != nil {
+			// Multicast may not be available. Torrents can still be downloaded without LSD.
+			l.Errorln("cannot start local service discovery:", lerr)
+		}
+	}
 	ports := make(map[int]struct{})
-	for p := cfg.PortBegin; p < cfg.PortEnd; p++ {
-		ports[int(p)] = struct{}{}
+	if cfg.Port == 0 {
+		for p := cfg.PortBegin; p < cfg.PortEnd; p++ {
+			ports[int(p)] = struct{}{}
+		}
 	}
 	bl := blocklist.New()
 	bl.Logger = l.Errorf
@@ -163,31 +261,40 @@ func NewSession(cfg Config) (*Session, error) {
 	c := &Session{
 		config:             cfg,
 		db:                 db,
-		resumer:            res,
 		blocklist:          bl,
-		trackerManager:     trackermanager.New(blTracker, cfg.DNSResolveTimeout, !cfg.TrackerHTTPVerifyTLS),
+		allowlist:          al,
+		proxy:              pr,
+		listeners:          handoff.New(cfg.InheritedListeners),
+		trackerManager:     trackermanager.New(blTracker, cfg.DNSResolveTimeout, !cfg.TrackerHTTPVerifyTLS, pr, !cfg.DisableProxyFallback),
 		log:                l,
 		torrents:           make(map[string]*Torrent),
 		torrentsByInfoHash: make(map[dht.InfoHash][]*Torrent),
 		availablePorts:     ports,
 		dht:                dhtNode,
+		lsd:                lsdNode,
 		pieceCache:         piececache.New(cfg.ReadCacheSize, cfg.ReadCacheTTL, cfg.ParallelReads),
 		ram:                resourcemanager.New[*peer.Peer](cfg.WriteCacheSize),
 		createdAt:          time.Now(),
 		semWrite:           semaphore.New(int(cfg.ParallelWrites)),
+		dialLimiter:        diallimiter.New(cfg.MaxConcurrentDials, cfg.MaxConcurrentDialsPerSubnet),
 		closeC:             make(chan struct{}),
+		addURLClient:       addURLClient,
+		httpTransport:      httpTransport,
 		webseedClient: http.Client{
 			Transport: &http.Transport{
 				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-					ip, port, err := resolver.Resolve(ctx, addr, cfg.DNSResolveTimeout, bl)
-					if err != nil {
-						return nil, err
-					}
-					var d net.Dialer
-					taddr := &net.TCPAddr{IP: ip, Port: port}
 					dctx, cancel := context.WithTimeout(ctx, cfg.WebseedDialTimeout)
 					defer cancel()
-					return d.DialContext(dctx, network, taddr.String())
+					direct := proxy.DialFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+						ip, port, err := resolver.Resolve(ctx, addr, cfg.DNSResolveTimeout, bl)
+						if err != nil {
+							return nil, err
+						}
+						var d net.Dialer
+						taddr := &net.TCPAddr{IP: ip, Port: port}
+						return d.DialContext(ctx, network, taddr.String())
+					})
+					return pr.Dialer(direct, !cfg.DisableProxyFallback).DialContext(dctx, network, addr)
 				},
 				TLSHandshakeTimeout:   cfg.WebseedTLSHandshakeTimeout,
 				TLSClientConfig:       &tls.Config{InsecureSkipVerify: !cfg.WebseedVerifyTLS}, // nolint: gosec
@@ -195,14 +302,8 @@ func NewSession(cfg Config) (*Session, error) {
 			},
 		},
 	}
-	dlSpeed := cfg.SpeedLimitDownload * 1024
-	if cfg.SpeedLimitDownload > 0 {
-		c.bucketDownload = ratelimit.NewBucketWithRate(float64(dlSpeed), dlSpeed)
-	}
-	ulSpeed := cfg.SpeedLimitUpload * 1024
-	if cfg.SpeedLimitUpload > 0 {
-		c.bucketUpload = ratelimit.NewBucketWithRate(float64(ulSpeed), ulSpeed)
-	}
+	c.bucketDownload = speedlimiter.New(cfg.SpeedLimitDownload*1024, nil)
+	c.bucketUpload = speedlimiter.New(cfg.SpeedLimitUpload*1024, nil)
 	err = c.startBlocklistReloader()
 	if err != nil {
 		return nil, err
@@ -213,11 +314,26 @@ func NewSession(cfg Config) (*Session, error) {
 	}
 	ext.Set(61) // Fast Extension (BEP 6)
 	ext.Set(43) // Extension Protocol (BEP 10)
+	ext.Set(59) // BitTorrent v2 (BEP 52)
 	if cfg.DHTEnabled {
 		ext.Set(63) // DHT Protocol (BEP 5)
 		c.dhtPeerRequests = make(map[*torrent]struct{})
 	}
 	c.initMetrics()
+	c.resumer, err = boltdbresumer.New(db, torrentsBucket, c.metrics.ResumeReadLatency, c.metrics.ResumeWriteLatency)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.PortMappingEnabled {
+		c.portMapper = portmapper.New(cfg.PortMappingLifetime, logger.New("portmapper"))
+		go c.portMapper.Run()
+	}
+	if cfg.Port != 0 {
+		err = c.startAcceptor()
+		if err != nil {
+			return nil, err
+		}
+	}
 	c.loadExistingTorrents(ids)
 	if c.config.RPCEnabled {
 		c.rpc = newRPCServer(c)
@@ -229,10 +345,30 @@ func NewSession(cfg Config) (*Session, error) {
 	if cfg.DHTEnabled {
 		go c.processDHTResults()
 	}
+	if c.lsd != nil {
+		go c.lsd.Run()
+		go c.processLSDResults()
+	}
 	go c.updateStatsLoop()
+	if len(cfg.WatchDirs) > 0 {
+		c.watchDoneC = make(chan struct{})
+		go c.watchDirs()
+	}
 	return c, nil
 }
 
+// newHTTPTransport returns the transport of the HTTP clients that download torrent files and blocklists.
+// If pr is not nil, connections are made through the proxy. Proxy settings in environment are not used in that case.
+func newHTTPTransport(pr *proxy.Proxy, fallback bool) http.RoundTripper {
+	if pr == nil {
+		return http.DefaultTransport
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = pr.Dialer(&net.Dialer{}, fallback).DialContext
+	return t
+}
+
 func (s *Session) parseTrackers(tiers [][]string, private bool) []tracker.Tracker {
 	ret := make([]tracker.Tracker, 0, len(tiers))
 	for _, tier := range tiers {
@@ -263,10 +399,18 @@ func (s *Session) getTrackerUserAgent(private bool) string {
 func (s *Session) Close() error {
 	close(s.closeC)
 
+	if s.watchDoneC != nil {
+		<-s.watchDoneC
+	}
+
 	if s.config.DHTEnabled {
 		s.dht.Stop()
 	}
 
+	if s.lsd != nil {
+		s.lsd.Close()
+	}
+
 	s.updateStats()
 
 	var wg sync.WaitGroup
@@ -282,6 +426,14 @@ func (s *Session) Close() error {
 	s.torrents = nil
 	s.mTorrents.Unlock()
 
+	if s.config.Port != 0 {
+		s.stopAcceptor()
+	}
+
+	if s.portMapper != nil {
+		s.portMapper.Close()
+	}
+
 	if s.rpc != nil {
 		err := s.rpc.Stop(s.config.RPCShutdownTimeout)
 		if err != nil {
@@ -289,6 +441,7 @@ func (s *Session) Close() error {
 		}
 	}
 
+	s.listeners.Close()
 	s.ram.Close()
 	s.pieceCache.Close()
 	s.trackerManager.Close()
@@ -296,6 +449,14 @@ func (s *Session) Close() error {
 	return s.db.Close()
 }
 
+// ListenerFiles returns duplicates of the listening sockets of the Session, keyed by network and address.
+// The files can be passed to a new process in Config.InheritedListeners for a zero-downtime upgrade.
+// The new process accepts connections on the same ports while this Session is being closed.
+// Returned files must be closed by the caller after passing them to the new process.
+func (s *Session) ListenerFiles() map[string]*os.File {
+	return s.listeners.Files()
+}
+
 // ListTorrents returns all torrents in session as a slice.
 // The order of the torrents returned is different on each call.
 func (s *Session) ListTorrents() []*Torrent {
@@ -308,7 +469,25 @@ func (s *Session) ListTorrents() []*Torrent {
 	return torrents
 }
 
+// ListTorrentsByLabel returns the torrents having the label in session as a slice.
+// The order of the torrents returned is different on each call.
+func (s *Session) ListTorrentsByLabel(label string) []*Torrent {
+	s.mTorrents.RLock()
+	defer s.mTorrents.RUnlock()
+	var torrents []*Torrent
+	for _, t := range s.torrents {
+		if t.torrent.hasLabel(label) {
+			torrents = append(torrents, t)
+		}
+	}
+	return torrents
+}
+
+// getPort allocates a port for a new torrent. Returns zero if all torrents share the same port.
 func (s *Session) getPort() (int, error) {
+	if s.config.Port != 0 {
+		return 0, nil
+	}
 	s.mPorts.Lock()
 	defer s.mPorts.Unlock()
 	for p := range s.availablePorts {
@@ -319,6 +498,9 @@ func (s *Session) getPort() (int, error) {
 }
 
 func (s *Session) releasePort(port int) {
+	if s.config.Port != 0 {
+		return
+	}
 	s.mPorts.Lock()
 	defer s.mPorts.Unlock()
 	s.availablePorts[port] = struct{}{}
@@ -340,6 +522,16 @@ func (s *Session) RemoveTorrent(id string) error {
 	return err
 }
 
+// removeTorrentKeepData removes the torrent from the Session without deleting its files.
+func (s *Session) removeTorrentKeepData(id string) error {
+	t, err := s.removeTorrentFromClient(id)
+	if t != nil {
+		t.torrent.Close()
+		s.releasePort(t.torrent.port)
+	}
+	return err
+}
+
 func (s *Session) removeTorrentFromClient(id string) (*Torrent, error) {
 	s.mTorrents.Lock()
 	t, ok := s.torrents[id]
@@ -378,18 +570,40 @@ func (s *Session) removeTorrentFromClient(id string) (*Torrent, error) {
 func (s *Session) stopAndRemoveData(t *Torrent) error {
 	t.torrent.Close()
 	s.releasePort(t.torrent.port)
-	var err error
-	var dest string
-	if s.config.DataDirIncludesTorrentID {
-		dest = filepath.Join(s.config.DataDir, t.torrent.id)
-	} else if t.torrent.info != nil {
-		dest = filepath.Join(s.config.DataDir, t.torrent.info.Name)
+	var name string
+	if t.torrent.info != nil {
+		name = t.torrent.info.Name
 	}
+	return s.removeData(s.torrentDataPath(t.torrent.id, t.torrent.dest, name))
+}
+
+// torrentDataPath returns the path that contains only the files of the torrent, so it can be removed with the torrent.
+// name is the name in the info dict of the torrent and it is empty if the metadata is not downloaded yet.
+// Returns empty string if there is no such path.
+func (s *Session) torrentDataPath(id, dest, name string) string {
 	if dest != "" {
-		err = os.RemoveAll(dest)
-		if err != nil {
-			s.log.Errorf("cannot remove torrent data. err: %s dest: %s", err, dest)
+		// Do not remove the directory given by the user, only the files of the torrent.
+		if name != "" {
+			return filepath.Join(dest, name)
 		}
+		return ""
+	}
+	if s.config.DataDirIncludesTorrentID {
+		return filepath.Join(s.config.DataDir, id)
+	}
+	if name != "" {
+		return filepath.Join(s.config.DataDir, name)
+	}
+	return ""
+}
+
+func (s *Session) removeData(dest string) error {
+	if dest == "" {
+		return nil
+	}
+	err := os.RemoveAll(dest)
+	if err != nil {
+		s.log.Errorf("cannot remove torrent data. err: %s dest: %s", err, dest)
 	}
 	return err
 }
@@ -436,6 +650,35 @@ func (s *Session) StopAll() error {
 	return nil
 }
 
+// SetDownloadLimit sets the global download speed limit in bytes per second. Zero means unlimited.
+// Downloads from peers and webseeds of all torrents draw from the same limit.
+func (s *Session) SetDownloadLimit(bytesPerSec int64) {
+	s.bucketDownload.SetRate(bytesPerSec)
+}
+
+// SetUploadLimit sets the global upload speed limit in bytes per second. Zero means unlimited.
+func (s *Session) SetUploadLimit(bytesPerSec int64) {
+	s.bucketUpload.SetRate(bytesPerSec)
+}
+
+// DownloadLimit returns the global download speed limit in bytes per second. Zero means unlimited.
+func (s *Session) DownloadLimit() int64 {
+	return s.bucketDownload.Rate()
+}
+
+// UploadLimit returns the global upload speed limit in bytes per second. Zero means unlimited.
+func (s *Session) UploadLimit() int64 {
+	return s.bucketUpload.Rate()
+}
+
+// dataDir returns the directory of the torrent files. dest is the directory given when adding or moving the torrent.
+func (s *Session) dataDir(torrentID, dest string) string {
+	if dest != "" {
+		return dest
+	}
+	return s.getDataDir(torrentID)
+}
+
 func (s *Session) getDataDir(torrentID string) string {
 	if s.config.DataDirIncludesTorrentID {
 		return filepath.Join(s.config.DataDir, torrentID)
@@ -0,0 +1,168 @@
+package torrent
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/cenkalti/rain/internal/acceptor"
+	"github.com/cenkalti/rain/internal/btconn"
+	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
+	"github.com/cenkalti/rain/internal/sockopt"
+	"github.com/cenkalti/rain/internal/utp"
+	"github.com/nictuku/dht"
+)
+
+// startAcceptor starts listening for peer connections on the port shared by all torrents.
+// It is only used when Config.Port is set.
+func (s *Session) startAcceptor() error {
+	host := net.JoinHostPort(s.config.Host, strconv.Itoa(int(s.config.Port)))
+	lc := net.ListenConfig{Control: s.socketOptions().Control}
+	s.incomingConnC = make(chan net.Conn)
+	s.incomingHandshakers = make(map[*incominghandshaker.IncomingHandshaker]struct{})
+	s.incomingHandshakerResultC = make(chan *incominghandshaker.IncomingHandshaker)
+	var listener net.Listener
+	if s.config.PeerTransport != PeerTransportUTP {
+		var err error
+		listener, err = s.listeners.Listen(context.Background(), &lc, "tcp", host)
+		if err != nil {
+			return err
+		}
+		s.log.Info("Listening peers on tcp://" + listener.Addr().String())
+	}
+	switch s.config.PeerTransport {
+	case PeerTransportUTP, PeerTransportBoth:
+		// uTP is listened on the same port number with TCP.
+		pc, err := s.listeners.ListenPacket(context.Background(), &lc, "udp", host)
+		if err != nil {
+			if listener != nil {
+				listener.Close()
+			}
+			return err
+		}
+		s.utpSocket = utp.NewSocket(pc)
+		s.log.Info("Listening peers on utp://" + s.utpSocket.Addr().String())
+		s.utpAcceptor = acceptor.New(s.utpSocket, s.incomingConnC, s.log)
+		go s.utpAcceptor.Run()
+	}
+	if listener != nil {
+		s.acceptor = acceptor.New(listener, s.incomingConnC, s.log)
+		go s.acceptor.Run()
+	}
+	s.acceptorDoneC = make(chan struct{})
+	go s.runAcceptor()
+	if s.portMapper != nil {
+		s.portMapper.AddPort(int(s.config.Port))
+	}
+	return nil
+}
+
+// stopAcceptor closes the listeners and the connections in handshake state.
+func (s *Session) stopAcceptor() {
+	if s.acceptor != nil {
+		s.acceptor.Close()
+	}
+	// Closing the acceptor closes the socket and the uTP connections on it.
+	if s.utpAcceptor != nil {
+		s.utpAcceptor.Close()
+	}
+	if s.acceptorDoneC != nil {
+		<-s.acceptorDoneC
+	}
+}
+
+func (s *Session) socketOptions() sockopt.Options {
+	return sockopt.Options{
+		DSCP:            s.config.PeerDSCP,
+		ReadBufferSize:  s.config.PeerReadBufferSize,
+		WriteBufferSize: s.config.PeerWriteBufferSize,
+		NotSentLowat:    s.config.PeerNotSentLowat,
+	}
+}
+
+func (s *Session) runAcceptor() {
+	defer close(s.acceptorDoneC)
+	for {
+		select {
+		case conn := <-s.incomingConnC:
+			s.handleNewConnection(conn)
+		case ih := <-s.incomingHandshakerResultC:
+			delete(s.incomingHandshakers, ih)
+			if ih.Error == nil {
+				s.sendConnectionToTorrent(ih)
+			}
+		case <-s.closeC:
+			for ih := range s.incomingHandshakers {
+				ih.Close()
+			}
+			return
+		}
+	}
+}
+
+func (s *Session) handleNewConnection(conn net.Conn) {
+	ip := btconn.PeerAddr(conn).IP
+	if s.config.BlocklistEnabledForIncomingConnections && s.blocklist != nil && s.blocklist.Blocked(ip) {
+		s.log.Debugln("peer is blocked:", conn.RemoteAddr().String())
+		s.metrics.BlockListRejectedIncoming.Inc(1)
+		conn.Close()
+		return
+	}
+	h := incominghandshaker.New(conn)
+	s.incomingHandshakers[h] = struct{}{}
+	go h.Run(
+		s.getSKey,
+		s.getPeerID,
+		s.incomingHandshakerResultC,
+		s.config.PeerHandshakeTimeout,
+		s.extensions,
+		s.config.ForceIncomingEncryption,
+	)
+}
+
+// findTorrentByInfoHash returns the first torrent with the info hash in the session.
+func (s *Session) findTorrentByInfoHash(infoHash [20]byte) *torrent {
+	s.mTorrents.RLock()
+	defer s.mTorrents.RUnlock()
+	torrents := s.torrentsByInfoHash[dht.InfoHash(infoHash[:])]
+	if len(torrents) == 0 {
+		return nil
+	}
+	return torrents[0].torrent
+}
+
+func (s *Session) getSKey(sKeyHash [20]byte) []byte {
+	s.mTorrents.RLock()
+	defer s.mTorrents.RUnlock()
+	for _, t := range s.torrents {
+		if sKey := t.torrent.getSKey(sKeyHash); sKey != nil {
+			return sKey
+		}
+	}
+	return nil
+}
+
+func (s *Session) getPeerID(infoHash [20]byte) ([20]byte, bool) {
+	t := s.findTorrentByInfoHash(infoHash)
+	if t == nil {
+		return [20]byte{}, false
+	}
+	return t.getPeerID(infoHash)
+}
+
+// sendConnectionToTorrent passes the connection to the torrent that the peer has requested in handshake.
+func (s *Session) sendConnectionToTorrent(ih *incominghandshaker.IncomingHandshaker) {
+	t := s.findTorrentByInfoHash(ih.InfoHash)
+	if t == nil {
+		// Torrent is removed during handshake.
+		ih.Conn.Close()
+		return
+	}
+	select {
+	case t.sharedPortConnC <- ih:
+	case <-t.closeC:
+		ih.Conn.Close()
+	case <-s.closeC:
+		ih.Conn.Close()
+	}
+}
@@ -0,0 +1,133 @@
+package torrent
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSharedPort(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	cfg := DefaultConfig
+	cfg.Port = uint16(port)
+	cfg.PeerTransport = PeerTransportBoth
+	s1, closeSession1 := newTestSessionConfig(t, cfg)
+	defer closeSession1()
+	addr := startSeeder(t, s1, true)
+	if addr != l.Addr().String() {
+		t.Fatalf("torrent must listen on shared port, got %s", addr)
+	}
+	for _, tor := range s1.ListTorrents() {
+		spec, err := s1.resumer.Read(tor.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if spec.Port != 0 {
+			t.Fatalf("port must not be saved, got %d", spec.Port)
+		}
+	}
+
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s2.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+}
+
+func TestSessionHandoff(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	cfg.Port = uint16(port)
+	s1, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startSeeder(t, s1, true)
+
+	// New session waits for the database until the old session is closed.
+	cfg.InheritedListeners = s1.ListenerFiles()
+	if len(cfg.InheritedListeners) == 0 {
+		t.Fatal("no listener files")
+	}
+	sessionC := make(chan *Session)
+	errC := make(chan error)
+	go func() {
+		s2, err2 := NewSession(cfg)
+		if err2 != nil {
+			errC <- err2
+			return
+		}
+		sessionC <- s2
+	}()
+	err = s1.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s2 *Session
+	select {
+	case s2 = <-sessionC:
+	case err = <-errC:
+		t.Fatal(err)
+	}
+	defer s2.Close()
+
+	s3, closeSession3 := newTestSession(t)
+	defer closeSession3()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s3.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+}
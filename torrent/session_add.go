@@ -1,20 +1,21 @@
 package torrent
 
 import (
+	"bytes"
 	"encoding/base64"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/cenkalti/rain/internal/allowlist"
 	"github.com/cenkalti/rain/internal/magnet"
 	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/cenkalti/rain/internal/resumer"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
-	"github.com/cenkalti/rain/internal/storage/filestorage"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"github.com/gofrs/uuid"
 	"github.com/nictuku/dht"
@@ -24,6 +25,7 @@ import (
 type AddTorrentOptions struct {
 	// ID uniquely identifies the torrent in Session.
 	// If empty, a random ID is generated.
+	// ID is used as the name of the data directory, so it cannot be "." or ".." or contain path separators.
 	ID string
 	// Do not start torrent automatically after adding.
 	Stopped bool
@@ -31,6 +33,27 @@ type AddTorrentOptions struct {
 	StopAfterDownload bool
 	// Stop torrent after metadata is downloaded from magnet links.
 	StopAfterMetadata bool
+	// Limits checked for the torrent instead of the ones in Config.
+	// Zero fields and nil value mean limits in Config are used.
+	Limits *TorrentLimits
+	// Peers allowed for the torrent instead of the ones in Config.PeerAllowlist.
+	// Items can be IP addresses or ranges in CIDR notation. Empty value means Config.PeerAllowlist is used.
+	PeerAllowlist []string
+	// Limits for stopping the torrent after seeding instead of the ones in Config.
+	// Nil value means limits in Config are used.
+	SeedLimits *SeedLimits
+	// Directory to save the files of the torrent. Config.DataDir is used if empty.
+	Dest string
+	// Number of peers unchoked for uploading instead of Config.UnchokedPeers.
+	// Zero value means Config.UnchokedPeers is used.
+	UploadSlots int
+	// Free-form labels for organizing torrents, e.g. for listing them with Session.ListTorrentsByLabel.
+	// Surrounding spaces are trimmed, empty and duplicate labels are ignored.
+	Labels []string
+	// Creates the storage of the torrent. Config.StorageProvider is used if nil.
+	// The provider is not saved in the session database,
+	// so Config.StorageProvider is used when the torrent is loaded again after restart.
+	StorageProvider StorageProvider
 }
 
 // AddTorrent adds a new torrent to the session by reading .torrent metainfo from reader.
@@ -49,30 +72,114 @@ func (s *Session) AddTorrent(r io.Reader, opt *AddTorrentOptions) (*Torrent, err
 	return t, err
 }
 
-func (s *Session) parseMetaInfo(r io.Reader) (*metainfo.MetaInfo, error) {
-	mi, err := metainfo.New(r)
+// TorrentLimits are checked when adding a torrent to protect the Session from torrents that would exhaust resources.
+// Zero value of a field means no limit.
+type TorrentLimits struct {
+	// Maximum number of pieces.
+	MaxPieces uint32
+	// Maximum number of files, including padding files.
+	MaxFiles uint
+	// Maximum total size of the files in bytes.
+	MaxContentSize int64
+}
+
+func (l TorrentLimits) check(info *metainfo.Info) error {
+	if l.MaxPieces > 0 && info.NumPieces > l.MaxPieces {
+		return &ErrLimitExceeded{Limit: "pieces", Value: int64(info.NumPieces), Max: int64(l.MaxPieces)}
+	}
+	if l.MaxFiles > 0 && uint(len(info.Files)) > l.MaxFiles {
+		return &ErrLimitExceeded{Limit: "files", Value: int64(len(info.Files)), Max: int64(l.MaxFiles)}
+	}
+	if l.MaxContentSize > 0 && info.Length > l.MaxContentSize {
+		return &ErrLimitExceeded{Limit: "size", Value: info.Length, Max: l.MaxContentSize}
+	}
+	return nil
+}
+
+// SeedLimits stop or remove a torrent automatically when it has seeded enough.
+// The torrent is stopped when any of the limits is reached. Zero value of a field means no limit.
+type SeedLimits struct {
+	// Ratio of uploaded bytes to downloaded bytes.
+	// If nothing is downloaded because the data already exists, the size of the torrent is used instead of downloaded bytes.
+	Ratio float64
+	// Total time spent in seeding state.
+	Duration time.Duration
+	// Time passed in seeding state without uploading any data. It is not saved, so it restarts when the torrent is started again.
+	IdleDuration time.Duration
+	// Remove the torrent from the Session instead of stopping it. Downloaded files are kept.
+	Remove bool
+}
+
+func (l SeedLimits) validate() error {
+	if l.Ratio < 0 || l.Duration < 0 || l.IdleDuration < 0 {
+		return errInvalidSeedLimits
+	}
+	return nil
+}
+
+func (s *Session) seedLimits() SeedLimits {
+	return SeedLimits{
+		Ratio:        s.config.SeedRatioLimit,
+		Duration:     s.config.SeedDurationLimit,
+		IdleDuration: s.config.SeedIdleLimit,
+		Remove:       s.config.SeedLimitRemove,
+	}
+}
+
+// torrentLimits returns the limits in Config overridden by the non-zero fields of the limits in options.
+func (s *Session) torrentLimits(opt *AddTorrentOptions) TorrentLimits {
+	l := TorrentLimits{
+		MaxPieces:      s.config.MaxPieces,
+		MaxFiles:       s.config.MaxFiles,
+		MaxContentSize: s.config.MaxContentSize,
+	}
+	if o := opt.Limits; o != nil {
+		if o.MaxPieces != 0 {
+			l.MaxPieces = o.MaxPieces
+		}
+		if o.MaxFiles != 0 {
+			l.MaxFiles = o.MaxFiles
+		}
+		if o.MaxContentSize != 0 {
+			l.MaxContentSize = o.MaxContentSize
+		}
+	}
+	return l
+}
+
+func (s *Session) parseMetaInfo(r io.Reader, limits TorrentLimits) (*metainfo.MetaInfo, error) {
+	b, err := io.ReadAll(io.LimitReader(r, int64(s.config.MaxTorrentSize)+1))
 	if err != nil {
 		return nil, err
 	}
-	if mi.Info.NumPieces > s.config.MaxPieces {
-		return nil, errTooManyPieces
+	if len(b) > int(s.config.MaxTorrentSize) {
+		return nil, ErrTorrentTooLarge
+	}
+	mi, err := metainfo.New(bytes.NewReader(b))
+	if err != nil {
+		return nil, newInvalidMetainfoError(err)
+	}
+	err = limits.check(&mi.Info)
+	if err != nil {
+		return nil, err
 	}
 	return mi, nil
 }
 
 func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torrent, error) {
-	r = io.LimitReader(r, int64(s.config.MaxTorrentSize))
-	mi, err := s.parseMetaInfo(r)
+	limits := s.torrentLimits(opt)
+	mi, err := s.parseMetaInfo(r, limits)
 	if err != nil {
 		return nil, newInputError(err)
 	}
-	id, port, sto, err := s.add(opt)
+	id, port, sto, newData, err := s.add(opt, mi.Info.Hash[:], mi.Info.Name)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		if err != nil {
 			s.releasePort(port)
+			_ = s.removeData(newData)
 		}
 	}()
 	t, err := newTorrent2(
@@ -92,10 +199,20 @@ func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torre
 		opt.StopAfterDownload,
 		opt.StopAfterMetadata,
 		false, // completeCmdRun
+		nil,   // completedAnnounces
+		false, // paused
+		TransferModeNormal,
+		nil, // filePriorities
+		limits,
+		opt.PeerAllowlist,
+		opt.SeedLimits,
+		opt.UploadSlots,
 	)
 	if err != nil {
 		return nil, err
 	}
+	t.dest = opt.Dest
+	t.labels = normalizeLabels(opt.Labels)
 	go s.checkTorrent(t)
 	defer func() {
 		if err != nil {
@@ -108,10 +225,16 @@ func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torre
 		Name:              mi.Info.Name,
 		Trackers:          mi.AnnounceList,
 		URLList:           mi.URLList,
+		Dest:              opt.Dest,
 		Info:              mi.Info.Bytes,
+		PieceLayers:       mi.Info.PieceLayersBytes(),
 		AddedAt:           t.addedAt,
 		StopAfterDownload: opt.StopAfterDownload,
 		StopAfterMetadata: opt.StopAfterMetadata,
+		PeerAllowlist:     opt.PeerAllowlist,
+		SeedLimits:        seedLimitsToSpec(opt.SeedLimits),
+		Labels:            t.labels,
+		UploadSlots:       opt.UploadSlots,
 	}
 	err = s.resumer.Write(id, rspec)
 	if err != nil {
@@ -140,7 +263,7 @@ func (s *Session) AddURI(uri string, opt *AddTorrentOptions) (*Torrent, error) {
 	case "magnet":
 		return s.addMagnet(uri, opt)
 	default:
-		return nil, errors.New("unsupported uri scheme: " + u.Scheme)
+		return nil, newInputError(&ErrUnsupportedScheme{Scheme: u.Scheme})
 	}
 }
 
@@ -157,21 +280,77 @@ func filterOutControlChars(s string) string {
 	return sb.String()
 }
 
+// newAddURLClient returns the HTTP client for downloading torrent files in AddURI.
+// The client keeps the cookies in cfg.TorrentAddHTTPCookies and the ones set by the servers.
+func newAddURLClient(cfg *Config, transport http.RoundTripper) (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	for rawURL, header := range cfg.TorrentAddHTTPCookies {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("url has no host: %q", rawURL)
+		}
+		req := http.Request{Header: http.Header{"Cookie": []string{header}}}
+		jar.SetCookies(u, req.Cookies())
+	}
+	maxRedirects := cfg.TorrentAddHTTPMaxRedirects
+	return &http.Client{
+		Transport: transport,
+		Timeout:   cfg.TorrentAddHTTPTimeout,
+		Jar:       jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}, nil
+}
+
 func (s *Session) addURL(u string, opt *AddTorrentOptions) (*Torrent, error) {
-	client := http.Client{
-		Timeout: s.config.TorrentAddHTTPTimeout,
+	req, err := http.NewRequest(http.MethodGet, u, nil) // nolint: noctx
+	if err != nil {
+		return nil, newInputError(err)
+	}
+	// Credentials in URL are sent with basic authentication.
+	// Unlike the credentials in URL, the Authorization header is kept if the server redirects to the same domain.
+	if req.URL.User != nil {
+		password, _ := req.URL.User.Password()
+		req.SetBasicAuth(req.URL.User.Username(), password)
+		req.URL.User = nil
+	}
+	if s.config.TorrentAddHTTPUserAgent != "" {
+		req.Header.Set("User-Agent", s.config.TorrentAddHTTPUserAgent)
 	}
-	resp, err := client.Get(u) // nolint: noctx
+	resp, err := s.addURLClient.Do(req)
 	if err != nil {
 		return nil, newInputError(err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, newInputError(fmt.Errorf("unexpected status code for torrent file: %d", resp.StatusCode))
+	}
+
 	if resp.ContentLength > int64(s.config.MaxTorrentSize) {
-		return nil, newInputError(fmt.Errorf("torrent too large: %d", resp.ContentLength))
+		return nil, newInputError(fmt.Errorf("%w: %d bytes", ErrTorrentTooLarge, resp.ContentLength))
 	}
-	r := io.LimitReader(resp.Body, int64(s.config.MaxTorrentSize))
-	return s.AddTorrent(r, opt)
+	return s.AddTorrent(resp.Body, opt)
+}
+
+// AddInfoHash adds a new torrent to the session by its info hash only.
+// The torrent has no trackers. Peers and metadata are found via DHT and peer exchange.
+// Nil value can be passed as opt for default options.
+func (s *Session) AddInfoHash(ih InfoHash, opt *AddTorrentOptions) (*Torrent, error) {
+	if opt == nil {
+		opt = &AddTorrentOptions{}
+	}
+	return s.addMagnetSpec(&magnet.Magnet{InfoHash: ih}, opt)
 }
 
 func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, error) {
@@ -179,13 +358,19 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 	if err != nil {
 		return nil, newInputError(err)
 	}
-	id, port, sto, err := s.add(opt)
+	return s.addMagnetSpec(ma, opt)
+}
+
+func (s *Session) addMagnetSpec(ma *magnet.Magnet, opt *AddTorrentOptions) (*Torrent, error) {
+	limits := s.torrentLimits(opt)
+	id, port, sto, newData, err := s.add(opt, ma.InfoHash[:], "")
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		if err != nil {
 			s.releasePort(port)
+			_ = s.removeData(newData)
 		}
 	}()
 	t, err := newTorrent2(
@@ -205,10 +390,20 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 		opt.StopAfterDownload,
 		opt.StopAfterMetadata,
 		false, // completeCmdRun
+		nil,   // completedAnnounces
+		false, // paused
+		TransferModeNormal,
+		nil, // filePriorities
+		limits,
+		opt.PeerAllowlist,
+		opt.SeedLimits,
+		opt.UploadSlots,
 	)
 	if err != nil {
 		return nil, err
 	}
+	t.dest = opt.Dest
+	t.labels = normalizeLabels(opt.Labels)
 	go s.checkTorrent(t)
 	defer func() {
 		if err != nil {
@@ -221,9 +416,14 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 		Name:              ma.Name,
 		Trackers:          ma.Trackers,
 		FixedPeers:        ma.Peers,
+		Dest:              opt.Dest,
 		AddedAt:           t.addedAt,
 		StopAfterDownload: opt.StopAfterDownload,
 		StopAfterMetadata: opt.StopAfterMetadata,
+		PeerAllowlist:     opt.PeerAllowlist,
+		SeedLimits:        seedLimitsToSpec(opt.SeedLimits),
+		Labels:            t.labels,
+		UploadSlots:       opt.UploadSlots,
 	}
 	err = s.resumer.Write(id, rspec)
 	if err != nil {
@@ -236,7 +436,35 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 	return t2, err
 }
 
-func (s *Session) add(opt *AddTorrentOptions) (id string, port int, sto *filestorage.FileStorage, err error) {
+// add validates the options and allocates the resources for a new torrent.
+// name is the name in the info dict of the torrent, empty for magnet links.
+// newData is the path of the files to remove if the torrent cannot be added.
+func (s *Session) add(opt *AddTorrentOptions, infoHash []byte, name string) (id string, port int, sto Storage, newData string, err error) {
+	if opt.ID != "" {
+		err = validateTorrentID(opt.ID)
+		if err != nil {
+			err = newInputError(err)
+			return
+		}
+	}
+	if len(opt.PeerAllowlist) > 0 {
+		_, err = allowlist.New(opt.PeerAllowlist)
+		if err != nil {
+			err = newInputError(err)
+			return
+		}
+	}
+	if opt.SeedLimits != nil {
+		err = opt.SeedLimits.validate()
+		if err != nil {
+			err = newInputError(err)
+			return
+		}
+	}
+	if opt.UploadSlots < 0 {
+		err = newInputError(errInvalidUploadSlots)
+		return
+	}
 	port, err = s.getPort()
 	if err != nil {
 		return
@@ -246,18 +474,18 @@ func (s *Session) add(opt *AddTorrentOptions) (id string, port int, sto *filesto
 			s.releasePort(port)
 		}
 	}()
-	var givenID string
-	if opt.ID != "" {
-		givenID = opt.ID
+	s.mTorrents.RLock()
+	defer s.mTorrents.RUnlock()
+	if existing := s.torrentsByInfoHash[dht.InfoHash(infoHash)]; len(existing) > 0 {
+		err = newInputError(&ErrDuplicateTorrent{ExistingID: existing[0].torrent.id})
+		return
 	}
-	if givenID != "" {
-		s.mTorrents.RLock()
-		defer s.mTorrents.RUnlock()
-		if _, ok := s.torrents[givenID]; ok {
-			err = errors.New("duplicate torrent id")
+	if opt.ID != "" {
+		if _, ok := s.torrents[opt.ID]; ok {
+			err = newInputError(&ErrDuplicateTorrent{ExistingID: opt.ID})
 			return
 		}
-		id = givenID
+		id = opt.ID
 	} else {
 		u1, err2 := uuid.NewV1()
 		if err2 != nil {
@@ -266,13 +494,20 @@ func (s *Session) add(opt *AddTorrentOptions) (id string, port int, sto *filesto
 		}
 		id = base64.RawURLEncoding.EncodeToString(u1[:])
 	}
-	sto, err = filestorage.New(s.getDataDir(id), s.config.FilePermissions)
-	if err != nil {
-		return
-	}
+	newData = s.newDataPath(id, opt.Dest, name)
+	sto, err = s.newStorage(id, opt.Dest, opt.StorageProvider)
 	return
 }
 
+// validateTorrentID checks that the ID given by the user is safe to use as the name of the data directory of the torrent.
+// Otherwise, removing the torrent could delete the data of other torrents or the files outside of the data directory.
+func validateTorrentID(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("invalid torrent id: %q", id)
+	}
+	return nil
+}
+
 func (s *Session) insertTorrent(t *torrent) *Torrent {
 	t.log.Info("added torrent")
 	t2 := &Torrent{
@@ -1,10 +1,17 @@
 package torrent
 
 import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.etcd.io/bbolt"
 )
 
 // TestInvalidTorrentData is test case for reproducing bug:
@@ -19,3 +26,321 @@ func TestInvalidTorrentData(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+func TestAddErrors(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	_, err := s.AddTorrent(strings.NewReader("some garbage data"), nil)
+	var invalidMetainfo *ErrInvalidMetainfo
+	assert.ErrorAs(t, err, &invalidMetainfo)
+
+	s.config.MaxTorrentSize = 10
+	_, err = s.AddTorrent(strings.NewReader("some garbage data"), nil)
+	assert.ErrorIs(t, err, ErrTorrentTooLarge)
+
+	_, err = s.AddURI("ftp://example.com/file.torrent", nil)
+	var unsupportedScheme *ErrUnsupportedScheme
+	if assert.ErrorAs(t, err, &unsupportedScheme) {
+		assert.Equal(t, "ftp", unsupportedScheme.Scheme)
+	}
+
+	_, err = s.AddURI(torrentMagnetLink, &AddTorrentOptions{ID: "foo", Stopped: true})
+	assert.NoError(t, err)
+	_, err = s.AddURI(torrentMagnetLink, &AddTorrentOptions{ID: "foo", Stopped: true})
+	var duplicate *ErrDuplicateTorrent
+	if assert.ErrorAs(t, err, &duplicate) {
+		assert.Equal(t, "foo", duplicate.ExistingID)
+	}
+}
+
+func TestAddInvalidID(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	// Torrent ID is used in data path, removing these torrents would delete other files in data dir or its parent.
+	for _, id := range []string{".", "..", "foo/bar", "../foo", `foo\bar`} {
+		_, err := s.AddURI(torrentMagnetLink, &AddTorrentOptions{ID: id, Stopped: true})
+		var inputErr *InputError
+		assert.ErrorAs(t, err, &inputErr, id)
+	}
+	assert.Empty(t, s.ListTorrents())
+}
+
+func TestAddDuplicate(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	b, err := os.ReadFile(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Torrents are matched by info hash, so the same torrent cannot be added with another ID or as a magnet link.
+	_, err = s.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{ID: "foo", Stopped: true})
+	var duplicate *ErrDuplicateTorrent
+	if assert.ErrorAs(t, err, &duplicate) {
+		assert.Equal(t, tor.ID(), duplicate.ExistingID)
+	}
+	_, err = s.AddURI(torrentMagnetLink, &AddTorrentOptions{Stopped: true})
+	if assert.ErrorAs(t, err, &duplicate) {
+		assert.Equal(t, tor.ID(), duplicate.ExistingID)
+	}
+	var inputErr *InputError
+	assert.ErrorAs(t, err, &inputErr)
+	assert.Len(t, s.ListTorrents(), 1)
+
+	// Torrent can be added again after it is removed.
+	err = s.RemoveTorrent(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.AddURI(torrentMagnetLink, &AddTorrentOptions{Stopped: true})
+	assert.NoError(t, err)
+}
+
+func TestStartErrors(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	tor, err := s.AddURI(torrentMagnetLink, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	var resumeErr *ErrResumeWrite
+	if assert.ErrorAs(t, err, &resumeErr) {
+		assert.Equal(t, tor.ID(), resumeErr.TorrentID)
+	}
+	assert.Equal(t, Stopped, tor.Stats().Status)
+	s.db, err = bbolt.Open(s.config.Database, 0640, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.RemoveTorrent(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorIs(t, tor.Start(), ErrTorrentClosed)
+	assert.ErrorIs(t, tor.Stop(), ErrTorrentClosed)
+}
+
+func TestAddLimits(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	b, err := os.ReadFile(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.config.MaxContentSize = 1
+	_, err = s.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{Stopped: true})
+	assert.ErrorIs(t, err, ErrTorrentTooLarge)
+	var limitExceeded *ErrLimitExceeded
+	if assert.ErrorAs(t, err, &limitExceeded) {
+		assert.Equal(t, "size", limitExceeded.Limit)
+		assert.Equal(t, int64(1), limitExceeded.Max)
+	}
+
+	s.config.MaxContentSize = 0
+	s.config.MaxPieces = 1
+	_, err = s.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{Stopped: true})
+	if assert.ErrorAs(t, err, &limitExceeded) {
+		assert.Equal(t, "pieces", limitExceeded.Limit)
+	}
+
+	// Limits in options override the ones in Config, limits not set in options are still checked.
+	_, err = s.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{Stopped: true, Limits: &TorrentLimits{MaxFiles: 1000}})
+	if assert.ErrorAs(t, err, &limitExceeded) {
+		assert.Equal(t, "pieces", limitExceeded.Limit)
+	}
+	_, err = s.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{Stopped: true, Limits: &TorrentLimits{MaxFiles: 1, MaxPieces: 1000}})
+	if assert.ErrorAs(t, err, &limitExceeded) {
+		assert.Equal(t, "files", limitExceeded.Limit)
+	}
+	_, err = s.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{Stopped: true, Limits: &TorrentLimits{MaxPieces: 1000}})
+	assert.NoError(t, err)
+}
+
+func TestAddDest(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	dest, closeDest := tempdir(t)
+	defer closeDest()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true, Dest: dest})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, dest, tor.torrent.storage.RootDir())
+	spec, err := s.resumer.Read(tor.ID())
+	if assert.NoError(t, err) {
+		assert.Equal(t, dest, spec.Dest)
+	}
+}
+
+func TestAddURL(t *testing.T) {
+	b, err := os.ReadFile(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "token", Value: "t1"})
+		http.Redirect(w, r, "/download", http.StatusFound)
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		session, _ := r.Cookie("session")
+		token, _ := r.Cookie("token")
+		if r.UserAgent() != "test-agent" || user != "user" || pass != "pass" || session == nil || session.Value != "s1" || token == nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(b)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.TorrentAddHTTPUserAgent = "test-agent"
+	cfg.TorrentAddHTTPMaxRedirects = 2
+	cfg.TorrentAddHTTPCookies = map[string]string{srv.URL: "session=s1"}
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.User = url.UserPassword("user", "pass")
+
+	_, err = s.AddURI(u.String()+"/download", &AddTorrentOptions{Stopped: true})
+	var inputErr *InputError
+	assert.ErrorAs(t, err, &inputErr)
+
+	_, err = s.AddURI(u.String()+"/login", &AddTorrentOptions{Stopped: true})
+	assert.NoError(t, err)
+
+	_, err = s.AddURI(srv.URL+"/loop", &AddTorrentOptions{Stopped: true})
+	assert.ErrorContains(t, err, "stopped after 2 redirects")
+}
+
+func TestLabels(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.AddURI(torrentMagnetLink, &AddTorrentOptions{ID: "foo", Stopped: true, Labels: []string{" movies ", "", "hd", "movies"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"movies", "hd"}, tor.Labels())
+	_, err = s.AddURI(otherMagnetLink, &AddTorrentOptions{ID: "bar", Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, s.ListTorrentsByLabel("hd"), 1) {
+		assert.Equal(t, "foo", s.ListTorrentsByLabel("hd")[0].ID())
+	}
+	assert.Empty(t, s.ListTorrentsByLabel("music"))
+
+	err = tor.SetLabels([]string{"music"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, s.ListTorrentsByLabel("hd"))
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assert.Equal(t, []string{"music"}, s.GetTorrent("foo").Labels())
+	assert.Empty(t, s.GetTorrent("bar").Labels())
+	assert.Len(t, s.ListTorrentsByLabel("music"), 1)
+}
+
+func TestUploadSlots(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	cfg.UnchokedPeers = 3
+	cfg.OptimisticUnchokedPeers = 1
+
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.AddURI(torrentMagnetLink, &AddTorrentOptions{Stopped: true, UploadSlots: -1})
+	assert.Error(t, err)
+	tor, err := s.AddURI(torrentMagnetLink, &AddTorrentOptions{ID: "foo", Stopped: true, UploadSlots: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 6, tor.Stats().Peers.UploadSlots)
+	bar, err := s.AddURI(otherMagnetLink, &AddTorrentOptions{ID: "bar", Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 4, bar.Stats().Peers.UploadSlots)
+
+	assert.Error(t, tor.SetUploadSlots(-1))
+	err = tor.SetUploadSlots(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 9, tor.Stats().Peers.UploadSlots)
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assert.Equal(t, 9, s.GetTorrent("foo").Stats().Peers.UploadSlots)
+	assert.Equal(t, 4, s.GetTorrent("bar").Stats().Peers.UploadSlots)
+}
@@ -2,13 +2,14 @@ package torrent
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"crypto/sha1"
 	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
 	"time"
 
 	"github.com/cenkalti/backoff/v3"
@@ -101,12 +102,81 @@ func (s *Session) retryReloadBlocklist() {
 	}
 }
 
+// ReloadBlocklist loads the blocklist from Config.BlocklistURL immediately and replaces the rules in use.
+func (s *Session) ReloadBlocklist() error {
+	if s.config.BlocklistURL == "" {
+		return errors.New("blocklist url is not set")
+	}
+	s.log.Info("Reloading blocklist...")
+	return s.reloadBlocklist()
+}
+
 func (s *Session) reloadBlocklist() error {
-	req, err := http.NewRequest(http.MethodGet, s.config.BlocklistURL, nil)
+	buf, err := s.fetchBlocklist()
+	if err != nil {
+		return err
+	}
+
+	err = s.loadBlocklistReader(bytes.NewReader(buf))
 	if err != nil {
 		return err
 	}
 
+	now := time.Now()
+
+	s.mBlocklist.Lock()
+	s.blocklistTimestamp = now
+	s.mBlocklist.Unlock()
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(sessionBucket)
+		err2 := b.Put(blocklistKey, buf)
+		if err2 != nil {
+			return err2
+		}
+		sum := sha1.Sum([]byte(s.config.BlocklistURL))
+		err2 = b.Put(blocklistURLHashKey, sum[:])
+		if err2 != nil {
+			return err2
+		}
+		return b.Put(blocklistTimestampKey, []byte(now.Format(time.RFC3339)))
+	})
+}
+
+// fetchBlocklist returns the contents of the blocklist from a HTTP server or from a local file.
+// Local files can be given as a file:// URL or as a path.
+func (s *Session) fetchBlocklist() ([]byte, error) {
+	u, err := url.Parse(s.config.BlocklistURL)
+	if err != nil {
+		return s.readBlocklistFile(s.config.BlocklistURL)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return s.downloadBlocklist()
+	case "file":
+		return s.readBlocklistFile(u.Path)
+	default:
+		return s.readBlocklistFile(s.config.BlocklistURL)
+	}
+}
+
+func (s *Session) readBlocklistFile(name string) ([]byte, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > s.config.BlocklistMaxResponseSize {
+		return nil, errors.New("blocklist file too big")
+	}
+	return ioutil.ReadFile(name)
+}
+
+func (s *Session) downloadBlocklist() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, s.config.BlocklistURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go func() {
@@ -119,12 +189,13 @@ func (s *Session) reloadBlocklist() error {
 	req = req.WithContext(ctx)
 
 	client := http.Client{
-		Timeout: s.config.BlocklistUpdateTimeout,
+		Transport: s.httpTransport,
+		Timeout:   s.config.BlocklistUpdateTimeout,
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -133,58 +204,21 @@ func (s *Session) reloadBlocklist() error {
 	s.log.Infoln("Blocklist response content type:", resp.Header.Get("content-type"))
 
 	if resp.StatusCode != 200 {
-		return errors.New("invalid blocklist status code")
+		return nil, errors.New("invalid blocklist status code")
 	}
 	if resp.ContentLength == -1 {
-		return errors.New("unknown content length")
+		return nil, errors.New("unknown content length")
 	}
 	if resp.ContentLength > s.config.BlocklistMaxResponseSize {
-		return errors.New("response too big")
+		return nil, errors.New("response too big")
 	}
 
 	buf := make([]byte, resp.ContentLength)
 	_, err = io.ReadFull(resp.Body, buf)
 	if err != nil {
-		return err
-	}
-	resp.Body.Close()
-
-	if resp.Header.Get("content-type") == "application/x-gzip" {
-		gr, gerr := gzip.NewReader(bytes.NewReader(buf))
-		if gerr != nil {
-			return gerr
-		}
-		defer gr.Close()
-		buf, err = ioutil.ReadAll(gr)
-		if err != nil {
-			return err
-		}
-	}
-
-	err = s.loadBlocklistReader(bytes.NewReader(buf))
-	if err != nil {
-		return err
+		return nil, err
 	}
-
-	now := time.Now()
-
-	s.mBlocklist.Lock()
-	s.blocklistTimestamp = now
-	s.mBlocklist.Unlock()
-
-	return s.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(sessionBucket)
-		err2 := b.Put(blocklistKey, buf)
-		if err2 != nil {
-			return err2
-		}
-		sum := sha1.Sum([]byte(s.config.BlocklistURL))
-		err2 = b.Put(blocklistURLHashKey, sum[:])
-		if err2 != nil {
-			return err2
-		}
-		return b.Put(blocklistTimestampKey, []byte(now.Format(time.RFC3339)))
-	})
+	return buf, nil
 }
 
 func (s *Session) loadBlocklistFromDB() error {
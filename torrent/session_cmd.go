@@ -5,30 +5,48 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+
+	"github.com/cenkalti/rain/internal/announcer"
 )
 
 func (s *Session) runOnCompleteCmd(torrent *torrent) {
-	command, err := exec.LookPath(s.config.OnCompleteCmd[0])
+	s.runHookCmd("completion", s.config.OnCompleteCmd, torrent)
+}
+
+func (s *Session) runOnTrackerWarningCmd(torrent *torrent, w announcer.TrackerWarning) {
+	s.runHookCmd("tracker warning", s.config.OnTrackerWarningCmd, torrent,
+		"RAIN_TRACKER_URL="+w.URL,
+		"RAIN_TRACKER_WARNING="+w.Message)
+}
+
+// runHookCmd runs the command with the details of the torrent in environment variables.
+func (s *Session) runHookCmd(hook string, args []string, torrent *torrent, env ...string) {
+	command, err := exec.LookPath(args[0])
 	if err != nil {
-		s.log.Errorf("error resolving completion hook command path: %s", err)
+		s.log.Errorf("error resolving %s hook command path: %s", hook, err)
 		return
 	}
 
 	cmd := exec.Command(command)
-	if len(s.config.OnCompleteCmd) > 1 {
-		cmd.Args = append(cmd.Args, s.config.OnCompleteCmd[1:]...)
+	if len(args) > 1 {
+		cmd.Args = append(cmd.Args, args[1:]...)
 	}
 
+	var dir string
+	if torrent.storage != nil {
+		dir = torrent.storage.RootDir()
+	}
 	cmd.Env = append(os.Environ(),
 		"RAIN_TORRENT_ADDED="+fmt.Sprint(torrent.addedAt.Unix()),
-		"RAIN_TORRENT_DIR="+torrent.storage.RootDir(),
+		"RAIN_TORRENT_DIR="+dir,
 		"RAIN_TORRENT_HASH="+hex.EncodeToString(torrent.infoHash[:]),
 		"RAIN_TORRENT_ID="+torrent.id,
 		"RAIN_TORRENT_NAME="+torrent.name)
+	cmd.Env = append(cmd.Env, env...)
 
-	s.log.Debugf("executing completion hook for torrent %s: %s", torrent.id, cmd.String())
+	s.log.Debugf("executing %s hook for torrent %s: %s", hook, torrent.id, cmd.String())
 
 	if err := cmd.Run(); err != nil {
-		s.log.Errorf("completion hook execution failed: %s", err)
+		s.log.Errorf("%s hook execution failed: %s", hook, err)
 	}
 }
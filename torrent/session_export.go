@@ -0,0 +1,125 @@
+package torrent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
+	"github.com/nictuku/dht"
+	"go.etcd.io/bbolt"
+)
+
+// exportVersion is the version of the archive format written by Session.Export.
+const exportVersion = 1
+
+type exportArchive struct {
+	Version  int
+	Torrents []exportedTorrent
+}
+
+type exportedTorrent struct {
+	ID   string
+	Spec *boltdbresumer.Spec
+}
+
+// Export writes the resume data of all torrents in the Session to w as a JSON archive that can be read by Session.Import.
+// The archive contains the metadata, bitfields, statistics and per torrent settings, but not the files of the torrents.
+// Export can be called while torrents are running. Statistics and bitfields are saved to the database before exporting.
+// Torrents with invalid resume data are not exported.
+func (s *Session) Export(w io.Writer) error {
+	s.updateStats()
+	var ids []string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(torrentsBucket).ForEach(func(k, _ []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	a := exportArchive{Version: exportVersion, Torrents: make([]exportedTorrent, 0, len(ids))}
+	for _, id := range ids {
+		spec, err := s.resumer.Read(id)
+		if err != nil {
+			s.log.Warningf("not exporting torrent %s: %s", id, err)
+			continue
+		}
+		a.Torrents = append(a.Torrents, exportedTorrent{ID: id, Spec: spec})
+	}
+	return json.NewEncoder(w).Encode(a)
+}
+
+// Import reads an archive written by Session.Export and adds the torrents in it to the Session.
+// Torrents keep their IDs, so torrents with IDs or info hashes that already exist in the Session are skipped.
+// Files of the torrents are not in the archive. They must be copied into the same directories before importing,
+// otherwise they are downloaded again.
+// If a torrent cannot be imported, remaining torrents are still imported and the first error is returned.
+func (s *Session) Import(r io.Reader) error {
+	var a exportArchive
+	err := json.NewDecoder(r).Decode(&a)
+	if err != nil {
+		return newInputError(err)
+	}
+	if a.Version < 1 || a.Version > exportVersion {
+		return newInputError(fmt.Errorf("unsupported archive version: %d", a.Version))
+	}
+	for _, et := range a.Torrents {
+		err2 := s.importTorrent(et.ID, et.Spec)
+		if err2 != nil {
+			s.log.Errorf("cannot import torrent %s: %s", et.ID, err2)
+			if err == nil {
+				err = err2
+			}
+		}
+	}
+	return err
+}
+
+func (s *Session) importTorrent(id string, spec *boltdbresumer.Spec) error {
+	if err := validateTorrentID(id); err != nil {
+		return newInputError(err)
+	}
+	if spec == nil || len(spec.InfoHash) != 20 {
+		return newInputError(fmt.Errorf("invalid resume data for torrent: %s", id))
+	}
+	s.mTorrents.RLock()
+	_, ok := s.torrents[id]
+	existing := s.torrentsByInfoHash[dht.InfoHash(spec.InfoHash)]
+	s.mTorrents.RUnlock()
+	if ok {
+		s.log.Warningln("torrent already exists, not importing:", id)
+		return nil
+	}
+	if len(existing) > 0 {
+		s.log.Warningf("torrent already exists with id: %s, not importing: %s", existing[0].torrent.id, id)
+		return nil
+	}
+	port, err := s.getPort()
+	if err != nil {
+		return err
+	}
+	// Port saved in the archive may be in use or out of the port range of this Session.
+	spec.Port = port
+	err = s.resumer.Write(id, spec)
+	if err != nil {
+		s.releasePort(port)
+		return err
+	}
+	t, started, err := s.loadExistingTorrent(id)
+	if err != nil {
+		s.releasePort(port)
+		err2 := s.db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(torrentsBucket).DeleteBucket([]byte(id))
+		})
+		if err2 != nil {
+			s.log.Error(err2)
+		}
+		return err
+	}
+	if started {
+		return t.Start()
+	}
+	return nil
+}
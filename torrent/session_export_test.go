@@ -0,0 +1,73 @@
+package torrent
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = s.AddTorrent(f, &AddTorrentOptions{ID: "foo", Stopped: true, Labels: []string{"movies"}, UploadSlots: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.AddURI(otherMagnetLink, &AddTorrentOptions{ID: "bar", Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = s.Export(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	err = s2.Import(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, s2.ListTorrents(), 2)
+	foo := s2.GetTorrent("foo")
+	if assert.NotNil(t, foo) {
+		assert.Equal(t, torrentName, foo.Name())
+		assert.Equal(t, torrentInfoHashString, foo.InfoHash().String())
+		assert.Equal(t, []string{"movies"}, foo.Labels())
+		assert.Equal(t, Stopped, foo.Stats().Status)
+		assert.Equal(t, 5+s2.config.OptimisticUnchokedPeers, foo.Stats().Peers.UploadSlots)
+	}
+	bar := s2.GetTorrent("bar")
+	if assert.NotNil(t, bar) {
+		assert.Equal(t, "0123456789abcdef0123456789abcdef01234567", bar.InfoHash().String())
+	}
+
+	// Existing torrents are skipped.
+	err = s2.Import(bytes.NewReader(archive))
+	assert.NoError(t, err)
+	assert.Len(t, s2.ListTorrents(), 2)
+
+	// Torrents with the same info hash are skipped.
+	renamed := bytes.Replace(archive, []byte(`"ID":"foo"`), []byte(`"ID":"baz"`), 1)
+	assert.NotEqual(t, archive, renamed)
+	err = s2.Import(bytes.NewReader(renamed))
+	assert.NoError(t, err)
+	assert.Len(t, s2.ListTorrents(), 2)
+
+	err = s2.Import(strings.NewReader(`{"Version": 2}`))
+	assert.Error(t, err)
+	err = s2.Import(strings.NewReader(`{"Version": 1, "Torrents": [{"ID": "../baz", "Spec": {}}]}`))
+	assert.Error(t, err)
+	assert.Len(t, s2.ListTorrents(), 2)
+}
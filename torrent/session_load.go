@@ -1,20 +1,18 @@
 package torrent
 
 import (
-	"errors"
 	"fmt"
+	"time"
 
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/cenkalti/rain/internal/resumer"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
-	"github.com/cenkalti/rain/internal/storage/filestorage"
 	"github.com/cenkalti/rain/internal/webseedsource"
+	"github.com/rcrowley/go-metrics"
 	"go.etcd.io/bbolt"
 )
 
-var errTooManyPieces = errors.New("too many pieces")
-
 func (s *Session) loadExistingTorrents(ids []string) {
 	var loaded int
 	var started []*Torrent
@@ -56,9 +54,6 @@ func (s *Session) parseInfo(b []byte, version int) (*metainfo.Info, error) {
 	if err != nil {
 		return nil, err
 	}
-	if i.NumPieces > s.config.MaxPieces {
-		return nil, errTooManyPieces
-	}
 	return i, nil
 }
 
@@ -78,6 +73,12 @@ func (s *Session) loadExistingTorrent(id string) (tt *Torrent, hasStarted bool,
 		}
 		info = info2
 		private = info.Private
+		if info.V2 && len(spec.PieceLayers) > 0 {
+			err2 = info.SetPieceLayers(spec.PieceLayers)
+			if err2 != nil {
+				return nil, spec.Started, err2
+			}
+		}
 		if len(spec.Bitfield) > 0 {
 			bf3, err3 := bitfield.NewBytes(spec.Bitfield, info.NumPieces)
 			if err3 != nil {
@@ -86,7 +87,7 @@ func (s *Session) loadExistingTorrent(id string) (tt *Torrent, hasStarted bool,
 			bf = bf3
 		}
 	}
-	sto, err := filestorage.New(s.getDataDir(id), s.config.FilePermissions)
+	sto, err := s.newStorage(id, spec.Dest, nil)
 	if err != nil {
 		return
 	}
@@ -112,11 +113,22 @@ func (s *Session) loadExistingTorrent(id string) (tt *Torrent, hasStarted bool,
 		spec.StopAfterDownload,
 		spec.StopAfterMetadata,
 		spec.CompleteCmdRun,
+		spec.CompletedAnnounces,
+		spec.Paused,
+		TransferMode(spec.TransferMode),
+		filePrioritiesFromInts(spec.FilePriorities),
+		// Per torrent limits are not saved. Limits are only checked for torrents without info.
+		s.torrentLimits(&AddTorrentOptions{}),
+		spec.PeerAllowlist,
+		seedLimitsFromSpec(spec.SeedLimits),
+		spec.UploadSlots,
 	)
 	if err != nil {
 		return
 	}
 	t.rawTrackers = spec.Trackers
+	t.dest = spec.Dest
+	t.labels = spec.Labels
 	t.rawWebseedSources = spec.URLList
 	go s.checkTorrent(t)
 	delete(s.availablePorts, spec.Port)
@@ -160,22 +172,40 @@ func (s *Session) CompactDatabase(output string) error {
 	if err != nil {
 		return err
 	}
-	res, err := boltdbresumer.New(db, torrentsBucket)
+	res, err := boltdbresumer.New(db, torrentsBucket, metrics.NilTimer{}, metrics.NilTimer{})
 	if err != nil {
 		return err
 	}
 	for _, t := range s.torrents {
+		port := t.torrent.port
+		if s.config.Port != 0 {
+			port = 0
+		}
 		spec := &boltdbresumer.Spec{
-			InfoHash:          t.torrent.InfoHash(),
-			Port:              t.torrent.port,
-			Name:              t.torrent.name,
-			Trackers:          t.torrent.rawTrackers,
-			URLList:           t.torrent.rawWebseedSources,
-			FixedPeers:        t.torrent.fixedPeers,
-			Info:              t.torrent.info.Bytes,
-			AddedAt:           t.torrent.addedAt,
-			StopAfterDownload: t.torrent.stopAfterDownload,
-			StopAfterMetadata: t.torrent.stopAfterMetadata,
+			InfoHash:           t.torrent.InfoHash(),
+			Port:               port,
+			Name:               t.torrent.name,
+			Trackers:           t.torrent.rawTrackers,
+			URLList:            t.torrent.rawWebseedSources,
+			FixedPeers:         t.torrent.fixedPeers,
+			Dest:               t.torrent.dest,
+			Info:               t.torrent.info.Bytes,
+			PieceLayers:        t.torrent.info.PieceLayersBytes(),
+			AddedAt:            t.torrent.addedAt,
+			BytesDownloaded:    t.torrent.bytesDownloaded.Count(),
+			BytesUploaded:      t.torrent.bytesUploaded.Count(),
+			BytesWasted:        t.torrent.bytesWasted.Count(),
+			SeededFor:          time.Duration(t.torrent.seededFor.Count()),
+			StopAfterDownload:  t.torrent.stopAfterDownload,
+			StopAfterMetadata:  t.torrent.stopAfterMetadata,
+			Paused:             t.torrent.paused,
+			TransferMode:       int(t.torrent.transferMode),
+			FilePriorities:     filePrioritiesToInts(t.torrent.filePriorities),
+			CompletedAnnounces: t.torrent.completedAnnounces,
+			PeerAllowlist:      t.torrent.peerAllowlist,
+			SeedLimits:         seedLimitsToSpec(t.torrent.seedLimits),
+			Labels:             t.torrent.Labels(),
+			UploadSlots:        t.torrent.uploadSlots,
 		}
 		err = res.Write(t.torrent.id, spec)
 		if err != nil {
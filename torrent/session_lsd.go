@@ -0,0 +1,31 @@
+package torrent
+
+import (
+	"net"
+
+	"github.com/nictuku/dht"
+)
+
+func (s *Session) processLSDResults() {
+	for {
+		select {
+		case p := <-s.lsd.Peers():
+			s.mTorrents.RLock()
+			torrents, ok := s.torrentsByInfoHash[dht.InfoHash(p.InfoHash[:])]
+			s.mTorrents.RUnlock()
+			if !ok {
+				continue
+			}
+			addrs := []*net.TCPAddr{p.Addr}
+			for _, t := range torrents {
+				select {
+				case t.torrent.lsdPeersC <- addrs:
+				case <-t.torrent.closeC:
+				default:
+				}
+			}
+		case <-s.closeC:
+			return
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package torrent
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/rcrowley/go-metrics"
@@ -10,28 +11,38 @@ type sessionMetrics struct {
 	session  *Session
 	registry metrics.Registry
 
-	Torrents              metrics.Gauge
-	Peers                 metrics.Counter
-	PortsAvailable        metrics.Gauge
-	Uptime                metrics.Gauge
-	BlockListRules        metrics.Gauge
-	BlockListRecency      metrics.Gauge
-	ReadCacheObjects      metrics.Gauge
-	ReadCacheSize         metrics.Gauge
-	ReadCacheUtilization  metrics.Gauge
-	ReadsPerSecond        metrics.Meter
-	ReadsActive           metrics.Gauge
-	ReadsPending          metrics.Gauge
-	WriteCacheObjects     metrics.Gauge
-	WriteCacheSize        metrics.Gauge
-	WriteCachePendingKeys metrics.Gauge
-	WritesPerSecond       metrics.Meter
-	WritesActive          metrics.Gauge
-	WritesPending         metrics.Gauge
-	SpeedDownload         metrics.Meter
-	SpeedUpload           metrics.Meter
-	SpeedRead             metrics.Meter
-	SpeedWrite            metrics.Meter
+	Torrents                  metrics.Gauge
+	Peers                     metrics.Counter
+	PortsAvailable            metrics.Gauge
+	Uptime                    metrics.Gauge
+	BlockListRules            metrics.Gauge
+	BlockListRecency          metrics.Gauge
+	BlockListRejectedIncoming metrics.Counter
+	BlockListRejectedOutgoing metrics.Counter
+	ReadCacheObjects          metrics.Gauge
+	ReadCacheSize             metrics.Gauge
+	ReadCacheUtilization      metrics.Gauge
+	ReadCacheHits             metrics.Gauge
+	ReadCacheMisses           metrics.Gauge
+	ReadsPerSecond            metrics.Meter
+	ReadsActive               metrics.Gauge
+	ReadsPending              metrics.Gauge
+	WriteCacheObjects         metrics.Gauge
+	WriteCacheSize            metrics.Gauge
+	WriteCachePendingKeys     metrics.Gauge
+	WritesPerSecond           metrics.Meter
+	WritesActive              metrics.Gauge
+	WritesPending             metrics.Gauge
+	WriteLatency              *latencyTimer
+	ResumeReadLatency         *latencyTimer
+	ResumeWriteLatency        *latencyTimer
+	StorageOpenLatency        *latencyTimer
+	StorageReadLatency        *latencyTimer
+	StorageWriteLatency       *latencyTimer
+	SpeedDownload             metrics.Meter
+	SpeedUpload               metrics.Meter
+	SpeedRead                 metrics.Meter
+	SpeedWrite                metrics.Meter
 }
 
 func (s *Session) initMetrics() {
@@ -62,10 +73,14 @@ func (s *Session) initMetrics() {
 			}
 			return int64(time.Since(s.blocklistTimestamp) / time.Second)
 		}),
+		BlockListRejectedIncoming: metrics.NewRegisteredCounter("blocklist_rejected_incoming", r),
+		BlockListRejectedOutgoing: metrics.NewRegisteredCounter("blocklist_rejected_outgoing", r),
 
 		ReadCacheObjects:     metrics.NewRegisteredFunctionalGauge("read_cache_objects", r, func() int64 { return int64(s.pieceCache.Len()) }),
 		ReadCacheSize:        metrics.NewRegisteredFunctionalGauge("read_cache_size", r, func() int64 { return s.pieceCache.Size() }),
 		ReadCacheUtilization: metrics.NewRegisteredFunctionalGauge("read_cache_utilization", r, func() int64 { return int64(s.pieceCache.Utilization()) }),
+		ReadCacheHits:        metrics.NewRegisteredFunctionalGauge("read_cache_hits", r, func() int64 { return s.pieceCache.Hits() }),
+		ReadCacheMisses:      metrics.NewRegisteredFunctionalGauge("read_cache_misses", r, func() int64 { return s.pieceCache.Misses() }),
 
 		ReadsPerSecond: s.pieceCache.NumLoad,
 		ReadsActive:    metrics.NewRegisteredFunctionalGauge("reads_active", r, func() int64 { return int64(s.pieceCache.LoadsActive()) }),
@@ -78,6 +93,13 @@ func (s *Session) initMetrics() {
 		WritesPerSecond: metrics.NewRegisteredMeter("writes_per_second", r),
 		WritesActive:    metrics.NewRegisteredFunctionalGauge("writes_active", r, func() int64 { return int64(s.semWrite.Len()) }),
 		WritesPending:   metrics.NewRegisteredFunctionalGauge("writes_pending", r, func() int64 { return int64(s.semWrite.Waiting()) }),
+		WriteLatency:    newRegisteredLatencyTimer("write_latency", r),
+
+		ResumeReadLatency:   newRegisteredLatencyTimer("resume_read_latency", r),
+		ResumeWriteLatency:  newRegisteredLatencyTimer("resume_write_latency", r),
+		StorageOpenLatency:  newRegisteredLatencyTimer("storage_open_latency", r),
+		StorageReadLatency:  newRegisteredLatencyTimer("storage_read_latency", r),
+		StorageWriteLatency: newRegisteredLatencyTimer("storage_write_latency", r),
 
 		SpeedDownload: metrics.NewRegisteredMeter("speed_download", r),
 		SpeedUpload:   metrics.NewRegisteredMeter("speed_upload", r),
@@ -90,7 +112,46 @@ func (s *Session) initMetrics() {
 
 func (m *sessionMetrics) Close() {
 	m.WritesPerSecond.Stop()
+	m.WriteLatency.Stop()
+	m.ResumeReadLatency.Stop()
+	m.ResumeWriteLatency.Stop()
+	m.StorageOpenLatency.Stop()
+	m.StorageReadLatency.Stop()
+	m.StorageWriteLatency.Stop()
 	m.SpeedDownload.Stop()
 	m.SpeedUpload.Stop()
 	m.SpeedWrite.Stop()
 }
+
+// latencyTimer is a metrics.Timer that also keeps the total of all recorded durations.
+// The timer only keeps a sample of recent durations, so the total cannot be calculated from it.
+type latencyTimer struct {
+	metrics.Timer
+	total int64
+}
+
+func newRegisteredLatencyTimer(name string, r metrics.Registry) *latencyTimer {
+	t := &latencyTimer{Timer: metrics.NewTimer()}
+	_ = r.Register(name, t)
+	return t
+}
+
+func (t *latencyTimer) Time(f func()) {
+	ts := time.Now()
+	f()
+	t.UpdateSince(ts)
+}
+
+func (t *latencyTimer) Update(d time.Duration) {
+	atomic.AddInt64(&t.total, int64(d))
+	t.Timer.Update(d)
+}
+
+func (t *latencyTimer) UpdateSince(ts time.Time) {
+	t.Update(time.Since(ts))
+}
+
+// Total returns the sum of all recorded durations.
+func (t *latencyTimer) Total() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.total))
+}
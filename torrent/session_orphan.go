@@ -0,0 +1,190 @@
+package torrent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
+	"go.etcd.io/bbolt"
+)
+
+var errRemoveOrphanedData = errors.New("orphaned data can only be removed when Config.DataDirIncludesTorrentID is true")
+
+// ScanOrphanedData finds the files and directories in Config.DataDir that do not belong to any torrent in the resume database,
+// e.g. the data left behind by a crash or by torrents removed from the database with another program.
+// Found paths are removed if remove is true.
+//
+// If Config.DataDirIncludesTorrentID is true, directories that do not contain the data of a torrent are returned.
+// Otherwise, files and directories that do not contain the data of a torrent are returned.
+// Entries containing the data of torrents saved into AddTorrentOptions.Dest, or containing Dest itself, are not returned.
+// Session database and watched directories are never returned, even if they are in Config.DataDir.
+//
+// If Config.DataDirIncludesTorrentID is false, Config.DataDir may contain files of the user
+// that cannot be told apart from the files created by the Session, so found paths can be listed but cannot be removed.
+// Torrents should not be moved into the Session while scanning, because their files are written before they are saved to the resume database.
+func (s *Session) ScanOrphanedData(remove bool) ([]string, error) {
+	if remove && !s.config.DataDirIncludesTorrentID {
+		return nil, newInputError(errRemoveOrphanedData)
+	}
+	known, err := s.knownDataEntries()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(s.config.DataDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	reserved := []string{s.config.Database}
+	for _, wd := range s.config.WatchDirs {
+		reserved = append(reserved, wd.Path)
+	}
+	var orphans []string
+	for _, e := range entries {
+		if _, ok := known[e.Name()]; ok {
+			continue
+		}
+		if s.config.DataDirIncludesTorrentID && !e.IsDir() {
+			continue
+		}
+		path := filepath.Join(s.config.DataDir, e.Name())
+		if containsAnyPath(path, reserved) {
+			continue
+		}
+		orphans = append(orphans, path)
+	}
+	if remove {
+		for _, path := range orphans {
+			s.log.Infof("removing orphaned data: %s", path)
+			err2 := s.removeData(path)
+			if err2 != nil && err == nil {
+				err = err2
+			}
+		}
+	}
+	return orphans, err
+}
+
+// knownDataEntries returns the names of the entries in Config.DataDir that contain the data of the torrents in the resume database.
+// Entries are read without the resumer, so torrents with invalid resume data can be matched with their files, too.
+func (s *Session) knownDataEntries() (map[string]struct{}, error) {
+	type entry struct {
+		id, name, dest string
+		info           []byte
+		version        int
+	}
+	var entries []entry
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(torrentsBucket).ForEach(func(k, _ []byte) error {
+			b := tx.Bucket(torrentsBucket).Bucket(k)
+			if b == nil {
+				return nil
+			}
+			// Values are only valid in the transaction, so they are copied.
+			e := entry{
+				id:   string(k),
+				name: string(b.Get(boltdbresumer.Keys.Name)),
+				dest: string(b.Get(boltdbresumer.Keys.Dest)),
+				info: append([]byte(nil), b.Get(boltdbresumer.Keys.Info)...),
+			}
+			e.version, _ = strconv.Atoi(string(b.Get(boltdbresumer.Keys.Version)))
+			if e.version == 0 {
+				e.version = 1
+			}
+			entries = append(entries, e)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]struct{})
+	add := func(path string) {
+		if name := s.dataDirEntry(path); name != "" {
+			known[name] = struct{}{}
+		}
+	}
+	for _, e := range entries {
+		// Directory given by the user is never removed, even if it does not contain the files of the torrent yet.
+		add(e.dest)
+		add(s.torrentDataPath(e.id, e.dest, e.name))
+		add(s.torrentDataPath(e.id, e.dest, s.infoName(e.info, e.version)))
+	}
+	return known, nil
+}
+
+// dataDirEntry returns the name of the entry in Config.DataDir that is path or contains path.
+// Returns empty string if path is not in Config.DataDir.
+func (s *Session) dataDirEntry(path string) string {
+	if path == "" {
+		return ""
+	}
+	dir, err := filepath.Abs(s.config.DataDir)
+	if err != nil {
+		return ""
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return strings.SplitN(rel, string(filepath.Separator), 2)[0]
+}
+
+// infoName returns the name in the info dict of a torrent in resume database.
+// Returns empty string if the info is not downloaded yet or cannot be parsed.
+func (s *Session) infoName(b []byte, version int) string {
+	if len(b) == 0 {
+		return ""
+	}
+	info, err := s.parseInfo(b, version)
+	if err != nil {
+		return ""
+	}
+	return info.Name
+}
+
+// newDataPath returns the path of the files of a torrent being added if the path does not exist yet,
+// so the files can be removed if the torrent cannot be added.
+// Returns empty string if the path exists, e.g. when a torrent is added for seeding existing data,
+// so the files of the user are never removed.
+func (s *Session) newDataPath(id, dest, name string) string {
+	path := s.torrentDataPath(id, dest, name)
+	if path == "" {
+		return ""
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		return ""
+	}
+	return path
+}
+
+// containsAnyPath returns true if dir is one of the paths or contains one of them.
+func containsAnyPath(dir string, paths []string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return true
+	}
+	for _, p := range paths {
+		p, err = filepath.Abs(p)
+		if err != nil {
+			return true
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			continue
+		}
+		if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanOrphanedData(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{tor.ID(), "orphan"} {
+		err = os.Mkdir(filepath.Join(s.config.DataDir, name), 0o750)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files are not torrent data when the directories are named after torrent IDs.
+	err = os.WriteFile(filepath.Join(s.config.DataDir, "file"), nil, 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orphan := filepath.Join(s.config.DataDir, "orphan")
+	paths, err := s.ScanOrphanedData(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{orphan}, paths)
+	assert.DirExists(t, orphan)
+
+	paths, err = s.ScanOrphanedData(true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{orphan}, paths)
+	assert.NoDirExists(t, orphan)
+	assert.DirExists(t, filepath.Join(s.config.DataDir, tor.ID()))
+	assert.FileExists(t, s.config.Database)
+
+	s.config.DataDirIncludesTorrentID = false
+	paths, err = s.ScanOrphanedData(false)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{filepath.Join(s.config.DataDir, tor.ID()), filepath.Join(s.config.DataDir, "file")}, paths)
+}
+
+func TestScanOrphanedDataDest(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	// Torrent is saved into the data directory with a custom destination.
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = s.AddTorrent(f, &AddTorrentOptions{Stopped: true, Dest: s.config.DataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Destination without the files of the torrent yet.
+	sub := filepath.Join(s.config.DataDir, "sub")
+	_, err = s.AddURI(otherMagnetLink, &AddTorrentOptions{Stopped: true, Dest: filepath.Join(sub, "dest")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := filepath.Join(s.config.DataDir, torrentName)
+	for _, dir := range []string{data, filepath.Join(sub, "dest"), filepath.Join(s.config.DataDir, "user")} {
+		err = os.MkdirAll(dir, 0o750)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user := filepath.Join(s.config.DataDir, "user")
+	paths, err := s.ScanOrphanedData(true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{user}, paths)
+	assert.DirExists(t, data)
+	assert.DirExists(t, sub)
+
+	// Files of the user cannot be told apart from torrent data when directories are not named after torrent IDs.
+	err = os.Mkdir(user, 0o750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.config.DataDirIncludesTorrentID = false
+	paths, err = s.ScanOrphanedData(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{user}, paths)
+	_, err = s.ScanOrphanedData(true)
+	assert.Error(t, err)
+	assert.DirExists(t, user)
+	assert.DirExists(t, data)
+}
+
+func TestNewDataPath(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	assert.Equal(t, filepath.Join(s.config.DataDir, "foo"), s.newDataPath("foo", "", "name"))
+	assert.Equal(t, "", s.newDataPath("foo", s.config.DataDir, ""))
+	assert.Equal(t, filepath.Join(s.config.DataDir, "name"), s.newDataPath("foo", s.config.DataDir, "name"))
+
+	err := os.Mkdir(filepath.Join(s.config.DataDir, "foo"), 0o750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "", s.newDataPath("foo", "", "name"))
+}
@@ -0,0 +1,228 @@
+package torrent
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsHandler returns a http.Handler that serves the metrics of the Session and its torrents in Prometheus text
+// format, so the Session can be scraped by Prometheus directly or the handler can be mounted on another HTTP server.
+// The handler is also served at "/metrics" path of the RPC server.
+func (s *Session) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		s.writeMetrics(&metricsWriter{w: bw})
+		_ = bw.Flush()
+	})
+}
+
+// MetricsCollector returns a prometheus.Collector that collects the same metrics served by MetricsHandler,
+// so they can be registered to the prometheus.Registry of the application that embeds the Session.
+func (s *Session) MetricsCollector() prometheus.Collector {
+	c := &metricsCollector{session: s}
+	for _, f := range sessionMetricFamilies {
+		c.sessionDescs = append(c.sessionDescs, prometheus.NewDesc(f.name, f.help, nil, nil))
+	}
+	for _, f := range timerMetricFamilies {
+		c.timerDescs = append(c.timerDescs, prometheus.NewDesc(f.name, f.help, nil, nil))
+	}
+	for _, f := range torrentMetricFamilies {
+		c.torrentDescs = append(c.torrentDescs, prometheus.NewDesc(f.name, f.help, []string{"id", "name"}, nil))
+	}
+	return c
+}
+
+type torrentMetrics struct {
+	id, name      string
+	stats         Stats
+	trackerErrors int
+}
+
+type metricFamily struct {
+	name, typ, help string
+}
+
+var sessionMetricFamilies = []struct {
+	metricFamily
+	value func(ss *SessionStats) float64
+}{
+	{metricFamily{"rain_uptime_seconds", "gauge", "Time elapsed after the session is created."}, func(ss *SessionStats) float64 { return ss.Uptime.Seconds() }},
+	{metricFamily{"rain_torrents", "gauge", "Number of torrents in session."}, func(ss *SessionStats) float64 { return float64(ss.Torrents) }},
+	{metricFamily{"rain_peers", "gauge", "Number of connected peers."}, func(ss *SessionStats) float64 { return float64(ss.Peers) }},
+	{metricFamily{"rain_download_speed_bytes", "gauge", "Download speed from peers in bytes/s."}, func(ss *SessionStats) float64 { return float64(ss.SpeedDownload) }},
+	{metricFamily{"rain_upload_speed_bytes", "gauge", "Upload speed to peers in bytes/s."}, func(ss *SessionStats) float64 { return float64(ss.SpeedUpload) }},
+	{metricFamily{"rain_downloaded_bytes_total", "counter", "Number of bytes downloaded from peers."}, func(ss *SessionStats) float64 { return float64(ss.BytesDownloaded) }},
+	{metricFamily{"rain_uploaded_bytes_total", "counter", "Number of bytes uploaded to peers."}, func(ss *SessionStats) float64 { return float64(ss.BytesUploaded) }},
+	{metricFamily{"rain_read_cache_hits_total", "counter", "Number of block reads served from read cache."}, func(ss *SessionStats) float64 { return float64(ss.ReadCacheHits) }},
+	{metricFamily{"rain_read_cache_misses_total", "counter", "Number of block reads loaded from disk."}, func(ss *SessionStats) float64 { return float64(ss.ReadCacheMisses) }},
+	{metricFamily{"rain_read_cache_size_bytes", "gauge", "Current size of read cache."}, func(ss *SessionStats) float64 { return float64(ss.ReadCacheSize) }},
+	{metricFamily{"rain_disk_read_bytes_total", "counter", "Number of bytes read from disk."}, func(ss *SessionStats) float64 { return float64(ss.BytesRead) }},
+	{metricFamily{"rain_disk_written_bytes_total", "counter", "Number of bytes written to disk."}, func(ss *SessionStats) float64 { return float64(ss.BytesWritten) }},
+	{metricFamily{"rain_disk_writes_pending", "gauge", "Number of pending write requests to disk."}, func(ss *SessionStats) float64 { return float64(ss.WritesPending) }},
+}
+
+var timerMetricFamilies = []struct {
+	metricFamily
+	timer func(m *sessionMetrics) *latencyTimer
+}{
+	{metricFamily{"rain_disk_write_latency_seconds", "summary", "Duration of piece writes to disk."}, func(m *sessionMetrics) *latencyTimer { return m.WriteLatency }},
+	{metricFamily{"rain_resume_read_latency_seconds", "summary", "Duration of reading torrents from resume database."}, func(m *sessionMetrics) *latencyTimer { return m.ResumeReadLatency }},
+	{metricFamily{"rain_resume_write_latency_seconds", "summary", "Duration of writing torrents to resume database."}, func(m *sessionMetrics) *latencyTimer { return m.ResumeWriteLatency }},
+	{metricFamily{"rain_storage_open_latency_seconds", "summary", "Duration of opening files in storage."}, func(m *sessionMetrics) *latencyTimer { return m.StorageOpenLatency }},
+	{metricFamily{"rain_storage_read_latency_seconds", "summary", "Duration of reads from storage."}, func(m *sessionMetrics) *latencyTimer { return m.StorageReadLatency }},
+	{metricFamily{"rain_storage_write_latency_seconds", "summary", "Duration of writes to storage."}, func(m *sessionMetrics) *latencyTimer { return m.StorageWriteLatency }},
+}
+
+var torrentMetricFamilies = []struct {
+	metricFamily
+	value func(tm *torrentMetrics) float64
+}{
+	{metricFamily{"rain_torrent_download_speed_bytes", "gauge", "Download speed of torrent in bytes/s."}, func(tm *torrentMetrics) float64 { return float64(tm.stats.Speed.Download) }},
+	{metricFamily{"rain_torrent_upload_speed_bytes", "gauge", "Upload speed of torrent in bytes/s."}, func(tm *torrentMetrics) float64 { return float64(tm.stats.Speed.Upload) }},
+	{metricFamily{"rain_torrent_downloaded_bytes_total", "counter", "Number of bytes downloaded from swarm."}, func(tm *torrentMetrics) float64 { return float64(tm.stats.Bytes.Downloaded) }},
+	{metricFamily{"rain_torrent_uploaded_bytes_total", "counter", "Number of bytes uploaded to swarm."}, func(tm *torrentMetrics) float64 { return float64(tm.stats.Bytes.Uploaded) }},
+	{metricFamily{"rain_torrent_completed_bytes", "gauge", "Number of bytes that are downloaded and passed hash check."}, func(tm *torrentMetrics) float64 { return float64(tm.stats.Bytes.Completed) }},
+	{metricFamily{"rain_torrent_size_bytes", "gauge", "Total size of files in torrent."}, func(tm *torrentMetrics) float64 { return float64(tm.stats.Bytes.Total) }},
+	{metricFamily{"rain_torrent_peers", "gauge", "Number of connected peers."}, func(tm *torrentMetrics) float64 { return float64(tm.stats.Peers.Total) }},
+	{metricFamily{"rain_torrent_pieces_failed_total", "counter", "Number of pieces that failed hash check."}, func(tm *torrentMetrics) float64 { return float64(tm.stats.Pieces.Failed) }},
+	{metricFamily{"rain_torrent_tracker_errors", "gauge", "Number of trackers that did not respond or returned an error on the last announce."}, func(tm *torrentMetrics) float64 { return float64(tm.trackerErrors) }},
+}
+
+var summaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// timerSummary contains the values of a latencyTimer in seconds.
+type timerSummary struct {
+	quantiles []float64
+	sum       float64
+	count     uint64
+}
+
+func newTimerSummary(t *latencyTimer) timerSummary {
+	ts := t.Snapshot()
+	s := timerSummary{
+		quantiles: ts.Percentiles(summaryQuantiles),
+		sum:       t.Total().Seconds(),
+		count:     uint64(ts.Count()),
+	}
+	for i := range s.quantiles {
+		s.quantiles[i] /= float64(time.Second)
+	}
+	return s
+}
+
+func (s *Session) torrentMetrics() []torrentMetrics {
+	torrents := s.ListTorrents()
+	tms := make([]torrentMetrics, 0, len(torrents))
+	for _, t := range torrents {
+		tm := torrentMetrics{id: t.ID(), name: t.Name(), stats: t.Stats()}
+		for _, tr := range t.Trackers() {
+			if tr.Status == NotWorking {
+				tm.trackerErrors++
+			}
+		}
+		tms = append(tms, tm)
+	}
+	return tms
+}
+
+func (s *Session) writeMetrics(m *metricsWriter) {
+	ss := s.Stats()
+	for _, f := range sessionMetricFamilies {
+		m.header(f.metricFamily)
+		m.sample(f.name, "", f.value(&ss))
+	}
+	for _, f := range timerMetricFamilies {
+		m.header(f.metricFamily)
+		m.summary(f.name, newTimerSummary(f.timer(s.metrics)))
+	}
+	tms := s.torrentMetrics()
+	for _, f := range torrentMetricFamilies {
+		m.header(f.metricFamily)
+		for i := range tms {
+			tm := &tms[i]
+			m.sample(f.name, `id="`+escapeLabel(tm.id)+`",name="`+escapeLabel(tm.name)+`"`, f.value(tm))
+		}
+	}
+}
+
+// metricsWriter writes metrics in Prometheus text format.
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+func (m *metricsWriter) header(f metricFamily) {
+	_, _ = m.w.WriteString("# HELP " + f.name + " " + f.help + "\n# TYPE " + f.name + " " + f.typ + "\n")
+}
+
+func (m *metricsWriter) sample(name, labels string, value float64) {
+	_, _ = m.w.WriteString(name)
+	if labels != "" {
+		_, _ = m.w.WriteString("{" + labels + "}")
+	}
+	_, _ = m.w.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+func (m *metricsWriter) summary(name string, s timerSummary) {
+	for i, v := range s.quantiles {
+		m.sample(name, `quantile="`+strconv.FormatFloat(summaryQuantiles[i], 'f', -1, 64)+`"`, v)
+	}
+	m.sample(name+"_sum", "", s.sum)
+	m.sample(name+"_count", "", float64(s.count))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// metricsCollector implements prometheus.Collector for the metrics of a Session.
+type metricsCollector struct {
+	session      *Session
+	sessionDescs []*prometheus.Desc
+	timerDescs   []*prometheus.Desc
+	torrentDescs []*prometheus.Desc
+}
+
+func (c *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, descs := range [][]*prometheus.Desc{c.sessionDescs, c.timerDescs, c.torrentDescs} {
+		for _, d := range descs {
+			ch <- d
+		}
+	}
+}
+
+func (c *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	ss := c.session.Stats()
+	for i, f := range sessionMetricFamilies {
+		ch <- prometheus.MustNewConstMetric(c.sessionDescs[i], valueType(f.typ), f.value(&ss))
+	}
+	for i, f := range timerMetricFamilies {
+		s := newTimerSummary(f.timer(c.session.metrics))
+		quantiles := make(map[float64]float64, len(s.quantiles))
+		for j, v := range s.quantiles {
+			quantiles[summaryQuantiles[j]] = v
+		}
+		ch <- prometheus.MustNewConstSummary(c.timerDescs[i], s.count, s.sum, quantiles)
+	}
+	tms := c.session.torrentMetrics()
+	for i, f := range torrentMetricFamilies {
+		for j := range tms {
+			tm := &tms[j]
+			ch <- prometheus.MustNewConstMetric(c.torrentDescs[i], valueType(f.typ), f.value(tm), tm.id, tm.name)
+		}
+	}
+}
+
+func valueType(typ string) prometheus.ValueType {
+	if typ == "counter" {
+		return prometheus.CounterValue
+	}
+	return prometheus.GaugeValue
+}
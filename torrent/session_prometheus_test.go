@@ -0,0 +1,116 @@
+package torrent
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(newRPCServer(s).httpServer.Handler)
+	defer ts.Close()
+	resp, err := ts.Client().Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(b)
+
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4"))
+	assert.Contains(t, body, "# TYPE rain_torrents gauge\nrain_torrents 1\n")
+	assert.Contains(t, body, "# TYPE rain_read_cache_hits_total counter\n")
+	assert.Contains(t, body, "# TYPE rain_disk_write_latency_seconds summary\n")
+	assert.Contains(t, body, "rain_disk_write_latency_seconds_count 0\n")
+	assert.Contains(t, body, "# TYPE rain_resume_write_latency_seconds summary\n")
+	assert.Contains(t, body, "# TYPE rain_storage_read_latency_seconds summary\n")
+	assert.NotContains(t, body, "rain_resume_write_latency_seconds_count 0\n")
+	assert.Contains(t, body, `rain_torrent_size_bytes{id="`+tor.ID()+`",name="`+tor.Name()+`"} `)
+	assert.Contains(t, body, `rain_torrent_pieces_failed_total{id="`+tor.ID()+`",name="`+tor.Name()+`"} 0`+"\n")
+}
+
+func TestEscapeLabel(t *testing.T) {
+	assert.Equal(t, `a\\b\"c\nd`, escapeLabel("a\\b\"c\nd"))
+}
+
+func TestLatencyTimerTotal(t *testing.T) {
+	lt := newRegisteredLatencyTimer("test", metrics.NewRegistry())
+	defer lt.Stop()
+	// Sample of the timer is smaller than the number of updates, so the total cannot be calculated from the sample.
+	for i := 0; i < 2000; i++ {
+		lt.Update(time.Millisecond)
+	}
+	lt.Update(time.Second)
+	assert.Equal(t, 3*time.Second, lt.Total())
+	assert.Equal(t, int64(2001), lt.Count())
+	s := newTimerSummary(lt)
+	assert.Equal(t, 3.0, s.sum)
+	assert.Equal(t, uint64(2001), s.count)
+}
+
+func TestMetricsCollector(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.metrics.WriteLatency.Update(2 * time.Second)
+
+	r := prometheus.NewPedanticRegistry()
+	err = r.Register(s.MetricsCollector())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, mfs, len(sessionMetricFamilies)+len(timerMetricFamilies)+len(torrentMetricFamilies))
+
+	expected := `# HELP rain_torrents Number of torrents in session.
+# TYPE rain_torrents gauge
+rain_torrents 1
+# HELP rain_torrent_pieces_failed_total Number of pieces that failed hash check.
+# TYPE rain_torrent_pieces_failed_total counter
+rain_torrent_pieces_failed_total{id="` + tor.ID() + `",name="` + tor.Name() + `"} 0
+`
+	err = testutil.GatherAndCompare(r, strings.NewReader(expected), "rain_torrents", "rain_torrent_pieces_failed_total")
+	assert.Nil(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() == "rain_disk_write_latency_seconds" {
+			assert.Equal(t, 2.0, mf.Metric[0].Summary.GetSampleSum())
+			assert.Equal(t, uint64(1), mf.Metric[0].Summary.GetSampleCount())
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/ratelimit"
+)
+
+// Max number of clients to keep rate limit buckets for.
+// When the limit is reached, buckets of idle clients are dropped and new clients are rejected until there is room.
+const maxRPCRateLimitClients = 10000
+
+// Parameters bigger than this are not written to the audit log, e.g. contents of torrent files.
+const maxRPCAuditParamsSize = 1024
+
+// rpcClientIP returns the IP address of the client making the request.
+func rpcClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rpcClientID returns the identity of the client making the request for rate limiting and the audit log.
+// Clients are identified by the token in the "Authorization: Bearer" header if it is one of the configured tokens,
+// otherwise by their IP address. Tokens are hashed so they are not revealed in logs.
+func rpcClientID(r *http.Request, tokens map[string]struct{}) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if _, ok := tokens[token]; ok {
+			sum := sha256.Sum256([]byte(token))
+			return "token:" + hex.EncodeToString(sum[:4])
+		}
+	}
+	return rpcClientIP(r)
+}
+
+// isRPCReadOnly returns true if the RPC method does not change the state of the Session.
+func isRPCReadOnly(method string) bool {
+	return method == "Session.Version" ||
+		strings.HasPrefix(method, "Session.Get") ||
+		strings.HasPrefix(method, "Session.List")
+}
+
+type rpcRateLimiter struct {
+	rate    float64
+	burst   int64
+	m       sync.Mutex
+	buckets map[string]*ratelimit.Bucket
+}
+
+func newRPCRateLimiter(rate float64, burst int64) *rpcRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rpcRateLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*ratelimit.Bucket),
+	}
+}
+
+// Allow returns false if the client has exceeded its rate limit.
+func (l *rpcRateLimiter) Allow(client string) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxRPCRateLimitClients {
+			l.dropIdle()
+		}
+		if len(l.buckets) >= maxRPCRateLimitClients {
+			return false
+		}
+		b = ratelimit.NewBucketWithRate(l.rate, l.burst)
+		l.buckets[client] = b
+	}
+	return b.TakeAvailable(1) == 1
+}
+
+// dropIdle removes the buckets that are full. Clients of these buckets are not limited, so forgetting them is harmless.
+func (l *rpcRateLimiter) dropIdle() {
+	for client, b := range l.buckets {
+		if b.Available() >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// rpcAuditLog writes the calls that change the state of the Session to a file, one JSON object per line.
+type rpcAuditLog struct {
+	m sync.Mutex
+	f *os.File
+}
+
+type rpcAuditEntry struct {
+	Time   time.Time
+	Client string
+	Addr   string
+	Method string
+	Params json.RawMessage `json:",omitempty"`
+}
+
+func openRPCAuditLog(name string, perm os.FileMode) (*rpcAuditLog, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, perm&^0111)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcAuditLog{f: f}, nil
+}
+
+func (a *rpcAuditLog) Close() error {
+	return a.f.Close()
+}
+
+func (a *rpcAuditLog) write(e rpcAuditEntry) error {
+	if len(e.Params) > maxRPCAuditParamsSize {
+		e.Params = nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	a.m.Lock()
+	defer a.m.Unlock()
+	_, err = a.f.Write(b)
+	return err
+}
+
+// LogRequest writes the JSON-RPC calls in the request body to the audit log. The body is restored for the next handler.
+func (a *rpcAuditLog) LogRequest(client, addr string, r *http.Request) error {
+	b, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	type call struct {
+		Method string
+		Params json.RawMessage
+	}
+	var calls []call
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		err = json.Unmarshal(b, &calls)
+	} else {
+		calls = make([]call, 1)
+		err = json.Unmarshal(b, &calls[0])
+	}
+	if err != nil {
+		// Invalid requests are rejected by the RPC server.
+		return nil
+	}
+	now := time.Now().UTC()
+	for _, c := range calls {
+		if isRPCReadOnly(c.Method) {
+			continue
+		}
+		err = a.write(rpcAuditEntry{Time: now, Client: client, Addr: addr, Method: c.Method, Params: c.Params})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package torrent
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/rainrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRPCRateLimitAndAuditLog(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	s.config.RPCRateLimit = 0.001
+	s.config.RPCRateLimitBurst = 3
+	s.config.RPCTokens = []string{"secret", "other"}
+	srv := newRPCServer(s)
+	auditFile := filepath.Join(s.config.DataDir, "audit.log")
+	var err error
+	srv.audit, err = openRPCAuditLog(auditFile, s.config.FilePermissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.audit.Close()
+	ts := httptest.NewServer(srv.httpServer.Handler)
+	defer ts.Close()
+
+	clt := rainrpc.NewClient(ts.URL)
+	defer clt.Close()
+	clt.SetToken("secret")
+	other := rainrpc.NewClient(ts.URL)
+	defer other.Close()
+	other.SetToken("other")
+	forged := rainrpc.NewClient(ts.URL)
+	defer forged.Close()
+	forged.SetToken("forged")
+
+	// Each configured token has its own limit.
+	_, err = clt.ListTorrents()
+	assert.NoError(t, err)
+	err = clt.StopAllTorrents()
+	assert.NoError(t, err)
+	_, err = clt.ListTorrents()
+	assert.NoError(t, err)
+	_, err = clt.ListTorrents()
+	assert.Error(t, err)
+	_, err = other.ListTorrents()
+	assert.NoError(t, err)
+
+	// Limit is shared by all clients without a configured token on the same IP, whatever token they send.
+	err = forged.StopAllTorrents()
+	assert.NoError(t, err)
+	forged.SetToken("another")
+	_, err = forged.ListTorrents()
+	assert.NoError(t, err)
+	forged.SetToken("")
+	_, err = forged.ListTorrents()
+	assert.NoError(t, err)
+	forged.SetToken("forged")
+	_, err = forged.ListTorrents()
+	assert.Error(t, err)
+	_, err = other.ListTorrents()
+	assert.NoError(t, err)
+
+	// Only the calls that change the state of the session are logged.
+	b, err := os.ReadFile(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	assert.Len(t, lines, 2)
+	var e rpcAuditEntry
+	err = json.Unmarshal(lines[0], &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Session.StopAllTorrents", e.Method)
+	assert.True(t, strings.HasPrefix(e.Client, "token:"))
+	assert.NotContains(t, e.Client, "secret")
+	assert.Equal(t, "127.0.0.1", e.Addr)
+
+	// Unknown tokens are not trusted.
+	err = json.Unmarshal(lines[1], &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "127.0.0.1", e.Client)
+}
+
+func TestRPCRateLimiterDropsIdleClients(t *testing.T) {
+	l := newRPCRateLimiter(0.001, 1)
+	for i := 0; i < maxRPCRateLimitClients; i++ {
+		assert.True(t, l.Allow(strconv.Itoa(i)))
+	}
+	// All buckets are in use, so existing clients are not forgotten to make room for a new one.
+	assert.False(t, l.Allow("new"))
+	assert.False(t, l.Allow("0"))
+
+	// Buckets are refilled after some time, then these clients are forgotten.
+	l = newRPCRateLimiter(1000, 1)
+	for i := 0; i < maxRPCRateLimitClients; i++ {
+		assert.True(t, l.Allow(strconv.Itoa(i)))
+	}
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, l.Allow("new"))
+	assert.Len(t, l.buckets, 1)
+}
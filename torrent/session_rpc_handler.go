@@ -12,12 +12,14 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/cenkalti/rain/internal/jsonrpc2"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
 	"github.com/cenkalti/rain/internal/rpctypes"
-	"github.com/powerman/rpc-codec/jsonrpc2"
+	"go.etcd.io/bbolt"
 )
 
 var errTorrentNotFound = jsonrpc2.NewError(1, "torrent not found")
@@ -32,7 +34,12 @@ func (h *rpcHandler) Version(args struct{}, reply *string) error {
 }
 
 func (h *rpcHandler) ListTorrents(args *rpctypes.ListTorrentsRequest, reply *rpctypes.ListTorrentsResponse) error {
-	torrents := h.session.ListTorrents()
+	var torrents []*Torrent
+	if args.Label != "" {
+		torrents = h.session.ListTorrentsByLabel(args.Label)
+	} else {
+		torrents = h.session.ListTorrents()
+	}
 	reply.Torrents = make([]rpctypes.Torrent, 0, len(torrents))
 	for _, t := range torrents {
 		reply.Torrents = append(reply.Torrents, newTorrent(t))
@@ -47,6 +54,10 @@ func (h *rpcHandler) AddTorrent(args *rpctypes.AddTorrentRequest, reply *rpctype
 		ID:                args.AddTorrentOptions.ID,
 		StopAfterDownload: args.StopAfterDownload,
 		StopAfterMetadata: args.StopAfterMetadata,
+		PeerAllowlist:     args.PeerAllowlist,
+		Dest:              args.Dest,
+		Labels:            args.Labels,
+		UploadSlots:       args.UploadSlots,
 	}
 	t, err := h.session.AddTorrent(r, opt)
 	var e *InputError
@@ -66,6 +77,10 @@ func (h *rpcHandler) AddURI(args *rpctypes.AddURIRequest, reply *rpctypes.AddURI
 		ID:                args.AddTorrentOptions.ID,
 		StopAfterDownload: args.StopAfterDownload,
 		StopAfterMetadata: args.StopAfterMetadata,
+		PeerAllowlist:     args.PeerAllowlist,
+		Dest:              args.Dest,
+		Labels:            args.Labels,
+		UploadSlots:       args.UploadSlots,
 	}
 	t, err := h.session.AddURI(args.URI, opt)
 	var e *InputError
@@ -79,6 +94,31 @@ func (h *rpcHandler) AddURI(args *rpctypes.AddURIRequest, reply *rpctypes.AddURI
 	return nil
 }
 
+func (h *rpcHandler) AddInfoHash(args *rpctypes.AddInfoHashRequest, reply *rpctypes.AddInfoHashResponse) error {
+	b, err := hex.DecodeString(args.InfoHash)
+	if err != nil || len(b) != 20 {
+		return jsonrpc2.NewError(2, "invalid info hash")
+	}
+	var ih InfoHash
+	copy(ih[:], b)
+	opt := &AddTorrentOptions{
+		Stopped:           args.AddTorrentOptions.Stopped,
+		ID:                args.AddTorrentOptions.ID,
+		StopAfterDownload: args.StopAfterDownload,
+		StopAfterMetadata: args.StopAfterMetadata,
+		PeerAllowlist:     args.PeerAllowlist,
+		Dest:              args.Dest,
+		Labels:            args.Labels,
+		UploadSlots:       args.UploadSlots,
+	}
+	t, err := h.session.AddInfoHash(ih, opt)
+	if err != nil {
+		return err
+	}
+	reply.Torrent = newTorrent(t)
+	return nil
+}
+
 func newTorrent(t *Torrent) rpctypes.Torrent {
 	return rpctypes.Torrent{
 		ID:       t.ID(),
@@ -86,6 +126,7 @@ func newTorrent(t *Torrent) rpctypes.Torrent {
 		InfoHash: t.InfoHash().String(),
 		Port:     t.Port(),
 		AddedAt:  rpctypes.Time{Time: t.AddedAt()},
+		Labels:   t.Labels(),
 	}
 }
 
@@ -120,6 +161,10 @@ func (h *rpcHandler) CleanDatabase(args *rpctypes.CleanDatabaseRequest, reply *r
 	return h.session.CleanDatabase()
 }
 
+func (h *rpcHandler) ReloadBlocklist(args *rpctypes.ReloadBlocklistRequest, reply *rpctypes.ReloadBlocklistResponse) error {
+	return h.session.ReloadBlocklist()
+}
+
 func (h *rpcHandler) GetSessionStats(args *rpctypes.GetSessionStatsRequest, reply *rpctypes.GetSessionStatsResponse) error {
 	s := h.session.Stats()
 	reply.Stats = rpctypes.SessionStats{
@@ -128,12 +173,16 @@ func (h *rpcHandler) GetSessionStats(args *rpctypes.GetSessionStatsRequest, repl
 		Peers:          s.Peers,
 		PortsAvailable: s.PortsAvailable,
 
-		BlockListRules:   s.BlockListRules,
-		BlockListRecency: int(s.BlockListRecency / time.Second),
+		BlockListRules:            s.BlockListRules,
+		BlockListRecency:          int(s.BlockListRecency / time.Second),
+		BlockListRejectedIncoming: s.BlockListRejectedIncoming,
+		BlockListRejectedOutgoing: s.BlockListRejectedOutgoing,
 
 		ReadCacheObjects:     s.ReadCacheObjects,
 		ReadCacheSize:        s.ReadCacheSize,
 		ReadCacheUtilization: s.ReadCacheUtilization,
+		ReadCacheHits:        s.ReadCacheHits,
+		ReadCacheMisses:      s.ReadCacheMisses,
 
 		ReadsPerSecond: s.ReadsPerSecond,
 		ReadsActive:    s.ReadsActive,
@@ -167,47 +216,66 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 	}
 	s := t.Stats()
 	reply.Stats = rpctypes.Stats{
-		InfoHash: s.InfoHash.String(),
-		Port:     s.Port,
-		Status:   s.Status.String(),
+		Version:      s.Version,
+		Time:         rpctypes.Time{Time: s.Time},
+		InfoHash:     s.InfoHash.String(),
+		Port:         s.Port,
+		Status:       s.Status.String(),
+		Paused:       s.Paused,
+		Boosted:      s.Boosted,
+		TransferMode: s.TransferMode.String(),
 		Pieces: struct {
 			Checked   uint32
 			Have      uint32
 			Missing   uint32
 			Available uint32
 			Total     uint32
+			Failed    uint32
 		}{
 			Checked:   s.Pieces.Checked,
 			Have:      s.Pieces.Have,
 			Missing:   s.Pieces.Missing,
 			Available: s.Pieces.Available,
 			Total:     s.Pieces.Total,
+			Failed:    s.Pieces.Failed,
 		},
 		Bytes: struct {
-			Total      int64
-			Allocated  int64
-			Completed  int64
-			Incomplete int64
-			Downloaded int64
-			Uploaded   int64
-			Wasted     int64
+			Total            int64
+			Wanted           int64
+			Allocated        int64
+			Completed        int64
+			Incomplete       int64
+			WantedIncomplete int64
+			Downloaded       int64
+			Uploaded         int64
+			Wasted           int64
 		}{
-			Total:      s.Bytes.Total,
-			Allocated:  s.Bytes.Allocated,
-			Completed:  s.Bytes.Completed,
-			Incomplete: s.Bytes.Incomplete,
-			Downloaded: s.Bytes.Downloaded,
-			Uploaded:   s.Bytes.Uploaded,
-			Wasted:     s.Bytes.Wasted,
+			Total:            s.Bytes.Total,
+			Wanted:           s.Bytes.Wanted,
+			Allocated:        s.Bytes.Allocated,
+			Completed:        s.Bytes.Completed,
+			Incomplete:       s.Bytes.Incomplete,
+			WantedIncomplete: s.Bytes.WantedIncomplete,
+			Downloaded:       s.Bytes.Downloaded,
+			Uploaded:         s.Bytes.Uploaded,
+			Wasted:           s.Bytes.Wasted,
 		},
 		Peers: struct {
-			Total    int
-			Incoming int
-			Outgoing int
+			Total       int
+			Incoming    int
+			Outgoing    int
+			Interested  int
+			Unchoked    int
+			Uploading   int
+			UploadSlots int
 		}{
-			Total:    s.Peers.Total,
-			Incoming: s.Peers.Incoming,
-			Outgoing: s.Peers.Outgoing,
+			Total:       s.Peers.Total,
+			Incoming:    s.Peers.Incoming,
+			Outgoing:    s.Peers.Outgoing,
+			Interested:  s.Peers.Interested,
+			Unchoked:    s.Peers.Unchoked,
+			Uploading:   s.Peers.Uploading,
+			UploadSlots: s.Peers.UploadSlots,
 		},
 		Handshakes: struct {
 			Total    int
@@ -223,31 +291,39 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 			Tracker int
 			DHT     int
 			PEX     int
+			LSD     int
 		}{
 			Total:   s.Addresses.Total,
 			Tracker: s.Addresses.Tracker,
 			DHT:     s.Addresses.DHT,
 			PEX:     s.Addresses.PEX,
+			LSD:     s.Addresses.LSD,
 		},
 		Downloads: struct {
 			Total   int
 			Running int
 			Snubbed int
 			Choked  int
+			Endgame bool
 		}{
 			Total:   s.Downloads.Total,
 			Running: s.Downloads.Running,
 			Snubbed: s.Downloads.Snubbed,
 			Choked:  s.Downloads.Choked,
+			Endgame: s.Downloads.Endgame,
 		},
 		MetadataDownloads: struct {
-			Total   int
-			Snubbed int
-			Running int
+			Total      int
+			Snubbed    int
+			Running    int
+			Downloaded int64
+			Size       int64
 		}{
-			Total:   s.MetadataDownloads.Total,
-			Snubbed: s.MetadataDownloads.Snubbed,
-			Running: s.MetadataDownloads.Running,
+			Total:      s.MetadataDownloads.Total,
+			Snubbed:    s.MetadataDownloads.Snubbed,
+			Running:    s.MetadataDownloads.Running,
+			Downloaded: s.MetadataDownloads.Downloaded,
+			Size:       s.MetadataDownloads.Size,
 		},
 		Name:        s.Name,
 		Private:     s.Private,
@@ -270,6 +346,10 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 	} else {
 		reply.Stats.ETA = -1
 	}
+	reply.Stats.WantedRange.File = s.WantedRange.File
+	reply.Stats.WantedRange.Offset = s.WantedRange.Offset
+	reply.Stats.WantedRange.Length = s.WantedRange.Length
+	reply.Stats.WantedRange.Completed = s.WantedRange.Completed
 	return nil
 }
 
@@ -282,17 +362,21 @@ func (h *rpcHandler) GetTorrentTrackers(args *rpctypes.GetTorrentTrackersRequest
 	reply.Trackers = make([]rpctypes.Tracker, len(trackers))
 	for i, t := range trackers {
 		reply.Trackers[i] = rpctypes.Tracker{
-			URL:      t.URL,
-			Status:   trackerStatusToString(t.Status),
-			Leechers: t.Leechers,
-			Seeders:  t.Seeders,
-			Warning:  t.Warning,
+			URL:           t.URL,
+			Status:        trackerStatusToString(t.Status),
+			Leechers:      t.Leechers,
+			Seeders:       t.Seeders,
+			Warning:       t.Warning,
+			CompletedSent: t.CompletedSent,
 		}
 		if t.Error != nil {
 			reply.Trackers[i].Error = t.Error.Error()
 			reply.Trackers[i].ErrorInternal = t.Error.err.ErrorWithType()
 			reply.Trackers[i].ErrorUnknown = t.Error.Unknown()
 		}
+		if !t.WarningAt.IsZero() {
+			reply.Trackers[i].WarningAt = rpctypes.Time{Time: t.WarningAt}
+		}
 		if !t.LastAnnounce.IsZero() {
 			reply.Trackers[i].LastAnnounce = rpctypes.Time{Time: t.LastAnnounce}
 		}
@@ -323,6 +407,8 @@ func (h *rpcHandler) GetTorrentPeers(args *rpctypes.GetTorrentPeersRequest, repl
 			source = "INCOMING"
 		case SourceManual:
 			source = "MANUAL"
+		case SourceLSD:
+			source = "LSD"
 		default:
 			panic("unhandled peer source")
 		}
@@ -339,6 +425,7 @@ func (h *rpcHandler) GetTorrentPeers(args *rpctypes.GetTorrentPeersRequest, repl
 			PeerChoking:        p.PeerChoking,
 			OptimisticUnchoked: p.OptimisticUnchoked,
 			Snubbed:            p.Snubbed,
+			RequestTimeouts:    p.RequestTimeouts,
 			EncryptedHandshake: p.EncryptedHandshake,
 			EncryptedStream:    p.EncryptedStream,
 			DownloadSpeed:      p.DownloadSpeed,
@@ -367,6 +454,52 @@ func (h *rpcHandler) GetTorrentWebseeds(args *rpctypes.GetTorrentWebseedsRequest
 	return nil
 }
 
+func (h *rpcHandler) GetTorrentFiles(args *rpctypes.GetTorrentFilesRequest, reply *rpctypes.GetTorrentFilesResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	files, err := t.Files()
+	if err != nil {
+		return err
+	}
+	reply.Files = make([]rpctypes.File, len(files))
+	for i, f := range files {
+		reply.Files[i] = rpctypes.File{
+			Path:      f.Path,
+			Length:    f.Length,
+			Padding:   f.Padding,
+			Priority:  int(f.Priority),
+			Completed: f.Completed,
+		}
+	}
+	return nil
+}
+
+func (h *rpcHandler) SetFilePriorities(args *rpctypes.SetFilePrioritiesRequest, reply *rpctypes.SetFilePrioritiesResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.SetFilePriorities(filePrioritiesFromInts(args.Priorities))
+}
+
+func (h *rpcHandler) SetPiecePriority(args *rpctypes.SetPiecePriorityRequest, reply *rpctypes.SetPiecePriorityResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.SetPiecePriority(args.Index, PiecePriority(args.Priority))
+}
+
+func (h *rpcHandler) SetByteRangeWanted(args *rpctypes.SetByteRangeWantedRequest, reply *rpctypes.SetByteRangeWantedResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.SetByteRangeWanted(args.File, args.Offset, args.Length)
+}
+
 func (h *rpcHandler) StartTorrent(args *rpctypes.StartTorrentRequest, reply *rpctypes.StartTorrentResponse) error {
 	t := h.session.GetTorrent(args.ID)
 	if t == nil {
@@ -392,6 +525,41 @@ func (h *rpcHandler) AnnounceTorrent(args *rpctypes.AnnounceTorrentRequest, repl
 	return nil
 }
 
+func (h *rpcHandler) PauseTorrent(args *rpctypes.PauseTorrentRequest, reply *rpctypes.PauseTorrentResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.Pause()
+}
+
+func (h *rpcHandler) ResumeTorrent(args *rpctypes.ResumeTorrentRequest, reply *rpctypes.ResumeTorrentResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.Resume()
+}
+
+func (h *rpcHandler) SetTransferMode(args *rpctypes.SetTransferModeRequest, reply *rpctypes.SetTransferModeResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	var mode TransferMode
+	switch args.Mode {
+	case "normal":
+		mode = TransferModeNormal
+	case "upload-only":
+		mode = TransferModeUploadOnly
+	case "download-only":
+		mode = TransferModeDownloadOnly
+	default:
+		return errInvalidTransferMode
+	}
+	return t.SetTransferMode(mode)
+}
+
 func (h *rpcHandler) VerifyTorrent(args *rpctypes.VerifyTorrentRequest, reply *rpctypes.VerifyTorrentResponse) error {
 	t := h.session.GetTorrent(args.ID)
 	if t == nil {
@@ -400,6 +568,57 @@ func (h *rpcHandler) VerifyTorrent(args *rpctypes.VerifyTorrentRequest, reply *r
 	return t.Verify()
 }
 
+func (h *rpcHandler) MoveTorrentData(args *rpctypes.MoveTorrentDataRequest, reply *rpctypes.MoveTorrentDataResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	err := t.MoveData(args.Dir)
+	var e *InputError
+	if errors.As(err, &e) {
+		return jsonrpc2.NewError(2, e.Error())
+	}
+	return err
+}
+
+func (h *rpcHandler) SetTorrentLabels(args *rpctypes.SetTorrentLabelsRequest, reply *rpctypes.SetTorrentLabelsResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.SetLabels(args.Labels)
+}
+
+func (h *rpcHandler) SetTorrentUploadSlots(args *rpctypes.SetTorrentUploadSlotsRequest, reply *rpctypes.SetTorrentUploadSlotsResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	err := t.SetUploadSlots(args.UploadSlots)
+	if err == errInvalidUploadSlots {
+		return jsonrpc2.NewError(2, err.Error())
+	}
+	return err
+}
+
+func (h *rpcHandler) VerifyTorrentData(args *rpctypes.VerifyTorrentDataRequest, reply *rpctypes.VerifyTorrentDataResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.VerifyData()
+}
+
+func (h *rpcHandler) ScanOrphanedData(args *rpctypes.ScanOrphanedDataRequest, reply *rpctypes.ScanOrphanedDataResponse) error {
+	var err error
+	reply.Paths, err = h.session.ScanOrphanedData(args.Remove)
+	var e *InputError
+	if errors.As(err, &e) {
+		return jsonrpc2.NewError(2, e.Error())
+	}
+	return err
+}
+
 func (h *rpcHandler) StartAllTorrents(args *rpctypes.StartAllTorrentsRequest, reply *rpctypes.StartAllTorrentsResponse) error {
 	return h.session.StartAll()
 }
@@ -408,6 +627,21 @@ func (h *rpcHandler) StopAllTorrents(args *rpctypes.StopAllTorrentsRequest, repl
 	return h.session.StopAll()
 }
 
+func (h *rpcHandler) SetSpeedLimit(args *rpctypes.SetSpeedLimitRequest, reply *rpctypes.SetSpeedLimitResponse) error {
+	if args.ID == "" {
+		h.session.SetDownloadLimit(args.Download)
+		h.session.SetUploadLimit(args.Upload)
+		return nil
+	}
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	t.SetDownloadLimit(args.Download)
+	t.SetUploadLimit(args.Upload)
+	return nil
+}
+
 func (h *rpcHandler) AddPeer(args *rpctypes.AddPeerRequest, reply *rpctypes.AddPeerResponse) error {
 	t := h.session.GetTorrent(args.ID)
 	if t == nil {
@@ -509,7 +743,21 @@ func (h *rpcHandler) handleMoveTorrent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	s.Port = port
+	// Files are saved into the data directory of this Session.
+	s.Dest = ""
 	spec := &s
+	version := spec.Version
+	if version == 0 {
+		version = boltdbresumer.LatestVersion
+	}
+	// Received files are removed if the torrent cannot be loaded, unless they existed before.
+	newData := h.session.newDataPath(id, "", h.session.infoName(spec.Info, version))
+	var loaded bool
+	defer func() {
+		if !loaded {
+			_ = h.session.removeData(newData)
+		}
+	}()
 	// case "data":
 	p, err = mr.NextPart()
 	if err != nil {
@@ -536,9 +784,16 @@ func (h *rpcHandler) handleMoveTorrent(w http.ResponseWriter, r *http.Request) {
 	t, started, err := h.session.loadExistingTorrent(id)
 	if err != nil {
 		h.session.log.Error(err)
+		err2 := h.session.db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(torrentsBucket).DeleteBucket([]byte(id))
+		})
+		if err2 != nil {
+			h.session.log.Error(err2)
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	loaded = true
 	if started {
 		err = t.Start()
 		if err != nil {
@@ -581,3 +836,69 @@ func readData(r io.Reader, dir string, perm fs.FileMode) error {
 	}
 	return nil
 }
+
+// handleExport writes the archive of Session.Export to the response.
+func (h *rpcHandler) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := h.session.Export(w)
+	if err != nil {
+		h.session.log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleImport adds the torrents in the archive in request body with Session.Import.
+func (h *rpcHandler) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	err := h.session.Import(r.Body)
+	var e *InputError
+	if errors.As(err, &e) {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.session.log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleStream serves the data of a torrent over HTTP. Range requests are supported.
+// Requests block until the requested bytes are downloaded.
+// Query parameters are "id" for torrent ID and optional "file" for the index of the file in torrent.
+func (h *rpcHandler) handleStream(w http.ResponseWriter, r *http.Request) {
+	t := h.session.GetTorrent(r.URL.Query().Get("id"))
+	if t == nil {
+		http.Error(w, "torrent not found", http.StatusNotFound)
+		return
+	}
+	var rd *Reader
+	var err error
+	if s := r.URL.Query().Get("file"); s != "" {
+		index, err2 := strconv.Atoi(s)
+		if err2 != nil {
+			http.Error(w, "invalid file index", http.StatusBadRequest)
+			return
+		}
+		rd, err = t.NewFileReader(index)
+	} else {
+		rd, err = t.NewReader()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer rd.Close()
+	go func() {
+		// Unblock pending reads when the client goes away.
+		<-r.Context().Done()
+		rd.Close()
+	}()
+	http.ServeContent(w, r, rd.Name(), t.AddedAt(), rd)
+}
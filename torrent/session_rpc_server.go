@@ -9,13 +9,20 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/cenkalti/rain/internal/handoff"
+	"github.com/cenkalti/rain/internal/jsonrpc2"
 	"github.com/cenkalti/rain/internal/logger"
-	"github.com/powerman/rpc-codec/jsonrpc2"
+	"github.com/mitchellh/go-homedir"
 )
 
 type rpcServer struct {
 	rpcServer  *rpc.Server
 	httpServer http.Server
+	limiter    *rpcRateLimiter
+	audit      *rpcAuditLog
+	tokens     map[string]struct{}
+	listeners  *handoff.Listeners
+	config     *Config
 	log        logger.Logger
 }
 
@@ -26,22 +33,76 @@ func newRPCServer(ses *Session) *rpcServer {
 
 	mux := http.NewServeMux()
 	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/metrics", ses.MetricsHandler())
 	mux.HandleFunc("/move-torrent", h.handleMoveTorrent)
+	mux.HandleFunc("/stream", h.handleStream)
+	mux.HandleFunc("/export", h.handleExport)
+	mux.HandleFunc("/import", h.handleImport)
 	mux.Handle("/", jsonrpc2.HTTPHandler(srv))
 
-	return &rpcServer{
+	s := &rpcServer{
 		rpcServer: srv,
-		httpServer: http.Server{
-			Handler: mux,
-		},
-		log: logger.New("rpc server"),
+		listeners: ses.listeners,
+		config:    &ses.config,
+		log:       logger.New("rpc server"),
+		tokens:    make(map[string]struct{}, len(ses.config.RPCTokens)),
 	}
+	for _, token := range ses.config.RPCTokens {
+		s.tokens[token] = struct{}{}
+	}
+	if ses.config.RPCRateLimit > 0 {
+		s.limiter = newRPCRateLimiter(ses.config.RPCRateLimit, ses.config.RPCRateLimitBurst)
+	}
+	s.httpServer.Handler = s.middleware(mux)
+	return s
+}
+
+// middleware applies the rate limits and writes the calls to the audit log before passing the request to the next handler.
+func (s *rpcServer) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Clients with a configured token have their own limit.
+		// Other clients are limited per IP address because they can send any token.
+		addr := rpcClientIP(r)
+		client := rpcClientID(r, s.tokens)
+		if s.limiter != nil && !s.limiter.Allow(client) {
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		if s.audit != nil {
+			var err error
+			switch r.URL.Path {
+			case "/":
+				err = s.audit.LogRequest(client, addr, r)
+			case "/move-torrent", "/export", "/import":
+				err = s.audit.write(rpcAuditEntry{Time: time.Now().UTC(), Client: client, Addr: addr, Method: r.URL.Path})
+			}
+			if err != nil {
+				s.log.Errorln("cannot write audit log:", err)
+				http.Error(w, "cannot write audit log", http.StatusInternalServerError)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (s *rpcServer) Start(host string, port int) error {
+	if s.config.RPCAuditLogFile != "" {
+		name, err := homedir.Expand(s.config.RPCAuditLogFile)
+		if err != nil {
+			return err
+		}
+		s.audit, err = openRPCAuditLog(name, s.config.FilePermissions)
+		if err != nil {
+			return err
+		}
+	}
 	addr := net.JoinHostPort(host, strconv.Itoa(port))
-	listener, err := net.Listen("tcp", addr)
+	listener, err := s.listeners.Listen(context.Background(), &net.ListenConfig{}, "tcp", addr)
 	if err != nil {
+		if s.audit != nil {
+			s.audit.Close()
+		}
 		return err
 	}
 
@@ -61,5 +122,11 @@ func (s *rpcServer) Start(host string, port int) error {
 func (s *rpcServer) Stop(timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	return s.httpServer.Shutdown(ctx)
+	err := s.httpServer.Shutdown(ctx)
+	if s.audit != nil {
+		if err2 := s.audit.Close(); err == nil {
+			err = err2
+		}
+	}
+	return err
 }
@@ -23,6 +23,10 @@ type SessionStats struct {
 	BlockListRules int
 	// Time elapsed after the last successful update of blocklist.
 	BlockListRecency time.Duration
+	// Number of incoming connections rejected because the peer IP is in blocklist.
+	BlockListRejectedIncoming int64
+	// Number of peer addresses from trackers, DHT and PEX that are not dialed because the IP is in blocklist.
+	BlockListRejectedOutgoing int64
 
 	// Number of objects in piece read cache.
 	// Each object is a block whose size is defined in Config.ReadCacheBlockSize.
@@ -31,6 +35,10 @@ type SessionStats struct {
 	ReadCacheSize int64
 	// Hit ratio of read cache.
 	ReadCacheUtilization int
+	// Number of block reads served from read cache since the session is created.
+	ReadCacheHits int64
+	// Number of block reads that are not found in read cache and loaded from disk.
+	ReadCacheMisses int64
 
 	// Number of reads per second from disk.
 	ReadsPerSecond int
@@ -83,12 +91,16 @@ func (s *Session) Stats() SessionStats {
 		Peers:          int(s.metrics.Peers.Count()),
 		PortsAvailable: int(s.metrics.PortsAvailable.Value()),
 
-		BlockListRules:   int(s.metrics.BlockListRules.Value()),
-		BlockListRecency: time.Duration(s.metrics.BlockListRecency.Value()) * time.Second,
+		BlockListRules:            int(s.metrics.BlockListRules.Value()),
+		BlockListRecency:          time.Duration(s.metrics.BlockListRecency.Value()) * time.Second,
+		BlockListRejectedIncoming: s.metrics.BlockListRejectedIncoming.Count(),
+		BlockListRejectedOutgoing: s.metrics.BlockListRejectedOutgoing.Count(),
 
 		ReadCacheObjects:     int(s.metrics.ReadCacheObjects.Value()),
 		ReadCacheSize:        s.metrics.ReadCacheSize.Value(),
 		ReadCacheUtilization: int(s.metrics.ReadCacheUtilization.Value()),
+		ReadCacheHits:        s.metrics.ReadCacheHits.Value(),
+		ReadCacheMisses:      s.metrics.ReadCacheMisses.Value(),
 
 		ReadsPerSecond: int(s.metrics.ReadsPerSecond.Rate1()),
 		ReadsActive:    int(s.metrics.ReadsActive.Value()),
@@ -130,6 +142,7 @@ func (s *Session) updateStatsLoop() {
 func (s *Session) updateStats() {
 	s.mTorrents.RLock()
 	defer s.mTorrents.RUnlock()
+	start := time.Now()
 	err := s.db.Update(func(tx *bbolt.Tx) error {
 		mb := tx.Bucket(torrentsBucket)
 		for _, t := range s.torrents {
@@ -146,6 +159,7 @@ func (s *Session) updateStats() {
 		}
 		return nil
 	})
+	s.metrics.ResumeWriteLatency.UpdateSince(start)
 	for _, t := range s.torrents {
 		t.torrent.mBitfield.RUnlock()
 	}
@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -55,7 +56,8 @@ func (t *Torrent) AddedAt() time.Time {
 	return t.torrent.addedAt
 }
 
-// Stats returns statistics about the torrent.
+// Stats returns a snapshot of statistics about the torrent.
+// The snapshot may be taken up to Config.StatsCacheDuration ago. See Stats.Time.
 func (t *Torrent) Stats() Stats {
 	return t.torrent.Stats()
 }
@@ -150,11 +152,24 @@ func (t *Torrent) AddTracker(uri string) error {
 	return nil
 }
 
+// closed returns true if the torrent is removed from the Session or the Session is closed.
+func (t *Torrent) closed() bool {
+	select {
+	case <-t.torrent.closeC:
+		return true
+	default:
+		return false
+	}
+}
+
 // Start downloading the torrent. If all pieces are completed, starts seeding them.
 func (t *Torrent) Start() error {
+	if t.closed() {
+		return ErrTorrentClosed
+	}
 	err := t.torrent.session.resumer.WriteStarted(t.torrent.id, true)
 	if err != nil {
-		return err
+		return &ErrResumeWrite{TorrentID: t.torrent.id, err: err}
 	}
 	t.torrent.Start()
 	return nil
@@ -164,14 +179,204 @@ func (t *Torrent) Start() error {
 // During Stopping state, a stop event sent to trackers with a timeout.
 // At most 5 seconds later, the torrent switches into Stopped state.
 func (t *Torrent) Stop() error {
+	if t.closed() {
+		return ErrTorrentClosed
+	}
 	err := t.torrent.session.resumer.WriteStarted(t.torrent.id, false)
 	if err != nil {
-		return err
+		return &ErrResumeWrite{TorrentID: t.torrent.id, err: err}
 	}
 	t.torrent.Stop()
 	return nil
 }
 
+// SetDownloadLimit sets the download speed limit of the torrent in bytes per second. Zero means unlimited.
+// The global limit of the Session is still applied.
+func (t *Torrent) SetDownloadLimit(bytesPerSec int64) {
+	t.torrent.bucketDownload.SetRate(bytesPerSec)
+}
+
+// SetUploadLimit sets the upload speed limit of the torrent in bytes per second. Zero means unlimited.
+// The global limit of the Session is still applied.
+func (t *Torrent) SetUploadLimit(bytesPerSec int64) {
+	t.torrent.bucketUpload.SetRate(bytesPerSec)
+}
+
+// DownloadLimit returns the download speed limit of the torrent in bytes per second. Zero means unlimited.
+func (t *Torrent) DownloadLimit() int64 {
+	return t.torrent.bucketDownload.Rate()
+}
+
+// UploadLimit returns the upload speed limit of the torrent in bytes per second. Zero means unlimited.
+func (t *Torrent) UploadLimit() int64 {
+	return t.torrent.bucketUpload.Rate()
+}
+
+// Pause the torrent. Peer connections and announces to trackers are kept alive
+// but no data is downloaded or uploaded until Resume is called.
+// Unlike Stop, the pause state is kept when the torrent is stopped and started again.
+func (t *Torrent) Pause() error {
+	err := t.torrent.session.resumer.WritePaused(t.torrent.id, true)
+	if err != nil {
+		return err
+	}
+	t.torrent.Pause()
+	return nil
+}
+
+// Resume downloading and uploading of a paused torrent.
+func (t *Torrent) Resume() error {
+	err := t.torrent.session.resumer.WritePaused(t.torrent.id, false)
+	if err != nil {
+		return err
+	}
+	t.torrent.Resume()
+	return nil
+}
+
+// SetTransferMode restricts the direction of data transfer of the torrent.
+// In TransferModeUploadOnly mode, no data is downloaded and only the pieces that are already downloaded are uploaded to peers.
+// In TransferModeDownloadOnly mode, no data is uploaded to peers.
+// Like the pause state, the transfer mode is kept when the torrent is stopped and started again.
+func (t *Torrent) SetTransferMode(mode TransferMode) error {
+	if mode < TransferModeNormal || mode > TransferModeDownloadOnly {
+		return errInvalidTransferMode
+	}
+	err := t.torrent.session.resumer.WriteTransferMode(t.torrent.id, int(mode))
+	if err != nil {
+		return err
+	}
+	t.torrent.SetTransferMode(mode)
+	return nil
+}
+
+// SetSeedLimits sets the limits for stopping or removing the torrent after seeding.
+// Nil value means the limits in Config are used.
+func (t *Torrent) SetSeedLimits(limits *SeedLimits) error {
+	if limits != nil {
+		err := limits.validate()
+		if err != nil {
+			return err
+		}
+		l := *limits
+		limits = &l
+	}
+	err := t.torrent.session.resumer.WriteSeedLimits(t.torrent.id, seedLimitsToSpec(limits))
+	if err != nil {
+		return err
+	}
+	t.torrent.SetSeedLimits(limits)
+	return nil
+}
+
+// SetUploadSlots sets the number of peers unchoked for uploading.
+// Zero value means Config.UnchokedPeers is used. Optimistic unchokes are not affected.
+func (t *Torrent) SetUploadSlots(n int) error {
+	if n < 0 {
+		return errInvalidUploadSlots
+	}
+	err := t.torrent.session.resumer.WriteUploadSlots(t.torrent.id, n)
+	if err != nil {
+		return err
+	}
+	t.torrent.SetUploadSlots(n)
+	return nil
+}
+
+// Labels returns the labels of the torrent.
+func (t *Torrent) Labels() []string {
+	return t.torrent.Labels()
+}
+
+// SetLabels replaces the labels of the torrent.
+// Surrounding spaces are trimmed, empty and duplicate labels are ignored.
+func (t *Torrent) SetLabels(labels []string) error {
+	labels = normalizeLabels(labels)
+	err := t.torrent.session.resumer.WriteLabels(t.torrent.id, labels)
+	if err != nil {
+		return err
+	}
+	t.torrent.setLabels(labels)
+	return nil
+}
+
+// MoveData moves the files of the torrent into dir, e.g. to move completed downloads off a scratch disk.
+// A running torrent is stopped while the files are moved and started again after the move.
+// Files are copied if they cannot be renamed, e.g. when dir is on another filesystem.
+// The new location is saved, so the torrent uses dir after the Session is restarted.
+// Files that exist in dir are not overwritten. An error is returned and no file is moved in that case.
+func (t *Torrent) MoveData(dir string) error {
+	if dir == "" {
+		return newInputError(errors.New("empty directory"))
+	}
+	sto, err := t.torrent.session.newStorage(t.torrent.id, dir, nil)
+	if err != nil {
+		return err
+	}
+	return t.torrent.MoveData(dir, sto)
+}
+
+// SetSequential enables or disables sequential download mode.
+// In sequential mode, pieces are downloaded in order instead of rarest first.
+func (t *Torrent) SetSequential(value bool) {
+	t.torrent.SetSequential(value)
+}
+
+// SetPiecePriority sets the download priority of the piece at index.
+// Returns error if the metadata of the torrent is not downloaded yet.
+//
+// Priority of a piece overrides the priorities of the files that the piece belongs to,
+// so a piece of a skipped file can be downloaded and a piece of a wanted file can be skipped.
+// Setting the priority to PiecePriorityNormal removes the override.
+// Pieces in the readahead window of a Reader are always downloaded first regardless of their priority.
+// Piece priorities are not saved and must be set again after the session is restarted.
+func (t *Torrent) SetPiecePriority(index uint32, priority PiecePriority) error {
+	return t.torrent.SetPiecePriority(index, priority)
+}
+
+// SetByteRangeWanted downloads only the pieces containing length bytes at offset in the file at index,
+// e.g. for previewing an archive or extracting a single member from a large file.
+// Returns error if the metadata of the torrent is not downloaded yet.
+//
+// The range replaces the priorities of files, so the range can be in a skipped file.
+// The torrent is considered complete when all pieces of the range are downloaded. Completion of the range is reported in Stats.
+// Setting a zero length removes the range and the torrent is downloaded according to file priorities again.
+// The range is not saved and must be set again after the session is restarted.
+func (t *Torrent) SetByteRangeWanted(index int, offset, length int64) error {
+	return t.torrent.SetByteRangeWanted(index, offset, length)
+}
+
+// Files returns the files in torrent. Returns error if the metadata of the torrent is not downloaded yet.
+func (t *Torrent) Files() ([]File, error) {
+	return t.torrent.Files()
+}
+
+// SetFilePriorities sets the download priorities of files in torrent.
+// Length of priorities must be equal to the number of files returned by Files.
+// Files with FilePrioritySkip priority are not downloaded and the torrent is considered complete when all other files are downloaded.
+func (t *Torrent) SetFilePriorities(priorities []FilePriority) error {
+	err := t.torrent.SetFilePriorities(priorities)
+	if err != nil {
+		return err
+	}
+	return t.torrent.session.resumer.WriteFilePriorities(t.torrent.id, filePrioritiesToInts(priorities))
+}
+
+// NewReader returns a new Reader for reading the data of all files in torrent as a single stream.
+// Reads block until the requested data is downloaded and verified.
+// Returns error if the metadata of the torrent is not downloaded yet.
+func (t *Torrent) NewReader() (*Reader, error) {
+	return t.torrent.NewReader(-1)
+}
+
+// NewFileReader is same as NewReader but reads only the file at index.
+func (t *Torrent) NewFileReader(index int) (*Reader, error) {
+	if index < 0 {
+		return nil, errors.New("invalid file index")
+	}
+	return t.torrent.NewReader(index)
+}
+
 // Announce the torrent to all trackers and DHT. It does not overrides the minimum interval value sent by the trackers or set in Config.
 func (t *Torrent) Announce() {
 	t.torrent.Announce()
@@ -181,10 +386,7 @@ func (t *Torrent) Announce() {
 // After Verify called, the torrent is stopped, then verification starts and the torrent switches into Verifying state.
 // The torrent stays stopped after verification finishes.
 func (t *Torrent) Verify() error {
-	err := t.torrent.session.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(torrentsBucket).Bucket([]byte(t.torrent.id))
-		return b.Delete([]byte("bitfield"))
-	})
+	err := t.deleteBitfield()
 	if err != nil {
 		return err
 	}
@@ -192,6 +394,29 @@ func (t *Torrent) Verify() error {
 	return nil
 }
 
+// VerifyData checks the files of the torrent again, e.g. after the data on disk is modified or partially deleted.
+// Peer connections are closed, all pieces are hashed against the info dictionary and the rebuilt bitfield is saved.
+// Unlike Verify, the torrent is started after verification and the missing pieces are downloaded again.
+func (t *Torrent) VerifyData() error {
+	err := t.deleteBitfield()
+	if err != nil {
+		return err
+	}
+	err = t.torrent.session.resumer.WriteStarted(t.torrent.id, true)
+	if err != nil {
+		return err
+	}
+	t.torrent.VerifyData()
+	return nil
+}
+
+func (t *Torrent) deleteBitfield() error {
+	return t.torrent.session.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(torrentsBucket).Bucket([]byte(t.torrent.id))
+		return b.Delete([]byte("bitfield"))
+	})
+}
+
 // Move torrent to another Session.
 // target must be the RPC server address in host:port form.
 func (t *Torrent) Move(target string) error {
@@ -269,7 +494,7 @@ func (t *Torrent) generateTar(pw *io.PipeWriter) {
 	defer func() { _ = pw.CloseWithError(err) }()
 
 	tw := tar.NewWriter(pw)
-	root := t.torrent.session.getDataDir(t.torrent.id)
+	root := t.torrent.session.dataDir(t.torrent.id, t.torrent.dest)
 	walkFunc := func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -0,0 +1,126 @@
+package torrent
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WatchDir is a directory that is checked periodically for new .torrent and .magnet files.
+// Files are added to the Session and then renamed by appending ".added" to their names.
+// A .magnet file contains a single magnet link or HTTP URL.
+// Files that cannot be added are renamed by appending ".failed" to their names.
+type WatchDir struct {
+	// Path of the directory.
+	Path string
+	// Do not start the added torrents automatically.
+	Stopped bool
+	// Directory to save the files of the added torrents. Config.DataDir is used if empty.
+	Dest string
+	// Labels of the added torrents.
+	Labels []string
+	// Delete the file after the torrent is added instead of renaming it.
+	Delete bool
+}
+
+// watchedFile is the state of a file in a watched directory at the last check.
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+func (s *Session) watchDirs() {
+	defer close(s.watchDoneC)
+	// Files are added after they are seen with the same size and modification time in two consecutive checks,
+	// so files that are still being written are not added.
+	seen := make(map[string]watchedFile)
+	ticker := time.NewTicker(s.config.WatchInterval)
+	defer ticker.Stop()
+	for {
+		current := make(map[string]watchedFile)
+		for i := range s.config.WatchDirs {
+			s.checkWatchDir(&s.config.WatchDirs[i], seen, current)
+		}
+		seen = current
+		select {
+		case <-ticker.C:
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+func (s *Session) checkWatchDir(wd *WatchDir, seen, current map[string]watchedFile) {
+	entries, err := os.ReadDir(wd.Path)
+	if err != nil {
+		s.log.Errorf("cannot read watch dir %s: %s", wd.Path, err)
+		return
+	}
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if !e.Type().IsRegular() || (ext != ".torrent" && ext != ".magnet") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(wd.Path, e.Name())
+		wf := watchedFile{size: fi.Size(), modTime: fi.ModTime()}
+		if prev, ok := seen[path]; !ok || prev != wf {
+			current[path] = wf
+			continue
+		}
+		select {
+		case <-s.closeC:
+			return
+		default:
+		}
+		s.addWatchedFile(wd, path, ext)
+	}
+}
+
+func (s *Session) addWatchedFile(wd *WatchDir, path, ext string) {
+	t, err := s.addFile(path, ext, &AddTorrentOptions{Stopped: wd.Stopped, Dest: wd.Dest, Labels: wd.Labels})
+	var duplicate *ErrDuplicateTorrent
+	switch {
+	case errors.As(err, &duplicate):
+		s.log.Infof("torrent in %s already exists with id: %s", path, duplicate.ExistingID)
+	case err != nil:
+		s.log.Errorf("cannot add torrent from %s: %s", path, err)
+		err = os.Rename(path, path+".failed")
+		if err != nil {
+			s.log.Errorf("cannot rename file %s: %s", path, err)
+		}
+		return
+	default:
+		s.log.Infof("added torrent %s from %s", t.ID(), path)
+	}
+	if wd.Delete {
+		err = os.Remove(path)
+	} else {
+		err = os.Rename(path, path+".added")
+	}
+	if err != nil {
+		s.log.Errorf("cannot remove added file %s: %s", path, err)
+	}
+}
+
+func (s *Session) addFile(path, ext string, opt *AddTorrentOptions) (*Torrent, error) {
+	if ext == ".magnet" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return s.AddURI(string(bytes.TrimSpace(b)), opt)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return s.AddTorrent(f, opt)
+}
@@ -0,0 +1,55 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchDir(t *testing.T) {
+	dir := t.TempDir()
+	deleteDir := t.TempDir()
+	cfg := DefaultConfig
+	cfg.WatchInterval = 10 * time.Millisecond
+	cfg.WatchDirs = []WatchDir{
+		{Path: dir, Stopped: true},
+		{Path: deleteDir, Stopped: true, Delete: true},
+	}
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	b, err := os.ReadFile(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		filepath.Join(dir, "a.torrent"):       b,
+		filepath.Join(dir, "b.magnet"):        []byte(otherMagnetLink + "\n"),
+		filepath.Join(dir, "c.torrent"):       []byte("some garbage data"),
+		filepath.Join(dir, "d.txt"):           []byte("not watched"),
+		filepath.Join(deleteDir, "e.torrent"): b,
+	}
+	for name, data := range files {
+		err = os.WriteFile(name, data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(deleteDir, "e.torrent"))
+		return os.IsNotExist(err)
+	}, timeout, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		_, err1 := os.Stat(filepath.Join(dir, "a.torrent.added"))
+		_, err2 := os.Stat(filepath.Join(dir, "b.magnet.added"))
+		_, err3 := os.Stat(filepath.Join(dir, "c.torrent.failed"))
+		return err1 == nil && err2 == nil && err3 == nil
+	}, timeout, 10*time.Millisecond)
+	_, err = os.Stat(filepath.Join(dir, "d.txt"))
+	assert.NoError(t, err)
+	// Same torrent in both directories is added once.
+	assert.Len(t, s.ListTorrents(), 2)
+}
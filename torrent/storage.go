@@ -0,0 +1,64 @@
+package torrent
+
+import (
+	"io/fs"
+
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/cenkalti/rain/internal/storage/filestorage"
+	"github.com/cenkalti/rain/internal/storage/memstorage"
+	"github.com/cenkalti/rain/internal/storage/meteredstorage"
+	"github.com/cenkalti/rain/internal/storage/mmapstorage"
+)
+
+// Storage keeps the files of a torrent.
+type Storage = storage.Storage
+
+// StorageFile is a file opened from a Storage.
+type StorageFile = storage.File
+
+// StorageProvider creates a Storage for each torrent in a Session.
+// Implement this interface to keep the torrent data somewhere other than files on disk.
+type StorageProvider = storage.Provider
+
+// NewFileStorageProvider returns a StorageProvider that saves files on disk.
+// This is the default when no provider is set.
+func NewFileStorageProvider(perm fs.FileMode) StorageProvider {
+	return filestorage.Provider{Perm: perm}
+}
+
+// NewMemoryStorageProvider returns a StorageProvider that keeps files in memory.
+// All data of the torrent is held in memory and lost when the Session is closed.
+func NewMemoryStorageProvider() StorageProvider {
+	return memstorage.Provider{}
+}
+
+// NewMmapStorageProvider returns a StorageProvider that saves files on disk and accesses them via memory mapping.
+// It is not supported on Windows.
+func NewMmapStorageProvider(perm fs.FileMode) StorageProvider {
+	return mmapstorage.Provider{Perm: perm}
+}
+
+// newStorage returns the Storage for the torrent with id.
+// Files are saved into dest if it is not empty.
+// The provider in options has precedence over the one in Config.
+func (s *Session) newStorage(id, dest string, provider StorageProvider) (Storage, error) {
+	dir := s.dataDir(id, dest)
+	if provider == nil {
+		provider = s.config.StorageProvider
+	}
+	var sto Storage
+	var err error
+	if provider == nil {
+		sto, err = filestorage.New(dir, s.config.FilePermissions)
+	} else {
+		sto, err = provider.NewStorage(id, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return meteredstorage.New(sto, &meteredstorage.Metrics{
+		Open:  s.metrics.StorageOpenLatency,
+		Read:  s.metrics.StorageReadLatency,
+		Write: s.metrics.StorageWriteLatency,
+	}), nil
+}
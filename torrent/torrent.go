@@ -11,15 +11,17 @@ import (
 	"github.com/cenkalti/rain/internal/acceptor"
 	"github.com/cenkalti/rain/internal/addrlist"
 	"github.com/cenkalti/rain/internal/allocator"
+	"github.com/cenkalti/rain/internal/allowlist"
 	"github.com/cenkalti/rain/internal/announcer"
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/blocklist"
 	"github.com/cenkalti/rain/internal/bufferpool"
+	"github.com/cenkalti/rain/internal/cachedpiece"
 	"github.com/cenkalti/rain/internal/externalip"
 	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
 	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
+	"github.com/cenkalti/rain/internal/hashdownloader"
 	"github.com/cenkalti/rain/internal/infodownloader"
-	"github.com/cenkalti/rain/internal/urldownloader"
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/cenkalti/rain/internal/mse"
@@ -30,10 +32,13 @@ import (
 	"github.com/cenkalti/rain/internal/piecepicker"
 	"github.com/cenkalti/rain/internal/piecewriter"
 	"github.com/cenkalti/rain/internal/resumer"
+	"github.com/cenkalti/rain/internal/speedlimiter"
 	"github.com/cenkalti/rain/internal/storage"
 	"github.com/cenkalti/rain/internal/suspendchan"
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/unchoker"
+	"github.com/cenkalti/rain/internal/urldownloader"
+	"github.com/cenkalti/rain/internal/utp"
 	"github.com/cenkalti/rain/internal/verifier"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"github.com/rcrowley/go-metrics"
@@ -61,6 +66,13 @@ type torrent struct {
 	// Storage implementation to save the files in torrent.
 	storage storage.Storage
 
+	// Directory given when adding or moving the torrent. Files are saved under Config.DataDir if empty.
+	dest string
+
+	// Free-form labels given by the user. Read outside of the torrent loop, so protected by mLabels.
+	labels  []string
+	mLabels sync.RWMutex
+
 	// TCP Port to listen for peer connections.
 	port int
 
@@ -74,12 +86,19 @@ type torrent struct {
 	// Protects bitfield writing from torrent loop and reading from announcer loop.
 	mBitfield sync.RWMutex
 
+	// Last snapshot returned from Stats. Only set if Config.StatsCacheDuration is not zero.
+	lastStats *Stats
+	mStats    sync.Mutex
+
 	// Unique peer ID is generated per downloader.
 	peerID [20]byte
 
 	files  []allocator.File
 	pieces []piece.Piece
 
+	// Reads piece data when uploading to peers.
+	pieceReader storage.PieceReader
+
 	piecePicker *piecepicker.PiecePicker
 
 	// Peers are sent to this channel when they are disconnected.
@@ -101,6 +120,12 @@ type torrent struct {
 	// Keep recently seen peers to fill underpopulated PEX lists.
 	recentlySeen pexlist.RecentlySeen
 
+	// Indexes of the pieces recently requested by peers, oldest first. Used for warming up the read cache on completion.
+	recentPieceRequests []uint32
+
+	// Loads pieces into the read cache after download is completed.
+	cacheWarmer *cachedpiece.Warmer
+
 	// Unchoker implements an algorithm to select peers to unchoke based on their download speed.
 	unchoker *unchoker.Unchoker
 
@@ -116,6 +141,18 @@ type torrent struct {
 	infoDownloaders        map[*peer.Peer]*infodownloader.InfoDownloader
 	infoDownloadersSnubbed map[*peer.Peer]*infodownloader.InfoDownloader
 
+	// Blocks of info dictionary shared by info downloaders. Nil if the download is not started yet.
+	metadata *infodownloader.Metadata
+
+	// Set when the info dictionary assembled from blocks of multiple peers does not match the info hash.
+	// Then each peer sends a complete copy, so only the peer sending bad data is banned.
+	metadataFromSinglePeer bool
+
+	// Downloads the piece layers of a v2 torrent that are not in the torrent file. Nil if all piece hashes are known.
+	hashDownloader *hashdownloader.HashDownloader
+
+	// Verifies and writes downloaded pieces. Nil if the torrent is not running.
+	pieceWriters       *piecewriter.Pool
 	pieceWriterResultC chan *piecewriter.PieceWriter
 
 	// This channel is closed once all torrent pieces are downloaded and verified.
@@ -143,25 +180,69 @@ type torrent struct {
 	doneC chan struct{}
 
 	// These are the channels for sending a message to run() loop.
-	statsCommandC        chan statsRequest        // Stats()
-	trackersCommandC     chan trackersRequest     // Trackers()
-	peersCommandC        chan peersRequest        // Peers()
-	webseedsCommandC     chan webseedsRequest     // Webseeds()
-	startCommandC        chan struct{}            // Start()
-	stopCommandC         chan struct{}            // Stop()
-	announceCommandC     chan struct{}            // Announce()
-	verifyCommandC       chan struct{}            // Verify()
-	notifyErrorCommandC  chan notifyErrorCommand  // NotifyError()
-	notifyListenCommandC chan notifyListenCommand // NotifyListen()
-	addPeersCommandC     chan []*net.TCPAddr      // AddPeers()
-	addTrackersCommandC  chan []tracker.Tracker   // AddTrackers()
+	statsCommandC          chan statsRequest          // Stats()
+	trackersCommandC       chan trackersRequest       // Trackers()
+	peersCommandC          chan peersRequest          // Peers()
+	webseedsCommandC       chan webseedsRequest       // Webseeds()
+	startCommandC          chan struct{}              // Start()
+	stopCommandC           chan struct{}              // Stop()
+	announceCommandC       chan struct{}              // Announce()
+	verifyCommandC         chan bool                  // Verify(), VerifyData()
+	pauseCommandC          chan struct{}              // Pause()
+	resumeCommandC         chan struct{}              // Resume()
+	transferModeCommandC   chan TransferMode          // SetTransferMode()
+	seedLimitsCommandC     chan *SeedLimits           // SetSeedLimits()
+	uploadSlotsCommandC    chan int                   // SetUploadSlots()
+	moveDataCommandC       chan moveDataRequest       // MoveData()
+	sequentialCommandC     chan bool                  // SetSequential()
+	priorityCommandC       chan priorityRequest       // SetPiecePriority()
+	byteRangeCommandC      chan byteRangeRequest      // SetByteRangeWanted()
+	newReaderCommandC      chan newReaderRequest      // NewReader()
+	readCommandC           chan readRequest           // Reader.Read()
+	closeReaderCommandC    chan *Reader               // Reader.Close()
+	filesCommandC          chan filesRequest          // Files()
+	filePrioritiesCommandC chan filePrioritiesRequest // SetFilePriorities()
+	notifyErrorCommandC    chan notifyErrorCommand    // NotifyError()
+	notifyListenCommandC   chan notifyListenCommand   // NotifyListen()
+	addPeersCommandC       chan []*net.TCPAddr        // AddPeers()
+	addTrackersCommandC    chan []tracker.Tracker     // AddTrackers()
 
 	// Trackers send announce responses to this channel.
 	addrsFromTrackers chan []*net.TCPAddr
 
+	// Trackers send their URL to this channel after they accept the "completed" event.
+	completedAnnouncedC chan string
+
+	// Trackers send new warning messages to this channel.
+	trackerWarningC chan announcer.TrackerWarning
+
 	// Keeps a list of peer addresses to connect.
 	addrList *addrlist.AddrList
 
+	// Number of failed connection attempts by peer address.
+	dialFailures map[string]int
+
+	// Failed peer addresses are sent to this channel after waiting for the retry interval.
+	dialRetryC chan dialRetry
+
+	// Timers of the scheduled retries by peer address. Stopped when the torrent is stopped.
+	dialRetryTimers map[string]*time.Timer
+
+	// Addresses of outgoing peers that are disconnected when the download is completed.
+	// They are dialed again if more pieces are wanted after completion.
+	completedPeerAddrs []dialRetry
+
+	// All addresses of a peer that is added with a hostname are sent to this channel after resolving.
+	resolvedPeerC chan []*net.TCPAddr
+
+	// Other addresses of peers that are added with a hostname, keyed by the address in addrList.
+	// Connections to these addresses are raced with the connection to the address in addrList.
+	peerFallbackAddrs map[string][]*net.TCPAddr
+
+	// Speed limiters of the torrent. Chained to the limiters of the Session.
+	bucketDownload *speedlimiter.Limiter
+	bucketUpload   *speedlimiter.Limiter
+
 	// New raw connections created by OutgoingHandshaker are sent to here.
 	incomingConnC chan net.Conn
 
@@ -171,6 +252,16 @@ type torrent struct {
 	// Listens for incoming peer connections.
 	acceptor *acceptor.Acceptor
 
+	// Accepts incoming uTP connections. The socket is also used for dialing peers over uTP.
+	utpAcceptor *acceptor.Acceptor
+	utpSocket   *utp.Socket
+
+	// True if the torrent accepts connections from the port shared by all torrents in Session.
+	acceptingSharedPort bool
+
+	// Connections accepted on the shared port are sent to this channel after the handshake is done by Session.
+	sharedPortConnC chan *incominghandshaker.IncomingHandshaker
+
 	// Special hash of info hash for encypted connection handshake.
 	sKeyHash [20]byte
 
@@ -185,6 +276,10 @@ type torrent struct {
 	dhtAnnouncer *announcer.DHTAnnouncer
 	dhtPeersC    chan []*net.TCPAddr
 
+	// If not nil, torrent is announced to local network periodically.
+	lsdAnnouncer *announcer.DHTAnnouncer
+	lsdPeersC    chan []*net.TCPAddr
+
 	// List of peers in handshake state.
 	incomingHandshakers map[*incominghandshaker.IncomingHandshaker]struct{}
 	outgoingHandshakers map[*outgoinghandshaker.OutgoingHandshaker]struct{}
@@ -211,6 +306,9 @@ type torrent struct {
 	verifierResultC   chan *verifier.Verifier
 	checkedPieces     uint32
 
+	// Number of downloaded pieces that failed hash check.
+	failedPieces uint32
+
 	// Metrics
 	downloadSpeed   metrics.Meter
 	uploadSpeed     metrics.Meter
@@ -222,6 +320,15 @@ type torrent struct {
 	seedDurationUpdatedAt time.Time
 	seedDurationTicker    *time.Ticker
 
+	// Time of the last upload while seeding. Used for checking SeedLimits.IdleDuration.
+	seedIdleSince    time.Time
+	seedIdleUploaded int64
+
+	// Download speed is below Config.BoostSpeedThreshold since this time.
+	slowSince time.Time
+	// Connection and request limits are raised until this time. Zero if the torrent is not boosted.
+	boostUntil time.Time
+
 	// Holds connected peer IPs so we don't dial/accept multiple connections to/from same IP.
 	connectedPeerIPs map[string]struct{}
 
@@ -250,6 +357,15 @@ type torrent struct {
 
 	// Set to true when manual verification is requested
 	doVerify bool
+	// If true, the torrent keeps running after manual verification instead of stopping.
+	resumeAfterVerify bool
+
+	// Files are being moved to another directory if not nil.
+	moveDataRequest *moveDataRequest
+	// Mover goroutine sends the result of the move to this channel.
+	moveDataResultC chan error
+	// Set to true if the torrent is stopped for moving files. The torrent is started again after files are moved.
+	startAfterMove bool
 
 	// If true, the torrent is stopped automatically when all torrent pieces are downloaded.
 	stopAfterDownload bool
@@ -257,9 +373,58 @@ type torrent struct {
 	// If true, the torrent is stopped automatically when all metadata pieces are downloaded.
 	stopAfterMetadata bool
 
+	// Limits for the info downloaded with metadata extension.
+	limits TorrentLimits
+
+	// Allowlist given when adding the torrent. Saved to resume database as is.
+	peerAllowlist []string
+
+	// Peers allowed to connect. Nil means all peers are allowed.
+	allowlist *allowlist.Allowlist
+
 	// True means that completeCmd has run before.
 	completeCmdRun bool
 
+	// State of the "completed" event for each tracker URL. True if sent, false if pending.
+	// Trackers are not in the map if the torrent is not completed by downloading.
+	completedAnnounces map[string]bool
+
+	// If true, peers and trackers are kept but no data is downloaded or uploaded.
+	paused bool
+
+	// Restricts downloading or uploading of data.
+	transferMode TransferMode
+
+	// Limits for stopping the torrent after seeding. Nil means the limits in Config are used.
+	seedLimits *SeedLimits
+
+	// Number of peers unchoked by their speed. Zero means Config.UnchokedPeers is used.
+	uploadSlots int
+
+	// If true, pieces are downloaded in order instead of rarest first.
+	sequential bool
+
+	// Priorities set by SetPiecePriority. Pieces with default priority are not kept in the map.
+	piecePriorities map[uint32]PiecePriority
+
+	// Priorities set by SetFilePriorities. Empty if all files have normal priority.
+	filePriorities []FilePriority
+
+	// Priorities of pieces calculated from filePriorities. Pieces with default priority are not kept in the map.
+	filePiecePriorities map[uint32]int
+
+	// Set by SetByteRangeWanted. Only the pieces in the range are downloaded if its length is not zero.
+	wantedRange byteRange
+
+	// Pieces that belong only to skipped files. Nil if there are no skipped pieces.
+	skippedPieces *bitfield.Bitfield
+
+	// Open readers and the index of the piece they are reading.
+	readers map[*Reader]uint32
+
+	// Channels to be closed when the piece at index is downloaded.
+	pieceWaiters map[uint32][]chan struct{}
+
 	log logger.Logger
 }
 
@@ -282,11 +447,36 @@ func newTorrent2(
 	stopAfterDownload bool,
 	stopAfterMetadata bool,
 	completeCmdRun bool,
+	completedAnnounces map[string]bool,
+	paused bool,
+	transferMode TransferMode,
+	filePriorities []FilePriority,
+	limits TorrentLimits, // checked when info is downloaded from peers
+	peerAllowlist []string, // replaces Config.PeerAllowlist if not empty
+	seedLimits *SeedLimits, // replaces the seed limits in Config if not nil
+	uploadSlots int, // replaces Config.UnchokedPeers if not zero
 ) (*torrent, error) {
 	if len(infoHash) != 20 {
 		return nil, errors.New("invalid infoHash (must be 20 bytes)")
 	}
+	if seedLimits != nil {
+		// Copy to prevent modifications by the caller.
+		l := *seedLimits
+		seedLimits = &l
+	}
+	al := s.allowlist
+	if len(peerAllowlist) > 0 {
+		var err error
+		al, err = allowlist.New(peerAllowlist)
+		if err != nil {
+			return nil, err
+		}
+	}
 	cfg := s.config
+	if cfg.Port != 0 {
+		// Port saved in resume data is not used when all torrents share the same port.
+		port = int(cfg.Port)
+	}
 	var ih [20]byte
 	copy(ih[:], infoHash)
 	t := &torrent{
@@ -321,7 +511,26 @@ func newTorrent2(
 		startCommandC:             make(chan struct{}),
 		stopCommandC:              make(chan struct{}),
 		announceCommandC:          make(chan struct{}),
-		verifyCommandC:            make(chan struct{}),
+		verifyCommandC:            make(chan bool),
+		pauseCommandC:             make(chan struct{}),
+		resumeCommandC:            make(chan struct{}),
+		transferModeCommandC:      make(chan TransferMode),
+		seedLimitsCommandC:        make(chan *SeedLimits),
+		uploadSlotsCommandC:       make(chan int),
+		moveDataCommandC:          make(chan moveDataRequest),
+		sequentialCommandC:        make(chan bool),
+		priorityCommandC:          make(chan priorityRequest),
+		byteRangeCommandC:         make(chan byteRangeRequest),
+		newReaderCommandC:         make(chan newReaderRequest),
+		readCommandC:              make(chan readRequest),
+		closeReaderCommandC:       make(chan *Reader),
+		filesCommandC:             make(chan filesRequest),
+		filePrioritiesCommandC:    make(chan filePrioritiesRequest),
+		filePriorities:            filePriorities,
+		filePiecePriorities:       make(map[uint32]int),
+		piecePriorities:           make(map[uint32]PiecePriority),
+		readers:                   make(map[*Reader]uint32),
+		pieceWaiters:              make(map[uint32][]chan struct{}),
 		statsCommandC:             make(chan statsRequest),
 		trackersCommandC:          make(chan trackersRequest),
 		peersCommandC:             make(chan peersRequest),
@@ -331,8 +540,18 @@ func newTorrent2(
 		addPeersCommandC:          make(chan []*net.TCPAddr),
 		addTrackersCommandC:       make(chan []tracker.Tracker),
 		addrsFromTrackers:         make(chan []*net.TCPAddr),
+		completedAnnouncedC:       make(chan string),
+		trackerWarningC:           make(chan announcer.TrackerWarning),
+		dialFailures:              make(map[string]int),
+		dialRetryC:                make(chan dialRetry),
+		dialRetryTimers:           make(map[string]*time.Timer),
+		resolvedPeerC:             make(chan []*net.TCPAddr),
+		peerFallbackAddrs:         make(map[string][]*net.TCPAddr),
+		bucketDownload:            speedlimiter.New(0, s.bucketDownload),
+		bucketUpload:              speedlimiter.New(0, s.bucketUpload),
 		peerIDs:                   make(map[[20]byte]struct{}),
 		incomingConnC:             make(chan net.Conn),
+		sharedPortConnC:           make(chan *incominghandshaker.IncomingHandshaker),
 		sKeyHash:                  mse.HashSKey(ih[:]),
 		infoDownloaderResultC:     make(chan *infodownloader.InfoDownloader),
 		incomingHandshakers:       make(map[*incominghandshaker.IncomingHandshaker]struct{}),
@@ -346,7 +565,9 @@ func newTorrent2(
 		connectedPeerIPs:          make(map[string]struct{}),
 		bannedPeerIPs:             make(map[string]struct{}),
 		announcersStoppedC:        make(chan struct{}),
+		moveDataResultC:           make(chan error, 1),
 		dhtPeersC:                 make(chan []*net.TCPAddr, 1),
+		lsdPeersC:                 make(chan []*net.TCPAddr, 1),
 		externalIP:                externalip.FirstExternalIP(),
 		downloadSpeed:             metrics.NilMeter{},
 		uploadSpeed:               metrics.NilMeter{},
@@ -362,10 +583,17 @@ func newTorrent2(
 		doneC:                     make(chan struct{}),
 		stopAfterDownload:         stopAfterDownload,
 		stopAfterMetadata:         stopAfterMetadata,
+		limits:                    limits,
+		peerAllowlist:             peerAllowlist,
+		allowlist:                 al,
 		completeCmdRun:            completeCmdRun,
+		completedAnnounces:        completedAnnounces,
+		paused:                    paused,
+		transferMode:              transferMode,
+		seedLimits:                seedLimits,
 	}
 	if len(t.webseedSources) > s.config.WebseedMaxSources {
-		t.webseedSources = t.webseedSources[:10]
+		t.webseedSources = t.webseedSources[:s.config.WebseedMaxSources]
 	}
 	t.bytesDownloaded.Inc(stats.BytesDownloaded)
 	t.bytesUploaded.Inc(stats.BytesUploaded)
@@ -375,16 +603,18 @@ func newTorrent2(
 	if cfg.BlocklistEnabledForOutgoingConnections {
 		blocklistForOutgoingConns = s.blocklist
 	}
-	t.addrList = addrlist.New(cfg.MaxPeerAddresses, blocklistForOutgoingConns, port, &t.externalIP)
+	t.addrList = addrlist.New(cfg.MaxPeerAddresses, blocklistForOutgoingConns, al, port, &t.externalIP)
 	if t.info != nil {
 		t.piecePool = bufferpool.New(int(t.info.PieceLength))
+		t.updateWantedPieces()
 	}
 	n := t.copyPeerIDPrefix()
 	_, err := rand.Read(t.peerID[n:])
 	if err != nil {
 		return nil, err
 	}
-	t.unchoker = unchoker.New(cfg.UnchokedPeers, cfg.OptimisticUnchokedPeers)
+	t.uploadSlots = uploadSlots
+	t.unchoker = unchoker.New(t.getUploadSlots(), cfg.OptimisticUnchokedPeers)
 	go t.run()
 	return t, nil
 }
@@ -420,6 +650,13 @@ func (t *torrent) announceDHT() {
 	t.session.mPeerRequests.Unlock()
 }
 
+func (t *torrent) announceLSD() {
+	err := t.session.lsd.Announce(t.infoHash, t.port)
+	if err != nil {
+		t.log.Debugln("cannot announce to local network:", err)
+	}
+}
+
 // DisableLogging disables all log messages printed to console.
 // This function needs to be called before creating a Session.
 func DisableLogging() {
@@ -7,6 +7,7 @@ import (
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/piece"
 	"github.com/cenkalti/rain/internal/piecepicker"
+	"github.com/cenkalti/rain/internal/storage"
 )
 
 func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
@@ -34,6 +35,11 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 		return
 	}
 	t.pieces = pieces
+	if pr, ok := t.storage.(storage.PieceReader); ok {
+		t.pieceReader = pr
+	} else {
+		t.pieceReader = piece.Reader(t.pieces)
+	}
 
 	for pe := range t.peers {
 		pe.GenerateAndSendAllowedFastMessages(t.session.config.AllowedFastSet, t.info.NumPieces, t.infoHash, t.pieces)
@@ -43,6 +49,10 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 		panic("piece picker exists")
 	}
 	t.piecePicker = piecepicker.New(t.pieces, t.session.config.EndgameMaxDuplicateDownloads, t.webseedSources)
+	t.piecePicker.SetSequential(t.sequential)
+	t.piecePicker.SetRandomFirstPieces(t.session.config.RandomFirstPieces)
+	t.piecePicker.SetEndgameThreshold(t.session.config.EndgameRemainingBlocks, t.session.config.EndgameRemainingPercent)
+	t.updatePiecePriorities()
 
 	for pe := range t.peers {
 		pe.Bitfield = bitfield.New(t.info.NumPieces)
@@ -53,6 +63,7 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 		for i := uint32(0); i < t.bitfield.Len(); i++ {
 			t.pieces[i].Done = t.bitfield.Test(i)
 		}
+		t.notifyPieceWaiters()
 		if t.checkCompletion() && t.stopAfterDownload {
 			t.stopAndSetStoppedOnComplete()
 			return
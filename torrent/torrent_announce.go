@@ -2,7 +2,9 @@ package torrent
 
 import (
 	"math"
+	"net"
 
+	"github.com/cenkalti/rain/internal/externalip"
 	"github.com/cenkalti/rain/internal/tracker"
 )
 
@@ -16,6 +18,21 @@ func (t *torrent) handleNewTrackers(trackers []tracker.Tracker) {
 	}
 }
 
+// announceIPv6 returns the IPv6 address of the client that is announced to trackers.
+// It returns nil if peers are not listened on a global IPv6 address.
+func (t *torrent) announceIPv6() net.IP {
+	host := t.session.config.Host
+	ip := net.ParseIP(host)
+	if host == "" || (ip != nil && ip.IsUnspecified()) {
+		// Listeners on unspecified address are dual-stack.
+		return externalip.FirstExternalIPv6()
+	}
+	if ip != nil && ip.To4() == nil && ip.IsGlobalUnicast() {
+		return ip
+	}
+	return nil
+}
+
 func (t *torrent) announcerFields() tracker.Torrent {
 	tr := tracker.Torrent{
 		InfoHash:        t.infoHash,
@@ -24,6 +41,17 @@ func (t *torrent) announcerFields() tracker.Torrent {
 		BytesDownloaded: t.bytesDownloaded.Count(),
 		BytesUploaded:   t.bytesUploaded.Count(),
 	}
+	if pm := t.session.portMapper; pm != nil {
+		// Peers can connect to the mapped port on the gateway.
+		if port := pm.ExternalPort(t.port); port != 0 {
+			tr.Port = port
+			tr.IP = pm.ExternalIP()
+		}
+	}
+	if ip := t.announceIPv6(); ip != nil {
+		// Port mapping is only done for IPv4, peers connect to the local port over IPv6.
+		tr.IPv6 = &net.TCPAddr{IP: ip, Port: t.port}
+	}
 	// t.bytesComplete() uses t.bitfied for calculation.
 	t.mBitfield.RLock()
 	if t.bitfield == nil {
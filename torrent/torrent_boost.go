@@ -0,0 +1,78 @@
+package torrent
+
+import "time"
+
+// boosting returns true if the connection and request limits of the torrent are raised temporarily.
+func (t *torrent) boosting() bool {
+	return !t.boostUntil.IsZero()
+}
+
+func (t *torrent) boostFactor() int {
+	if t.boosting() && t.session.config.BoostFactor > 1 {
+		return t.session.config.BoostFactor
+	}
+	return 1
+}
+
+func (t *torrent) maxPeerDial() int {
+	return t.session.config.MaxPeerDial * t.boostFactor()
+}
+
+func (t *torrent) maxPeerAccept() int {
+	return t.session.config.MaxPeerAccept * t.boostFactor()
+}
+
+// downloadBandwidthAvailable returns false if the torrent or the session is downloading at its speed limit.
+func (t *torrent) downloadBandwidthAvailable() bool {
+	if rate := t.bucketDownload.Rate(); rate > 0 && int64(t.downloadSpeed.Rate1()) >= rate {
+		return false
+	}
+	if rate := t.session.bucketDownload.Rate(); rate > 0 && int64(t.session.metrics.SpeedDownload.Rate1()) >= rate {
+		return false
+	}
+	return true
+}
+
+// checkBoost boosts the torrent if the download is slow while there is unused bandwidth,
+// and restores the limits after Config.BoostDuration.
+func (t *torrent) checkBoost(now time.Time) {
+	threshold := t.session.config.BoostSpeedThreshold
+	if threshold <= 0 || t.status() != Downloading || !t.downloadEnabled() {
+		t.slowSince = time.Time{}
+		t.boostUntil = time.Time{}
+		return
+	}
+	if t.boosting() {
+		if now.Before(t.boostUntil) {
+			return
+		}
+		// Connections made during the boost are kept until they are closed, new ones obey the normal limits.
+		t.log.Info("boost ended")
+		t.boostUntil = time.Time{}
+		t.slowSince = now
+		return
+	}
+	if int64(t.downloadSpeed.Rate1()) >= threshold || !t.downloadBandwidthAvailable() {
+		t.slowSince = time.Time{}
+		return
+	}
+	if t.slowSince.IsZero() {
+		t.slowSince = now
+		return
+	}
+	if now.Sub(t.slowSince) < t.session.config.BoostAfter {
+		return
+	}
+	t.startBoost(now)
+}
+
+func (t *torrent) startBoost(now time.Time) {
+	t.log.Infof("download speed is below %d bytes/s, boosting for %s", t.session.config.BoostSpeedThreshold, t.session.config.BoostDuration)
+	t.boostUntil = now.Add(t.session.config.BoostDuration)
+	t.setNeedMorePeers(true)
+	if t.dhtAnnouncer != nil {
+		t.announceDHT()
+	}
+	t.dialAddresses()
+	t.startPieceDownloaders()
+}
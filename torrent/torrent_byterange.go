@@ -0,0 +1,59 @@
+package torrent
+
+import "errors"
+
+// byteRange is a section of a file in torrent.
+type byteRange struct {
+	file   int
+	offset int64
+	length int64
+}
+
+type byteRangeRequest struct {
+	File     int
+	Offset   int64
+	Length   int64
+	Response chan error
+}
+
+// SetByteRangeWanted limits the download to the pieces containing the byte range in the file at index.
+func (t *torrent) SetByteRangeWanted(file int, offset, length int64) error {
+	req := byteRangeRequest{File: file, Offset: offset, Length: length, Response: make(chan error, 1)}
+	select {
+	case t.byteRangeCommandC <- req:
+	case <-t.closeC:
+		return ErrTorrentClosed
+	}
+	select {
+	case err := <-req.Response:
+		return err
+	case <-t.closeC:
+		return ErrTorrentClosed
+	}
+}
+
+func (t *torrent) handleSetByteRangeWanted(req byteRangeRequest) error {
+	if t.info == nil {
+		return errors.New("torrent metadata not ready")
+	}
+	if req.File < 0 || req.File >= len(t.info.Files) {
+		return errors.New("invalid file index")
+	}
+	if req.Offset < 0 || req.Length < 0 || req.Offset+req.Length > t.info.Files[req.File].Length {
+		return errors.New("invalid byte range")
+	}
+	t.wantedRange = byteRange{file: req.File, offset: req.Offset, length: req.Length}
+	t.updateWantedPieces()
+	t.updatePiecePriorities()
+	t.checkWantedPieces()
+	return nil
+}
+
+// wantedRangeSection returns the section [begin, end) of torrent data that is set by SetByteRangeWanted.
+func (t *torrent) wantedRangeSection() (begin, end int64) {
+	for _, f := range t.info.Files[:t.wantedRange.file] {
+		begin += f.Length
+	}
+	begin += t.wantedRange.offset
+	return begin, begin + t.wantedRange.length
+}
@@ -0,0 +1,88 @@
+package torrent
+
+import (
+	"github.com/cenkalti/rain/internal/cachedpiece"
+	"github.com/cenkalti/rain/internal/piece"
+)
+
+// Number of piece requests remembered for warming up the read cache.
+const maxRecentPieceRequests = 64
+
+func (t *torrent) addRecentPieceRequest(index uint32) {
+	n := len(t.recentPieceRequests)
+	if n > 0 && t.recentPieceRequests[n-1] == index {
+		// Consecutive block requests for the same piece.
+		return
+	}
+	if n == maxRecentPieceRequests {
+		copy(t.recentPieceRequests, t.recentPieceRequests[1:])
+		t.recentPieceRequests = t.recentPieceRequests[:n-1]
+	}
+	t.recentPieceRequests = append(t.recentPieceRequests, index)
+}
+
+func (t *torrent) startCacheWarmer() {
+	if t.cacheWarmer != nil {
+		panic("cache warmer exists")
+	}
+	pieces := t.cacheWarmupPieces()
+	if len(pieces) == 0 {
+		return
+	}
+	t.log.Debugf("warming up read cache with %d pieces", len(pieces))
+	t.cacheWarmer = cachedpiece.NewWarmer()
+	go t.cacheWarmer.Run(t.pieceReader, pieces, t.session.pieceCache, t.session.config.ReadCacheBlockSize, t.peerID)
+}
+
+// stopCacheWarmer must be called before closing the data files.
+func (t *torrent) stopCacheWarmer() {
+	if t.cacheWarmer != nil {
+		t.cacheWarmer.Close()
+		t.cacheWarmer = nil
+	}
+}
+
+// cacheWarmupPieces returns the pieces to load into the read cache in order of importance.
+// Recently requested pieces come first, most recent first, followed by the first and last pieces of each file.
+func (t *torrent) cacheWarmupPieces() []*piece.Piece {
+	budget := t.session.config.ReadCacheWarmupSize
+	if budget > t.session.config.ReadCacheSize {
+		budget = t.session.config.ReadCacheSize
+	}
+	var ret []*piece.Piece
+	added := make(map[uint32]struct{})
+	add := func(index uint32) bool {
+		if _, ok := added[index]; ok {
+			return true
+		}
+		pi := &t.pieces[index]
+		if int64(pi.Length) > budget {
+			return false
+		}
+		budget -= int64(pi.Length)
+		added[index] = struct{}{}
+		ret = append(ret, pi)
+		return true
+	}
+	for i := len(t.recentPieceRequests) - 1; i >= 0; i-- {
+		if !add(t.recentPieceRequests[i]) {
+			return ret
+		}
+	}
+	var offset int64
+	pieceLength := int64(t.info.PieceLength)
+	for _, f := range t.info.Files {
+		begin := offset
+		offset += f.Length
+		if f.Padding || f.Length == 0 {
+			continue
+		}
+		if !add(uint32(begin / pieceLength)) {
+			return ret
+		}
+		if !add(uint32((offset - 1) / pieceLength)) {
+			return ret
+		}
+	}
+	return ret
+}
@@ -1,19 +1,15 @@
 package torrent
 
 import (
-	"errors"
-
 	"github.com/cenkalti/rain/internal/infodownloader"
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/piecedownloader"
 	"github.com/cenkalti/rain/internal/webseedsource"
 )
 
-var errClosed = errors.New("torrent is closed")
-
 func (t *torrent) close() {
 	// Stop if running.
-	t.stop(errClosed)
+	t.stop(ErrTorrentClosed)
 
 	// Maybe we are in "Stopping" state. Close "stopped" event announcer.
 	if t.stoppedEventAnnouncer != nil {
@@ -32,6 +28,9 @@ func (t *torrent) closePeer(pe *peer.Peer) {
 	if id, ok := t.infoDownloaders[pe]; ok {
 		t.closeInfoDownloader(id)
 	}
+	if t.hashDownloader != nil {
+		t.hashDownloader.ClosePeer(pe)
+	}
 	delete(t.peers, pe)
 	delete(t.incomingPeers, pe)
 	delete(t.outgoingPeers, pe)
@@ -69,6 +68,7 @@ func (t *torrent) closePieceDownloader(pd *piecedownloader.PieceDownloader) {
 }
 
 func (t *torrent) closeInfoDownloader(id *infodownloader.InfoDownloader) {
+	id.Release()
 	delete(t.infoDownloaders, id.Peer.(*peer.Peer))
 	delete(t.infoDownloadersSnubbed, id.Peer.(*peer.Peer))
 }
@@ -1,6 +1,7 @@
 package torrent
 
 import (
+	"crypto/sha256"
 	"errors"
 	"net"
 	"time"
@@ -39,7 +40,55 @@ func (t *torrent) Announce() {
 // Verify pieces by checking files.
 func (t *torrent) Verify() {
 	select {
-	case t.verifyCommandC <- struct{}{}:
+	case t.verifyCommandC <- false:
+	case <-t.closeC:
+	}
+}
+
+// VerifyData verifies pieces by checking files and keeps the torrent running after verification.
+func (t *torrent) VerifyData() {
+	select {
+	case t.verifyCommandC <- true:
+	case <-t.closeC:
+	}
+}
+
+// Pause downloading and uploading without closing peer connections.
+func (t *torrent) Pause() {
+	select {
+	case t.pauseCommandC <- struct{}{}:
+	case <-t.closeC:
+	}
+}
+
+// Resume downloading and uploading after Pause.
+func (t *torrent) Resume() {
+	select {
+	case t.resumeCommandC <- struct{}{}:
+	case <-t.closeC:
+	}
+}
+
+// SetTransferMode restricts the direction of data transfer.
+func (t *torrent) SetTransferMode(mode TransferMode) {
+	select {
+	case t.transferModeCommandC <- mode:
+	case <-t.closeC:
+	}
+}
+
+// SetSeedLimits sets the limits for stopping the torrent after seeding. Nil value means the limits in Config are used.
+func (t *torrent) SetSeedLimits(limits *SeedLimits) {
+	select {
+	case t.seedLimitsCommandC <- limits:
+	case <-t.closeC:
+	}
+}
+
+// SetUploadSlots sets the number of peers unchoked by their speed. Zero value means Config.UnchokedPeers is used.
+func (t *torrent) SetUploadSlots(n int) {
+	select {
+	case t.uploadSlotsCommandC <- n:
 	case <-t.closeC:
 	}
 }
@@ -99,6 +148,10 @@ func (t *torrent) Magnet() (string, error) {
 		Trackers: t.getTieredTrackers(),
 		Peers:    t.fixedPeers,
 	}
+	if t.info != nil && t.info.V2 {
+		sum := sha256.Sum256(t.info.Bytes)
+		m.InfoHashV2 = sum[:]
+	}
 	return m.String(), nil
 }
 
@@ -110,21 +163,13 @@ func (t *torrent) Torrent() ([]byte, error) {
 	for i, ws := range t.webseedSources {
 		webseeds[i] = ws.URL
 	}
-	return metainfo.NewBytes(t.info.Bytes, t.getTieredTrackers(), webseeds, "")
+	return metainfo.NewBytes(t.info.Bytes, t.info.PieceLayersBytes(), t.getTieredTrackers(), webseeds, "")
 }
 
 func (t *torrent) getTieredTrackers() [][]string {
 	var trackers [][]string
 	for _, tr := range t.trackers {
-		if tier, ok := tr.(*tracker.Tier); ok {
-			urls := make([]string, len(tier.Trackers))
-			for i, tt := range tier.Trackers {
-				urls[i] = tt.URL()
-			}
-			trackers = append(trackers, urls)
-		} else {
-			trackers = append(trackers, []string{tr.URL()})
-		}
+		trackers = append(trackers, trackerURLs(tr))
 	}
 	return trackers
 }
@@ -135,6 +180,14 @@ type statsRequest struct {
 
 // Stats returns statistics about the Torrent.
 func (t *torrent) Stats() Stats {
+	if d := t.session.config.StatsCacheDuration; d > 0 {
+		t.mStats.Lock()
+		stats := t.lastStats
+		t.mStats.Unlock()
+		if stats != nil && time.Since(stats.Time) < d {
+			return stats.clone()
+		}
+	}
 	var stats Stats
 	req := statsRequest{Response: make(chan Stats, 1)}
 	select {
@@ -188,14 +241,18 @@ func trackerStatusToString(s TrackerStatus) string {
 
 // Tracker is a server that tracks the peers of torrents.
 type Tracker struct {
-	URL          string
-	Status       TrackerStatus
-	Leechers     int
-	Seeders      int
-	Error        *AnnounceError
-	Warning      string
+	URL      string
+	Status   TrackerStatus
+	Leechers int
+	Seeders  int
+	Error    *AnnounceError
+	Warning  string
+	// Time of the last announce response containing the warning.
+	WarningAt    time.Time
 	LastAnnounce time.Time
 	NextAnnounce time.Time
+	// True if the tracker has received the "completed" event for this torrent.
+	CompletedSent bool
 }
 
 type trackersRequest struct {
@@ -230,6 +287,7 @@ type Peer struct {
 	PeerChoking        bool
 	OptimisticUnchoked bool
 	Snubbed            bool
+	RequestTimeouts    int
 	EncryptedHandshake bool
 	EncryptedStream    bool
 	DownloadSpeed      int
@@ -250,6 +308,8 @@ const (
 	SourceIncoming
 	// SourceManual indicates that the peer is added manually via AddPeer method.
 	SourceManual
+	// SourceLSD indicates that the peer is found in local network with Local Service Discovery.
+	SourceLSD
 )
 
 type peersRequest struct {
@@ -0,0 +1,80 @@
+package torrent
+
+import (
+	"github.com/cenkalti/rain/internal/announcer"
+	"github.com/cenkalti/rain/internal/tracker"
+)
+
+// trackerURLs returns the URLs of all trackers in the tier, or the URL of a single tracker.
+func trackerURLs(tr tracker.Tracker) []string {
+	tier, ok := tr.(*tracker.Tier)
+	if !ok {
+		return []string{tr.URL()}
+	}
+	urls := make([]string, len(tier.Trackers))
+	for i, tt := range tier.Trackers {
+		urls[i] = tt.URL()
+	}
+	return urls
+}
+
+// completedEvent returns the initial state of the "completed" event for the tracker.
+// A tier announces to one of its trackers at a time, which may change after a failure or restart.
+// The event is sent once to a tier, so it is considered sent if any tracker in the tier has received it.
+func (t *torrent) completedEvent(tr tracker.Tracker) announcer.CompletedEvent {
+	event := announcer.CompletedNotDue
+	for _, u := range trackerURLs(tr) {
+		sent, ok := t.completedAnnounces[u]
+		switch {
+		case !ok:
+		case sent:
+			return announcer.CompletedSent
+		default:
+			event = announcer.CompletedPending
+		}
+	}
+	return event
+}
+
+// setCompletedAnnouncesPending marks the "completed" event as pending for the trackers that has not received it yet.
+// It is saved to resume db so the event is sent after restart if the torrent is stopped before trackers accept it.
+func (t *torrent) setCompletedAnnouncesPending() {
+	if t.completedAnnounces == nil {
+		t.completedAnnounces = make(map[string]bool)
+	}
+	for _, tr := range t.trackers {
+		for _, u := range trackerURLs(tr) {
+			if _, ok := t.completedAnnounces[u]; !ok {
+				t.completedAnnounces[u] = false
+			}
+		}
+	}
+	t.writeCompletedAnnounces()
+}
+
+// handleCompletedAnnounced marks the "completed" event as sent for all trackers in the tier of the tracker.
+func (t *torrent) handleCompletedAnnounced(trackerURL string) {
+	if t.completedAnnounces == nil {
+		t.completedAnnounces = make(map[string]bool)
+	}
+	t.completedAnnounces[trackerURL] = true
+	for _, tr := range t.trackers {
+		urls := trackerURLs(tr)
+		for _, u := range urls {
+			if u == trackerURL {
+				for _, u2 := range urls {
+					t.completedAnnounces[u2] = true
+				}
+				break
+			}
+		}
+	}
+	t.writeCompletedAnnounces()
+}
+
+func (t *torrent) writeCompletedAnnounces() {
+	err := t.session.resumer.WriteCompletedAnnounces(t.id, t.completedAnnounces)
+	if err != nil {
+		t.log.Errorf("cannot write completed announces to resume db: %s", err)
+	}
+}
@@ -0,0 +1,53 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cenkalti/rain/internal/announcer"
+	"github.com/cenkalti/rain/internal/tracker"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingTracker string
+
+func (t failingTracker) Announce(ctx context.Context, req tracker.AnnounceRequest) (*tracker.AnnounceResponse, error) {
+	return nil, errors.New("announce failed")
+}
+
+func (t failingTracker) URL() string { return string(t) }
+
+func TestCompletedEventTierFailover(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	tor, err := s.AddURI(torrentMagnetLink, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTier := func() *tracker.Tier {
+		return tracker.NewTier([]tracker.Tracker{failingTracker("http://a/announce"), failingTracker("http://b/announce")})
+	}
+	tier := newTier()
+	other := failingTracker("http://c/announce")
+	tt := tor.torrent
+	tt.trackers = []tracker.Tracker{tier, other}
+
+	tt.setCompletedAnnouncesPending()
+	assert.Equal(t, announcer.CompletedPending, tt.completedEvent(tier))
+	assert.Equal(t, announcer.CompletedPending, tt.completedEvent(other))
+
+	// Event is accepted by the tracker in use, then the tier switches to the other tracker.
+	tt.handleCompletedAnnounced(tier.URL())
+	sentTo := tier.URL()
+	_, _ = tier.Announce(context.Background(), tracker.AnnounceRequest{})
+	assert.NotEqual(t, sentTo, tier.URL())
+	assert.Equal(t, announcer.CompletedSent, tt.completedEvent(tier))
+	assert.Equal(t, announcer.CompletedPending, tt.completedEvent(other))
+
+	// Tier may start with another tracker after restart.
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, announcer.CompletedSent, tt.completedEvent(newTier()))
+	}
+}
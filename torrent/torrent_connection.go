@@ -3,42 +3,65 @@ package torrent
 import (
 	"net"
 
+	"github.com/cenkalti/rain/internal/btconn"
 	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
+	"github.com/cenkalti/rain/internal/peersource"
 )
 
 func (t *torrent) handleNewConnection(conn net.Conn) {
-	if len(t.incomingHandshakers)+len(t.incomingPeers) >= t.session.config.MaxPeerAccept {
-		t.log.Debugln("peer limit reached, rejecting peer", conn.RemoteAddr().String())
-		conn.Close()
-		return
-	}
-	ip := conn.RemoteAddr().(*net.TCPAddr).IP
-	ipstr := ip.String()
-	if t.session.config.BlocklistEnabledForIncomingConnections && t.session.blocklist != nil && t.session.blocklist.Blocked(ip) {
-		t.log.Debugln("peer is blocked:", conn.RemoteAddr().String())
-		conn.Close()
-		return
-	}
-	if _, ok := t.connectedPeerIPs[ipstr]; ok {
-		t.log.Debugln("received duplicate connection from same IP: ", ipstr)
-		conn.Close()
-		return
-	}
-	if _, ok := t.bannedPeerIPs[ipstr]; ok {
-		t.log.Debugln("connection attempt from banned IP: ", ipstr)
+	if !t.checkIncomingConnection(conn) {
 		conn.Close()
 		return
 	}
+	ipstr := btconn.PeerAddr(conn).IP.String()
 	h := incominghandshaker.New(conn)
 	t.incomingHandshakers[h] = struct{}{}
 	t.connectedPeerIPs[ipstr] = struct{}{}
 	go h.Run(
-		t.peerID,
 		t.getSKey,
-		t.checkInfoHash,
+		t.getPeerID,
 		t.incomingHandshakerResultC,
 		t.session.config.PeerHandshakeTimeout,
 		t.session.extensions,
 		t.session.config.ForceIncomingEncryption,
 	)
 }
+
+// handleSharedPortConnection starts a peer for a connection accepted on the port shared by all torrents in Session.
+// Handshake is already done by the Session.
+func (t *torrent) handleSharedPortConnection(ih *incominghandshaker.IncomingHandshaker) {
+	if !t.acceptingSharedPort || !t.checkIncomingConnection(ih.Conn) {
+		ih.Conn.Close()
+		return
+	}
+	t.connectedPeerIPs[btconn.PeerAddr(ih.Conn).IP.String()] = struct{}{}
+	t.startPeer(ih.Conn, peersource.Incoming, t.incomingPeers, ih.PeerID, ih.Extensions, ih.Cipher)
+}
+
+// checkIncomingConnection returns false if the connection must be rejected.
+func (t *torrent) checkIncomingConnection(conn net.Conn) bool {
+	if len(t.incomingHandshakers)+len(t.incomingPeers) >= t.maxPeerAccept() {
+		t.log.Debugln("peer limit reached, rejecting peer", conn.RemoteAddr().String())
+		return false
+	}
+	ip := btconn.PeerAddr(conn).IP
+	ipstr := ip.String()
+	if t.session.config.BlocklistEnabledForIncomingConnections && t.session.blocklist != nil && t.session.blocklist.Blocked(ip) {
+		t.log.Debugln("peer is blocked:", conn.RemoteAddr().String())
+		t.session.metrics.BlockListRejectedIncoming.Inc(1)
+		return false
+	}
+	if t.allowlist != nil && !t.allowlist.Allowed(ip) {
+		t.log.Debugln("peer is not in allowlist:", conn.RemoteAddr().String())
+		return false
+	}
+	if _, ok := t.connectedPeerIPs[ipstr]; ok {
+		t.log.Debugln("received duplicate connection from same IP: ", ipstr)
+		return false
+	}
+	if _, ok := t.bannedPeerIPs[ipstr]; ok {
+		t.log.Debugln("connection attempt from banned IP: ", ipstr)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package torrent
+
+import (
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/metainfo"
+)
+
+// CreateTorrentOptions contains options for creating a new torrent with CreateTorrent.
+type CreateTorrentOptions struct {
+	// Files or directories to include in the torrent.
+	Paths []string
+	// Paths in the torrent are relative to Root. Required if more than one path is given.
+	Root string
+	// Name of the torrent. Defaults to the base name of the path if a single path is given.
+	Name string
+	// Length of a single piece. Must be a multiple of 16K, or a power of two for v2 torrents.
+	// If zero, it is calculated automatically based on the total size of files.
+	PieceLength uint32
+	// Set the private flag for private trackers. Private torrents are not shared over DHT and PEX.
+	Private bool
+	// Tiers of tracker URLs.
+	Trackers [][]string
+	// Webseed URLs.
+	Webseeds []string
+	// Optional comment.
+	Comment string
+	// Create a BitTorrent v2 (BEP 52) torrent. Pieces are hashed with SHA-256 merkle trees.
+	V2 bool
+}
+
+// CreateTorrent reads and hashes the files on disk and returns the contents of the new .torrent file.
+// Pieces are hashed concurrently using all CPUs.
+//
+// To seed the created torrent, place the files into the data directory of the torrent
+// and add it with Session.AddTorrent. Existing files are verified when the torrent is started,
+// so the torrent starts seeding without downloading anything.
+func CreateTorrent(opt CreateTorrentOptions) ([]byte, error) {
+	var info, pieceLayers []byte
+	var err error
+	if opt.V2 {
+		info, pieceLayers, err = metainfo.NewInfoBytesV2(opt.Root, opt.Paths, opt.Private, opt.PieceLength, opt.Name, logger.New("create torrent"))
+	} else {
+		info, err = metainfo.NewInfoBytes(opt.Root, opt.Paths, opt.Private, opt.PieceLength, opt.Name, logger.New("create torrent"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return metainfo.NewBytes(info, pieceLayers, opt.Trackers, opt.Webseeds, opt.Comment)
+}
@@ -0,0 +1,317 @@
+package torrent
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/piecepicker"
+)
+
+// FilePriority is the download priority of a file in torrent.
+type FilePriority int
+
+const (
+	// FilePrioritySkip means that the file is not downloaded.
+	// Pieces that are shared with other files are still downloaded.
+	FilePrioritySkip FilePriority = -1
+	// FilePriorityNormal is the default priority of files.
+	FilePriorityNormal FilePriority = 0
+	// FilePriorityHigh files are downloaded before the files with normal priority.
+	FilePriorityHigh FilePriority = 1
+)
+
+// File is a file in torrent.
+type File struct {
+	// Path of the file relative to the torrent directory.
+	Path string
+	// Length of the file in bytes.
+	Length int64
+	// Padding files are not written to disk.
+	Padding bool
+	// Download priority of the file.
+	Priority FilePriority
+	// Number of bytes of the file that are downloaded and passed hash check.
+	Completed int64
+}
+
+type filesRequest struct {
+	Response chan filesResponse
+}
+
+type filesResponse struct {
+	Files []File
+	Error error
+}
+
+type filePrioritiesRequest struct {
+	Priorities []FilePriority
+	Response   chan error
+}
+
+// Files returns the files in torrent. Returns error if the metadata of the torrent is not downloaded yet.
+func (t *torrent) Files() ([]File, error) {
+	req := filesRequest{Response: make(chan filesResponse, 1)}
+	select {
+	case t.filesCommandC <- req:
+	case <-t.closeC:
+		return nil, ErrTorrentClosed
+	}
+	select {
+	case resp := <-req.Response:
+		return resp.Files, resp.Error
+	case <-t.closeC:
+		return nil, ErrTorrentClosed
+	}
+}
+
+// SetFilePriorities sets the download priorities of files in torrent.
+func (t *torrent) SetFilePriorities(priorities []FilePriority) error {
+	req := filePrioritiesRequest{Priorities: priorities, Response: make(chan error, 1)}
+	select {
+	case t.filePrioritiesCommandC <- req:
+	case <-t.closeC:
+		return ErrTorrentClosed
+	}
+	select {
+	case err := <-req.Response:
+		return err
+	case <-t.closeC:
+		return ErrTorrentClosed
+	}
+}
+
+func (t *torrent) handleFiles() filesResponse {
+	if t.info == nil {
+		return filesResponse{Error: errors.New("torrent metadata not ready")}
+	}
+	files := make([]File, len(t.info.Files))
+	var offset int64
+	for i, f := range t.info.Files {
+		files[i] = File{
+			Path:     f.Path,
+			Length:   f.Length,
+			Padding:  f.Padding,
+			Priority: t.filePriority(i),
+		}
+		files[i].Completed = t.bytesCompleteInRange(offset, offset+f.Length)
+		offset += f.Length
+	}
+	return filesResponse{Files: files}
+}
+
+func (t *torrent) handleSetFilePriorities(priorities []FilePriority) error {
+	if t.info == nil {
+		return errors.New("torrent metadata not ready")
+	}
+	if len(priorities) != len(t.info.Files) {
+		return errors.New("number of priorities must be equal to the number of files")
+	}
+	for _, p := range priorities {
+		if p < FilePrioritySkip || p > FilePriorityHigh {
+			return errors.New("invalid file priority")
+		}
+	}
+	t.filePriorities = append([]FilePriority(nil), priorities...)
+	t.updateWantedPieces()
+	t.updatePiecePriorities()
+	t.checkWantedPieces()
+	return nil
+}
+
+func (t *torrent) filePriority(i int) FilePriority {
+	if len(t.filePriorities) != len(t.info.Files) {
+		return FilePriorityNormal
+	}
+	return t.filePriorities[i]
+}
+
+// updateWantedPieces calculates the priorities of pieces from the priorities of the files they belong to.
+// A piece is skipped only if all of the files that it belongs to are skipped.
+// If a byte range is set with SetByteRangeWanted, only the pieces in the range are wanted regardless of the priorities of files.
+// Priorities set with SetPiecePriority override the priorities of files and the byte range.
+func (t *torrent) updateWantedPieces() {
+	t.skippedPieces = nil
+	t.filePiecePriorities = make(map[uint32]int)
+	if t.info == nil {
+		return
+	}
+	pieceLength := int64(t.info.PieceLength)
+	wanted := bitfield.New(t.info.NumPieces)
+	var offset int64
+	for i, f := range t.info.Files {
+		begin, end := offset, offset+f.Length
+		offset = end
+		priority := t.filePriority(i)
+		if f.Padding || f.Length == 0 || priority == FilePrioritySkip {
+			continue
+		}
+		for j := uint32(begin / pieceLength); j <= uint32((end-1)/pieceLength); j++ {
+			wanted.Set(j)
+			if p := int(priority); p > t.filePiecePriorities[j] {
+				t.filePiecePriorities[j] = p
+			}
+		}
+	}
+	if t.wantedRange.length > 0 {
+		wanted = bitfield.New(t.info.NumPieces)
+		begin, end := t.wantedRangeSection()
+		for j := uint32(begin / pieceLength); j <= uint32((end-1)/pieceLength); j++ {
+			wanted.Set(j)
+		}
+	}
+	for i, p := range t.piecePriorities {
+		if p == PiecePrioritySkip {
+			wanted.Clear(i)
+		} else {
+			wanted.Set(i)
+		}
+	}
+	if wanted.All() {
+		return
+	}
+	t.skippedPieces = bitfield.New(t.info.NumPieces)
+	for i := uint32(0); i < t.info.NumPieces; i++ {
+		if !wanted.Test(i) {
+			t.skippedPieces.Set(i)
+		}
+	}
+}
+
+// pieceSkipped returns true if the piece at index does not need to be downloaded.
+// Pieces in the readahead window of a Reader are always downloaded.
+func (t *torrent) pieceSkipped(i uint32) bool {
+	if t.skippedPieces == nil || !t.skippedPieces.Test(i) {
+		return false
+	}
+	readahead := t.readahead()
+	for _, pos := range t.readers {
+		if i >= pos && i-pos < readahead {
+			return false
+		}
+	}
+	return true
+}
+
+// wantedPiecesDone returns true if all pieces are downloaded except the skipped ones.
+func (t *torrent) wantedPiecesDone() bool {
+	if t.skippedPieces == nil {
+		return t.bitfield.All()
+	}
+	for i := uint32(0); i < t.bitfield.Len(); i++ {
+		if !t.bitfield.Test(i) && !t.pieceSkipped(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWantedPieces updates the completion status of the torrent after the set of wanted pieces is changed.
+// A completed torrent starts downloading again if there are new pieces to download.
+func (t *torrent) checkWantedPieces() {
+	switch t.status() {
+	case Downloading:
+		if t.checkCompletion() && t.stopAfterDownload {
+			t.stopAndSetStoppedOnComplete()
+		}
+	case Seeding:
+		if t.wantedPiecesDone() {
+			return
+		}
+		t.updateSeedDuration(time.Now())
+		t.completed = false
+		t.completeC = make(chan struct{})
+		t.piecePicker = piecepicker.New(t.pieces, t.session.config.EndgameMaxDuplicateDownloads, t.webseedSources)
+		t.piecePicker.SetSequential(t.sequential)
+		t.piecePicker.SetRandomFirstPieces(t.session.config.RandomFirstPieces)
+		t.piecePicker.SetEndgameThreshold(t.session.config.EndgameRemainingBlocks, t.session.config.EndgameRemainingPercent)
+		t.updatePiecePriorities()
+		for pe := range t.peers {
+			for i := uint32(0); i < pe.Bitfield.Len(); i++ {
+				if pe.Bitfield.Test(i) {
+					t.piecePicker.HandleHave(pe, i)
+				}
+			}
+			t.updateInterestedState(pe)
+		}
+		for _, r := range t.completedPeerAddrs {
+			t.addrList.Push(t.filterBannedIPs([]*net.TCPAddr{r.addr}), r.source)
+		}
+		t.completedPeerAddrs = nil
+		t.addFixedPeers()
+		t.dialAddresses()
+		t.startPieceDownloaders()
+	case Stopped:
+		if t.completed && t.bitfield != nil && !t.wantedPiecesDone() {
+			t.completed = false
+			t.completeC = make(chan struct{})
+		}
+	}
+}
+
+// bytesCompleteInRange returns the number of downloaded bytes in the section [begin, end) of torrent data.
+func (t *torrent) bytesCompleteInRange(begin, end int64) int64 {
+	if t.bitfield == nil || begin >= end {
+		return 0
+	}
+	pieceLength := int64(t.info.PieceLength)
+	var n int64
+	for i := uint32(begin / pieceLength); i <= uint32((end-1)/pieceLength); i++ {
+		if !t.bitfield.Test(i) {
+			continue
+		}
+		pieceBegin := int64(i) * pieceLength
+		pieceEnd := pieceBegin + pieceLength
+		if pieceBegin < begin {
+			pieceBegin = begin
+		}
+		if pieceEnd > end {
+			pieceEnd = end
+		}
+		n += pieceEnd - pieceBegin
+	}
+	return n
+}
+
+// bytesWanted returns the total length of pieces that are not skipped and the length of the ones that are not downloaded yet.
+func (t *torrent) bytesWanted() (wanted, incomplete int64) {
+	pieceLength := int64(t.info.PieceLength)
+	for i := uint32(0); i < t.info.NumPieces; i++ {
+		if t.skippedPieces != nil && t.skippedPieces.Test(i) {
+			continue
+		}
+		pieceEnd := int64(i+1) * pieceLength
+		if pieceEnd > t.info.Length {
+			pieceEnd = t.info.Length
+		}
+		n := pieceEnd - int64(i)*pieceLength
+		wanted += n
+		if t.bitfield == nil || !t.bitfield.Test(i) {
+			incomplete += n
+		}
+	}
+	return
+}
+
+func filePrioritiesToInts(priorities []FilePriority) []int {
+	if len(priorities) == 0 {
+		return nil
+	}
+	ret := make([]int, len(priorities))
+	for i, p := range priorities {
+		ret[i] = int(p)
+	}
+	return ret
+}
+
+func filePrioritiesFromInts(values []int) []FilePriority {
+	if len(values) == 0 {
+		return nil
+	}
+	ret := make([]FilePriority, len(values))
+	for i, v := range values {
+		ret[i] = FilePriority(v)
+	}
+	return ret
+}
@@ -3,6 +3,7 @@ package torrent
 import (
 	"net"
 
+	"github.com/cenkalti/rain/internal/btconn"
 	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
 	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
 	"github.com/cenkalti/rain/internal/peersource"
@@ -15,14 +16,14 @@ func (t *torrent) getSKey(sKeyHash [20]byte) []byte {
 	return nil
 }
 
-func (t *torrent) checkInfoHash(infoHash [20]byte) bool {
-	return infoHash == t.infoHash
+func (t *torrent) getPeerID(infoHash [20]byte) ([20]byte, bool) {
+	return t.peerID, infoHash == t.infoHash
 }
 
 func (t *torrent) handleIncomingHandshakeDone(ih *incominghandshaker.IncomingHandshaker) {
 	delete(t.incomingHandshakers, ih)
 	if ih.Error != nil {
-		delete(t.connectedPeerIPs, ih.Conn.RemoteAddr().(*net.TCPAddr).IP.String())
+		delete(t.connectedPeerIPs, btconn.PeerAddr(ih.Conn).IP.String())
 		return
 	}
 	t.startPeer(ih.Conn, peersource.Incoming, t.incomingPeers, ih.PeerID, ih.Extensions, ih.Cipher)
@@ -32,8 +33,20 @@ func (t *torrent) handleOutgoingHandshakeDone(oh *outgoinghandshaker.OutgoingHan
 	delete(t.outgoingHandshakers, oh)
 	if oh.Error != nil {
 		delete(t.connectedPeerIPs, oh.Addr.IP.String())
+		for _, fa := range oh.Fallbacks {
+			delete(t.connectedPeerIPs, fa.IP.String())
+		}
+		t.scheduleDialRetry(oh.Addr, oh.Source)
 		t.dialAddresses()
 		return
 	}
+	// Only the address that won the race stays connected.
+	connectedIP := btconn.PeerAddr(oh.Conn).IP
+	for _, a := range append([]*net.TCPAddr{oh.Addr}, oh.Fallbacks...) {
+		if !a.IP.Equal(connectedIP) {
+			delete(t.connectedPeerIPs, a.IP.String())
+		}
+	}
+	delete(t.dialFailures, oh.Addr.String())
 	t.startPeer(oh.Conn, oh.Source, t.outgoingPeers, oh.PeerID, oh.Extensions, oh.Cipher)
 }
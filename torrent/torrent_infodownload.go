@@ -24,8 +24,18 @@ func (t *torrent) nextInfoDownload() *infodownloader.InfoDownloader {
 		if !ok {
 			continue
 		}
+		if t.metadataFromSinglePeer {
+			t.log.Debugln("downloading info from", pe.String(), "without sharing blocks")
+			return infodownloader.New(pe, infodownloader.NewMetadata(pe.MetadataSize()))
+		}
+		if t.metadata == nil {
+			t.metadata = infodownloader.NewMetadata(pe.MetadataSize())
+		} else if t.metadata.Size() != int64(pe.MetadataSize()) {
+			// Peers reporting a different size cannot be sending the same info dictionary.
+			continue
+		}
 		t.log.Debugln("downloading info from", pe.String())
-		return infodownloader.New(pe)
+		return infodownloader.New(pe, t.metadata)
 	}
 	return nil
 }
@@ -0,0 +1,45 @@
+package torrent
+
+import "strings"
+
+// Labels returns a copy of the labels of the torrent.
+func (t *torrent) Labels() []string {
+	t.mLabels.RLock()
+	defer t.mLabels.RUnlock()
+	return append([]string(nil), t.labels...)
+}
+
+func (t *torrent) setLabels(labels []string) {
+	t.mLabels.Lock()
+	t.labels = labels
+	t.mLabels.Unlock()
+}
+
+func (t *torrent) hasLabel(label string) bool {
+	t.mLabels.RLock()
+	defer t.mLabels.RUnlock()
+	for _, l := range t.labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeLabels trims the spaces around labels and removes empty and duplicate labels by keeping the order.
+func normalizeLabels(labels []string) []string {
+	var ret []string
+	seen := make(map[string]struct{}, len(labels))
+	for _, l := range labels {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		if _, ok := seen[l]; ok {
+			continue
+		}
+		seen[l] = struct{}{}
+		ret = append(ret, l)
+	}
+	return ret
+}
@@ -9,10 +9,8 @@ import (
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/peerconn/peerwriter"
 	"github.com/cenkalti/rain/internal/peerprotocol"
-	"github.com/cenkalti/rain/internal/peersource"
 	"github.com/cenkalti/rain/internal/piecedownloader"
 	"github.com/cenkalti/rain/internal/piecewriter"
-	"github.com/cenkalti/rain/internal/tracker"
 )
 
 func (t *torrent) handlePieceMessage(pm peer.PieceMessage) {
@@ -96,20 +94,19 @@ func (t *torrent) handlePieceMessage(pm peer.PieceMessage) {
 	t.closePieceDownloader(pd)
 	pe.StopSnubTimer()
 
-	if piece.Writing {
-		panic("piece is already writing")
+	if piece.Writing || piece.Done {
+		// Piece is downloaded from a webseed source at the same time.
+		t.bytesWasted.Inc(int64(len(pd.Buffer.Data)))
+		pd.Buffer.Release()
+		t.startPieceDownloaderFor(pe)
+		return
 	}
 	piece.Writing = true
 
 	// Request next piece while writing the completed piece, being optimistic about hash check.
 	t.startPieceDownloaderFor(pe)
 
-	// Prevent receiving piece messages to avoid more than 1 write per torrent.
-	t.pieceMessagesC.Suspend()
-	t.webseedPieceResultC.Suspend()
-
-	pw := piecewriter.New(piece, pe, pd.Buffer)
-	go pw.Run(t.pieceWriterResultC, t.doneC, t.session.metrics.WritesPerSecond, t.session.metrics.SpeedWrite, t.session.semWrite)
+	t.writePiece(piecewriter.New(piece, pe, pd.Buffer))
 }
 
 func (t *torrent) handlePeerMessage(pm peer.Message) {
@@ -220,7 +217,9 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		t.startPieceDownloaders()
 	case peerprotocol.InterestedMessage:
 		pe.PeerInterested = true
-		t.unchoker.FastUnchoke(pe)
+		if t.uploadEnabled() {
+			t.unchoker.FastUnchoke(pe)
+		}
 	case peerprotocol.NotInterestedMessage:
 		pe.PeerInterested = false
 	case peerprotocol.RequestMessage:
@@ -245,17 +244,25 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			pe.SendMessage(m)
 			break
 		}
+		if !t.uploadEnabled() {
+			if pe.FastEnabled {
+				m := peerprotocol.RejectMessage{RequestMessage: msg}
+				pe.SendMessage(m)
+			}
+			break
+		}
+		t.addRecentPieceRequest(pi.Index)
 		if pe.ClientChoking {
 			if pe.FastEnabled {
 				if pe.SentAllowedFast.Has(pi) {
-					pe.SendPiece(msg, cachedpiece.New(pi, t.session.pieceCache, t.session.config.ReadCacheBlockSize, t.peerID))
+					pe.SendPiece(msg, cachedpiece.New(t.pieceReader, pi, t.session.pieceCache, t.session.config.ReadCacheBlockSize, t.peerID))
 				} else {
 					m := peerprotocol.RejectMessage{RequestMessage: msg}
 					pe.SendMessage(m)
 				}
 			}
 		} else {
-			pe.SendPiece(msg, cachedpiece.New(pi, t.session.pieceCache, t.session.config.ReadCacheBlockSize, t.peerID))
+			pe.SendPiece(msg, cachedpiece.New(t.pieceReader, pi, t.session.pieceCache, t.session.config.ReadCacheBlockSize, t.peerID))
 		}
 	case peerprotocol.RejectMessage:
 		if t.pieces == nil || t.bitfield == nil {
@@ -324,31 +331,21 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		if _, ok := msg.M[peerprotocol.ExtensionKeyMetadata]; ok {
 			t.startInfoDownloaders()
 		}
-		if t.session.config.PEXEnabled {
+		if t.pexEnabled() {
 			if _, ok := msg.M[peerprotocol.ExtensionKeyPEX]; ok {
-				if t.info != nil && !t.info.Private {
-					pe.StartPEX(t.peers, &t.recentlySeen)
-				}
+				pe.StartPEX(t.peers, &t.recentlySeen)
 			}
 		}
 	case peerprotocol.ExtensionMetadataMessage:
 		t.handleMetadataMessage(pe, msg)
 	case peerprotocol.ExtensionPEXMessage:
-		if !t.session.config.PEXEnabled {
-			break
-		}
-		addrs, err := tracker.DecodePeersCompact([]byte(msg.Added))
-		if err != nil {
-			t.log.Error(err)
-			break
-		}
-		t.handleNewPeers(addrs, peersource.PEX)
-		addrs, err = tracker.DecodePeersCompact([]byte(msg.Dropped))
-		if err != nil {
-			t.log.Error(err)
-			break
-		}
-		t.handleNewPeers(addrs, peersource.PEX)
+		t.handlePEXMessage(pe, msg)
+	case peerprotocol.HashRequestMessage:
+		t.handleHashRequest(pe, msg)
+	case peerprotocol.HashesMessage:
+		t.handleHashes(pe, msg)
+	case peerprotocol.HashRejectMessage:
+		t.handleHashReject(pe, msg)
 	default:
 		panic(fmt.Sprintf("unhandled peer message type: %T", msg))
 	}
@@ -359,11 +356,11 @@ func (t *torrent) updateInterestedState(pe *peer.Peer) {
 		return
 	}
 	interested := false
-	if !t.completed {
+	if !t.completed && t.transferMode != TransferModeUploadOnly {
 		for i := uint32(0); i < t.bitfield.Len(); i++ {
 			weHave := t.bitfield.Test(i)
 			peerHave := pe.Bitfield.Test(i)
-			if !weHave && peerHave {
+			if !weHave && peerHave && !t.pieceSkipped(i) {
 				interested = true
 				break
 			}
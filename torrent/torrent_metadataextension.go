@@ -1,12 +1,11 @@
 package torrent
 
 import (
-	"bytes"
-	"crypto/sha1"
 	"errors"
 	"fmt"
 
 	"github.com/cenkalti/rain/internal/bufferpool"
+	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/peerprotocol"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
@@ -65,24 +64,45 @@ func (t *torrent) handleMetadataMessage(pe *peer.Peer, msg peerprotocol.Extensio
 			t.startInfoDownloaders()
 			break
 		}
-		if !id.Done() {
-			id.RequestBlocks(t.maxAllowedRequests(pe))
-			pe.ResetSnubTimer()
+		if !id.Metadata.Done() {
+			if _, ok := t.infoDownloadersSnubbed[pe]; !ok {
+				t.requestMetadataBlocks(id)
+			}
 			break
 		}
 		pe.StopSnubTimer()
 
-		hash := sha1.New()
-		_, _ = hash.Write(id.Bytes)
-		if !bytes.Equal(hash.Sum(nil), t.infoHash[:]) {
-			pe.Logger().Errorln("received info does not match with hash")
-			t.closePeer(id.Peer.(*peer.Peer))
+		if !metainfo.VerifyInfoHash(id.Metadata.Bytes, t.infoHash) {
+			sources := id.Metadata.Sources()
+			if len(sources) == 1 {
+				// Whole info is sent by a single peer, so we know that it is lying.
+				src := sources[0].(*peer.Peer)
+				t.log.Errorf("received info from %s does not match with hash, banning peer", src.String())
+				t.bannedPeerIPs[src.IP()] = struct{}{}
+				t.closePeer(src)
+			} else {
+				// Blocks have come from different peers. We cannot know which one is sending bad data.
+				// Download the info again by getting a complete copy from each peer, then ban only the lying ones.
+				t.log.Errorf("received info from %d peers does not match with hash, downloading from single peers", len(sources))
+				t.metadataFromSinglePeer = true
+			}
+			// Throw away the blocks. Downloaders sharing them start over.
+			for _, id2 := range t.infoDownloaders {
+				if id2.Metadata == id.Metadata {
+					t.closeInfoDownloader(id2)
+				}
+			}
+			if t.metadata == id.Metadata {
+				t.metadata = nil
+			}
 			t.startInfoDownloaders()
 			break
 		}
+		metadata := id.Metadata.Bytes
 		t.stopInfoDownloaders()
+		t.metadata = nil
 
-		info, err := t.session.parseInfo(id.Bytes, boltdbresumer.LatestVersion)
+		info, err := t.session.parseInfo(metadata, boltdbresumer.LatestVersion)
 		if err != nil {
 			t.stop(fmt.Errorf("cannot parse info bytes: %s", err))
 			break
@@ -91,8 +111,16 @@ func (t *torrent) handleMetadataMessage(pe *peer.Peer, msg peerprotocol.Extensio
 			t.stop(errors.New("private torrent from magnet"))
 			break
 		}
+		// Hybrid torrents may be added with their v2 info hash.
+		info.Hash = t.infoHash
+		err = t.limits.check(info)
+		if err != nil {
+			t.stop(err)
+			break
+		}
 		t.info = info
 		t.piecePool = bufferpool.New(int(info.PieceLength))
+		t.updateWantedPieces()
 		err = t.session.resumer.WriteInfo(t.id, t.info.Bytes)
 		if err != nil {
 			t.stop(fmt.Errorf("cannot write resume info: %s", err))
@@ -106,6 +134,7 @@ func (t *torrent) handleMetadataMessage(pe *peer.Peer, msg peerprotocol.Extensio
 		if t.stopAfterMetadata {
 			t.stopAndSetStoppedOnMetadata()
 		} else {
+			t.startPEX()
 			t.startAllocator()
 		}
 	case peerprotocol.ExtensionMetadataMessageTypeReject:
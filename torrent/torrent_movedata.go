@@ -0,0 +1,102 @@
+package torrent
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/cenkalti/rain/internal/storage/filestorage"
+)
+
+var (
+	errMovingData     = errors.New("files are being moved")
+	errStorageNotDisk = errors.New("storage does not keep files on disk")
+)
+
+type moveDataRequest struct {
+	Dir      string
+	Storage  Storage
+	Response chan error
+}
+
+// MoveData moves the files of the torrent into dir and returns after the files are moved.
+// Running torrents are stopped during the move instead of pausing only the piece writers,
+// because open files, the read cache and peers serving blocks also refer to the old location.
+// The torrent is started again after the move, whether the move succeeds or not.
+func (t *torrent) MoveData(dir string, sto Storage) error {
+	req := moveDataRequest{Dir: dir, Storage: sto, Response: make(chan error, 1)}
+	select {
+	case t.moveDataCommandC <- req:
+	case <-t.closeC:
+		return ErrTorrentClosed
+	}
+	select {
+	case err := <-req.Response:
+		return err
+	case <-t.closeC:
+		return ErrTorrentClosed
+	}
+}
+
+func (t *torrent) handleMoveData(req moveDataRequest) {
+	if t.moveDataRequest != nil {
+		req.Response <- errMovingData
+		return
+	}
+	src, dst := t.storage.RootDir(), req.Storage.RootDir()
+	if src == "" || dst == "" {
+		req.Response <- errStorageNotDisk
+		return
+	}
+	t.moveDataRequest = &req
+	if filepath.Clean(src) == filepath.Clean(dst) {
+		t.moveDataResultC <- nil
+		return
+	}
+	// Files must be closed and piece writers must be finished before moving files.
+	// Stopping the torrent does both.
+	switch t.status() {
+	case Stopped, Stopping:
+	default:
+		t.startAfterMove = true
+		t.stop(nil)
+	}
+	var names []string
+	if t.info != nil {
+		for _, f := range t.info.Files {
+			if !f.Padding {
+				names = append(names, f.Path)
+			}
+		}
+	}
+	t.log.Infof("moving files from %s to %s", src, dst)
+	perm := t.session.config.FilePermissions
+	go func() {
+		moved, err := filestorage.Move(src, dst, names, perm)
+		if err != nil && len(moved) > 0 {
+			// Move back the files that are moved so far.
+			_, _ = filestorage.Move(dst, src, moved, perm)
+		}
+		t.moveDataResultC <- err
+	}()
+}
+
+func (t *torrent) handleMoveDataDone(err error) {
+	req := t.moveDataRequest
+	t.moveDataRequest = nil
+	if err == nil {
+		err = t.session.resumer.WriteDest(t.id, req.Dir)
+	}
+	if err != nil {
+		t.log.Errorf("cannot move files: %s", err)
+	} else {
+		t.log.Info("files are moved")
+		t.dest = req.Dir
+		t.storage = req.Storage
+	}
+	req.Response <- err
+	// If the torrent is still in Stopping state, it is started in handleStopped.
+	if t.startAfterMove && t.status() == Stopped {
+		t.startAfterMove = false
+		t.start()
+	}
+}
@@ -0,0 +1,103 @@
+package torrent
+
+import "errors"
+
+// TransferMode restricts the direction of data transfer of a torrent.
+type TransferMode int
+
+const (
+	// TransferModeNormal allows both downloading and uploading.
+	TransferModeNormal TransferMode = iota
+	// TransferModeUploadOnly disables downloading. Pieces that are already downloaded are served to peers.
+	TransferModeUploadOnly
+	// TransferModeDownloadOnly disables uploading. Peers are kept choked.
+	TransferModeDownloadOnly
+)
+
+func (m TransferMode) String() string {
+	switch m {
+	case TransferModeNormal:
+		return "Normal"
+	case TransferModeUploadOnly:
+		return "Upload only"
+	case TransferModeDownloadOnly:
+		return "Download only"
+	default:
+		return "Unknown"
+	}
+}
+
+var errInvalidTransferMode = errors.New("invalid transfer mode")
+
+// downloadEnabled returns true if pieces can be downloaded from peers and webseed sources.
+func (t *torrent) downloadEnabled() bool {
+	return !t.paused && t.transferMode != TransferModeUploadOnly
+}
+
+// uploadEnabled returns true if peers can be unchoked and their requests can be served.
+func (t *torrent) uploadEnabled() bool {
+	return !t.paused && t.transferMode != TransferModeDownloadOnly
+}
+
+func (t *torrent) handlePause() {
+	if t.paused {
+		return
+	}
+	t.log.Info("pausing torrent")
+	t.paused = true
+	t.stopInfoDownloaders()
+	t.stopPieceDownloads()
+	t.unchoker.ChokeAll()
+}
+
+func (t *torrent) handleResume() {
+	if !t.paused {
+		return
+	}
+	t.log.Info("resuming torrent")
+	t.paused = false
+	t.startInfoDownloaders()
+	t.startPieceDownloaders()
+	if t.uploadEnabled() {
+		t.unchoker.TickUnchoke(t.getPeersForUnchoker(), t.completed)
+	}
+}
+
+func (t *torrent) handleSetTransferMode(mode TransferMode) {
+	if t.transferMode == mode {
+		return
+	}
+	t.log.Infof("setting transfer mode to %q", mode)
+	t.transferMode = mode
+	if t.downloadEnabled() {
+		t.startPieceDownloaders()
+	} else {
+		t.stopPieceDownloads()
+	}
+	if t.uploadEnabled() {
+		t.unchoker.TickUnchoke(t.getPeersForUnchoker(), t.completed)
+	} else {
+		t.unchoker.ChokeAll()
+	}
+	for pe := range t.peers {
+		t.updateInterestedState(pe)
+		// Let peers know that we are not going to download from them.
+		if pe.ExtensionsEnabled {
+			t.sendExtensionHandshake(pe)
+		}
+	}
+}
+
+// stopPieceDownloads cancels the piece downloads from peers and webseed sources.
+func (t *torrent) stopPieceDownloads() {
+	for _, pd := range t.pieceDownloaders {
+		t.closePieceDownloader(pd)
+		pd.CancelPending()
+	}
+	for _, src := range t.webseedSources {
+		if src.Downloader != nil {
+			t.closeWebseedDownloader(src)
+			t.webseedActiveDownloads--
+		}
+	}
+}
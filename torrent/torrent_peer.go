@@ -4,8 +4,10 @@ import (
 	"context"
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/btconn"
 	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
 	"github.com/cenkalti/rain/internal/mse"
 	"github.com/cenkalti/rain/internal/peer"
@@ -21,6 +23,9 @@ func (t *torrent) setNeedMorePeers(val bool) {
 	if t.dhtAnnouncer != nil {
 		t.dhtAnnouncer.NeedMorePeers(val)
 	}
+	if t.lsdAnnouncer != nil {
+		t.lsdAnnouncer.NeedMorePeers(val)
+	}
 }
 
 func (t *torrent) addPeerString(addr string) error {
@@ -56,12 +61,43 @@ func (t *torrent) resolveAndAddPeer(host string, port int) {
 		}
 		cancel()
 	}()
-	ip, err := resolver.ResolveIPv4(ctx, t.session.config.DNSResolveTimeout, host)
+	ips, err := resolver.ResolveAll(ctx, t.session.config.DNSResolveTimeout, host)
 	if err != nil {
 		return
 	}
-	addrs := []*net.TCPAddr{{IP: ip, Port: port}}
-	t.handleNewPeers(addrs, peersource.Manual)
+	addrs := make([]*net.TCPAddr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = &net.TCPAddr{IP: ip, Port: port}
+	}
+	select {
+	case t.resolvedPeerC <- addrs:
+	case <-t.closeC:
+	}
+}
+
+// handleResolvedPeer adds the first address of a hostname to the address list.
+// Other addresses are kept as fallbacks to be raced when the peer is dialed.
+func (t *torrent) handleResolvedPeer(addrs []*net.TCPAddr) {
+	if status := t.status(); status == Stopped || status == Stopping {
+		return
+	}
+	addrs = t.filterBannedIPs(addrs)
+	if bl := t.session.blocklist; bl != nil {
+		b := addrs[:0]
+		for _, addr := range addrs {
+			if !bl.Blocked(addr.IP) {
+				b = append(b, addr)
+			}
+		}
+		addrs = b
+	}
+	if len(addrs) == 0 {
+		return
+	}
+	if len(addrs) > 1 {
+		t.peerFallbackAddrs[addrs[0].String()] = addrs[1:]
+	}
+	t.handleNewPeers(addrs[:1], peersource.Manual)
 }
 
 func (t *torrent) handleNewPeers(addrs []*net.TCPAddr, source peersource.Source) {
@@ -72,7 +108,9 @@ func (t *torrent) handleNewPeers(addrs []*net.TCPAddr, source peersource.Source)
 	}
 	if !t.completed {
 		addrs = t.filterBannedIPs(addrs)
-		t.addrList.Push(addrs, source)
+		if n := t.addrList.Push(addrs, source); n > 0 {
+			t.session.metrics.BlockListRejectedOutgoing.Inc(int64(n))
+		}
 		t.dialAddresses()
 	}
 }
@@ -91,10 +129,21 @@ func (t *torrent) dialAddresses() {
 	if t.completed {
 		return
 	}
+	var tcpDialer btconn.Dialer
+	utpSocket := t.utpSocket
+	if pr := t.session.proxy; pr != nil {
+		// uTP cannot be used through the proxy.
+		tcpDialer = pr.Dialer(&net.Dialer{Control: t.socketOptions().Control}, !t.session.config.DisableProxyFallback)
+		utpSocket = nil
+	} else if t.tcpEnabled() {
+		tcpDialer = &net.Dialer{Control: t.socketOptions().Control}
+	} else if t.utpSocket == nil {
+		return
+	}
 	peersConnected := func() int {
 		return len(t.outgoingPeers) + len(t.outgoingHandshakers)
 	}
-	for peersConnected() < t.session.config.MaxPeerDial {
+	for peersConnected() < t.maxPeerDial() {
 		addr, src := t.addrList.Pop()
 		if addr == nil {
 			t.setNeedMorePeers(true)
@@ -104,9 +153,18 @@ func (t *torrent) dialAddresses() {
 		if _, ok := t.connectedPeerIPs[ip]; ok {
 			continue
 		}
-		h := outgoinghandshaker.New(addr, src)
+		var fallbacks []*net.TCPAddr
+		for _, fa := range t.peerFallbackAddrs[addr.String()] {
+			if _, ok := t.connectedPeerIPs[fa.IP.String()]; !ok {
+				fallbacks = append(fallbacks, fa)
+			}
+		}
+		h := outgoinghandshaker.New(addr, src, t.session.dialLimiter, fallbacks...)
 		t.outgoingHandshakers[h] = struct{}{}
 		t.connectedPeerIPs[ip] = struct{}{}
+		for _, fa := range fallbacks {
+			t.connectedPeerIPs[fa.IP.String()] = struct{}{}
+		}
 		go h.Run(
 			t.session.config.PeerConnectTimeout,
 			t.session.config.PeerHandshakeTimeout,
@@ -116,10 +174,67 @@ func (t *torrent) dialAddresses() {
 			t.session.extensions,
 			t.session.config.DisableOutgoingEncryption,
 			t.session.config.ForceOutgoingEncryption,
+			utpSocket,
+			tcpDialer,
 		)
 	}
 }
 
+type dialRetry struct {
+	addr   *net.TCPAddr
+	source peersource.Source
+}
+
+// scheduleDialRetry puts the address back to the address list after waiting for an exponentially increasing interval.
+func (t *torrent) scheduleDialRetry(addr *net.TCPAddr, source peersource.Source) {
+	if status := t.status(); status == Stopped || status == Stopping {
+		return
+	}
+	cfg := &t.session.config
+	key := addr.String()
+	n := t.dialFailures[key]
+	if n >= cfg.PeerDialRetries {
+		delete(t.dialFailures, key)
+		return
+	}
+	if _, ok := t.dialRetryTimers[key]; ok {
+		// Address is dialed again when the pending retry fires, this failure does not count as an attempt.
+		return
+	}
+	t.dialFailures[key] = n + 1
+	t.dialRetryTimers[key] = time.AfterFunc(cfg.PeerDialRetryInterval<<n, func() {
+		select {
+		case t.dialRetryC <- dialRetry{addr: addr, source: source}:
+		case <-t.closeC:
+		}
+	})
+}
+
+// stopDialRetries stops the timers of scheduled retries.
+func (t *torrent) stopDialRetries() {
+	for _, tm := range t.dialRetryTimers {
+		tm.Stop()
+	}
+	t.dialRetryTimers = make(map[string]*time.Timer)
+}
+
+func (t *torrent) handleDialRetry(r dialRetry) {
+	key := r.addr.String()
+	if _, ok := t.dialRetryTimers[key]; !ok {
+		// Timer is fired before the retries are stopped.
+		return
+	}
+	delete(t.dialRetryTimers, key)
+	if status := t.status(); status == Stopped || status == Stopping {
+		return
+	}
+	if t.completed {
+		return
+	}
+	t.addrList.Push(t.filterBannedIPs([]*net.TCPAddr{r.addr}), r.source)
+	t.dialAddresses()
+}
+
 func (t *torrent) startPeer(
 	conn net.Conn,
 	source peersource.Source,
@@ -128,7 +243,7 @@ func (t *torrent) startPeer(
 	extensions [8]byte,
 	cipher mse.CryptoMethod,
 ) {
-	addr := conn.RemoteAddr().(*net.TCPAddr)
+	addr := btconn.PeerAddr(conn)
 	t.pexAddPeer(addr)
 	_, ok := t.peerIDs[peerID]
 	if ok {
@@ -140,7 +255,7 @@ func (t *torrent) startPeer(
 	}
 	t.peerIDs[peerID] = struct{}{}
 
-	pe := peer.New(conn, source, peerID, extensions, cipher, t.session.config.PieceReadTimeout, t.session.config.RequestTimeout, t.session.config.MaxRequestsIn, t.session.bucketDownload, t.session.bucketUpload)
+	pe := peer.New(conn, source, peerID, extensions, cipher, t.session.config.PieceReadTimeout, t.session.config.RequestTimeout, t.session.config.MaxRequestsIn, t.bucketDownload, t.bucketUpload)
 	t.peers[pe] = struct{}{}
 	peers[pe] = struct{}{}
 	if t.info != nil {
@@ -150,6 +265,9 @@ func (t *torrent) startPeer(
 	t.session.metrics.Peers.Inc(1)
 	t.sendFirstMessage(pe)
 	t.recentlySeen.Add(pe.Addr())
+	if t.hashDownloader != nil && pe.V2Enabled {
+		t.hashDownloader.RequestHashes(pe, time.Now())
+	}
 }
 
 func (t *torrent) sendFirstMessage(p *peer.Peer) {
@@ -167,17 +285,8 @@ func (t *torrent) sendFirstMessage(p *peer.Peer) {
 		msg := peerprotocol.BitfieldMessage{Data: bitfieldData}
 		p.SendMessage(&msg)
 	}
-	var metadataSize uint32
-	if t.info != nil {
-		metadataSize = uint32(len(t.info.Bytes))
-	}
 	if p.ExtensionsEnabled {
-		extHandshakeMsg := peerprotocol.NewExtensionHandshake(metadataSize, t.getClientVersion(), p.Addr().IP, t.session.config.MaxRequestsIn)
-		msg := peerprotocol.ExtensionMessage{
-			ExtendedMessageID: peerprotocol.ExtensionIDHandshake,
-			Payload:           extHandshakeMsg,
-		}
-		p.SendMessage(msg)
+		t.sendExtensionHandshake(p)
 	}
 	if p.DHTEnabled {
 		msg := peerprotocol.PortMessage{Port: t.session.config.DHTPort}
@@ -188,6 +297,25 @@ func (t *torrent) sendFirstMessage(p *peer.Peer) {
 	}
 }
 
+func (t *torrent) sendExtensionHandshake(p *peer.Peer) {
+	var metadataSize uint32
+	if t.info != nil {
+		metadataSize = uint32(len(t.info.Bytes))
+	}
+	extHandshakeMsg := peerprotocol.NewExtensionHandshake(metadataSize, t.getClientVersion(), p.Addr().IP, t.session.config.MaxRequestsIn)
+	if t.transferMode == TransferModeUploadOnly {
+		extHandshakeMsg.UploadOnly = 1
+	}
+	if !t.pexEnabled() {
+		delete(extHandshakeMsg.M, peerprotocol.ExtensionKeyPEX)
+	}
+	msg := peerprotocol.ExtensionMessage{
+		ExtendedMessageID: peerprotocol.ExtensionIDHandshake,
+		Payload:           extHandshakeMsg,
+	}
+	p.SendMessage(msg)
+}
+
 func (t *torrent) getClientVersion() string {
 	if t.info != nil && t.info.Private {
 		return t.session.config.PrivateExtensionHandshakeClientVersion
@@ -214,6 +342,27 @@ func (t *torrent) handlePeerSnubbed(pe *peer.Peer) {
 			return
 		}
 		pe.Snubbed = true
+		pe.RequestTimeouts++
+		pd.Timeouts++
+		cfg := &t.session.config
+		if cfg.MaxPeerRequestTimeouts > 0 && pe.RequestTimeouts >= cfg.MaxPeerRequestTimeouts {
+			pe.Logger().Debugln("too many request timeouts:", pe.RequestTimeouts)
+			t.closePeer(pe)
+			t.bannedPeerIPs[pe.IP()] = struct{}{}
+			t.startPieceDownloaders()
+			return
+		}
+		if cfg.RequestTimeoutReassignAfter > 0 && pd.Timeouts >= cfg.RequestTimeoutReassignAfter {
+			// Give up on this peer and let other peers download the piece from scratch.
+			t.log.Debugf("re-assigning piece #%d after %d request timeouts from %s", pd.Piece.Index, pd.Timeouts, pe.IP())
+			t.closePieceDownloader(pd)
+			pd.CancelPending()
+			if t.piecePicker != nil {
+				t.piecePicker.HandleRequestTimeout(pe, pd.Piece.Index)
+			}
+			t.startPieceDownloaders()
+			return
+		}
 		t.pieceDownloadersSnubbed[pe] = pd
 		if t.piecePicker != nil {
 			t.piecePicker.HandleSnubbed(pe, pd.Piece.Index)
@@ -222,6 +371,8 @@ func (t *torrent) handlePeerSnubbed(pe *peer.Peer) {
 	} else if id, ok := t.infoDownloaders[pe]; ok {
 		pe.Snubbed = true
 		t.infoDownloadersSnubbed[pe] = id
+		// Let other peers request the blocks of the snubbed peer.
+		id.Release()
 		t.startInfoDownloaders()
 	}
 }
@@ -1,6 +1,48 @@
 package torrent
 
-import "net"
+import (
+	"net"
+	"time"
+
+	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+	"github.com/cenkalti/rain/internal/peersource"
+	"github.com/cenkalti/rain/internal/tracker"
+)
+
+const (
+	// PEX messages are sent once a minute. Messages that are received more frequently are ignored.
+	pexMinInterval = 30 * time.Second
+	// BEP 11: Except for the initial PEX message the combined amount of added v4/v6 contacts should not exceed 50 entries.
+	pexMaxAddedPeers = 50
+)
+
+// pexEnabled returns true if peer addresses can be exchanged with peers.
+// BEP 27: PEX must be disabled for private torrents.
+// Torrents of magnet links may turn out to be private, so PEX is disabled until the metadata is downloaded.
+func (t *torrent) pexEnabled() bool {
+	return t.session.config.PEXEnabled && t.info != nil && !t.info.Private
+}
+
+// startPEX enables PEX with the peers that are connected while the metadata is being downloaded.
+// The extension handshake is sent again to announce the PEX extension to these peers (BEP 10).
+func (t *torrent) startPEX() {
+	if !t.pexEnabled() {
+		return
+	}
+	for pe := range t.peers {
+		if !pe.ExtensionsEnabled {
+			continue
+		}
+		t.sendExtensionHandshake(pe)
+		if pe.ExtensionHandshake == nil {
+			continue
+		}
+		if _, ok := pe.ExtensionHandshake.M[peerprotocol.ExtensionKeyPEX]; ok {
+			pe.StartPEX(t.peers, &t.recentlySeen)
+		}
+	}
+}
 
 func (t *torrent) pexAddPeer(addr *net.TCPAddr) {
 	for pe := range t.peers {
@@ -17,3 +59,32 @@ func (t *torrent) pexDropPeer(addr *net.TCPAddr) {
 		}
 	}
 }
+
+func (t *torrent) handlePEXMessage(pe *peer.Peer, msg peerprotocol.ExtensionPEXMessage) {
+	if !t.pexEnabled() {
+		return
+	}
+	now := time.Now()
+	initial := pe.LastPEXMessage.IsZero()
+	if !initial && now.Sub(pe.LastPEXMessage) < pexMinInterval {
+		pe.Logger().Debugln("ignoring pex message received too early")
+		return
+	}
+	pe.LastPEXMessage = now
+	addrs, err := tracker.DecodePeersCompact([]byte(msg.Added))
+	if err != nil {
+		pe.Logger().Errorln("cannot decode pex message:", err)
+		return
+	}
+	addrs6, err := tracker.DecodePeersCompact6([]byte(msg.Added6))
+	if err != nil {
+		pe.Logger().Errorln("cannot decode pex message:", err)
+		return
+	}
+	addrs = append(addrs, addrs6...)
+	if !initial && len(addrs) > pexMaxAddedPeers {
+		addrs = addrs[:pexMaxAddedPeers]
+	}
+	// Dropped peers are not added to the address list because they have left the swarm or are not reachable.
+	t.handleNewPeers(addrs, peersource.PEX)
+}
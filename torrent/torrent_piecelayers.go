@@ -0,0 +1,138 @@
+package torrent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/rain/internal/hashdownloader"
+	"github.com/cenkalti/rain/internal/merkle"
+	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+// startHashDownloader starts downloading the piece layers of a v2 torrent that are not in the torrent file.
+// Pieces cannot be verified before their hashes are known, so files are allocated after the download is finished.
+func (t *torrent) startHashDownloader() {
+	if t.hashDownloader == nil {
+		t.log.Info("downloading piece layers")
+		t.hashDownloader = hashdownloader.New(t.info)
+	}
+	t.addFixedPeers()
+	t.startAcceptor()
+	t.startAnnouncers()
+	t.requestHashes()
+}
+
+func (t *torrent) requestHashes() {
+	if t.hashDownloader == nil {
+		return
+	}
+	now := time.Now()
+	for pe := range t.peers {
+		if pe.V2Enabled {
+			t.hashDownloader.RequestHashes(pe, now)
+		}
+	}
+}
+
+func (t *torrent) handleHashRequest(pe *peer.Peer, msg peerprotocol.HashRequestMessage) {
+	hashes, ok := t.hashesFor(msg)
+	if !ok {
+		pe.SendMessage(peerprotocol.HashRejectMessage{HashRequestMessage: msg})
+		return
+	}
+	pe.SendMessage(peerprotocol.HashesMessage{HashRequestMessage: msg, Hashes: hashes})
+}
+
+// hashesFor returns the hashes in the piece layer followed by the uncle hashes requested in msg.
+// Only the requests for piece layers are served.
+func (t *torrent) hashesFor(msg peerprotocol.HashRequestMessage) ([]byte, bool) {
+	if t.info == nil || !t.info.V2 {
+		return nil, false
+	}
+	layer, ok := t.info.PieceLayer(msg.PiecesRoot[:])
+	if !ok || layer.Hashes == nil {
+		return nil, false
+	}
+	if msg.BaseLayer != uint32(merkle.Log2(int(t.info.PieceLength/merkle.BlockSize))) {
+		return nil, false
+	}
+	width := merkle.NextPowerOfTwo(int(layer.NumPieces))
+	length := int(msg.Length)
+	index := int(msg.Index)
+	if length < 2 || length > hashdownloader.MaxHashesPerRequest || length&(length-1) != 0 || index%length != 0 || index+length > width {
+		return nil, false
+	}
+	numUncles := int(msg.ProofLayers) - merkle.Log2(length)
+	if numUncles < 0 {
+		numUncles = 0
+	}
+	if numUncles > merkle.Log2(width/length) {
+		return nil, false
+	}
+	pad := t.info.PieceLayerPad()
+	hashes := make([]byte, length*merkle.HashSize, (length+numUncles)*merkle.HashSize)
+	for i := 0; i < length; i++ {
+		// Layer is padded up to width.
+		h := pad
+		if begin := (index + i) * merkle.HashSize; begin < len(layer.Hashes) {
+			h = layer.Hashes[begin : begin+merkle.HashSize]
+		}
+		copy(hashes[i*merkle.HashSize:], h)
+	}
+	return append(hashes, merkle.Proof(layer.Hashes, width, pad, index, length, numUncles)...), true
+}
+
+func (t *torrent) handleHashes(pe *peer.Peer, msg peerprotocol.HashesMessage) {
+	if t.hashDownloader == nil {
+		return
+	}
+	err := t.hashDownloader.GotHashes(pe, msg)
+	if err != nil {
+		pe.Logger().Errorln("cannot verify hashes:", err)
+		t.closePeer(pe)
+		t.requestHashes()
+		return
+	}
+	if !t.hashDownloader.Done() {
+		t.hashDownloader.RequestHashes(pe, time.Now())
+		return
+	}
+	for _, l := range t.hashDownloader.Layers() {
+		err = t.info.SetPieceLayer(l.PiecesRoot, l.Hashes)
+		if err != nil {
+			t.stop(fmt.Errorf("cannot set piece layer: %s", err))
+			return
+		}
+	}
+	t.hashDownloader = nil
+	t.log.Info("piece layers are downloaded")
+	err = t.session.resumer.WritePieceLayers(t.id, t.info.PieceLayersBytes())
+	if err != nil {
+		t.stop(fmt.Errorf("cannot write resume info: %s", err))
+		return
+	}
+	t.startAllocator()
+}
+
+func (t *torrent) handleHashReject(pe *peer.Peer, msg peerprotocol.HashRejectMessage) {
+	if t.hashDownloader == nil {
+		return
+	}
+	t.hashDownloader.Rejected(pe, msg)
+	t.requestHashes()
+}
+
+// checkHashRequestTimeouts requests the hashes from other peers if a peer does not respond in time.
+func (t *torrent) checkHashRequestTimeouts(now time.Time) {
+	if t.hashDownloader == nil {
+		return
+	}
+	peers := t.hashDownloader.CheckTimeouts(now, t.session.config.MetadataRequestTimeout)
+	for _, pe := range peers {
+		pe.(*peer.Peer).Logger().Debugln("hash request timed out")
+	}
+	if len(peers) > 0 {
+		t.requestHashes()
+	}
+}
@@ -0,0 +1,144 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/magnet"
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/fortytw2/leaktest"
+)
+
+// v2Seeder starts seeding the test data as a v2 torrent and returns the torrent file.
+// Pieces are small, so the piece layers are requested in more than one chunk.
+func v2Seeder(t *testing.T) (addr string, torrentFile []byte, c func()) {
+	s, closeSession := newTestSession(t)
+	b, err := CreateTorrent(CreateTorrentOptions{
+		Paths:       []string{filepath.Join(torrentDataDir, torrentName)},
+		PieceLength: 16 << 10,
+		V2:          true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(s.config.DataDir, tor.ID()), os.ModeDir|s.config.FilePermissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CopyDir(filepath.Join(torrentDataDir, torrentName), filepath.Join(s.config.DataDir, tor.ID(), torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var port int
+	select {
+	case port = <-tor.torrent.NotifyListen():
+	case err = <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("seeder is not ready")
+	}
+	select {
+	case <-tor.NotifyComplete():
+	case <-time.After(timeout):
+		t.Fatal("seeder is not completed")
+	}
+	return "127.0.0.1:" + strconv.Itoa(port), b, closeSession
+}
+
+func TestDownloadV2Torrent(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, b, cl := v2Seeder(t)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	tor, err := s.AddTorrent(bytes.NewReader(b), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+}
+
+func TestDownloadV2Magnet(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, b, cl := v2Seeder(t)
+	defer cl()
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mi, err := metainfo.New(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Piece layers are not in the info dictionary, so they are downloaded from the seeder with hash requests.
+	sum := sha256.Sum256(mi.Info.Bytes)
+	m := magnet.Magnet{InfoHash: mi.Info.Hash, InfoHashV2: sum[:], Peers: []string{addr}}
+	tor, err := s.AddURI(m.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+	id := tor.ID()
+
+	// Torrent file contains the downloaded piece layers.
+	b2, err := tor.Torrent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi2, err := metainfo.New(bytes.NewReader(b2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mi2.Info.HasPieceLayers() {
+		t.Fatal("piece layers are missing in torrent file")
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Piece layers are saved in resume data, so the torrent is seeding after restart without downloading them again.
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor = s.GetTorrent(id)
+	if tor == nil {
+		t.Fatal("torrent is not loaded")
+	}
+	select {
+	case <-tor.NotifyComplete():
+	case <-time.After(timeout):
+		t.Fatalf("torrent is not completed after restart, status: %s", tor.Stats().Status)
+	}
+}
@@ -18,7 +18,7 @@ func (t *torrent) checkCompletion() bool {
 	if t.completed {
 		return true
 	}
-	if !t.bitfield.All() {
+	if !t.wantedPiecesDone() {
 		return false
 	}
 	t.completed = true
@@ -30,8 +30,12 @@ func (t *torrent) checkCompletion() bool {
 	for _, src := range t.webseedSources {
 		t.closeWebseedDownloader(src)
 	}
+	t.completedPeerAddrs = nil
 	for pe := range t.peers {
 		if !pe.PeerInterested {
+			if _, ok := t.outgoingPeers[pe]; ok {
+				t.completedPeerAddrs = append(t.completedPeerAddrs, dialRetry{addr: pe.Addr(), source: pe.Source})
+			}
 			t.closePeer(pe)
 		}
 	}
@@ -0,0 +1,350 @@
+package torrent
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/cenkalti/rain/internal/filesection"
+)
+
+// readerPriority is the priority of the pieces in the readahead window of a Reader.
+// It is higher than the priorities that can be set with SetPiecePriority.
+const readerPriority = 1 << 24
+
+// PiecePriority is the download priority of a piece in torrent.
+// Pieces with higher priority are downloaded first.
+// Values greater than PiecePriorityHigh can be used for ordering the pieces between each other.
+type PiecePriority int
+
+const (
+	// PiecePrioritySkip means that the piece is not downloaded.
+	PiecePrioritySkip PiecePriority = -1
+	// PiecePriorityNormal is the default priority of pieces.
+	PiecePriorityNormal PiecePriority = 0
+	// PiecePriorityHigh pieces are downloaded before the pieces with normal priority.
+	PiecePriorityHigh PiecePriority = 1
+)
+
+var errReaderClosed = errors.New("reader is closed")
+
+// Reader reads the data of a torrent. Read blocks until the piece containing the requested bytes is downloaded and verified.
+// Pieces after the current position of the Reader are downloaded with high priority.
+type Reader struct {
+	torrent *torrent
+	name    string
+
+	// Section of the torrent data that is read by this Reader.
+	begin, length int64
+
+	pieceLength int64
+	totalLength int64
+
+	offset int64
+
+	closeC    chan struct{}
+	closeOnce sync.Once
+}
+
+type newReaderRequest struct {
+	File     int // -1 for all files
+	Response chan newReaderResponse
+}
+
+type newReaderResponse struct {
+	Reader *Reader
+	Error  error
+}
+
+type readRequest struct {
+	Reader   *Reader
+	Index    uint32
+	Response chan readResponse
+}
+
+type readResponse struct {
+	// Data of the piece if it is already downloaded.
+	Data filesection.Piece
+	// Closed when the piece is downloaded if Data is nil.
+	WaitC chan struct{}
+}
+
+type priorityRequest struct {
+	Index    uint32
+	Priority PiecePriority
+	Response chan error
+}
+
+// NewReader returns a new Reader for reading the file at index. If index is -1, Reader reads the concatenated data of all files.
+func (t *torrent) NewReader(index int) (*Reader, error) {
+	req := newReaderRequest{File: index, Response: make(chan newReaderResponse, 1)}
+	select {
+	case t.newReaderCommandC <- req:
+	case <-t.closeC:
+		return nil, ErrTorrentClosed
+	}
+	select {
+	case resp := <-req.Response:
+		return resp.Reader, resp.Error
+	case <-t.closeC:
+		return nil, ErrTorrentClosed
+	}
+}
+
+// SetSequential sets the sequential download mode.
+func (t *torrent) SetSequential(value bool) {
+	select {
+	case t.sequentialCommandC <- value:
+	case <-t.closeC:
+	}
+}
+
+// SetPiecePriority sets the priority of the piece at index.
+func (t *torrent) SetPiecePriority(index uint32, priority PiecePriority) error {
+	req := priorityRequest{Index: index, Priority: priority, Response: make(chan error, 1)}
+	select {
+	case t.priorityCommandC <- req:
+	case <-t.closeC:
+		return ErrTorrentClosed
+	}
+	select {
+	case err := <-req.Response:
+		return err
+	case <-t.closeC:
+		return ErrTorrentClosed
+	}
+}
+
+func (t *torrent) handleNewReader(index int) newReaderResponse {
+	if t.info == nil {
+		return newReaderResponse{Error: errors.New("torrent metadata not ready")}
+	}
+	r := &Reader{
+		torrent:     t,
+		name:        t.info.Name,
+		length:      t.info.Length,
+		pieceLength: int64(t.info.PieceLength),
+		totalLength: t.info.Length,
+		closeC:      make(chan struct{}),
+	}
+	if index >= 0 {
+		if index >= len(t.info.Files) {
+			return newReaderResponse{Error: errors.New("invalid file index")}
+		}
+		for _, f := range t.info.Files[:index] {
+			r.begin += f.Length
+		}
+		r.name = t.info.Files[index].Path
+		r.length = t.info.Files[index].Length
+	}
+	return newReaderResponse{Reader: r}
+}
+
+func (t *torrent) handleRead(req readRequest) readResponse {
+	// Priorities change only when the reader moves to another piece.
+	pos, ok := t.readers[req.Reader]
+	moved := !ok || pos != req.Index
+	if moved {
+		t.readers[req.Reader] = req.Index
+		readahead := t.readahead()
+		if ok {
+			t.updatePiecePrioritiesInRange(pos, pos+readahead)
+		}
+		t.updatePiecePrioritiesInRange(req.Index, req.Index+readahead)
+	}
+	if t.pieces != nil && t.pieces[req.Index].Done {
+		return readResponse{Data: t.pieces[req.Index].Data}
+	}
+	if moved {
+		// Piece may belong to a skipped file.
+		t.checkWantedPieces()
+	}
+	waitC := make(chan struct{})
+	t.pieceWaiters[req.Index] = append(t.pieceWaiters[req.Index], waitC)
+	return readResponse{WaitC: waitC}
+}
+
+func (t *torrent) handleCloseReader(r *Reader) {
+	delete(t.readers, r)
+	t.updatePiecePriorities()
+	t.checkWantedPieces()
+}
+
+func (t *torrent) handleSetSequential(value bool) {
+	t.sequential = value
+	if t.piecePicker != nil {
+		t.piecePicker.SetSequential(value)
+	}
+}
+
+func (t *torrent) handleSetPiecePriority(req priorityRequest) error {
+	if t.info == nil {
+		return errors.New("torrent metadata not ready")
+	}
+	if req.Index >= t.info.NumPieces {
+		return errors.New("invalid piece index")
+	}
+	if req.Priority < PiecePrioritySkip || req.Priority >= readerPriority {
+		return errors.New("invalid piece priority")
+	}
+	if req.Priority == PiecePriorityNormal {
+		delete(t.piecePriorities, req.Index)
+	} else {
+		t.piecePriorities[req.Index] = req.Priority
+	}
+	t.updateWantedPieces()
+	t.updatePiecePriorities()
+	t.checkWantedPieces()
+	return nil
+}
+
+// readahead returns the number of pieces that are prioritized after the position of a Reader.
+func (t *torrent) readahead() uint32 {
+	if n := t.session.config.ReaderReadahead / int64(t.info.PieceLength); n > 1 {
+		return uint32(n)
+	}
+	return 1
+}
+
+// updatePiecePriorities sets the priorities of pieces in piece picker from the priorities set by the user and the positions of open readers.
+// Priority of a piece overrides the priorities of the files it belongs to. Readers override both.
+func (t *torrent) updatePiecePriorities() {
+	if t.info == nil {
+		return
+	}
+	t.updatePiecePrioritiesInRange(0, t.info.NumPieces)
+}
+
+// updatePiecePrioritiesInRange updates the priorities of pieces in the range [begin, end).
+func (t *torrent) updatePiecePrioritiesInRange(begin, end uint32) {
+	if t.piecePicker == nil {
+		return
+	}
+	if end > t.info.NumPieces {
+		end = t.info.NumPieces
+	}
+	readahead := t.readahead()
+	for i := begin; i < end; i++ {
+		priority := t.filePiecePriorities[i]
+		if p, ok := t.piecePriorities[i]; ok {
+			priority = int(p)
+		}
+		for _, pos := range t.readers {
+			if i >= pos && i-pos < readahead {
+				// Closer pieces to the reader are more important.
+				if p := readerPriority + int(readahead-(i-pos)); p > priority {
+					priority = p
+				}
+			}
+		}
+		t.piecePicker.SetPriority(i, priority)
+		t.piecePicker.SetSkip(i, t.pieceSkipped(i))
+	}
+}
+
+// notifyPieceWaiters wakes up the readers waiting for pieces that are downloaded.
+func (t *torrent) notifyPieceWaiters() {
+	if t.pieces == nil {
+		return
+	}
+	for i, waiters := range t.pieceWaiters {
+		if !t.pieces[i].Done {
+			continue
+		}
+		for _, waitC := range waiters {
+			close(waitC)
+		}
+		delete(t.pieceWaiters, i)
+	}
+}
+
+func (t *torrent) readPiece(r *Reader, index uint32) (filesection.Piece, error) {
+	for {
+		req := readRequest{Reader: r, Index: index, Response: make(chan readResponse, 1)}
+		select {
+		case t.readCommandC <- req:
+		case <-r.closeC:
+			return nil, errReaderClosed
+		case <-t.closeC:
+			return nil, ErrTorrentClosed
+		}
+		var resp readResponse
+		select {
+		case resp = <-req.Response:
+		case <-t.closeC:
+			return nil, ErrTorrentClosed
+		}
+		if resp.WaitC == nil {
+			return resp.Data, nil
+		}
+		select {
+		case <-resp.WaitC:
+		case <-r.closeC:
+			return nil, errReaderClosed
+		case <-t.closeC:
+			return nil, ErrTorrentClosed
+		}
+	}
+}
+
+// Name returns the path of the file if the Reader is for a single file, otherwise the name of the torrent.
+func (r *Reader) Name() string {
+	return r.name
+}
+
+// Read implements io.Reader interface.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.length {
+		return 0, io.EOF
+	}
+	pos := r.begin + r.offset
+	index := uint32(pos / r.pieceLength)
+	data, err := r.torrent.readPiece(r, index)
+	if err != nil {
+		return 0, err
+	}
+	pieceBegin := int64(index) * r.pieceLength
+	pieceEnd := pieceBegin + r.pieceLength
+	if pieceEnd > r.totalLength {
+		pieceEnd = r.totalLength
+	}
+	if left := pieceEnd - pos; int64(len(p)) > left {
+		p = p[:left]
+	}
+	if left := r.length - r.offset; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := data.ReadAt(p, pos-pieceBegin)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker interface.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.length
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close the Reader. Pieces in the readahead window of the Reader are not prioritized anymore.
+func (r *Reader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closeC)
+		select {
+		case r.torrent.closeReaderCommandC <- r:
+		case <-r.torrent.closeC:
+		}
+	})
+	return nil
+}
@@ -26,8 +26,38 @@ func (t *torrent) run() {
 			t.stop(nil)
 		case <-t.announceCommandC:
 			t.setNeedMorePeers(true)
-		case <-t.verifyCommandC:
-			t.handleVerifyCommand()
+		case resume := <-t.verifyCommandC:
+			t.handleVerifyCommand(resume)
+		case <-t.pauseCommandC:
+			t.handlePause()
+		case <-t.resumeCommandC:
+			t.handleResume()
+		case mode := <-t.transferModeCommandC:
+			t.handleSetTransferMode(mode)
+		case limits := <-t.seedLimitsCommandC:
+			t.handleSetSeedLimits(limits)
+		case n := <-t.uploadSlotsCommandC:
+			t.handleSetUploadSlots(n)
+		case req := <-t.moveDataCommandC:
+			t.handleMoveData(req)
+		case err := <-t.moveDataResultC:
+			t.handleMoveDataDone(err)
+		case value := <-t.sequentialCommandC:
+			t.handleSetSequential(value)
+		case req := <-t.priorityCommandC:
+			req.Response <- t.handleSetPiecePriority(req)
+		case req := <-t.byteRangeCommandC:
+			req.Response <- t.handleSetByteRangeWanted(req)
+		case req := <-t.newReaderCommandC:
+			req.Response <- t.handleNewReader(req.File)
+		case req := <-t.readCommandC:
+			req.Response <- t.handleRead(req)
+		case r := <-t.closeReaderCommandC:
+			t.handleCloseReader(r)
+		case req := <-t.filesCommandC:
+			req.Response <- t.handleFiles()
+		case req := <-t.filePrioritiesCommandC:
+			req.Response <- t.handleSetFilePriorities(req.Priorities)
 		case <-t.announcersStoppedC:
 			t.handleStopped()
 		case cmd := <-t.notifyErrorCommandC:
@@ -35,7 +65,7 @@ func (t *torrent) run() {
 		case cmd := <-t.notifyListenCommandC:
 			cmd.portCC <- t.portC
 		case req := <-t.statsCommandC:
-			req.Response <- t.stats()
+			req.Response <- t.takeStats()
 		case req := <-t.trackersCommandC:
 			req.Response <- t.getTrackers()
 		case req := <-t.peersCommandC:
@@ -54,26 +84,46 @@ func (t *torrent) run() {
 			t.startSinglePieceDownloader(data)
 		case addrs := <-t.addrsFromTrackers:
 			t.handleNewPeers(addrs, peersource.Tracker)
+		case trackerURL := <-t.completedAnnouncedC:
+			t.handleCompletedAnnounced(trackerURL)
+		case w := <-t.trackerWarningC:
+			t.handleTrackerWarning(w)
 		case addrs := <-t.addPeersCommandC:
 			t.handleNewPeers(addrs, peersource.Manual)
 		case addrs := <-t.dhtPeersC:
 			t.handleNewPeers(addrs, peersource.DHT)
+		case addrs := <-t.lsdPeersC:
+			// Peers are not used if the torrent is not announced, e.g. the torrent is private.
+			if t.lsdAnnouncer != nil {
+				t.handleNewPeers(addrs, peersource.LSD)
+			}
+		case addrs := <-t.resolvedPeerC:
+			t.handleResolvedPeer(addrs)
+		case r := <-t.dialRetryC:
+			t.handleDialRetry(r)
 		case trackers := <-t.addTrackersCommandC:
 			t.handleNewTrackers(trackers)
 		case conn := <-t.incomingConnC:
 			t.handleNewConnection(conn)
+		case ih := <-t.sharedPortConnC:
+			t.handleSharedPortConnection(ih)
 		case res := <-t.webseedPieceResultC.ReceiveC():
 			t.handleWebseedPieceResult(res)
 		case src := <-t.webseedRetryC:
-			t.startPieceDownloaderForWebseed(src)
+			t.handleWebseedRetry(src)
 		case pw := <-t.pieceWriterResultC:
 			t.handlePieceWriteDone(pw)
 		case now := <-t.seedDurationTicker.C:
 			t.updateSeedDuration(now)
+			t.checkSeedLimits(now)
+			t.checkBoost(now)
+			t.checkHashRequestTimeouts(now)
 		case pe := <-t.peerSnubbedC:
 			t.handlePeerSnubbed(pe)
 		case <-t.unchokeTicker.C:
-			t.unchoker.TickUnchoke(t.getPeersForUnchoker(), t.completed)
+			if t.uploadEnabled() {
+				t.unchoker.TickUnchoke(t.getPeersForUnchoker(), t.completed)
+			}
 		case ih := <-t.incomingHandshakerResultC:
 			t.handleIncomingHandshakeDone(ih)
 		case oh := <-t.outgoingHandshakerResultC:
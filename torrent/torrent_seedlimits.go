@@ -0,0 +1,93 @@
+package torrent
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
+)
+
+var errInvalidSeedLimits = errors.New("invalid seed limits")
+
+func (t *torrent) getSeedLimits() SeedLimits {
+	if t.seedLimits != nil {
+		return *t.seedLimits
+	}
+	return t.session.seedLimits()
+}
+
+func (t *torrent) handleSetSeedLimits(limits *SeedLimits) {
+	t.seedLimits = limits
+	t.checkSeedLimits(time.Now())
+}
+
+// seedRatio returns the ratio of uploaded bytes to downloaded bytes.
+func (t *torrent) seedRatio() float64 {
+	downloaded := t.bytesDownloaded.Count()
+	if downloaded == 0 && t.info != nil {
+		downloaded = t.info.Length
+	}
+	if downloaded == 0 {
+		return 0
+	}
+	return float64(t.bytesUploaded.Count()) / float64(downloaded)
+}
+
+// checkSeedLimits stops or removes the torrent if one of the seed limits is reached.
+func (t *torrent) checkSeedLimits(now time.Time) {
+	if t.status() != Seeding {
+		t.seedIdleSince = time.Time{}
+		return
+	}
+	uploaded := t.bytesUploaded.Count()
+	if t.seedIdleSince.IsZero() || uploaded != t.seedIdleUploaded {
+		t.seedIdleSince = now
+		t.seedIdleUploaded = uploaded
+	}
+	limits := t.getSeedLimits()
+	var reason string
+	switch {
+	case limits.Ratio > 0 && t.seedRatio() >= limits.Ratio:
+		reason = "ratio"
+	case limits.Duration > 0 && time.Duration(t.seededFor.Count()) >= limits.Duration:
+		reason = "seed duration"
+	case limits.IdleDuration > 0 && now.Sub(t.seedIdleSince) >= limits.IdleDuration:
+		reason = "idle duration"
+	default:
+		return
+	}
+	if limits.Remove {
+		t.log.Infof("%s limit is reached, removing torrent", reason)
+		t.stop(nil)
+		// Removing closes the torrent and waits for the run loop to exit, so it cannot be done in the loop.
+		go func() {
+			err := t.session.removeTorrentKeepData(t.id)
+			if err != nil {
+				t.log.Errorf("cannot remove torrent: %s", err)
+			}
+		}()
+		return
+	}
+	t.log.Infof("%s limit is reached, stopping torrent", reason)
+	err := t.session.resumer.WriteStarted(t.id, false)
+	if err != nil {
+		t.log.Errorf("cannot write status to resume db: %s", err)
+	}
+	t.stop(nil)
+}
+
+func seedLimitsToSpec(l *SeedLimits) *boltdbresumer.SeedLimits {
+	if l == nil {
+		return nil
+	}
+	sl := boltdbresumer.SeedLimits(*l)
+	return &sl
+}
+
+func seedLimitsFromSpec(sl *boltdbresumer.SeedLimits) *SeedLimits {
+	if sl == nil {
+		return nil
+	}
+	l := SeedLimits(*sl)
+	return &l
+}
@@ -1,16 +1,20 @@
 package torrent
 
 import (
+	"context"
 	"net"
 
 	"github.com/cenkalti/rain/internal/acceptor"
 	"github.com/cenkalti/rain/internal/allocator"
 	"github.com/cenkalti/rain/internal/announcer"
+	"github.com/cenkalti/rain/internal/infodownloader"
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/piecedownloader"
 	"github.com/cenkalti/rain/internal/piecepicker"
+	"github.com/cenkalti/rain/internal/sockopt"
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/urldownloader"
+	"github.com/cenkalti/rain/internal/utp"
 	"github.com/cenkalti/rain/internal/verifier"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"github.com/rcrowley/go-metrics"
@@ -22,6 +26,12 @@ func (t *torrent) start() {
 		return
 	}
 
+	// Files are being moved. Start after files are moved.
+	if t.moveDataRequest != nil {
+		t.startAfterMove = true
+		return
+	}
+
 	// Stop announcing Stopped event if in "Stopping" state.
 	if t.stoppedEventAnnouncer != nil {
 		t.stoppedEventAnnouncer.Close()
@@ -34,6 +44,7 @@ func (t *torrent) start() {
 	t.lastError = nil
 	t.downloadSpeed = metrics.NewMeter()
 	t.uploadSpeed = metrics.NewMeter()
+	t.startPieceWriters()
 
 	if t.info != nil {
 		if t.pieces != nil {
@@ -71,6 +82,10 @@ func (t *torrent) startAllocator() {
 	if t.allocator != nil {
 		panic("allocator exists")
 	}
+	if !t.info.HasPieceLayers() {
+		t.startHashDownloader()
+		return
+	}
 	t.allocator = allocator.New()
 	go t.allocator.Run(t.info, t.storage, t.allocatorProgressC, t.allocatorResultC)
 }
@@ -91,6 +106,10 @@ func (t *torrent) startAnnouncers() {
 		t.dhtAnnouncer = announcer.NewDHTAnnouncer()
 		go t.dhtAnnouncer.Run(t.announceDHT, t.session.config.DHTAnnounceInterval, t.session.config.DHTMinAnnounceInterval, t.log)
 	}
+	if t.lsdAnnouncer == nil && t.session.lsd != nil && (t.info == nil || !t.info.Private) {
+		t.lsdAnnouncer = announcer.NewDHTAnnouncer()
+		go t.lsdAnnouncer.Run(t.announceLSD, t.session.config.LSDAnnounceInterval, t.session.config.LSDMinAnnounceInterval, t.log)
+	}
 }
 
 func (t *torrent) startNewAnnouncer(tr tracker.Tracker) {
@@ -100,6 +119,9 @@ func (t *torrent) startNewAnnouncer(tr tracker.Tracker) {
 		t.session.config.TrackerMinAnnounceInterval,
 		t.announcerFields,
 		t.completeC,
+		t.completedEvent(tr),
+		t.completedAnnouncedC,
+		t.trackerWarningC,
 		t.addrsFromTrackers,
 		t.log,
 	)
@@ -108,40 +130,122 @@ func (t *torrent) startNewAnnouncer(tr tracker.Tracker) {
 }
 
 func (t *torrent) startAcceptor() {
-	if t.acceptor != nil {
+	if t.session.config.Port != 0 {
+		// Session accepts the connections and sends them to the torrent after handshake.
+		if !t.acceptingSharedPort {
+			t.acceptingSharedPort = true
+			t.utpSocket = t.session.utpSocket
+			t.portC <- t.port
+			t.dialUTPAddresses()
+		}
+		return
+	}
+	if t.acceptor != nil || t.utpAcceptor != nil {
 		return
 	}
 	ip := net.ParseIP(t.session.config.Host)
-	listener, err := net.ListenTCP("tcp4", &net.TCPAddr{IP: ip, Port: t.port})
-	if err != nil {
-		t.log.Warningf("cannot listen port %d: %s", t.port, err)
-	} else {
-		t.log.Info("Listening peers on tcp://" + listener.Addr().String())
-		t.port = listener.Addr().(*net.TCPAddr).Port
+	lc := net.ListenConfig{Control: t.socketOptions().Control}
+	listening := false
+	if t.tcpEnabled() {
+		listener, err := t.session.listeners.Listen(context.Background(), &lc, "tcp", (&net.TCPAddr{IP: ip, Port: t.port}).String())
+		if err != nil {
+			t.log.Warningf("cannot listen port %d: %s", t.port, err)
+		} else {
+			t.log.Info("Listening peers on tcp://" + listener.Addr().String())
+			t.port = listener.Addr().(*net.TCPAddr).Port
+			listening = true
+			t.acceptor = acceptor.New(listener, t.incomingConnC, t.log)
+			go t.acceptor.Run()
+		}
+	}
+	if t.utpEnabled() {
+		// uTP is listened on the same port number with TCP so the port announced to trackers is valid for both.
+		pc, err := t.session.listeners.ListenPacket(context.Background(), &lc, "udp", (&net.UDPAddr{IP: ip, Port: t.port}).String())
+		if err != nil {
+			t.log.Warningf("cannot listen utp port %d: %s", t.port, err)
+		} else {
+			socket := utp.NewSocket(pc)
+			t.log.Info("Listening peers on utp://" + socket.Addr().String())
+			t.port = socket.Addr().(*net.UDPAddr).Port
+			listening = true
+			t.utpSocket = socket
+			t.utpAcceptor = acceptor.New(socket, t.incomingConnC, t.log)
+			go t.utpAcceptor.Run()
+		}
+	}
+	if listening {
+		if t.session.portMapper != nil {
+			t.session.portMapper.AddPort(t.port)
+		}
 		t.portC <- t.port
-		t.acceptor = acceptor.New(listener, t.incomingConnC, t.log)
-		go t.acceptor.Run()
+	}
+	t.dialUTPAddresses()
+}
+
+// dialUTPAddresses dials the addresses received before the uTP socket is ready, e.g. while the files are allocated.
+// Addresses cannot be dialed without the socket if TCP is disabled.
+func (t *torrent) dialUTPAddresses() {
+	if !t.tcpEnabled() && t.utpSocket != nil {
+		t.dialAddresses()
+	}
+}
+
+func (t *torrent) socketOptions() sockopt.Options {
+	return t.session.socketOptions()
+}
+
+func (t *torrent) tcpEnabled() bool {
+	return t.session.config.PeerTransport != PeerTransportUTP
+}
+
+func (t *torrent) utpEnabled() bool {
+	switch t.session.config.PeerTransport {
+	case PeerTransportUTP, PeerTransportBoth:
+		return true
+	default:
+		return false
 	}
 }
 
 func (t *torrent) startInfoDownloaders() {
-	if t.info != nil {
+	if t.info != nil || t.paused {
 		return
 	}
+	// Idle downloaders may request the blocks released by other peers.
+	for pe, id := range t.infoDownloaders {
+		if _, ok := t.infoDownloadersSnubbed[pe]; !ok && id.Pending() == 0 {
+			t.requestMetadataBlocks(id)
+		}
+	}
 	for len(t.infoDownloaders)-len(t.infoDownloadersSnubbed) < t.session.config.ParallelMetadataDownloads {
 		id := t.nextInfoDownload()
+		if id == nil && len(t.infoDownloaders) == len(t.infoDownloadersSnubbed) && t.metadata != nil {
+			// No connected peer is sending the metadata of this size. The size may be reported by a lying peer.
+			// Start over with the size reported by the next peer. Snubbed downloaders keep the old blocks.
+			t.metadata = nil
+			id = t.nextInfoDownload()
+		}
 		if id == nil {
 			break
 		}
 		pe := id.Peer.(*peer.Peer)
 		t.infoDownloaders[pe] = id
-		id.RequestBlocks(t.maxAllowedRequests(pe))
-		id.Peer.(*peer.Peer).ResetSnubTimer()
+		t.requestMetadataBlocks(id)
+	}
+}
+
+func (t *torrent) requestMetadataBlocks(id *infodownloader.InfoDownloader) {
+	pe := id.Peer.(*peer.Peer)
+	id.RequestBlocks(t.maxAllowedRequests(pe))
+	if id.Pending() > 0 {
+		pe.ResetSnubTimerTimeout(t.session.config.MetadataRequestTimeout)
+	} else {
+		pe.StopSnubTimer()
 	}
 }
 
 func (t *torrent) startPieceDownloaders() {
-	if t.status() != Downloading {
+	if t.status() != Downloading || !t.downloadEnabled() {
 		return
 	}
 	for _, src := range t.webseedSources {
@@ -163,7 +267,7 @@ func (t *torrent) startPieceDownloaderForWebseed(src *webseedsource.WebseedSourc
 	if t.webseedActiveDownloads >= t.session.config.WebseedMaxDownloads {
 		return false
 	}
-	if t.status() != Downloading {
+	if t.status() != Downloading || !t.downloadEnabled() {
 		return false
 	}
 	sp := t.piecePicker.PickWebseed(src)
@@ -177,7 +281,7 @@ func (t *torrent) startPieceDownloaderForWebseed(src *webseedsource.WebseedSourc
 
 func (t *torrent) startWebseedDownloader(sp *piecepicker.WebseedDownloadSpec) {
 	t.log.Debugf("downloading pieces %d-%d from webseed %s", sp.Begin, sp.End, sp.Source.URL)
-	ud := urldownloader.New(sp.Source.URL, sp.Begin, sp.End, t.session.bucketDownload)
+	ud := urldownloader.New(sp.Source.URL, sp.Begin, sp.End, t.bucketDownload)
 	for _, src := range t.webseedSources {
 		if src != sp.Source {
 			continue
@@ -195,7 +299,7 @@ func (t *torrent) startWebseedDownloader(sp *piecepicker.WebseedDownloadSpec) {
 }
 
 func (t *torrent) startPieceDownloaderFor(pe *peer.Peer) {
-	if t.status() != Downloading {
+	if t.status() != Downloading || !t.downloadEnabled() {
 		return
 	}
 	if t.session.ram == nil {
@@ -215,7 +319,7 @@ func (t *torrent) startSinglePieceDownloader(pe *peer.Peer) {
 			t.session.ram.Release(int64(t.info.PieceLength))
 		}
 	}()
-	if t.status() != Downloading {
+	if t.status() != Downloading || !t.downloadEnabled() {
 		return
 	}
 	pi, allowedFast := t.piecePicker.PickFor(pe)
@@ -235,12 +339,12 @@ func (t *torrent) startSinglePieceDownloader(pe *peer.Peer) {
 }
 
 func (t *torrent) maxAllowedRequests(pe *peer.Peer) int {
-	ret := t.session.config.DefaultRequestsOut
+	ret := t.session.config.DefaultRequestsOut * t.boostFactor()
 	if pe.ExtensionHandshake != nil && pe.ExtensionHandshake.RequestQueue > 0 {
 		ret = pe.ExtensionHandshake.RequestQueue
 	}
-	if ret > t.session.config.MaxRequestsOut {
-		ret = t.session.config.MaxRequestsOut
+	if limit := t.session.config.MaxRequestsOut * t.boostFactor(); ret > limit {
+		ret = limit
 	}
 	return ret
 }
@@ -8,14 +8,29 @@ import (
 	"github.com/cenkalti/rain/internal/stringutil"
 )
 
+// StatsVersion is the version of the Stats schema.
+// It is incremented when a field of Stats is removed or its meaning is changed.
+const StatsVersion = 1
+
 // Stats contains statistics about Torrent.
+// Stats is a snapshot of the torrent at Time. All fields are calculated at the same time.
 type Stats struct {
+	// Version of the schema. Equal to StatsVersion.
+	Version int
+	// Time when the snapshot is taken.
+	Time time.Time
 	// Info hash of torrent.
 	InfoHash InfoHash
 	// Listening port number.
 	Port int
 	// Status of the torrent.
 	Status Status
+	// True if the torrent is paused. Paused torrents keep their status but do not transfer data.
+	Paused bool
+	// True if the connection and request limits are raised temporarily because the download is slow. See Config.BoostSpeedThreshold.
+	Boosted bool
+	// Restricts downloading or uploading of data.
+	TransferMode TransferMode
 	// Contains the error message if torrent is stopped unexpectedly.
 	Error  error
 	Pieces struct {
@@ -31,6 +46,8 @@ type Stats struct {
 		Available uint32
 		// Number of total pieces in torrent.
 		Total uint32
+		// Number of pieces that failed hash check since the torrent is loaded into the Session.
+		Failed uint32
 	}
 	Bytes struct {
 		// Bytes that are downloaded and passed hash check.
@@ -39,6 +56,10 @@ type Stats struct {
 		Incomplete int64
 		// The number of total bytes of files in torrent.  Total = Completed + Incomplete
 		Total int64
+		// The number of bytes in pieces that are not skipped by SetFilePriorities. Equal to Total if no file is skipped.
+		Wanted int64
+		// The number of bytes that is needed to complete all wanted pieces.
+		WantedIncomplete int64
 		// Downloaded is the number of bytes downloaded from swarm.
 		// Because some pieces may be downloaded more than once, this number may be greater than completed bytes.
 		Downloaded int64
@@ -56,6 +77,15 @@ type Stats struct {
 		Incoming int
 		// Number of peers that we have connected to.
 		Outgoing int
+		// Number of peers that are interested in pieces that we have.
+		Interested int
+		// Number of peers that we are not choking.
+		Unchoked int
+		// Number of peers that we are uploading data to at the moment.
+		Uploading int
+		// Number of peers that can be unchoked at the same time, including optimistic unchokes.
+		// Comparing with Unchoked shows how much of the upload capacity is used.
+		UploadSlots int
 	}
 	Handshakes struct {
 		// Number of peers that are not handshaked yet.
@@ -74,6 +104,8 @@ type Stats struct {
 		DHT int
 		// Peers found via peer exchange.
 		PEX int
+		// Peers found via Local Service Discovery.
+		LSD int
 	}
 	Downloads struct {
 		// Number of active piece downloads.
@@ -84,6 +116,8 @@ type Stats struct {
 		Snubbed int
 		// Number of piece downloads in choked state.
 		Choked int
+		// True if endgame mode is active. Remaining pieces are requested from multiple peers in endgame mode.
+		Endgame bool
 	}
 	MetadataDownloads struct {
 		// Number of active metadata downloads.
@@ -92,6 +126,10 @@ type Stats struct {
 		Snubbed int
 		// Number of peers that are being downloaded normally.
 		Running int
+		// Number of metadata bytes received so far.
+		Downloaded int64
+		// Size of the metadata. Zero if not known yet.
+		Size int64
 	}
 	// Name can change after metadata is downloaded.
 	Name string
@@ -112,33 +150,101 @@ type Stats struct {
 	}
 	// Time remaining to complete download. nil value means infinity.
 	ETA *time.Duration
+	// Byte range set with SetByteRangeWanted.
+	WantedRange struct {
+		// Index of the file.
+		File int
+		// Offset of the range in the file.
+		Offset int64
+		// Length of the range. Zero if the range is not set.
+		Length int64
+		// Number of bytes in the range that are downloaded and passed hash check.
+		Completed int64
+	}
+}
+
+// clone returns a copy of the snapshot that does not share pointer fields with s.
+// Snapshots in the cache are returned to many callers, so they must not see changes made by each other.
+func (s Stats) clone() Stats {
+	if s.ETA != nil {
+		eta := *s.ETA
+		s.ETA = &eta
+	}
+	return s
+}
+
+// takeStats returns a new snapshot and saves it for the next calls of Stats if Config.StatsCacheDuration is set.
+func (t *torrent) takeStats() Stats {
+	s := t.stats()
+	if t.session.config.StatsCacheDuration > 0 {
+		cached := s.clone()
+		t.mStats.Lock()
+		t.lastStats = &cached
+		t.mStats.Unlock()
+	}
+	return s
 }
 
 func (t *torrent) stats() Stats {
-	t.updateSeedDuration(time.Now())
+	now := time.Now()
+	t.updateSeedDuration(now)
 
 	var s Stats
+	s.Version = StatsVersion
+	s.Time = now
 	s.InfoHash = t.infoHash
 	s.Port = t.port
 	s.Status = t.status()
+	s.Paused = t.paused
+	s.Boosted = t.boosting()
+	s.TransferMode = t.transferMode
 	s.Error = t.lastError
 	s.Addresses.Total = t.addrList.Len()
 	s.Addresses.Tracker = t.addrList.LenSource(peersource.Tracker)
 	s.Addresses.DHT = t.addrList.LenSource(peersource.DHT)
 	s.Addresses.PEX = t.addrList.LenSource(peersource.PEX)
+	s.Addresses.LSD = t.addrList.LenSource(peersource.LSD)
 	s.Handshakes.Incoming = len(t.incomingHandshakers)
 	s.Handshakes.Outgoing = len(t.outgoingHandshakers)
 	s.Handshakes.Total = len(t.incomingHandshakers) + len(t.outgoingHandshakers)
 	s.Peers.Total = len(t.peers)
 	s.Peers.Incoming = len(t.incomingPeers)
 	s.Peers.Outgoing = len(t.outgoingPeers)
+	for pe := range t.peers {
+		if pe.PeerInterested {
+			s.Peers.Interested++
+		}
+		if !pe.ClientChoking {
+			s.Peers.Unchoked++
+			if pe.PeerInterested && pe.UploadSpeed() > 0 {
+				s.Peers.Uploading++
+			}
+		}
+	}
+	s.Peers.UploadSlots = t.getUploadSlots() + t.session.config.OptimisticUnchokedPeers
 	s.MetadataDownloads.Total = len(t.infoDownloaders)
 	s.MetadataDownloads.Snubbed = len(t.infoDownloadersSnubbed)
 	s.MetadataDownloads.Running = len(t.infoDownloaders) - len(t.infoDownloadersSnubbed)
+	if t.info != nil {
+		s.MetadataDownloads.Size = int64(len(t.info.Bytes))
+		s.MetadataDownloads.Downloaded = s.MetadataDownloads.Size
+	} else if t.metadata != nil {
+		s.MetadataDownloads.Size = t.metadata.Size()
+		s.MetadataDownloads.Downloaded = t.metadata.Downloaded()
+	} else {
+		// Each peer is sending its own copy. Report the one closest to completion.
+		for _, id := range t.infoDownloaders {
+			if id.Metadata.Downloaded() >= s.MetadataDownloads.Downloaded {
+				s.MetadataDownloads.Size = id.Metadata.Size()
+				s.MetadataDownloads.Downloaded = id.Metadata.Downloaded()
+			}
+		}
+	}
 	s.Downloads.Total = len(t.pieceDownloaders)
 	s.Downloads.Snubbed = len(t.pieceDownloadersSnubbed)
 	s.Downloads.Choked = len(t.pieceDownloadersChoked)
 	s.Downloads.Running = len(t.pieceDownloaders) - len(t.pieceDownloadersChoked) - len(t.pieceDownloadersSnubbed)
+	s.Downloads.Endgame = t.piecePicker != nil && t.piecePicker.Endgame()
 	s.Pieces.Available = t.avaliablePieceCount()
 	s.Bytes.Downloaded = t.bytesDownloaded.Count()
 	s.Bytes.Uploaded = t.bytesUploaded.Count()
@@ -146,6 +252,7 @@ func (t *torrent) stats() Stats {
 	s.SeededFor = time.Duration(t.seededFor.Count())
 	s.Bytes.Allocated = t.bytesAllocated
 	s.Pieces.Checked = t.checkedPieces
+	s.Pieces.Failed = t.failedPieces
 	s.Speed.Download = int(t.downloadSpeed.Rate1())
 	s.Speed.Upload = int(t.uploadSpeed.Rate1())
 
@@ -153,12 +260,20 @@ func (t *torrent) stats() Stats {
 		s.Bytes.Total = t.info.Length
 		s.Bytes.Completed = t.bytesComplete()
 		s.Bytes.Incomplete = s.Bytes.Total - s.Bytes.Completed
+		s.Bytes.Wanted, s.Bytes.WantedIncomplete = t.bytesWanted()
 
 		s.Name = t.info.Name
 		s.Private = t.info.Private
 		s.FileCount = len(t.info.Files)
 		s.PieceLength = t.info.PieceLength
 		s.Pieces.Total = t.info.NumPieces
+
+		if t.wantedRange.length > 0 {
+			s.WantedRange.File = t.wantedRange.file
+			s.WantedRange.Offset = t.wantedRange.offset
+			s.WantedRange.Length = t.wantedRange.length
+			s.WantedRange.Completed = t.bytesCompleteInRange(t.wantedRangeSection())
+		}
 	} else {
 		s.Name = t.name
 	}
@@ -170,7 +285,7 @@ func (t *torrent) stats() Stats {
 	if s.Status == Downloading {
 		bps := int64(s.Speed.Download)
 		if bps != 0 {
-			eta := time.Duration(s.Bytes.Incomplete/bps) * time.Second
+			eta := time.Duration(s.Bytes.WantedIncomplete/bps) * time.Second
 			switch {
 			case eta > 8*time.Hour:
 				eta = eta.Round(time.Hour)
@@ -219,13 +334,15 @@ func (t *torrent) getTrackers() []Tracker {
 	for i, an := range t.announcers {
 		st := an.Stats()
 		trackers[i] = Tracker{
-			URL:          an.Tracker.URL(),
-			Status:       TrackerStatus(st.Status),
-			Seeders:      st.Seeders,
-			Leechers:     st.Leechers,
-			Warning:      st.Warning,
-			LastAnnounce: st.LastAnnounce,
-			NextAnnounce: st.NextAnnounce,
+			URL:           an.Tracker.URL(),
+			Status:        TrackerStatus(st.Status),
+			Seeders:       st.Seeders,
+			Leechers:      st.Leechers,
+			Warning:       st.Warning,
+			WarningAt:     st.WarningAt,
+			LastAnnounce:  st.LastAnnounce,
+			NextAnnounce:  st.NextAnnounce,
+			CompletedSent: st.CompletedSent,
 		}
 		if st.Error != nil {
 			trackers[i].Error = &AnnounceError{st.Error}
@@ -249,6 +366,8 @@ func (t *torrent) getPeers() []Peer {
 			source = SourceIncoming
 		case peersource.Manual:
 			source = SourceManual
+		case peersource.LSD:
+			source = SourceLSD
 		default:
 			panic("unhandled peer source")
 		}
@@ -264,6 +383,7 @@ func (t *torrent) getPeers() []Peer {
 			PeerChoking:        pe.PeerChoking,
 			OptimisticUnchoked: pe.OptimisticUnchoked,
 			Snubbed:            pe.Snubbed,
+			RequestTimeouts:    pe.RequestTimeouts,
 			EncryptedHandshake: pe.EncryptionCipher != 0,
 			EncryptedStream:    pe.EncryptionCipher == mse.RC4,
 			Source:             source,
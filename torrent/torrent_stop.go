@@ -1,6 +1,8 @@
 package torrent
 
 import (
+	"net"
+
 	"github.com/cenkalti/rain/internal/announcer"
 	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
 	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
@@ -16,6 +18,9 @@ func (t *torrent) handleStopped() {
 	if t.doVerify {
 		t.bitfield = nil
 		t.start()
+	} else if t.startAfterMove && t.moveDataRequest == nil {
+		t.startAfterMove = false
+		t.start()
 	} else {
 		t.log.Info("torrent has stopped")
 	}
@@ -45,7 +50,7 @@ func (t *torrent) stop(err error) {
 
 	t.log.Info("stopping torrent")
 	t.lastError = err
-	if err != nil && err != errClosed {
+	if err != nil && err != ErrTorrentClosed {
 		t.log.Error(err)
 	}
 
@@ -53,7 +58,10 @@ func (t *torrent) stop(err error) {
 	t.stopPeers()
 	t.stopPiecedownloaders()
 	t.stopInfoDownloaders()
+	t.hashDownloader = nil
 	t.stopWebseedDownloads()
+	t.stopPieceWriters()
+	t.stopCacheWarmer()
 
 	if t.bitfield != nil {
 		_ = t.writeBitfield()
@@ -95,6 +103,11 @@ func (t *torrent) stop(err error) {
 	go t.stoppedEventAnnouncer.Run()
 
 	t.addrList.Reset()
+	t.dialFailures = make(map[string]int)
+	t.stopDialRetries()
+	t.peerFallbackAddrs = make(map[string][]*net.TCPAddr)
+	t.metadataFromSinglePeer = false
+	t.completedPeerAddrs = nil
 }
 
 func (t *torrent) stopAllocator() {
@@ -152,6 +165,8 @@ func (t *torrent) closeData() {
 	}
 	t.files = nil
 	t.pieces = nil
+	t.pieceReader = nil
+	t.recentPieceRequests = nil
 	t.piecePicker = nil
 	t.bytesAllocated = 0
 	t.checkedPieces = 0
@@ -167,14 +182,28 @@ func (t *torrent) stopPeriodicalAnnouncers() {
 		t.dhtAnnouncer.Close()
 		t.dhtAnnouncer = nil
 	}
+	if t.lsdAnnouncer != nil {
+		t.lsdAnnouncer.Close()
+		t.lsdAnnouncer = nil
+	}
 }
 
 func (t *torrent) stopAcceptor() {
 	t.log.Debugln("stopping acceptor")
+	if (t.acceptor != nil || t.utpAcceptor != nil) && t.session.portMapper != nil {
+		t.session.portMapper.RemovePort(t.port)
+	}
 	if t.acceptor != nil {
 		t.acceptor.Close()
 	}
 	t.acceptor = nil
+	// Closing the acceptor closes the socket and the uTP connections on it.
+	if t.utpAcceptor != nil {
+		t.utpAcceptor.Close()
+	}
+	t.utpAcceptor = nil
+	t.utpSocket = nil
+	t.acceptingSharedPort = false
 }
 
 func (t *torrent) stopPeers() {
@@ -1,29 +1,45 @@
 package torrent
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/btconn"
 	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/peerprotocol"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	fhttp "github.com/chihaya/chihaya/frontend/http"
 	"github.com/chihaya/chihaya/middleware"
 	"github.com/chihaya/chihaya/storage"
 	_ "github.com/chihaya/chihaya/storage/memory"
 	"github.com/fortytw2/leaktest"
+	"github.com/rcrowley/go-metrics"
 )
 
 var (
 	torrentFile           = filepath.Join("testdata", "sample_torrent.torrent")
 	torrentInfoHashString = "4242e334070406956b87c25f7c36251d32743461"
 	torrentMagnetLink     = "magnet:?xt=urn:btih:" + torrentInfoHashString
+	otherMagnetLink       = "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567"
 	torrentDataDir        = "testdata"
 	torrentName           = "sample_torrent"
 	timeout               = 10 * time.Second
@@ -33,13 +49,26 @@ func init() {
 	logger.SetDebug()
 }
 
+func TestMain(m *testing.M) {
+	// Goroutines that run for the lifetime of the process must be started before leaktest takes its first snapshot,
+	// otherwise the first test checking for leaks fails when it is run alone.
+	// Meters share a global ticker goroutine and chihaya starts its time cache in init.
+	metrics.NewMeter().Stop()
+	time.Sleep(100 * time.Millisecond)
+	os.Exit(m.Run())
+}
+
 func newTestSession(t *testing.T) (*Session, func()) {
+	return newTestSessionConfig(t, DefaultConfig)
+}
+
+func newTestSessionConfig(t *testing.T, cfg Config) (*Session, func()) {
 	tmp, closeTmp := tempdir(t)
-	cfg := DefaultConfig
 	cfg.Database = filepath.Join(tmp, "session.db")
 	cfg.DataDir = tmp
 	cfg.DHTEnabled = false
 	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
 	cfg.RPCEnabled = false
 	cfg.Host = "127.0.0.1"
 	s, err := NewSession(cfg)
@@ -61,12 +90,17 @@ func CopyDir(src, dst string) error {
 }
 
 func seeder(t *testing.T, clearTrackers bool) (addr string, c func()) {
+	s, closeSession := newTestSession(t)
+	return startSeeder(t, s, clearTrackers), closeSession
+}
+
+// startSeeder adds the test torrent to the session with its data and starts seeding.
+func startSeeder(t *testing.T, s *Session, clearTrackers bool) (addr string) {
 	f, err := os.Open(torrentFile)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer f.Close()
-	s, closeSession := newTestSession(t)
 	opt := &AddTorrentOptions{Stopped: true}
 	tor, err := s.AddTorrent(f, opt)
 	if err != nil {
@@ -94,9 +128,7 @@ func seeder(t *testing.T, clearTrackers bool) (addr string, c func()) {
 	case <-time.After(timeout):
 		t.Fatal("seeder is not ready")
 	}
-	return "127.0.0.1:" + strconv.Itoa(port), func() {
-		closeSession()
-	}
+	return "127.0.0.1:" + strconv.Itoa(port)
 }
 
 func tempdir(t *testing.T) (string, func()) {
@@ -126,122 +158,2189 @@ func TestDownloadMagnet(t *testing.T) {
 	assertCompleted(t, tor)
 }
 
-func TestDownloadTorrent(t *testing.T) {
-	// TODO defer leaktest.Check(t)()
-	defer startHTTPTracker(t)()
-
-	_, cl := seeder(t, false)
+func TestDownloadMagnetHostnamePeer(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
 	defer cl()
-
 	s, closeSession := newTestSession(t)
 	defer closeSession()
 
-	f, err := os.Open(torrentFile)
+	_, port, err := net.SplitHostPort(addr)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer f.Close()
-
-	tor, err := s.AddTorrent(f, nil)
+	tor, err := s.AddURI(torrentMagnetLink+"&x.pe="+net.JoinHostPort("localhost", port), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
+	assertCompleted(t, tor)
+}
 
+func TestDownloadMagnetLyingPeer(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	cfg := DefaultConfig
+	cfg.DisableOutgoingEncryption = true
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	liar := startLyingPeer(t, 100, true)
+	defer liar.Close()
+
+	// Lying peer is the only peer, so the size of the metadata is taken from it.
+	tor, err := s.AddURI(torrentMagnetLink+"&x.pe="+liar.Addr(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	liar.waitRequest(t)
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
 	assertCompleted(t, tor)
+	if n := liar.Accepted(); n != 1 {
+		t.Fatalf("lying peer is connected %d times", n)
+	}
 }
 
-func startHTTPTracker(t *testing.T) (stop func()) {
-	responseConfig := middleware.ResponseConfig{
-		AnnounceInterval: time.Minute,
+func TestDownloadMagnetLyingPeerNextToHonestPeer(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	cfg := DefaultConfig
+	cfg.DisableOutgoingEncryption = true
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
 	}
-	ps, err := storage.NewPeerStore("memory", map[string]interface{}{})
+	mi, err := metainfo.New(f)
+	f.Close()
 	if err != nil {
 		t.Fatal(err)
 	}
-	lgc := middleware.NewLogic(responseConfig, ps, nil, nil)
-	fe, err := fhttp.NewFrontend(lgc, fhttp.Config{
-		Addr:         "127.0.0.1:5000",
-		ReadTimeout:  time.Second,
-		WriteTimeout: time.Second,
-	})
+	// Lying peer reports the correct size, so its blocks are shared with the honest peer.
+	liar := startLyingPeer(t, len(mi.Info.Bytes), true)
+	defer liar.Close()
+
+	tor, err := s.AddURI(torrentMagnetLink+"&x.pe="+liar.Addr()+"&x.pe="+addr, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	return func() {
-		errC := fe.Stop()
-		err := <-errC
-		if err != nil {
-			t.Fatal(err)
-		}
+	assertCompleted(t, tor)
+}
+
+func TestDownloadMagnetStallingPeer(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	cfg := DefaultConfig
+	cfg.DisableOutgoingEncryption = true
+	cfg.MetadataRequestTimeout = 500 * time.Millisecond
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	liar := startLyingPeer(t, 100, false)
+	defer liar.Close()
+
+	// Lying peer reports a wrong size and never sends it. The size must not block the honest peer.
+	tor, err := s.AddURI(torrentMagnetLink+"&x.pe="+liar.Addr(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	liar.waitRequest(t)
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
 	}
+	assertCompleted(t, tor)
 }
 
-func webseed(t *testing.T) (port int, c func()) {
-	l, err := net.Listen("tcp4", "127.0.0.1:0")
+// lyingPeer accepts connections of a torrent and serves metadata with the wrong content.
+type lyingPeer struct {
+	l         net.Listener
+	size      int
+	respond   bool
+	requested chan struct{}
+	accepted  int32
+}
+
+// startLyingPeer starts listening on another IP, so banning the lying peer does not ban the seeder.
+// If respond is false, metadata requests are never answered.
+func startLyingPeer(t *testing.T, size int, respond bool) *lyingPeer {
+	l, err := net.Listen("tcp4", "127.0.0.2:0")
 	if err != nil {
 		t.Fatal(err)
 	}
-	port = l.Addr().(*net.TCPAddr).Port
-	servingDone := make(chan struct{})
-	srv := &http.Server{Handler: http.FileServer(http.Dir("./testdata"))}
+	p := &lyingPeer{
+		l:         l,
+		size:      size,
+		respond:   respond,
+		requested: make(chan struct{}),
+	}
 	go func() {
-		srv.Serve(l)
-		close(servingDone)
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&p.accepted, 1)
+			go p.serve(conn)
+		}
 	}()
-	return port, func() {
-		srv.Close()
-		l.Close()
-		<-servingDone
+	return p
+}
+
+func (p *lyingPeer) Addr() string { return p.l.Addr().String() }
+
+func (p *lyingPeer) Accepted() int32 { return atomic.LoadInt32(&p.accepted) }
+
+func (p *lyingPeer) Close() { p.l.Close() }
+
+func (p *lyingPeer) waitRequest(t *testing.T) {
+	select {
+	case <-p.requested:
+	case <-time.After(timeout):
+		t.Fatal("metadata is not requested from lying peer")
 	}
 }
 
-func TestDownloadWebseed(t *testing.T) {
+func (p *lyingPeer) serve(conn net.Conn) {
+	defer conn.Close()
+	var ourID [20]byte
+	var ourExtensions [8]byte
+	ourExtensions[5] |= 0x10 // Extension Protocol (BEP 10)
+	getPeerID := func(ih [20]byte) ([20]byte, bool) { return ourID, true }
+	conn, _, _, _, _, err := btconn.Accept(conn, timeout, nil, false, getPeerID, ourExtensions)
+	if err != nil {
+		return
+	}
+	writeExtension := func(id uint8, payload interface{}) error {
+		var buf bytes.Buffer
+		_, err := peerprotocol.ExtensionMessage{ExtendedMessageID: id, Payload: payload}.WriteTo(&buf)
+		if err != nil {
+			return err
+		}
+		var header [5]byte
+		binary.BigEndian.PutUint32(header[:4], uint32(buf.Len()+1))
+		header[4] = byte(peerprotocol.Extension)
+		_, err = conn.Write(append(header[:], buf.Bytes()...))
+		return err
+	}
+	hs := peerprotocol.NewExtensionHandshake(uint32(p.size), "liar", nil, 250)
+	err = writeExtension(peerprotocol.ExtensionIDHandshake, hs)
+	if err != nil {
+		return
+	}
+	var theirMetadataID uint8
+	for {
+		var length uint32
+		err = binary.Read(conn, binary.BigEndian, &length)
+		if err != nil {
+			return
+		}
+		if length == 0 {
+			continue
+		}
+		b := make([]byte, length)
+		_, err = io.ReadFull(conn, b)
+		if err != nil {
+			return
+		}
+		if peerprotocol.MessageID(b[0]) != peerprotocol.Extension {
+			continue
+		}
+		var msg peerprotocol.ExtensionMessage
+		err = msg.UnmarshalBinary(b[1:])
+		if err != nil {
+			return
+		}
+		switch payload := msg.Payload.(type) {
+		case peerprotocol.ExtensionHandshakeMessage:
+			theirMetadataID = payload.M[peerprotocol.ExtensionKeyMetadata]
+		case peerprotocol.ExtensionMetadataMessage:
+			if payload.Type != peerprotocol.ExtensionMetadataMessageTypeRequest {
+				continue
+			}
+			if p.respond {
+				begin := int(payload.Piece) * 16 * 1024
+				end := begin + 16*1024
+				if end > p.size {
+					end = p.size
+				}
+				data := peerprotocol.ExtensionMetadataMessage{
+					Type:      peerprotocol.ExtensionMetadataMessageTypeData,
+					Piece:     payload.Piece,
+					TotalSize: p.size,
+					Data:      make([]byte, end-begin),
+				}
+				err = writeExtension(theirMetadataID, data)
+				if err != nil {
+					return
+				}
+			}
+			select {
+			case p.requested <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func TestRequestTimeoutBan(t *testing.T) {
 	defer leaktest.Check(t)()
-	port1, close1 := webseed(t)
-	defer close1()
-	port2, close2 := webseed(t)
-	defer close2()
 	addr, cl := seeder(t, true)
 	defer cl()
-	s, closeSession := newTestSession(t)
+	cfg := DefaultConfig
+	cfg.DisableOutgoingEncryption = true
+	cfg.RequestTimeout = 500 * time.Millisecond
+	cfg.MaxPeerRequestTimeouts = 1
+	s, closeSession := newTestSessionConfig(t, cfg)
 	defer closeSession()
+	staller := startStallingPeer(t)
+	defer staller.Close()
 
 	f, err := os.Open(torrentFile)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer f.Close()
-
-	opt := &AddTorrentOptions{Stopped: true}
-	tor, err := s.AddTorrent(f, opt)
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(staller.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	staller.wait(t, staller.requested, "piece is not requested from stalling peer")
+	// Peer is disconnected after the timeout without help from other peers.
+	staller.wait(t, staller.disconnected, "stalling peer is not disconnected")
+	err = tor.AddPeer(addr)
 	if err != nil {
 		t.Fatal(err)
 	}
-	tor.torrent.webseedSources = webseedsource.NewList([]string{
-		"http://127.0.0.1:" + strconv.Itoa(port1),
-		"http://127.0.0.1:" + strconv.Itoa(port2),
-	})
-	tor.torrent.webseedClient = http.DefaultClient
-	tor.Start()
-	tor.AddPeer(addr)
-
 	assertCompleted(t, tor)
+	if n := staller.Accepted(); n != 1 {
+		t.Fatalf("stalling peer is connected %d times", n)
+	}
 }
 
-func assertCompleted(t *testing.T, tor *Torrent) {
-	t2 := tor.torrent
+func TestRequestTimeoutReassign(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	cfg := DefaultConfig
+	cfg.DisableOutgoingEncryption = true
+	cfg.RequestTimeout = 500 * time.Millisecond
+	cfg.RequestTimeoutReassignAfter = 1
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	staller := startStallingPeer(t)
+	defer staller.Close()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(staller.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	staller.wait(t, staller.requested, "piece is not requested from stalling peer")
+	// Requests are cancelled after the first timeout, so other peers can download the piece from scratch.
+	staller.wait(t, staller.cancelled, "requests are not cancelled")
 	select {
-	case <-t2.NotifyComplete():
-	case err := <-t2.NotifyError():
+	case <-staller.disconnected:
+		t.Fatal("stalling peer must not be disconnected")
+	default:
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+}
+
+// stallingPeer accepts connections of a torrent, advertises all pieces and never sends the requested blocks.
+type stallingPeer struct {
+	l            net.Listener
+	requested    chan struct{}
+	cancelled    chan struct{}
+	disconnected chan struct{}
+	accepted     int32
+}
+
+// startStallingPeer starts listening on another IP, so banning the stalling peer does not ban the seeder.
+func startStallingPeer(t *testing.T) *stallingPeer {
+	l, err := net.Listen("tcp4", "127.0.0.2:0")
+	if err != nil {
 		t.Fatal(err)
+	}
+	p := &stallingPeer{
+		l:            l,
+		requested:    make(chan struct{}, 1),
+		cancelled:    make(chan struct{}, 1),
+		disconnected: make(chan struct{}, 1),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&p.accepted, 1)
+			go p.serve(conn)
+		}
+	}()
+	return p
+}
+
+func (p *stallingPeer) Addr() string { return p.l.Addr().String() }
+
+func (p *stallingPeer) Accepted() int32 { return atomic.LoadInt32(&p.accepted) }
+
+func (p *stallingPeer) Close() { p.l.Close() }
+
+func (p *stallingPeer) wait(t *testing.T, c chan struct{}, msg string) {
+	select {
+	case <-c:
 	case <-time.After(timeout):
-		t.Fatal("download did not finish")
+		t.Fatal(msg)
 	}
-	dir1 := filepath.Join(torrentDataDir, torrentName)
-	dir2 := filepath.Join(tor.torrent.session.config.DataDir, tor.ID(), torrentName)
-	cmd := exec.Command("diff", "-rq", dir1, dir2)
-	err := cmd.Run()
+}
+
+func (p *stallingPeer) serve(conn net.Conn) {
+	defer conn.Close()
+	var ourID [20]byte
+	var ourExtensions [8]byte
+	ourExtensions[7] |= 0x04 // Fast Extension (BEP 6)
+	getPeerID := func(ih [20]byte) ([20]byte, bool) { return ourID, true }
+	conn, _, _, _, _, err := btconn.Accept(conn, timeout, nil, false, getPeerID, ourExtensions)
+	if err != nil {
+		return
+	}
+	// Connection must stay open until the peer is disconnected by the torrent.
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		return
+	}
+	_, err = conn.Write([]byte{0, 0, 0, 1, byte(peerprotocol.HaveAll), 0, 0, 0, 1, byte(peerprotocol.Unchoke)})
+	if err != nil {
+		return
+	}
+	notify := func(c chan struct{}) {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+	defer notify(p.disconnected)
+	for {
+		var length uint32
+		err = binary.Read(conn, binary.BigEndian, &length)
+		if err != nil {
+			return
+		}
+		if length == 0 {
+			continue
+		}
+		b := make([]byte, length)
+		_, err = io.ReadFull(conn, b)
+		if err != nil {
+			return
+		}
+		switch peerprotocol.MessageID(b[0]) {
+		case peerprotocol.Request:
+			notify(p.requested)
+		case peerprotocol.Cancel:
+			notify(p.cancelled)
+		}
+	}
+}
+
+func TestDialRetry(t *testing.T) {
+	defer leaktest.Check(t)()
+	cfg := DefaultConfig
+	// Otherwise, each attempt is retried without encryption.
+	cfg.DisableOutgoingEncryption = true
+	cfg.PeerDialRetries = 2
+	cfg.PeerDialRetryInterval = 200 * time.Millisecond
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	p := startClosingPeer(t)
+	defer p.Close()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(p.Addr())
 	if err != nil {
 		t.Fatal(err)
 	}
+	p.waitAccepted(t, 3)
+	// Address is not dialed again after the retries are exhausted.
+	time.Sleep(4 * cfg.PeerDialRetryInterval)
+	times := p.AcceptTimes()
+	if len(times) != 3 {
+		t.Fatalf("peer is dialed %d times", len(times))
+	}
+	// Retry interval is doubled after each failure.
+	for i, d := range []time.Duration{cfg.PeerDialRetryInterval, 2 * cfg.PeerDialRetryInterval} {
+		if elapsed := times[i+1].Sub(times[i]); elapsed < d {
+			t.Fatalf("retry #%d is dialed after %s, want at least %s", i+1, elapsed, d)
+		}
+	}
+}
+
+func TestDialRetryStop(t *testing.T) {
+	defer leaktest.Check(t)()
+	cfg := DefaultConfig
+	// Otherwise, each attempt is retried without encryption.
+	cfg.DisableOutgoingEncryption = true
+	cfg.PeerDialRetries = 2
+	cfg.PeerDialRetryInterval = 200 * time.Millisecond
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	p := startClosingPeer(t)
+	defer p.Close()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(p.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.waitAccepted(t, 1)
+	// Wait for the failure to be handled and the retry to be scheduled.
+	time.Sleep(cfg.PeerDialRetryInterval / 2)
+	err = tor.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(timeout)
+	for tor.Stats().Status != Stopped {
+		select {
+		case <-deadline:
+			t.Fatal("torrent is not stopped")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// Scheduled retry is cancelled when the torrent is stopped, also after the torrent is started again.
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(4 * cfg.PeerDialRetryInterval)
+	if n := len(p.AcceptTimes()); n != 1 {
+		t.Fatalf("peer is dialed %d times", n)
+	}
+}
+
+// closingPeer accepts connections and closes them before the handshake.
+type closingPeer struct {
+	l       net.Listener
+	m       sync.Mutex
+	times   []time.Time
+	acceptC chan struct{}
+}
+
+func startClosingPeer(t *testing.T) *closingPeer {
+	l, err := net.Listen("tcp4", "127.0.0.2:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &closingPeer{
+		l:       l,
+		acceptC: make(chan struct{}, 10),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+			p.m.Lock()
+			p.times = append(p.times, time.Now())
+			p.m.Unlock()
+			p.acceptC <- struct{}{}
+		}
+	}()
+	return p
+}
+
+func (p *closingPeer) Addr() string { return p.l.Addr().String() }
+
+func (p *closingPeer) Close() { p.l.Close() }
+
+func (p *closingPeer) AcceptTimes() []time.Time {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return append([]time.Time(nil), p.times...)
+}
+
+func (p *closingPeer) waitAccepted(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-p.acceptC:
+		case <-time.After(timeout):
+			t.Fatal("peer is not dialed")
+		}
+	}
+}
+
+func TestPEXPrivateAndMagnet(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	cfg := DefaultConfig
+	cfg.DisableOutgoingEncryption = true
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	s.config.PEXEnabled = true
+
+	// Magnet link may be of a private torrent, PEX is offered after the metadata is downloaded.
+	pp := startExtensionPeer(t)
+	defer pp.Close()
+	tor, err := s.AddURI(torrentMagnetLink, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(pp.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pp.waitHandshake(t)[peerprotocol.ExtensionKeyPEX]; ok {
+		t.Fatal("pex is offered before metadata is downloaded")
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pp.waitHandshake(t)[peerprotocol.ExtensionKeyPEX]; !ok {
+		t.Fatal("pex is not offered after metadata is downloaded")
+	}
+	assertCompleted(t, tor)
+
+	// PEX is never offered for private torrents.
+	b, err := CreateTorrent(CreateTorrentOptions{
+		Paths:   []string{filepath.Join(torrentDataDir, torrentName)},
+		Private: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp2 := startExtensionPeer(t)
+	defer pp2.Close()
+	tor, err = s.AddTorrent(bytes.NewReader(b), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(pp2.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pp2.waitHandshake(t)[peerprotocol.ExtensionKeyPEX]; ok {
+		t.Fatal("pex is offered for private torrent")
+	}
+}
+
+// extensionPeer accepts connections of a torrent and sends the extensions offered in extension handshakes to handshakeC.
+type extensionPeer struct {
+	l          net.Listener
+	handshakeC chan map[string]uint8
+}
+
+func startExtensionPeer(t *testing.T) *extensionPeer {
+	l, err := net.Listen("tcp4", "127.0.0.2:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &extensionPeer{
+		l:          l,
+		handshakeC: make(chan map[string]uint8, 10),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	return p
+}
+
+func (p *extensionPeer) Addr() string { return p.l.Addr().String() }
+
+func (p *extensionPeer) Close() { p.l.Close() }
+
+func (p *extensionPeer) waitHandshake(t *testing.T) map[string]uint8 {
+	select {
+	case m := <-p.handshakeC:
+		return m
+	case <-time.After(timeout):
+		t.Fatal("extension handshake is not received")
+		return nil
+	}
+}
+
+func (p *extensionPeer) serve(conn net.Conn) {
+	defer conn.Close()
+	var ourID [20]byte
+	var ourExtensions [8]byte
+	ourExtensions[5] |= 0x10 // Extension Protocol (BEP 10)
+	getPeerID := func(ih [20]byte) ([20]byte, bool) { return ourID, true }
+	conn, _, _, _, _, err := btconn.Accept(conn, timeout, nil, false, getPeerID, ourExtensions)
+	if err != nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	hs := peerprotocol.NewExtensionHandshake(0, "fake", nil, 250)
+	// Metadata is not served by this peer.
+	delete(hs.M, peerprotocol.ExtensionKeyMetadata)
+	var buf bytes.Buffer
+	_, err = peerprotocol.ExtensionMessage{ExtendedMessageID: peerprotocol.ExtensionIDHandshake, Payload: hs}.WriteTo(&buf)
+	if err != nil {
+		return
+	}
+	var header [5]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(buf.Len()+1))
+	header[4] = byte(peerprotocol.Extension)
+	_, err = conn.Write(append(header[:], buf.Bytes()...))
+	if err != nil {
+		return
+	}
+	for {
+		var length uint32
+		err = binary.Read(conn, binary.BigEndian, &length)
+		if err != nil {
+			return
+		}
+		if length == 0 {
+			continue
+		}
+		b := make([]byte, length)
+		_, err = io.ReadFull(conn, b)
+		if err != nil {
+			return
+		}
+		if peerprotocol.MessageID(b[0]) != peerprotocol.Extension {
+			continue
+		}
+		var msg peerprotocol.ExtensionMessage
+		err = msg.UnmarshalBinary(b[1:])
+		if err != nil {
+			return
+		}
+		if payload, ok := msg.Payload.(peerprotocol.ExtensionHandshakeMessage); ok {
+			p.handshakeC <- payload.M
+		}
+	}
+}
+
+func TestDownloadInfoHash(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	var ih InfoHash
+	_, err := hex.Decode(ih[:], []byte(torrentInfoHashString))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.AddInfoHash(ih, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+}
+
+func TestDownloadTorrent(t *testing.T) {
+	// TODO defer leaktest.Check(t)()
+	defer startHTTPTracker(t)()
+
+	_, cl := seeder(t, false)
+	defer cl()
+
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertCompleted(t, tor)
+}
+
+func startHTTPTracker(t *testing.T) (stop func()) {
+	responseConfig := middleware.ResponseConfig{
+		AnnounceInterval: time.Minute,
+	}
+	ps, err := storage.NewPeerStore("memory", map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lgc := middleware.NewLogic(responseConfig, ps, nil, nil)
+	fe, err := fhttp.NewFrontend(lgc, fhttp.Config{
+		Addr:         "127.0.0.1:5000",
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		errC := fe.Stop()
+		err := <-errC
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func webseed(t *testing.T) (port int, c func()) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port = l.Addr().(*net.TCPAddr).Port
+	servingDone := make(chan struct{})
+	srv := &http.Server{Handler: http.FileServer(http.Dir("./testdata"))}
+	go func() {
+		srv.Serve(l)
+		close(servingDone)
+	}()
+	return port, func() {
+		srv.Close()
+		l.Close()
+		<-servingDone
+	}
+}
+
+func TestDownloadWebseed(t *testing.T) {
+	defer leaktest.Check(t)()
+	port1, close1 := webseed(t)
+	defer close1()
+	port2, close2 := webseed(t)
+	defer close2()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	opt := &AddTorrentOptions{Stopped: true}
+	tor, err := s.AddTorrent(f, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.webseedSources = webseedsource.NewList([]string{
+		"http://127.0.0.1:" + strconv.Itoa(port1),
+		"http://127.0.0.1:" + strconv.Itoa(port2),
+	})
+	tor.torrent.webseedClient = http.DefaultClient
+	tor.Start()
+	tor.AddPeer(addr)
+
+	assertCompleted(t, tor)
+}
+
+func assertCompleted(t *testing.T, tor *Torrent) {
+	t2 := tor.torrent
+	select {
+	case <-t2.NotifyComplete():
+	case err := <-t2.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	dir1 := filepath.Join(torrentDataDir, torrentName)
+	dir2 := filepath.Join(tor.torrent.session.config.DataDir, tor.ID(), torrentName)
+	cmd := exec.Command("diff", "-rq", dir1, dir2)
+	err := cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// webseedTorrent returns the test torrent with url as the only source of data.
+func webseedTorrent(t *testing.T, url string) []byte {
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mi, err := metainfo.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := metainfo.NewBytes(mi.Info.Bytes, nil, nil, []string{url}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDownloadWebseedOnly(t *testing.T) {
+	defer leaktest.Check(t)()
+	port, closeWebseed := webseed(t)
+	defer closeWebseed()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	b := webseedTorrent(t, "http://127.0.0.1:"+strconv.Itoa(port))
+	tor, err := s.AddTorrent(bytes.NewReader(b), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+}
+
+func TestDownloadWebseedResume(t *testing.T) {
+	defer leaktest.Check(t)()
+	// Webseed is slow until the session is restarted, so the session is closed in the middle of the download.
+	var slow int32 = 1
+	var served int64
+	fs := http.FileServer(http.Dir("./testdata"))
+	ws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs.ServeHTTP(&countingResponseWriter{ResponseWriter: w, slow: atomic.LoadInt32(&slow) == 1, n: &served}, r)
+	}))
+	defer ws.Close()
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.DHTEnabled = false
+	cfg.PEXEnabled = false
+	cfg.LSDEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tor, err := s.AddTorrent(bytes.NewReader(webseedTorrent(t, ws.URL)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := tor.ID()
+	var stats Stats
+	deadline := time.After(timeout)
+	for {
+		stats = tor.Stats()
+		if stats.Bytes.Completed >= stats.Bytes.Total/4 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timeout")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&slow, 0)
+	atomic.StoreInt64(&served, 0)
+
+	// Torrent continues downloading from webseed after restart without fetching the completed pieces again.
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor = s.GetTorrent(id)
+	if tor == nil {
+		t.Fatal("torrent is not loaded")
+	}
+	assertCompleted(t, tor)
+	// More pieces may be completed before the session is closed.
+	// Ranges requested from webseed may overlap with the completed pieces by less than a piece.
+	remaining := stats.Bytes.Total - stats.Bytes.Completed
+	if n := atomic.LoadInt64(&served); n > remaining+stats.Bytes.Total/int64(stats.Pieces.Total) {
+		t.Fatalf("served %d bytes after restart, remaining: %d", n, remaining)
+	}
+}
+
+// countingResponseWriter counts the bytes written and slows down the writes if slow is true.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	slow bool
+	n    *int64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		b := p
+		if w.slow && len(b) > 16<<10 {
+			b = b[:16<<10]
+		}
+		n, err := w.ResponseWriter.Write(b)
+		written += n
+		atomic.AddInt64(w.n, int64(n))
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		if w.slow {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	return written, nil
+}
+
+func TestDownloadWebseedRetry(t *testing.T) {
+	defer leaktest.Check(t)()
+	// First requests to the webseed fail.
+	var requests int32
+	fs := http.FileServer(http.Dir("./testdata"))
+	ws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 3 {
+			http.Error(w, "try again later", http.StatusServiceUnavailable)
+			return
+		}
+		fs.ServeHTTP(w, r)
+	}))
+	defer ws.Close()
+	cfg := DefaultConfig
+	cfg.WebseedRetryInterval = 10 * time.Millisecond
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	tor, err := s.AddTorrent(bytes.NewReader(webseedTorrent(t, ws.URL)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+}
+
+func TestPauseResume(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.Pause()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.NotifyComplete():
+		t.Fatal("paused torrent must not download")
+	case <-time.After(time.Second):
+	}
+	if !tor.Stats().Paused {
+		t.Fatal("torrent must be paused")
+	}
+	err = tor.Resume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+}
+
+func TestReader(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	tor.SetSequential(true)
+	r, err := tor.NewFileReader(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := ioutil.ReadFile(filepath.Join(torrentDataDir, r.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, b2) {
+		t.Fatal("invalid data")
+	}
+}
+
+func TestFilePriorities(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	files, err := tor.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priorities := make([]FilePriority, len(files))
+	skipped := -1
+	for i, file := range files {
+		if filepath.Base(file.Path) == "zero.bin" {
+			priorities[i] = FilePrioritySkip
+			skipped = i
+		}
+	}
+	if skipped == -1 {
+		t.Fatal("file not found")
+	}
+	err = tor.SetFilePriorities(priorities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.NotifyComplete():
+	case err = <-tor.NotifyStop():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	stats := tor.Stats()
+	if stats.Bytes.Wanted >= stats.Bytes.Total {
+		t.Fatal("wanted bytes must be less than total bytes")
+	}
+	if stats.Bytes.WantedIncomplete != 0 {
+		t.Fatal("wanted bytes must be completed")
+	}
+	files, err = tor.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, file := range files {
+		if i == skipped {
+			if file.Completed == file.Length {
+				t.Fatal("skipped file must not be downloaded")
+			}
+			continue
+		}
+		if file.Completed != file.Length {
+			t.Fatalf("file is not downloaded: %s", file.Path)
+		}
+	}
+}
+
+func TestPiecePriority(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	numPieces := tor.torrent.info.NumPieces
+	if err = tor.SetPiecePriority(numPieces, PiecePriorityHigh); err == nil {
+		t.Fatal("invalid piece index must return error")
+	}
+	// Download only the first piece.
+	for i := uint32(1); i < numPieces; i++ {
+		err = tor.SetPiecePriority(i, PiecePrioritySkip)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.NotifyComplete():
+	case err = <-tor.NotifyStop():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	if have := tor.Stats().Pieces.Have; have != 1 {
+		t.Fatalf("downloaded %d pieces, must be 1", have)
+	}
+	// Removing the overrides downloads the remaining pieces.
+	// The seeder is disconnected on completion, so it must be dialed again.
+	for i := uint32(1); i < numPieces; i++ {
+		err = tor.SetPiecePriority(i, PiecePriorityNormal)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertCompleted(t, tor)
+}
+
+func TestByteRangeWanted(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	files, err := tor.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pick the largest file and a range crossing a piece boundary in it.
+	index := 0
+	for i, file := range files {
+		if file.Length > files[index].Length {
+			index = i
+		}
+	}
+	pieceLength := int64(tor.torrent.info.PieceLength)
+	offset, length := pieceLength/2, pieceLength
+	if err = tor.SetByteRangeWanted(index, files[index].Length, 1); err == nil {
+		t.Fatal("invalid byte range must return error")
+	}
+	err = tor.SetByteRangeWanted(index, offset, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.NotifyComplete():
+	case err = <-tor.NotifyStop():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	stats := tor.Stats()
+	if stats.WantedRange.File != index || stats.WantedRange.Offset != offset || stats.WantedRange.Length != length {
+		t.Fatalf("invalid wanted range in stats: %+v", stats.WantedRange)
+	}
+	if stats.WantedRange.Completed != length {
+		t.Fatalf("completed %d bytes of range, must be %d", stats.WantedRange.Completed, length)
+	}
+	if stats.Pieces.Have >= stats.Pieces.Total {
+		t.Fatal("only the pieces in range must be downloaded")
+	}
+	// Removing the range makes the torrent download the remaining pieces.
+	err = tor.SetByteRangeWanted(index, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if length = tor.Stats().WantedRange.Length; length != 0 {
+		t.Fatalf("range must be removed, got length %d", length)
+	}
+	select {
+	case <-tor.NotifyComplete():
+		t.Fatal("torrent must not be complete")
+	default:
+	}
+}
+
+func TestUploadOnly(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.SetTransferMode(TransferModeUploadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.NotifyComplete():
+		t.Fatal("upload-only torrent must not download")
+	case <-time.After(time.Second):
+	}
+	if tor.Stats().TransferMode != TransferModeUploadOnly {
+		t.Fatal("invalid transfer mode")
+	}
+	err = tor.SetTransferMode(TransferModeNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+}
+
+func TestDownloadUTP(t *testing.T) {
+	defer leaktest.Check(t)()
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	s1.config.PeerTransport = PeerTransportUTP
+	addr := startSeeder(t, s1, true)
+
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	s2.config.PeerTransport = PeerTransportUTP
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s2.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+}
+
+func TestDownloadMemoryStorage(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	opt := &AddTorrentOptions{Stopped: true, StorageProvider: NewMemoryStorageProvider()}
+	tor, err := s.AddTorrent(f, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.torrent.NotifyComplete():
+	case err = <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	r, err := tor.NewFileReader(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := ioutil.ReadFile(filepath.Join(torrentDataDir, r.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, b2) {
+		t.Fatal("invalid data")
+	}
+	_, err = os.Stat(filepath.Join(s.config.DataDir, tor.ID()))
+	if !os.IsNotExist(err) {
+		t.Fatal("data is written to disk")
+	}
+}
+
+func TestReadCacheWarmup(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	cfg := DefaultConfig
+	cfg.ReadCacheWarmup = true
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+
+	// First and last pieces of each file are loaded into the cache.
+	deadline := time.Now().Add(timeout)
+	for s.pieceCache.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("read cache is not warmed up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPeerAllowlist(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	cfg := DefaultConfig
+	cfg.PeerAllowlist = []string{"10.0.0.0/8"}
+	sr, closeSeeder := newTestSessionConfig(t, cfg)
+	defer closeSeeder()
+	addrRestricted := startSeeder(t, sr, true)
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	addTorrent := func(allowlist []string) *Torrent {
+		f, err := os.Open(torrentFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		opt := &AddTorrentOptions{Stopped: true, StorageProvider: NewMemoryStorageProvider(), PeerAllowlist: allowlist}
+		tor, err := s.AddTorrent(f, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tor.torrent.trackers = nil
+		err = tor.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tor
+	}
+	assertNotConnected := func(tor *Torrent, addr string) {
+		err := tor.AddPeer(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-tor.torrent.NotifyComplete():
+			t.Fatal("download must not finish")
+		case err = <-tor.torrent.NotifyError():
+			t.Fatal(err)
+		case <-time.After(time.Second):
+		}
+		if n := tor.Stats().Peers.Total; n != 0 {
+			t.Fatalf("connected to %d peers", n)
+		}
+	}
+
+	// Peer is not in the allowlist of the session.
+	tor1 := addTorrent(nil)
+	assertNotConnected(tor1, addr)
+	err := s.RemoveTorrent(tor1.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Torrent allows the peer but the peer does not accept the connection.
+	tor2 := addTorrent([]string{"127.0.0.1"})
+	assertNotConnected(tor2, addrRestricted)
+
+	err = tor2.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor2.torrent.NotifyComplete():
+	case err = <-tor2.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+
+	_, err = s.AddURI("magnet:?xt=urn:btih:"+tor1.InfoHash().String(), &AddTorrentOptions{PeerAllowlist: []string{"invalid"}})
+	var e *InputError
+	if !errors.As(err, &e) {
+		t.Fatalf("invalid allowlist must be rejected, got: %v", err)
+	}
+}
+
+func TestBlocklistFile(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	blocklistPath := filepath.Join(tmp, "blocklist.p2p")
+	err := ioutil.WriteFile(blocklistPath, []byte("Localhost:127.0.0.0-127.255.255.255\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig
+	cfg.BlocklistURL = blocklistPath
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	if n := s.Stats().BlockListRules; n != 1 {
+		t.Fatalf("blocklist has %d rules", n)
+	}
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{StorageProvider: NewMemoryStorageProvider()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.torrent.NotifyComplete():
+		t.Fatal("download must not finish")
+	case err = <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(time.Second):
+	}
+	if n := s.Stats().BlockListRejectedOutgoing; n != 1 {
+		t.Fatalf("rejected %d outgoing peers", n)
+	}
+
+	err = ioutil.WriteFile(blocklistPath, []byte("Private:10.0.0.0-10.255.255.255\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.ReloadBlocklist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.torrent.NotifyComplete():
+	case err = <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+}
+
+func TestSeedLimits(t *testing.T) {
+	defer leaktest.Check(t)()
+	cfg := DefaultConfig
+	cfg.SeedDurationLimit = time.Second
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	startSeeder(t, s, true)
+	tor := s.ListTorrents()[0]
+
+	waitFor := func(cond func() bool) {
+		deadline := time.After(timeout)
+		for !cond() {
+			select {
+			case <-deadline:
+				t.Fatal("timeout")
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	waitFor(func() bool { return tor.Stats().Status == Stopped })
+	if d := tor.Stats().SeededFor; d < time.Second {
+		t.Fatalf("stopped after seeding for %s", d)
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Started {
+		t.Fatal("torrent must be saved as stopped")
+	}
+
+	// Torrent limits replace the limits in Config.
+	err = tor.SetSeedLimits(&SeedLimits{IdleDuration: time.Second, Remove: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(func() bool { return s.GetTorrent(tor.ID()) == nil })
+	_, err = os.Stat(filepath.Join(s.config.DataDir, tor.ID(), torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tor.SetSeedLimits(&SeedLimits{Ratio: -1})
+	if err != errInvalidSeedLimits {
+		t.Fatalf("invalid limits must be rejected, got: %v", err)
+	}
+}
+
+func TestBoost(t *testing.T) {
+	defer leaktest.Check(t)()
+	cfg := DefaultConfig
+	cfg.BoostSpeedThreshold = 1 << 20
+	cfg.BoostAfter = time.Second
+	cfg.BoostDuration = 2 * time.Second
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor := func(cond func() bool) {
+		deadline := time.After(timeout)
+		for !cond() {
+			select {
+			case <-deadline:
+				t.Fatal("timeout")
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	// There are no peers, so the download speed stays below the threshold.
+	waitFor(func() bool { return tor.Stats().Boosted })
+	waitFor(func() bool { return !tor.Stats().Boosted })
+
+	err = tor.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(func() bool { return tor.Stats().Status == Stopped })
+	if tor.Stats().Boosted {
+		t.Fatal("stopped torrent must not be boosted")
+	}
+}
+
+func TestVerifyData(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	startSeeder(t, s, true)
+	tor := s.ListTorrents()[0]
+
+	waitFor := func(cond func() bool) {
+		deadline := time.After(timeout)
+		for !cond() {
+			select {
+			case <-deadline:
+				t.Fatal("timeout")
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	waitFor(func() bool { return tor.Stats().Status == Seeding })
+
+	err := os.Remove(filepath.Join(s.config.DataDir, tor.ID(), torrentName, "data", "file1.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.VerifyData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Torrent keeps running after verification to download the missing pieces.
+	waitFor(func() bool { return tor.Stats().Status == Downloading })
+	stats := tor.Stats()
+	if stats.Pieces.Have == 0 || stats.Pieces.Have == stats.Pieces.Total {
+		t.Fatalf("unexpected number of pieces after verification: %d/%d", stats.Pieces.Have, stats.Pieces.Total)
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !spec.Started {
+		t.Fatal("torrent must be saved as started")
+	}
+	bf, err := bitfield.NewBytes(spec.Bitfield, stats.Pieces.Total)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bf.Count() != stats.Pieces.Have {
+		t.Fatalf("saved bitfield has %d pieces, want %d", bf.Count(), stats.Pieces.Have)
+	}
+}
+
+func TestMoveData(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	startSeeder(t, s, true)
+	tor := s.ListTorrents()[0]
+	dest, closeDest := tempdir(t)
+	defer closeDest()
+
+	waitFor := func(cond func() bool) {
+		deadline := time.After(timeout)
+		for !cond() {
+			select {
+			case <-deadline:
+				t.Fatal("timeout")
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	waitFor(func() bool { return tor.Stats().Status == Seeding })
+
+	err := tor.MoveData(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("diff", "-rq", filepath.Join(torrentDataDir, torrentName), filepath.Join(dest, torrentName))
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(filepath.Join(s.config.DataDir, tor.ID(), torrentName))
+	if !os.IsNotExist(err) {
+		t.Fatalf("files must be removed from old directory, got: %v", err)
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Dest != dest {
+		t.Fatalf("saved dest: %q", spec.Dest)
+	}
+	// Torrent is started again after the move and continues seeding from the new directory.
+	waitFor(func() bool { return tor.Stats().Status == Seeding })
+	if tor.torrent.storage.RootDir() != dest {
+		t.Fatalf("storage is not updated: %s", tor.torrent.storage.RootDir())
+	}
+}
+
+func TestMoveDataExisting(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	startSeeder(t, s, true)
+	tor := s.ListTorrents()[0]
+	dest, closeDest := tempdir(t)
+	defer closeDest()
+
+	existing := filepath.Join(dest, torrentName, "data", "zero.bin")
+	err := os.MkdirAll(filepath.Dir(existing), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(existing, []byte("existing"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tor.MoveData(dest)
+	if !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := os.ReadFile(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "existing" {
+		t.Fatalf("existing file is overwritten: %q", b)
+	}
+	cmd := exec.Command("diff", "-rq", filepath.Join(torrentDataDir, torrentName), filepath.Join(s.config.DataDir, tor.ID(), torrentName))
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tor.torrent.storage.RootDir() == dest {
+		t.Fatal("storage must not be updated")
+	}
+	// Torrent is started again after the failed move and continues seeding from the old directory.
+	deadline := time.After(timeout)
+	for tor.Stats().Status != Seeding {
+		select {
+		case <-deadline:
+			t.Fatal("timeout")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func TestPieceValidator(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+
+	var validated int32
+	cfg := DefaultConfig
+	cfg.PieceValidator = func(torrentID string, index uint32, data []byte) error {
+		atomic.AddInt32(&validated, 1)
+		return nil
+	}
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	tor, err := s.AddURI(torrentMagnetLink+"&x.pe="+addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+	if n := atomic.LoadInt32(&validated); uint32(n) != tor.Stats().Pieces.Total {
+		t.Fatalf("validated %d pieces", n)
+	}
+}
+
+func TestPieceValidatorError(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+
+	errRejected := errors.New("rejected")
+	cfg := DefaultConfig
+	cfg.PieceValidator = func(torrentID string, index uint32, data []byte) error {
+		if index == 1 {
+			return errRejected
+		}
+		return nil
+	}
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	tor, err := s.AddURI(torrentMagnetLink+"&x.pe="+addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-tor.torrent.NotifyError():
+	case <-time.After(timeout):
+		t.Fatal("torrent is not stopped")
+	}
+	var validationErr *ErrPieceValidation
+	if !errors.As(err, &validationErr) || validationErr.Index != 1 || !errors.Is(err, errRejected) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Started {
+		t.Fatal("torrent must be saved as stopped")
+	}
+}
+
+func TestStatsCache(t *testing.T) {
+	defer leaktest.Check(t)()
+	cfg := DefaultConfig
+	cfg.StatsCacheDuration = time.Hour
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tor.Stats()
+	if stats.Version != StatsVersion {
+		t.Fatalf("invalid stats version: %d", stats.Version)
+	}
+	if stats.Time.IsZero() {
+		t.Fatal("stats time is not set")
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Snapshot is returned from cache until it expires.
+	cached := tor.Stats()
+	if !cached.Time.Equal(stats.Time) || cached.Status != Stopped {
+		t.Fatalf("stats must be returned from cache, got status %s at %s", cached.Status, cached.Time)
+	}
+	s.config.StatsCacheDuration = 0
+	if stats = tor.Stats(); stats.Time.Equal(cached.Time) || stats.Status == Stopped {
+		t.Fatalf("new stats must be taken, got status %s at %s", stats.Status, stats.Time)
+	}
+
+	// Pointer fields of the snapshots are not shared.
+	eta := time.Minute
+	stats = Stats{ETA: &eta}
+	*stats.clone().ETA = 0
+	if *stats.ETA != time.Minute {
+		t.Fatal("ETA of the snapshot is changed")
+	}
+}
+
+// connectProxy is an HTTP proxy that only supports CONNECT method.
+type connectProxy struct {
+	l net.Listener
+
+	m sync.Mutex
+	// Local addresses of the connections that the proxy opens to targets.
+	localAddrs map[string]struct{}
+	targets    []string
+}
+
+func startConnectProxy(t *testing.T) *connectProxy {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &connectProxy{l: l, localAddrs: make(map[string]struct{})}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.handleConn(conn)
+		}
+	}()
+	return p
+}
+
+func (p *connectProxy) handleConn(conn net.Conn) {
+	defer conn.Close()
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil || req.Method != http.MethodConnect {
+		return
+	}
+	target, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		return
+	}
+	defer target.Close()
+	p.m.Lock()
+	p.localAddrs[target.LocalAddr().String()] = struct{}{}
+	p.targets = append(p.targets, req.Host)
+	p.m.Unlock()
+	_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+	go func() { _, _ = io.Copy(target, conn); target.Close() }()
+	_, _ = io.Copy(conn, target)
+}
+
+func (p *connectProxy) URL() string {
+	return "http://" + p.l.Addr().String()
+}
+
+// Proxied returns true if the connection from remoteAddr is opened by the proxy.
+func (p *connectProxy) Proxied(remoteAddr string) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+	_, ok := p.localAddrs[remoteAddr]
+	return ok
+}
+
+// Connected returns true if the proxy has connected to target.
+func (p *connectProxy) Connected(target string) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+	for _, t := range p.targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *connectProxy) Close() {
+	p.l.Close()
+}
+
+func TestDownloadProxy(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t, true)
+	defer cl()
+	pr := startConnectProxy(t)
+	defer pr.Close()
+
+	cfg := DefaultConfig
+	cfg.ProxyURL = pr.URL()
+	cfg.DisableProxyFallback = true
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true, StorageProvider: NewMemoryStorageProvider()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.torrent.NotifyComplete():
+	case err = <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	if !pr.Connected(addr) {
+		t.Fatal("peer is not connected through proxy")
+	}
+}
+
+func TestProxyNoBypass(t *testing.T) {
+	defer leaktest.Check(t)()
+	pr := startConnectProxy(t)
+	defer pr.Close()
+
+	// Server for the torrent file, the blocklist and the webseed. Fails the test if a request is not made through the proxy.
+	var bypassed int32
+	torrentData, err := ioutil.ReadFile(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file.torrent", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(torrentData)
+	})
+	mux.HandleFunc("/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("blocked:10.0.0.1-10.0.0.1\n"))
+	})
+	mux.Handle("/webseed/", http.StripPrefix("/webseed", http.FileServer(http.Dir(torrentDataDir))))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !pr.Proxied(r.RemoteAddr) {
+			atomic.AddInt32(&bypassed, 1)
+			t.Errorf("request for %s bypassed the proxy", r.URL.Path)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.ProxyURL = pr.URL()
+	cfg.DisableProxyFallback = true
+	cfg.BlocklistURL = srv.URL + "/blocklist"
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	err = s.ReloadBlocklist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.AddURI(srv.URL+"/file.torrent", &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	tor.torrent.webseedSources = webseedsource.NewList([]string{srv.URL + "/webseed"})
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+	if n := atomic.LoadInt32(&bypassed); n > 0 {
+		t.Fatalf("%d requests bypassed the proxy", n)
+	}
+}
+
+func TestCreateTorrent(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	b, err := CreateTorrent(CreateTorrentOptions{
+		Paths:    []string{filepath.Join(torrentDataDir, torrentName)},
+		Trackers: [][]string{{"http://127.0.0.1:5000/announce"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tor.Name() != torrentName {
+		t.Fatalf("unexpected name: %s", tor.Name())
+	}
+	tor.torrent.trackers = nil
+
+	// Existing data is verified and the torrent starts seeding without any peers.
+	err = os.Mkdir(filepath.Join(s.config.DataDir, tor.ID()), os.ModeDir|s.config.FilePermissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CopyDir(filepath.Join(torrentDataDir, torrentName), filepath.Join(s.config.DataDir, tor.ID(), torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.NotifyComplete():
+	case err = <-tor.NotifyStop():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("torrent is not completed")
+	}
 }
@@ -0,0 +1,12 @@
+package torrent
+
+import "github.com/cenkalti/rain/internal/announcer"
+
+// handleTrackerWarning is called when a tracker returns a warning message different from the previous one.
+// Private trackers use warnings to tell the user about problems like low ratio or a banned client.
+func (t *torrent) handleTrackerWarning(w announcer.TrackerWarning) {
+	t.log.Warningf("tracker %s returned warning: %s", w.URL, w.Message)
+	if len(t.session.config.OnTrackerWarningCmd) > 0 {
+		go t.session.runOnTrackerWarningCmd(t, w)
+	}
+}
@@ -0,0 +1,20 @@
+package torrent
+
+import "errors"
+
+var errInvalidUploadSlots = errors.New("invalid upload slots")
+
+// getUploadSlots returns the number of peers unchoked by their speed.
+// Peers unchoked optimistically are not included.
+func (t *torrent) getUploadSlots() int {
+	if t.uploadSlots > 0 {
+		return t.uploadSlots
+	}
+	return t.session.config.UnchokedPeers
+}
+
+func (t *torrent) handleSetUploadSlots(n int) {
+	t.uploadSlots = n
+	// Peers are unchoked or choked in the next tick of the unchoker.
+	t.unchoker.SetNumUnchoked(t.getUploadSlots())
+}
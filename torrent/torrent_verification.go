@@ -7,9 +7,10 @@ import (
 	"github.com/cenkalti/rain/internal/verifier"
 )
 
-func (t *torrent) handleVerifyCommand() {
+func (t *torrent) handleVerifyCommand(resume bool) {
 	t.log.Info("verifying")
 	t.doVerify = true
+	t.resumeAfterVerify = resume
 	if t.status() == Stopped {
 		t.bitfield = nil
 		t.start()
@@ -25,6 +26,9 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 	t.verifier = nil
 
 	if ve.Error != nil {
+		// Do not restart verification after the torrent is stopped.
+		t.doVerify = false
+		t.resumeAfterVerify = false
 		t.stop(fmt.Errorf("file verification error: %s", ve.Error))
 		return
 	}
@@ -50,9 +54,10 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 			haveMessages = append(haveMessages, peerprotocol.HaveMessage{Index: i})
 		}
 	}
+	t.notifyPieceWaiters()
 
 	// We may detect missing pieces after verification. Then, status must be set from Seeding to Downloading.
-	if !t.bitfield.All() {
+	if !t.wantedPiecesDone() {
 		t.completed = false
 		if t.completeC == nil {
 			t.completeC = make(chan struct{})
@@ -60,10 +65,13 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 	}
 
 	if t.doVerify {
-		// Stop after manual verification command.
 		t.doVerify = false
-		t.stop(nil)
-		return
+		if !t.resumeAfterVerify {
+			// Stop after manual verification command.
+			t.stop(nil)
+			return
+		}
+		t.resumeAfterVerify = false
 	}
 
 	// Tell connected peers that pieces we have.
@@ -15,7 +15,13 @@ func (t *torrent) handleWebseedPieceResult(msg *urldownloader.PieceResult) {
 		// * Client.Do error
 		// * Unexpected status code
 		// * Response.Body.Read error
-		t.disableSource(msg.Downloader.URL, msg.Error, true)
+		src := t.findWebseedSource(msg.Downloader)
+		if src == nil {
+			// Downloader is closed before the error is received.
+			return
+		}
+		// Remaining pieces of the source are released here so that they can be downloaded from peers.
+		t.disableSource(src.URL, msg.Error, true)
 		t.webseedActiveDownloads--
 		t.startPieceDownloaders()
 		return
@@ -26,39 +32,46 @@ func (t *torrent) handleWebseedPieceResult(msg *urldownloader.PieceResult) {
 
 	t.bytesDownloaded.Inc(int64(len(msg.Buffer.Data)))
 	t.downloadSpeed.Mark(int64(len(msg.Buffer.Data)))
-	for _, src := range t.webseedSources {
-		if src.URL != msg.Downloader.URL {
-			continue
-		}
-		src.DownloadSpeed.Mark(int64(len(msg.Buffer.Data)))
-		break
+	src := t.findWebseedSource(msg.Downloader)
+	if src == nil {
+		// Downloader is closed before the piece is received, e.g. the piece is given to a peer.
+		// The piece may be downloading from the peer now, so the data is discarded.
+		t.bytesWasted.Inc(int64(len(msg.Buffer.Data)))
+		msg.Buffer.Release()
+		return
 	}
+	src.DownloadSpeed.Mark(int64(len(msg.Buffer.Data)))
+	src.Failures = 0
 
-	if piece.Writing {
-		panic("piece is already writing")
+	// Piece may be given to a peer while the downloader is reading it because the downloader reads the end index concurrently.
+	// The downloader finishes after sending it, so only the data is discarded.
+	if t.piecePicker == nil || t.piecePicker.RequestedWebseedSource(msg.Index) != src || piece.Done || piece.Writing {
+		t.bytesWasted.Inc(int64(len(msg.Buffer.Data)))
+		msg.Buffer.Release()
+	} else {
+		piece.Writing = true
+		t.writePiece(piecewriter.New(piece, msg.Downloader, msg.Buffer))
 	}
-	piece.Writing = true
-
-	// Prevent receiving piece messages to avoid more than 1 write per torrent.
-	t.pieceMessagesC.Suspend()
-	t.webseedPieceResultC.Suspend()
-
-	pw := piecewriter.New(piece, msg.Downloader, msg.Buffer)
-	go pw.Run(t.pieceWriterResultC, t.doneC, t.session.metrics.WritesPerSecond, t.session.metrics.SpeedWrite, t.session.semWrite)
 
 	if msg.Done {
-		for _, src := range t.webseedSources {
-			if src.URL != msg.Downloader.URL {
-				continue
-			}
-			t.closeWebseedDownloader(src)
-			t.webseedActiveDownloads--
-			t.startPieceDownloaderForWebseed(src)
-			break
+		t.closeWebseedDownloader(src)
+		t.webseedActiveDownloads--
+		t.startPieceDownloaderForWebseed(src)
+	}
+}
+
+// findWebseedSource returns the source that is currently downloading with ud.
+func (t *torrent) findWebseedSource(ud *urldownloader.URLDownloader) *webseedsource.WebseedSource {
+	for _, src := range t.webseedSources {
+		if src.Downloader == ud {
+			return src
 		}
 	}
+	return nil
 }
 
+// disableSource stops downloading from the source.
+// If retry is true, the source is enabled again after a delay that grows with the number of consecutive failures.
 func (t *torrent) disableSource(srcurl string, err error, retry bool) {
 	for _, src := range t.webseedSources {
 		if src.URL != srcurl {
@@ -67,17 +80,22 @@ func (t *torrent) disableSource(srcurl string, err error, retry bool) {
 		src.Disabled = true
 		src.DisabledAt = time.Now()
 		src.LastError = err
+		src.RetryAt = time.Time{}
 		t.closeWebseedDownloader(src)
 		if retry {
-			go t.notifyWebseedRetry(src)
+			src.Failures++
+			delay := src.RetryDelay(t.session.config.WebseedRetryInterval, t.session.config.WebseedMaxRetryInterval)
+			src.RetryAt = src.DisabledAt.Add(delay)
+			t.log.Debugf("retrying webseed %s in %s", src.URL, delay)
+			go t.notifyWebseedRetry(src, delay)
 		}
 		break
 	}
 }
 
-func (t *torrent) notifyWebseedRetry(src *webseedsource.WebseedSource) {
+func (t *torrent) notifyWebseedRetry(src *webseedsource.WebseedSource, delay time.Duration) {
 	select {
-	case <-time.After(time.Minute):
+	case <-time.After(delay):
 		select {
 		case t.webseedRetryC <- src:
 		case <-t.closeC:
@@ -85,3 +103,13 @@ func (t *torrent) notifyWebseedRetry(src *webseedsource.WebseedSource) {
 	case <-t.closeC:
 	}
 }
+
+func (t *torrent) handleWebseedRetry(src *webseedsource.WebseedSource) {
+	if !src.Disabled || src.RetryAt.IsZero() || time.Now().Before(src.RetryAt) {
+		// Source is disabled permanently or failed again after this retry is scheduled.
+		return
+	}
+	src.Disabled = false
+	src.RetryAt = time.Time{}
+	t.startPieceDownloaderForWebseed(src)
+}
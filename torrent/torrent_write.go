@@ -10,15 +10,76 @@ import (
 	"github.com/cenkalti/rain/internal/urldownloader"
 )
 
+// PieceValidator checks the data of a downloaded piece of the torrent with torrentID.
+// It is called from the goroutines that write pieces, so it may be called concurrently.
+// data must not be modified or retained after the function returns.
+// Embedders can use it for scanning the content or processing the files incrementally while they are downloaded.
+type PieceValidator func(torrentID string, index uint32, data []byte) error
+
+// writePiece queues the downloaded piece for verification and writing.
+func (t *torrent) writePiece(pw *piecewriter.PieceWriter) {
+	if v := t.session.config.PieceValidator; v != nil {
+		id := t.id
+		pw.Validate = func(index uint32, data []byte) error {
+			return v(id, index, data)
+		}
+	}
+	t.pieceWriters.Add(pw)
+	if t.pieceWriters.Full() {
+		// Prevent receiving piece messages to limit the memory used by pieces waiting for write.
+		t.pieceMessagesC.Suspend()
+		t.webseedPieceResultC.Suspend()
+	}
+}
+
+func (t *torrent) startPieceWriters() {
+	if t.pieceWriters != nil {
+		panic("piece writers exist")
+	}
+	cfg := &t.session.config
+	t.pieceWriters = piecewriter.NewPool(
+		int(cfg.ParallelWritesPerTorrent),
+		int(cfg.WriteQueueLength),
+		t.pieceWriterResultC,
+		t.session.metrics.WritesPerSecond,
+		t.session.metrics.SpeedWrite,
+		t.session.metrics.WriteLatency,
+		t.session.semWrite,
+	)
+}
+
+// stopPieceWriters waits for ongoing writes to finish and discards the pieces that are not written yet.
+// It must be called before closing the data files.
+func (t *torrent) stopPieceWriters() {
+	t.log.Debugln("stopping piece writers")
+	if t.pieceWriters != nil {
+		t.pieceWriters.Close()
+		t.pieceWriters = nil
+	}
+	t.pieceMessagesC.Resume()
+	t.webseedPieceResultC.Resume()
+}
+
+// quarantine stops the torrent with err and saves it as stopped, so it is not started again after restart.
+func (t *torrent) quarantine(err error) {
+	werr := t.session.resumer.WriteStarted(t.id, false)
+	if werr != nil {
+		t.log.Errorf("cannot write status to resume db: %s", werr)
+	}
+	t.stop(err)
+}
+
 func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 	pw.Piece.Writing = false
 
+	t.pieceWriters.Done()
 	t.pieceMessagesC.Resume()
 	t.webseedPieceResultC.Resume()
 
 	pw.Buffer.Release()
 
 	if !pw.HashOK {
+		t.failedPieces++
 		t.bytesWasted.Inc(int64(len(pw.Buffer.Data)))
 		switch src := pw.Source.(type) {
 		case *peer.Peer:
@@ -34,6 +95,10 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 		t.startPieceDownloaders()
 		return
 	}
+	if pw.ValidationError != nil {
+		t.quarantine(&ErrPieceValidation{Index: pw.Piece.Index, err: pw.ValidationError})
+		return
+	}
 	if pw.Error != nil {
 		t.stop(pw.Error)
 		return
@@ -46,6 +111,7 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 	t.mBitfield.Lock()
 	t.bitfield.Set(pw.Piece.Index)
 	t.mBitfield.Unlock()
+	t.notifyPieceWaiters()
 
 	if t.piecePicker != nil {
 		_, ok := pw.Source.(*urldownloader.URLDownloader)
@@ -80,11 +146,14 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 	completed := t.checkCompletion()
 	if completed {
 		t.log.Info("download completed")
+		t.setCompletedAnnouncesPending()
 		err := t.writeBitfield()
 		if err != nil {
 			t.stop(err)
 		} else if t.stopAfterDownload {
 			t.stopAndSetStoppedOnComplete()
+		} else if t.session.config.ReadCacheWarmup {
+			t.startCacheWarmer()
 		}
 	}
 }
@@ -0,0 +1,11 @@
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Server process starts a new process with the same arguments and passes the listening sockets on this signal.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
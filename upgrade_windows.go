@@ -0,0 +1,8 @@
+// +build windows
+
+package main
+
+import "os"
+
+// Passing sockets to a new process is not supported on Windows.
+var upgradeSignals []os.Signal